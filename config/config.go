@@ -15,14 +15,61 @@ type Config struct {
 	Web        WebConfig        `yaml:"web"`
 	Plugins    PluginsConfig    `yaml:"plugins"`
 	Logging    LoggingConfig    `yaml:"logging"`
+	Scheduler  SchedulerConfig  `yaml:"scheduler"`
+	MCP        MCPConfig        `yaml:"mcp"`
 }
 
 type AgentConfig struct {
-	Name        string `yaml:"name"`
-	Version     string `yaml:"version"`
-	Description string `yaml:"description"`
-	Workspace   string `yaml:"workspace"`
-	MaxQueueSize int   `yaml:"max_queue_size"`
+	Name            string        `yaml:"name"`
+	Version         string        `yaml:"version"`
+	Description     string        `yaml:"description"`
+	Workspace       string        `yaml:"workspace"`
+	MaxQueueSize    int           `yaml:"max_queue_size"`
+	Workers         int           `yaml:"workers"`
+	PartitionKey    string        `yaml:"partition_key"`    // event metadata key whose events are processed in order
+	StarvationLimit int           `yaml:"starvation_limit"` // high priority events processed before yielding to lower lanes
+	OverflowPolicy  string        `yaml:"overflow_policy"`  // reject, block, drop_oldest or spill
+	BlockTimeout    int           `yaml:"block_timeout"`    // seconds Emit waits for queue space under the block policy
+	Journal         JournalConfig `yaml:"journal"`
+	Retry           RetryConfig   `yaml:"retry"`
+	HandlerTimeout  int           `yaml:"handler_timeout"` // seconds a single handler invocation may run
+	ToolTimeout     int           `yaml:"tool_timeout"`    // seconds a tool attempt may run unless the tool sets its own timeout
+
+	DeadLetterCapacity int `yaml:"dead_letter_capacity"`
+
+	EventHistorySize int    `yaml:"event_history_size"`
+	EventHistoryFile string `yaml:"event_history_file"` // optional, empty keeps history in memory
+
+	Heartbeat HeartbeatConfig `yaml:"heartbeat"`
+
+	TraceCapacity int `yaml:"trace_capacity"` // requests whose causal trace is kept for /api/v1/traces
+
+	RouterFanOut      string `yaml:"router_fan_out"`     // sequential or parallel (equal priority message handlers run concurrently)
+	RouterConcurrency int    `yaml:"router_concurrency"` // message handlers run at once under parallel fan-out
+}
+
+// HeartbeatConfig configures the heartbeat producer and liveness watchdog
+type HeartbeatConfig struct {
+	Enabled           bool `yaml:"enabled"`
+	Interval          int  `yaml:"interval"`            // seconds between heartbeat events
+	StallTimeout      int  `yaml:"stall_timeout"`       // seconds a heartbeat may stay unprocessed before the loop is unhealthy
+	DegradedLatencyMs int  `yaml:"degraded_latency_ms"` // heartbeat latency above which the loop is degraded
+}
+
+// RetryConfig configures retries of failing event handlers
+type RetryConfig struct {
+	MaxAttempts      int     `yaml:"max_attempts"` // including the first attempt
+	InitialBackoffMs int     `yaml:"initial_backoff_ms"`
+	MaxBackoffMs     int     `yaml:"max_backoff_ms"`
+	Multiplier       float64 `yaml:"multiplier"`
+	Jitter           float64 `yaml:"jitter"` // random fraction added to or removed from each backoff
+}
+
+// JournalConfig configures the event write-ahead journal kept in the workspace
+type JournalConfig struct {
+	Enabled          bool `yaml:"enabled"`
+	Sync             bool `yaml:"sync"`              // fsync after every write
+	CompactThreshold int  `yaml:"compact_threshold"` // acknowledged entries before the journal is compacted
 }
 
 type ServerConfig struct {
@@ -60,6 +107,38 @@ type PluginsConfig struct {
 	AutoReload  bool     `yaml:"auto_reload"`
 }
 
+type SchedulerConfig struct {
+	Enabled bool                `yaml:"enabled"`
+	Jobs    []ScheduleJobConfig `yaml:"jobs"`
+}
+
+type ScheduleJobConfig struct {
+	Name     string                 `yaml:"name"` // also used as the job ID
+	Spec     string                 `yaml:"spec"` // 5 or 6 field cron expression, or @every <duration>
+	Payload  interface{}            `yaml:"payload"`
+	Metadata map[string]interface{} `yaml:"metadata"`
+	CatchUp  string                 `yaml:"catch_up"` // skip, once or all
+}
+
+// MCPConfig configures the Model Context Protocol server started by "clawdlocal mcp"
+// and the MCP servers whose tools the agent imports
+type MCPConfig struct {
+	Transport string `yaml:"transport"` // stdio or http
+	Addr      string `yaml:"addr"`      // listen address of the http transport
+
+	Servers []MCPServerProcessConfig `yaml:"servers"`
+	Restart RetryConfig              `yaml:"restart"` // backoff between restarts of crashed servers, max_attempts 0 restarts forever
+}
+
+// MCPServerProcessConfig describes an MCP server spawned over stdio
+type MCPServerProcessConfig struct {
+	Name    string            `yaml:"name"` // tools are registered as <name>.<tool>
+	Command string            `yaml:"command"`
+	Args    []string          `yaml:"args"`
+	Env     map[string]string `yaml:"env"`
+	Dir     string            `yaml:"dir"`
+}
+
 type LoggingConfig struct {
 	Level  string `yaml:"level"`
 	Format string `yaml:"format"`
@@ -71,11 +150,41 @@ func Load(configPath string) (*Config, error) {
 	// Create default config
 	cfg := &Config{
 		Agent: AgentConfig{
-			Name:         "ClawdLocal",
-			Version:      "0.1.0",
-			Description:  "Lightweight local AI agent framework",
-			Workspace:    "./workspace",
-			MaxQueueSize: 1000,
+			Name:            "ClawdLocal",
+			Version:         "0.1.0",
+			Description:     "Lightweight local AI agent framework",
+			Workspace:       "./workspace",
+			MaxQueueSize:    1000,
+			Workers:         4,
+			PartitionKey:    "session_id",
+			StarvationLimit: 8,
+			OverflowPolicy:  "reject",
+			BlockTimeout:    5,
+			Journal: JournalConfig{
+				Enabled:          false,
+				Sync:             true,
+				CompactThreshold: 1000,
+			},
+			Retry: RetryConfig{
+				MaxAttempts:      3,
+				InitialBackoffMs: 100,
+				MaxBackoffMs:     5000,
+				Multiplier:       2,
+				Jitter:           0.2,
+			},
+			HandlerTimeout:     30,
+			ToolTimeout:        60,
+			DeadLetterCapacity: 1000,
+			EventHistorySize: 1000,
+			Heartbeat: HeartbeatConfig{
+				Enabled:           true,
+				Interval:          10,
+				StallTimeout:      30,
+				DegradedLatencyMs: 1000,
+			},
+			TraceCapacity:     1000,
+			RouterFanOut:      "sequential",
+			RouterConcurrency: 4,
 		},
 		Server: ServerConfig{
 			Host: "localhost",
@@ -109,6 +218,20 @@ func Load(configPath string) (*Config, error) {
 			Format: "text",
 			Output: "stdout",
 		},
+		Scheduler: SchedulerConfig{
+			Enabled: true,
+		},
+		MCP: MCPConfig{
+			Transport: "stdio",
+			Addr:      "127.0.0.1:8090",
+			Restart: RetryConfig{
+				MaxAttempts:      0,
+				InitialBackoffMs: 1000,
+				MaxBackoffMs:     60000,
+				Multiplier:       2,
+				Jitter:           0.2,
+			},
+		},
 	}
 
 	// Try to load from file if it exists
@@ -3,6 +3,9 @@ package core
 import (
 	"context"
 	"clawdlocal/config"
+	"fmt"
+	"os"
+	"path/filepath"
 	"time"
 	"github.com/sirupsen/logrus"
 )
@@ -16,6 +19,12 @@ type Agent struct {
 	ToolManager   *ToolManager
 	MemoryManager *MemoryManager
 	webServer     *WebServer
+	scheduler     *Scheduler
+	heartbeat     *Heartbeat
+	tracer        *Tracer
+	metrics       *MessageMetrics
+	mcpImporter   *MCPImporter
+	startedAt     time.Time
 }
 
 // NewAgent creates a new agent instance
@@ -49,20 +58,108 @@ func NewAgent(cfg *config.Config) (*Agent, error) {
 
 // Run starts the agent's main event loop
 func (a *Agent) Run(ctx context.Context) error {
+	a.startedAt = time.Now()
 	a.logger.Info("ClawdLocal agent starting...")
 	a.logger.Infof("Agent: %s v%s", a.config.Agent.Name, a.config.Agent.Version)
 	a.logger.Infof("Workspace: %s", a.config.Agent.Workspace)
 	a.logger.Infof("Server: %s:%d", a.config.Server.Host, a.config.Server.Port)
 	
+	// Link events, messages and tool calls of the same request
+	a.tracer = NewTracer(a.logger, &TracerConfig{Capacity: a.config.Agent.TraceCapacity})
+	a.ToolManager.SetTracer(a.tracer)
+	a.ToolManager.SetDefaultTimeout(time.Duration(a.config.Agent.ToolTimeout) * time.Second)
+
 	// Initialize message router
 	a.messageRouter = NewMessageRouter()
+	a.messageRouter.SetTracer(a.tracer)
+	handlerTimeout := time.Duration(a.config.Agent.HandlerTimeout) * time.Second
+	a.messageRouter.SetHandlerTimeout(handlerTimeout)
+	fanOut, err := ParseFanOutMode(a.config.Agent.RouterFanOut)
+	if err != nil {
+		return err
+	}
+	a.messageRouter.SetFanOut(fanOut, a.config.Agent.RouterConcurrency)
+
+	// Log, measure and recover every handler invocation
+	a.metrics = NewMessageMetrics(nil)
+	a.messageRouter.Use(LoggingMiddleware(a.logger), a.metrics.Middleware(), RecoveryMiddleware())
+	a.messageRouter.UseFor("memory_*", ValidationMiddleware(map[MessageType]PayloadValidator{
+		"memory_*": RequireFields("key"),
+	}))
 	
 	// Register default handlers
 	a.registerDefaultHandlers()
 	
 	// Initialize event loop
-	a.eventLoop = NewEventLoop(ctx, a.logger, a.config.Agent.MaxQueueSize)
-	
+	overflow, err := ParseOverflowPolicy(a.config.Agent.OverflowPolicy)
+	if err != nil {
+		return err
+	}
+	loopConfig := &EventLoopConfig{
+		MaxQueueSize:    a.config.Agent.MaxQueueSize,
+		Workers:         a.config.Agent.Workers,
+		PartitionKey:    a.config.Agent.PartitionKey,
+		StarvationLimit: a.config.Agent.StarvationLimit,
+		OverflowPolicy:  overflow,
+		BlockTimeout:    time.Duration(a.config.Agent.BlockTimeout) * time.Second,
+		SpillFile:       filepath.Join(a.config.Agent.Workspace, "event_spill.jsonl"),
+		Retry: &RetryPolicy{
+			MaxAttempts:    a.config.Agent.Retry.MaxAttempts,
+			InitialBackoff: time.Duration(a.config.Agent.Retry.InitialBackoffMs) * time.Millisecond,
+			MaxBackoff:     time.Duration(a.config.Agent.Retry.MaxBackoffMs) * time.Millisecond,
+			Multiplier:     a.config.Agent.Retry.Multiplier,
+			Jitter:         a.config.Agent.Retry.Jitter,
+		},
+		HandlerTimeout: handlerTimeout,
+		DelayFile:      filepath.Join(a.config.Agent.Workspace, "delayed_events.json"),
+	}
+	if a.config.Agent.Journal.Enabled {
+		loopConfig.JournalFile = filepath.Join(a.config.Agent.Workspace, "event_journal.wal")
+		loopConfig.JournalSync = a.config.Agent.Journal.Sync
+		loopConfig.JournalCompactThreshold = a.config.Agent.Journal.CompactThreshold
+	}
+	a.eventLoop = NewEventLoopWithConfig(ctx, a.logger, loopConfig)
+
+	// Record processed events for the events API
+	history, err := NewEventHistory(a.logger, &EventHistoryConfig{
+		Capacity: a.config.Agent.EventHistorySize,
+		File:     a.config.Agent.EventHistoryFile,
+	})
+	if err != nil {
+		return err
+	}
+	a.eventLoop.SetHistory(history)
+
+	// Keep events whose handlers exhausted their retries
+	deadLetters, err := NewDeadLetterStore(a.logger, &DeadLetterConfig{
+		Capacity: a.config.Agent.DeadLetterCapacity,
+		File:     filepath.Join(a.config.Agent.Workspace, "dead_letters.json"),
+	})
+	if err != nil {
+		return err
+	}
+	a.eventLoop.SetDeadLetterStore(deadLetters)
+	a.eventLoop.SetTracer(a.tracer)
+
+	// Dispatch events to the message router
+	a.eventLoop.RegisterHandler(NewRouterEventHandler(a.messageRouter, a.eventLoop, a.logger))
+
+	// Track event loop liveness for the health endpoint
+	if hb := a.config.Agent.Heartbeat; hb.Enabled {
+		a.heartbeat = NewHeartbeat(a.logger, a.eventLoop, &HeartbeatConfig{
+			Interval:        time.Duration(hb.Interval) * time.Second,
+			StallTimeout:    time.Duration(hb.StallTimeout) * time.Second,
+			DegradedLatency: time.Duration(hb.DegradedLatencyMs) * time.Millisecond,
+		})
+	}
+
+	// Emit cron events for configured and persisted jobs
+	if a.config.Scheduler.Enabled {
+		if err := a.setupScheduler(); err != nil {
+			return err
+		}
+	}
+
 	// Create and start web server
 	webConfig := &WebConfig{
 		Host: a.config.Server.Host,
@@ -82,6 +179,14 @@ func (a *Agent) Run(ctx context.Context) error {
 	if err := a.eventLoop.Start(); err != nil {
 		return err
 	}
+
+	if a.scheduler != nil {
+		go a.scheduler.Start(ctx)
+	}
+	a.startMCPImporter(ctx)
+	if a.heartbeat != nil {
+		go a.heartbeat.Start(ctx)
+	}
 	
 	a.logger.Info("ClawdLocal agent started successfully!")
 	
@@ -91,23 +196,135 @@ func (a *Agent) Run(ctx context.Context) error {
 	return ctx.Err()
 }
 
-// registerDefaultHandlers registers built-in message handlers
-func (a *Agent) registerDefaultHandlers() {
-	// Register echo handler
-	a.messageRouter.RegisterHandler(&EchoHandler{})
-	
-	// Register test handler  
-	a.messageRouter.RegisterHandler(&TestHandler{})
-	
-	// Register tool call handler
-	a.messageRouter.RegisterHandler(&ToolCallMessageHandler{
-		ToolManager: a.ToolManager,
+// RunMCP serves the registered tools and memory over the Model Context Protocol until
+// ctx is cancelled or, for the stdio transport, stdin is closed. The event loop and web
+// UI are not started.
+func (a *Agent) RunMCP(ctx context.Context) error {
+	a.startedAt = time.Now()
+	a.tracer = NewTracer(a.logger, &TracerConfig{Capacity: a.config.Agent.TraceCapacity})
+	a.ToolManager.SetTracer(a.tracer)
+	a.ToolManager.SetDefaultTimeout(time.Duration(a.config.Agent.ToolTimeout) * time.Second)
+
+	server := NewMCPServer(a.logger, a.ToolManager, a.MemoryManager, &MCPServerConfig{
+		Name:    a.config.Agent.Name,
+		Version: a.config.Agent.Version,
 	})
-	
-	// Register memory handler
-	a.messageRouter.RegisterHandler(&MemoryMessageHandler{
-		MemoryManager: a.MemoryManager,
+
+	switch a.config.MCP.Transport {
+	case "", MCPTransportStdio:
+		return server.ServeStdio(ctx, os.Stdin, os.Stdout)
+	case MCPTransportHTTP:
+		return server.ListenAndServe(ctx, a.config.MCP.Addr)
+	default:
+		return fmt.Errorf("unknown MCP transport: %s", a.config.MCP.Transport)
+	}
+}
+
+// startMCPImporter starts the configured MCP servers and imports their tools
+func (a *Agent) startMCPImporter(ctx context.Context) {
+	if len(a.config.MCP.Servers) == 0 {
+		return
+	}
+
+	servers := make([]*MCPStdioServer, len(a.config.MCP.Servers))
+	for i, server := range a.config.MCP.Servers {
+		servers[i] = &MCPStdioServer{
+			Name:    server.Name,
+			Command: server.Command,
+			Args:    server.Args,
+			Env:     server.Env,
+			Dir:     server.Dir,
+		}
+	}
+	restart := a.config.MCP.Restart
+	a.mcpImporter = NewMCPImporter(a.logger, a.ToolManager, &MCPImporterConfig{
+		Servers: servers,
+		Restart: &RetryPolicy{
+			MaxAttempts:    restart.MaxAttempts,
+			InitialBackoff: time.Duration(restart.InitialBackoffMs) * time.Millisecond,
+			MaxBackoff:     time.Duration(restart.MaxBackoffMs) * time.Millisecond,
+			Multiplier:     restart.Multiplier,
+			Jitter:         restart.Jitter,
+		},
+		ClientInfo: MCPImplementation{Name: a.config.Agent.Name, Version: a.config.Agent.Version},
+	})
+	a.mcpImporter.Start(ctx)
+}
+
+// setupScheduler creates the scheduler and registers the jobs from config
+func (a *Agent) setupScheduler() error {
+	scheduler, err := NewScheduler(a.logger, a.eventLoop, &SchedulerConfig{
+		File: filepath.Join(a.config.Agent.Workspace, "schedules.json"),
 	})
+	if err != nil {
+		return err
+	}
+
+	jobs := make([]*ScheduleJob, 0, len(a.config.Scheduler.Jobs))
+	for _, jobConfig := range a.config.Scheduler.Jobs {
+		jobs = append(jobs, &ScheduleJob{
+			ID:       jobConfig.Name,
+			Name:     jobConfig.Name,
+			Spec:     jobConfig.Spec,
+			Payload:  jobConfig.Payload,
+			Metadata: jobConfig.Metadata,
+			CatchUp:  CatchUpPolicy(jobConfig.CatchUp),
+		})
+	}
+	if err := scheduler.SetConfigJobs(jobs); err != nil {
+		return err
+	}
+
+	a.scheduler = scheduler
+	return nil
+}
+
+// Tracer returns the request tracer
+func (a *Agent) Tracer() *Tracer {
+	return a.tracer
+}
+
+// MessageMetrics returns the message handler latency metrics
+func (a *Agent) MessageMetrics() *MessageMetrics {
+	return a.metrics
+}
+
+// Heartbeat returns the heartbeat producer, nil when disabled
+func (a *Agent) Heartbeat() *Heartbeat {
+	return a.heartbeat
+}
+
+// Uptime returns how long the agent has been running
+func (a *Agent) Uptime() time.Duration {
+	if a.startedAt.IsZero() {
+		return 0
+	}
+	return time.Since(a.startedAt)
+}
+
+// Scheduler returns the cron scheduler, nil when disabled
+func (a *Agent) Scheduler() *Scheduler {
+	return a.scheduler
+}
+
+// registerDefaultHandlers registers built-in message handlers under the names
+// messages can address through Message.Target
+func (a *Agent) registerDefaultHandlers() {
+	handlers := []struct {
+		name    string
+		handler MessageHandler
+	}{
+		{"echo", &EchoHandler{}},
+		{"test", &TestHandler{}},
+		{"tool_call", &ToolCallMessageHandler{ToolManager: a.ToolManager}},
+		{"memory", &MemoryMessageHandler{MemoryManager: a.MemoryManager}},
+	}
+
+	for _, h := range handlers {
+		if _, err := a.messageRouter.RegisterNamedHandler(h.name, h.handler); err != nil {
+			a.logger.WithError(err).Errorf("Failed to register %s handler", h.name)
+		}
+	}
 }
 
 // Shutdown gracefully stops the agent
@@ -118,5 +335,8 @@ func (a *Agent) Shutdown() {
 	if a.eventLoop != nil {
 		a.eventLoop.Stop()
 	}
+	if a.mcpImporter != nil {
+		a.mcpImporter.Stop()
+	}
 	a.logger.Info("Agent shutdown complete")
 }
\ No newline at end of file
@@ -0,0 +1,269 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// MetadataTargetHandler 事件元数据中的处理器名称，设置后事件只交给该处理器（用于重新投递死信）
+const MetadataTargetHandler = "target_handler"
+
+// DeadLetter 重试耗尽后仍然失败的事件
+type DeadLetter struct {
+	ID       string    `json:"id"`
+	Event    *Event    `json:"event"`
+	Handler  string    `json:"handler"`
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// DeadLetterConfig holds dead letter store configuration
+type DeadLetterConfig struct {
+	Capacity int    `yaml:"capacity"`
+	File     string `yaml:"file"` // optional JSON file, empty keeps dead letters in memory only
+}
+
+const defaultDeadLetterCapacity = 1000
+
+// DeadLetterStore keeps events whose handlers exhausted their retries
+type DeadLetterStore struct {
+	letters map[string]*DeadLetter
+	mutex   sync.RWMutex
+	logger  *logrus.Logger
+	config  *DeadLetterConfig
+}
+
+// NewDeadLetterStore creates a new dead letter store, loading persisted entries if configured
+func NewDeadLetterStore(logger *logrus.Logger, config *DeadLetterConfig) (*DeadLetterStore, error) {
+	if logger == nil {
+		logger = logrus.New()
+	}
+	if config == nil {
+		config = &DeadLetterConfig{}
+	}
+	if config.Capacity <= 0 {
+		config.Capacity = defaultDeadLetterCapacity
+	}
+
+	ds := &DeadLetterStore{
+		letters: make(map[string]*DeadLetter),
+		logger:  logger,
+		config:  config,
+	}
+
+	if config.File != "" {
+		if err := ds.load(); err != nil {
+			return nil, err
+		}
+	}
+
+	return ds, nil
+}
+
+// Add stores a dead letter, evicting the oldest entry when full
+func (ds *DeadLetterStore) Add(letter *DeadLetter) error {
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	if letter.ID == "" {
+		letter.ID = GenerateMessageID()
+	}
+	if letter.FailedAt.IsZero() {
+		letter.FailedAt = time.Now()
+	}
+
+	ds.letters[letter.ID] = letter
+	if len(ds.letters) > ds.config.Capacity {
+		ds.evictOldest()
+	}
+
+	return ds.save()
+}
+
+// List returns all dead letters, newest first
+func (ds *DeadLetterStore) List() []*DeadLetter {
+	ds.mutex.RLock()
+	defer ds.mutex.RUnlock()
+
+	letters := make([]*DeadLetter, 0, len(ds.letters))
+	for _, letter := range ds.letters {
+		letters = append(letters, letter)
+	}
+	sort.Slice(letters, func(i, j int) bool {
+		return letters[i].FailedAt.After(letters[j].FailedAt)
+	})
+	return letters
+}
+
+// Get returns a single dead letter
+func (ds *DeadLetterStore) Get(id string) (*DeadLetter, bool) {
+	ds.mutex.RLock()
+	defer ds.mutex.RUnlock()
+
+	letter, ok := ds.letters[id]
+	return letter, ok
+}
+
+// Remove deletes a dead letter
+func (ds *DeadLetterStore) Remove(id string) (bool, error) {
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	if _, ok := ds.letters[id]; !ok {
+		return false, nil
+	}
+	delete(ds.letters, id)
+	return true, ds.save()
+}
+
+// Purge deletes all dead letters and returns how many were removed
+func (ds *DeadLetterStore) Purge() (int, error) {
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	n := len(ds.letters)
+	ds.letters = make(map[string]*DeadLetter)
+	return n, ds.save()
+}
+
+// Len returns the number of dead letters
+func (ds *DeadLetterStore) Len() int {
+	ds.mutex.RLock()
+	defer ds.mutex.RUnlock()
+	return len(ds.letters)
+}
+
+// evictOldest removes the oldest dead letter
+func (ds *DeadLetterStore) evictOldest() {
+	var oldestID string
+	var oldestTime time.Time
+
+	for id, letter := range ds.letters {
+		if oldestID == "" || letter.FailedAt.Before(oldestTime) {
+			oldestID = id
+			oldestTime = letter.FailedAt
+		}
+	}
+
+	if oldestID != "" {
+		delete(ds.letters, oldestID)
+		ds.logger.Debugf("Evicted oldest dead letter: %s", oldestID)
+	}
+}
+
+// save writes dead letters to file
+func (ds *DeadLetterStore) save() error {
+	if ds.config.File == "" {
+		return nil
+	}
+
+	dir := filepath.Dir(ds.config.File)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(ds.letters, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal dead letters: %w", err)
+	}
+
+	if err := os.WriteFile(ds.config.File, data, 0644); err != nil {
+		return fmt.Errorf("failed to write dead letter file: %w", err)
+	}
+	return nil
+}
+
+// load reads dead letters from file
+func (ds *DeadLetterStore) load() error {
+	data, err := os.ReadFile(ds.config.File)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// File doesn't exist, that's okay
+			return nil
+		}
+		return fmt.Errorf("failed to read dead letter file: %w", err)
+	}
+
+	if len(data) == 0 {
+		return nil
+	}
+
+	var letters map[string]*DeadLetter
+	if err := json.Unmarshal(data, &letters); err != nil {
+		return fmt.Errorf("failed to unmarshal dead letters: %w", err)
+	}
+
+	ds.letters = letters
+	ds.logger.Infof("Loaded %d dead letters from %s", len(letters), ds.config.File)
+	return nil
+}
+
+// SetDeadLetterStore 设置死信存储，重试耗尽的事件会被保存
+func (el *EventLoop) SetDeadLetterStore(store *DeadLetterStore) {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	el.deadLetters = store
+}
+
+// DeadLetters 获取死信存储，未设置时返回nil
+func (el *EventLoop) DeadLetters() *DeadLetterStore {
+	el.mu.RLock()
+	defer el.mu.RUnlock()
+	return el.deadLetters
+}
+
+// RequeueDeadLetter 将死信重新投递给失败的处理器，投递成功后从存储中删除
+func (el *EventLoop) RequeueDeadLetter(id string) error {
+	store := el.DeadLetters()
+	if store == nil {
+		return ErrDeadLetterNotFound
+	}
+
+	letter, ok := store.Get(id)
+	if !ok {
+		return ErrDeadLetterNotFound
+	}
+
+	// 复制事件，只交给之前失败的处理器
+	event := *letter.Event
+	event.Metadata = make(map[string]interface{}, len(letter.Event.Metadata)+1)
+	for k, v := range letter.Event.Metadata {
+		event.Metadata[k] = v
+	}
+	event.Metadata[MetadataTargetHandler] = letter.Handler
+
+	if err := el.Emit(&event); err != nil {
+		return err
+	}
+
+	_, err := store.Remove(id)
+	return err
+}
+
+// deadLetter 保存重试耗尽的事件
+func (el *EventLoop) deadLetter(store *DeadLetterStore, event *Event, handler string, attempts int, err error) {
+	if store == nil {
+		return
+	}
+
+	letter := &DeadLetter{
+		Event:    event,
+		Handler:  handler,
+		Error:    err.Error(),
+		Attempts: attempts,
+	}
+	if addErr := store.Add(letter); addErr != nil {
+		el.logger.WithError(addErr).WithField("event_id", event.ID).Error("Failed to store dead letter")
+		return
+	}
+	el.logger.WithField("event_id", event.ID).WithField("dead_letter_id", letter.ID).
+		WithField("handler", handler).Warn("Event moved to dead letter store")
+}
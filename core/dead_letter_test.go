@@ -0,0 +1,208 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDeadLetterStore(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	letter := func(id string, minute int) *DeadLetter {
+		return &DeadLetter{
+			ID:       id,
+			Event:    &Event{ID: "ev-" + id, Type: EventTypeMessage},
+			Handler:  "handler",
+			Error:    "boom",
+			Attempts: 3,
+			FailedAt: base.Add(time.Duration(minute) * time.Minute),
+		}
+	}
+
+	tests := []struct {
+		name     string
+		capacity int
+		add      []*DeadLetter
+		want     []string // newest first
+	}{
+		{name: "newest first", capacity: 10, add: []*DeadLetter{letter("a", 1), letter("b", 3), letter("c", 2)}, want: []string{"b", "c", "a"}},
+		{name: "evicts the oldest", capacity: 2, add: []*DeadLetter{letter("a", 2), letter("b", 1), letter("c", 3)}, want: []string{"c", "a"}},
+		{name: "same ID replaces", capacity: 10, add: []*DeadLetter{letter("a", 1), letter("a", 5)}, want: []string{"a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "dead", "letters.json")
+			store, err := NewDeadLetterStore(testLogger(), &DeadLetterConfig{Capacity: tt.capacity, File: file})
+			if err != nil {
+				t.Fatalf("NewDeadLetterStore: %v", err)
+			}
+			for _, l := range tt.add {
+				if err := store.Add(l); err != nil {
+					t.Fatalf("Add: %v", err)
+				}
+			}
+
+			check := func(store *DeadLetterStore) {
+				t.Helper()
+				letters := store.List()
+				if len(letters) != len(tt.want) {
+					t.Fatalf("List returned %d letters, want %d", len(letters), len(tt.want))
+				}
+				for i, l := range letters {
+					if l.ID != tt.want[i] {
+						t.Errorf("List[%d] = %s, want %s", i, l.ID, tt.want[i])
+					}
+				}
+			}
+			check(store)
+
+			reloaded, err := NewDeadLetterStore(testLogger(), &DeadLetterConfig{Capacity: tt.capacity, File: file})
+			if err != nil {
+				t.Fatalf("reload: %v", err)
+			}
+			check(reloaded)
+		})
+	}
+}
+
+func TestDeadLetterStoreRemoveAndPurge(t *testing.T) {
+	store, _ := NewDeadLetterStore(testLogger(), nil)
+	store.Add(&DeadLetter{Event: &Event{ID: "ev-1"}})
+	store.Add(&DeadLetter{Event: &Event{ID: "ev-2"}})
+
+	letters := store.List()
+	for _, l := range letters {
+		if l.ID == "" || l.FailedAt.IsZero() {
+			t.Errorf("Add did not fill in ID and FailedAt: %+v", l)
+		}
+	}
+
+	if removed, err := store.Remove(letters[0].ID); err != nil || !removed {
+		t.Fatalf("Remove = %v, %v", removed, err)
+	}
+	if removed, _ := store.Remove(letters[0].ID); removed {
+		t.Error("Remove reported a missing letter as removed")
+	}
+	if _, ok := store.Get(letters[1].ID); !ok {
+		t.Error("Get lost the remaining letter")
+	}
+
+	if n, err := store.Purge(); err != nil || n != 1 {
+		t.Errorf("Purge = %d, %v; want 1", n, err)
+	}
+	if store.Len() != 0 {
+		t.Errorf("Len = %d after purge", store.Len())
+	}
+}
+
+// failingEventHandler is an EventHandler with its own type name, so dead letters can target it
+type failingEventHandler struct {
+	funcEventHandler
+}
+
+func TestRequeueDeadLetterTargetsFailedHandler(t *testing.T) {
+	el := startTestLoop(t, nil, &EventLoopConfig{Retry: &RetryPolicy{MaxAttempts: 1}})
+	store, _ := NewDeadLetterStore(testLogger(), nil)
+	el.SetDeadLetterStore(store)
+
+	var healthy, failing atomic.Int32
+	var broken atomic.Bool
+	broken.Store(true)
+	el.RegisterHandler(&funcEventHandler{handle: func(ctx context.Context, event *Event) error {
+		healthy.Add(1)
+		return nil
+	}})
+	el.RegisterHandler(&failingEventHandler{funcEventHandler{handle: func(ctx context.Context, event *Event) error {
+		failing.Add(1)
+		if broken.Load() {
+			return errors.New("boom")
+		}
+		return nil
+	}}})
+
+	el.Emit(&Event{ID: "ev-1", Type: EventTypeMessage, Metadata: map[string]interface{}{"session_id": "s1"}})
+	waitFor(t, 2*time.Second, "dead letter", func() bool { return store.Len() == 1 })
+
+	letter := store.List()[0]
+	if letter.Handler != handlerName(&failingEventHandler{}) {
+		t.Fatalf("dead letter handler = %s", letter.Handler)
+	}
+
+	broken.Store(false)
+	if err := el.RequeueDeadLetter(letter.ID); err != nil {
+		t.Fatalf("RequeueDeadLetter: %v", err)
+	}
+	waitFor(t, 2*time.Second, "requeued event", func() bool { return failing.Load() == 2 })
+
+	if store.Len() != 0 {
+		t.Errorf("requeued letter still stored")
+	}
+	if got := healthy.Load(); got != 1 {
+		t.Errorf("healthy handler ran %d times, want 1", got)
+	}
+	if err := el.RequeueDeadLetter(letter.ID); !errors.Is(err, ErrDeadLetterNotFound) {
+		t.Errorf("second requeue = %v, want ErrDeadLetterNotFound", err)
+	}
+	// The stored event is not modified by the requeue
+	if _, ok := letter.Event.Metadata[MetadataTargetHandler]; ok {
+		t.Error("requeue changed the metadata of the stored event")
+	}
+}
+
+func TestDeadLetterEndpoints(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		path       string // {id} is replaced with the stored letter ID
+		wantStatus int
+		wantLen    int
+	}{
+		{name: "list", method: "GET", path: "/api/v1/deadletters", wantStatus: http.StatusOK, wantLen: 1},
+		{name: "get", method: "GET", path: "/api/v1/deadletters/{id}", wantStatus: http.StatusOK, wantLen: 1},
+		{name: "get missing", method: "GET", path: "/api/v1/deadletters/missing", wantStatus: http.StatusNotFound, wantLen: 1},
+		{name: "delete", method: "DELETE", path: "/api/v1/deadletters/{id}", wantStatus: http.StatusNoContent, wantLen: 0},
+		{name: "delete missing", method: "DELETE", path: "/api/v1/deadletters/missing", wantStatus: http.StatusNotFound, wantLen: 1},
+		{name: "requeue", method: "POST", path: "/api/v1/deadletters/{id}/requeue", wantStatus: http.StatusAccepted, wantLen: 0},
+		{name: "requeue missing", method: "POST", path: "/api/v1/deadletters/missing/requeue", wantStatus: http.StatusNotFound, wantLen: 1},
+		{name: "purge", method: "DELETE", path: "/api/v1/deadletters", wantStatus: http.StatusOK, wantLen: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			el := startTestLoop(t, nil, nil)
+			el.RegisterHandler(&funcEventHandler{})
+			store, _ := NewDeadLetterStore(testLogger(), nil)
+			el.SetDeadLetterStore(store)
+			letter := &DeadLetter{Event: &Event{Type: EventTypeMessage}, Handler: handlerName(&funcEventHandler{}), Error: "boom"}
+			store.Add(letter)
+
+			ws := newTestWebServer(t, el)
+			rec := serveTestRequest(ws, tt.method, strings.Replace(tt.path, "{id}", letter.ID, 1), "")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if store.Len() != tt.wantLen {
+				t.Errorf("store has %d letters, want %d", store.Len(), tt.wantLen)
+			}
+
+			if tt.name == "list" {
+				var letters []*DeadLetter
+				if err := json.Unmarshal(rec.Body.Bytes(), &letters); err != nil || len(letters) != 1 || letters[0].ID != letter.ID {
+					t.Errorf("list body = %s", rec.Body)
+				}
+			}
+		})
+	}
+
+	t.Run("store not configured", func(t *testing.T) {
+		ws := newTestWebServer(t, startTestLoop(t, nil, nil))
+		if rec := serveTestRequest(ws, "GET", "/api/v1/deadletters", ""); rec.Code != http.StatusInternalServerError {
+			t.Errorf("status = %d, want 500", rec.Code)
+		}
+	})
+}
@@ -16,7 +16,12 @@ func (h *EchoHandler) Handle(ctx context.Context, msg *Message) error {
 
 // CanHandle checks if this handler can handle the message type
 func (h *EchoHandler) CanHandle(msgType MessageType) bool {
-	return true // Handle all message types
+	return msgType == MessageTypeUserInput || msgType == MessageTypeAgentMessage
+}
+
+// MessageTypes declares the conversational message types that are echoed back
+func (h *EchoHandler) MessageTypes() []MessageType {
+	return []MessageType{MessageTypeUserInput, MessageTypeAgentMessage}
 }
 
 // Priority returns the handler priority
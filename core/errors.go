@@ -3,10 +3,30 @@ package core
 import "errors"
 
 var (
-	ErrEventLoopNotRunning = errors.New("event loop is not running")
-	ErrEventQueueFull      = errors.New("event queue is full")
-	ErrInvalidEvent        = errors.New("invalid event")
-	ErrHandlerNotFound     = errors.New("no handler found for event type")
-	ErrMessageQueueClosed  = errors.New("message queue is closed")
-	ErrInvalidMessageType  = errors.New("invalid message type")
-)
\ No newline at end of file
+	ErrEventLoopNotRunning  = errors.New("event loop is not running")
+	ErrEventQueueFull       = errors.New("event queue is full")
+	ErrEmitTimeout          = errors.New("timed out waiting for event queue space")
+	ErrInvalidEvent         = errors.New("invalid event")
+	ErrHandlerNotFound      = errors.New("no handler found for event type")
+	ErrMessageQueueClosed   = errors.New("message queue is closed")
+	ErrInvalidMessageType   = errors.New("invalid message type")
+	ErrDeadLetterNotFound   = errors.New("dead letter not found")
+	ErrHandlerTimeout       = errors.New("handler timed out")
+	ErrDelayedEventNotFound = errors.New("delayed event not found")
+	ErrNoResponder          = errors.New("message was not sent as a request")
+	ErrNoReply              = errors.New("no handler replied to request")
+	ErrRequestTimeout       = errors.New("request timed out waiting for reply")
+	ErrRequestNotFound      = errors.New("no pending request for reply")
+	ErrInvalidPayload       = errors.New("invalid message payload")
+	ErrUnauthorized         = errors.New("message not authorized")
+	ErrTargetNotFound       = errors.New("no handler registered for message target")
+	ErrHandlerNotRegistered = errors.New("handler is not registered")
+	ErrMCPClientClosed      = errors.New("MCP server connection closed")
+	ErrToolTimeout          = errors.New("tool call timed out")
+	ErrToolCallCancelled    = errors.New("tool call cancelled")
+	ErrToolCallNotFound     = errors.New("tool call is not running")
+	ErrToolCallFailed       = errors.New("tool call failed")
+
+	// ErrStopPropagation 消息处理器返回该错误表示独占消息，优先级更低的处理器不会再收到它
+	ErrStopPropagation = errors.New("stop propagation")
+)
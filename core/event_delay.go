@@ -0,0 +1,348 @@
+package core
+
+import (
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// delayRetryInterval 延迟事件到期但队列已满时，再次尝试投递前的等待时间
+const delayRetryInterval = time.Second
+
+// delayedItem 延迟队列中的元素，index用于按ID取消
+type delayedItem struct {
+	event *Event
+	index int
+}
+
+// delayHeap 按NotBefore排序的最小堆
+type delayHeap []*delayedItem
+
+func (h delayHeap) Len() int { return len(h) }
+
+func (h delayHeap) Less(i, j int) bool {
+	return h[i].event.NotBefore.Before(*h[j].event.NotBefore)
+}
+
+func (h delayHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *delayHeap) Push(x interface{}) {
+	item := x.(*delayedItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *delayHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
+
+// delayQueue 保存尚未到期的事件，可选地持久化到文件以便重启后恢复
+type delayQueue struct {
+	mu     sync.Mutex
+	items  delayHeap
+	byID   map[string]*delayedItem
+	file   string
+	logger *logrus.Logger
+	wake   chan struct{}
+}
+
+// newDelayQueue 创建延迟队列，file不为空时加载之前保存的事件
+func newDelayQueue(file string, logger *logrus.Logger) (*delayQueue, error) {
+	q := &delayQueue{
+		byID:   make(map[string]*delayedItem),
+		file:   file,
+		logger: logger,
+		wake:   make(chan struct{}, 1),
+	}
+	if file != "" {
+		if err := q.load(); err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+// add 加入延迟事件，相同ID的事件会被替换
+func (q *delayQueue) add(event *Event) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.insert(event)
+	q.notify()
+	return q.save()
+}
+
+// cancel 按ID删除延迟事件
+func (q *delayQueue) cancel(id string) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.remove(id) {
+		return false, nil
+	}
+	q.notify()
+	return true, q.save()
+}
+
+// take 取出到期的事件以便投递，不唤醒投递goroutine也不写文件。
+// 投递成功后调用persist，失败时调用restore放回。
+func (q *delayQueue) take(id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.remove(id)
+}
+
+// persist 投递成功后将取出后的状态写入文件
+func (q *delayQueue) persist() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.save()
+}
+
+// restore 放回投递失败的事件，不唤醒投递goroutine，以免跳过重试间隔。
+// 取出期间已加入同ID的新事件时保留新事件。
+func (q *delayQueue) restore(event *Event) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.byID[event.ID]; ok {
+		return nil
+	}
+	q.insert(event)
+	// 取出期间其他写入可能已将该事件从文件中移除
+	return q.save()
+}
+
+// insert 加入事件，调用者必须持有q.mu
+func (q *delayQueue) insert(event *Event) {
+	if existing, ok := q.byID[event.ID]; ok {
+		heap.Remove(&q.items, existing.index)
+	}
+	item := &delayedItem{event: event}
+	heap.Push(&q.items, item)
+	q.byID[event.ID] = item
+}
+
+// remove 按ID删除事件，调用者必须持有q.mu
+func (q *delayQueue) remove(id string) bool {
+	item, ok := q.byID[id]
+	if !ok {
+		return false
+	}
+	heap.Remove(&q.items, item.index)
+	delete(q.byID, id)
+	return true
+}
+
+// next 返回最早到期的延迟事件
+func (q *delayQueue) next() (*Event, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.items) == 0 {
+		return nil, false
+	}
+	return q.items[0].event, true
+}
+
+// list 返回所有延迟事件，按到期时间排序
+func (q *delayQueue) list() []*Event {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	events := make([]*Event, 0, len(q.items))
+	for _, item := range q.items {
+		events = append(events, item.event)
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].NotBefore.Before(*events[j].NotBefore)
+	})
+	return events
+}
+
+// Len 返回延迟事件数量
+func (q *delayQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// notify 唤醒投递goroutine重新计算等待时间
+func (q *delayQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// save 将延迟事件写入文件，调用者必须持有q.mu
+func (q *delayQueue) save() error {
+	if q.file == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(q.file), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	events := make([]*Event, 0, len(q.items))
+	for _, item := range q.items {
+		events = append(events, item.event)
+	}
+	data, err := json.MarshalIndent(events, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal delayed events: %w", err)
+	}
+
+	tmp := q.file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write delayed events file: %w", err)
+	}
+	if err := os.Rename(tmp, q.file); err != nil {
+		return fmt.Errorf("failed to replace delayed events file: %w", err)
+	}
+	return nil
+}
+
+// load 从文件读取延迟事件
+func (q *delayQueue) load() error {
+	data, err := os.ReadFile(q.file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read delayed events file: %w", err)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	var events []*Event
+	if err := json.Unmarshal(data, &events); err != nil {
+		return fmt.Errorf("failed to unmarshal delayed events: %w", err)
+	}
+	for _, event := range events {
+		if event.NotBefore == nil {
+			continue
+		}
+		item := &delayedItem{event: event}
+		heap.Push(&q.items, item)
+		q.byID[event.ID] = item
+	}
+
+	q.logger.Infof("Loaded %d delayed events from %s", len(q.items), q.file)
+	return nil
+}
+
+// isDelayed 判断事件是否需要延迟投递
+func (e *Event) isDelayed(now time.Time) bool {
+	return e.NotBefore != nil && e.NotBefore.After(now)
+}
+
+// EmitAfter 在delay之后投递事件
+func (el *EventLoop) EmitAfter(event *Event, delay time.Duration) error {
+	notBefore := time.Now().Add(delay)
+	event.NotBefore = &notBefore
+	return el.Emit(event)
+}
+
+// CancelDelayed 取消尚未投递的延迟事件
+func (el *EventLoop) CancelDelayed(id string) error {
+	removed, err := el.delayed.cancel(id)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return ErrDelayedEventNotFound
+	}
+	el.logger.WithField("event_id", id).Info("Cancelled delayed event")
+	return nil
+}
+
+// DelayedEvents 返回尚未投递的延迟事件，按到期时间排序
+func (el *EventLoop) DelayedEvents() []*Event {
+	return el.delayed.list()
+}
+
+// GetDelayedCount 获取尚未投递的延迟事件数量
+func (el *EventLoop) GetDelayedCount() int {
+	return el.delayed.Len()
+}
+
+// emitDelayed 将未到期的事件放入延迟队列
+func (el *EventLoop) emitDelayed(event *Event) error {
+	if event.ID == "" {
+		event.ID = GenerateMessageID()
+	}
+	if err := el.delayed.add(event); err != nil {
+		el.logger.WithError(err).WithField("event_id", event.ID).Error("Failed to persist delayed event")
+		return err
+	}
+	el.logger.WithField("event_id", event.ID).WithField("not_before", *event.NotBefore).Debug("Delayed event")
+	return nil
+}
+
+// runDelayed 在延迟事件到期后将其投递到事件循环
+func (el *EventLoop) runDelayed() {
+	defer el.wg.Done()
+
+	for {
+		// 没有延迟事件时也定期醒来，新事件会通过wake唤醒
+		wait := time.Minute
+		for {
+			event, ok := el.delayed.next()
+			if !ok {
+				break
+			}
+			if d := time.Until(*event.NotBefore); d > 0 {
+				if d < wait {
+					wait = d
+				}
+				break
+			}
+
+			// 先从延迟队列中取出，避免与CancelDelayed竞争
+			if !el.delayed.take(event.ID) {
+				continue
+			}
+			if err := el.enqueue(event); err != nil {
+				// 队列已满时放回延迟队列，等待delayRetryInterval后重试
+				el.logger.WithError(err).WithField("event_id", event.ID).Warn("Failed to deliver delayed event, retrying")
+				if err := el.delayed.restore(event); err != nil {
+					el.logger.WithError(err).WithField("event_id", event.ID).Error("Failed to persist delayed event")
+				}
+				wait = delayRetryInterval
+				break
+			}
+			if err := el.delayed.persist(); err != nil {
+				el.logger.WithError(err).WithField("event_id", event.ID).Warn("Failed to persist delayed events")
+			}
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-el.delayed.wake:
+			timer.Stop()
+		case <-el.ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
@@ -0,0 +1,354 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+// delayedEvent returns an event held until base+offset
+func delayedEvent(id string, base time.Time, offset time.Duration) *Event {
+	notBefore := base.Add(offset)
+	return &Event{ID: id, Type: EventTypeMessage, NotBefore: &notBefore}
+}
+
+// delayedIDs returns the IDs of the events in order
+func delayedIDs(events []*Event) []string {
+	ids := make([]string, len(events))
+	for i, event := range events {
+		ids[i] = event.ID
+	}
+	return ids
+}
+
+func TestDelayQueueOrder(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		add    []*Event
+		cancel []string
+		want   []string
+	}{
+		{
+			name: "soonest first",
+			add:  []*Event{delayedEvent("c", base, 3*time.Minute), delayedEvent("a", base, time.Minute), delayedEvent("b", base, 2*time.Minute)},
+			want: []string{"a", "b", "c"},
+		},
+		{
+			name:   "cancel from the middle",
+			add:    []*Event{delayedEvent("a", base, time.Minute), delayedEvent("b", base, 2*time.Minute), delayedEvent("c", base, 3*time.Minute)},
+			cancel: []string{"b"},
+			want:   []string{"a", "c"},
+		},
+		{
+			name:   "cancel the head",
+			add:    []*Event{delayedEvent("a", base, time.Minute), delayedEvent("b", base, 2*time.Minute)},
+			cancel: []string{"a"},
+			want:   []string{"b"},
+		},
+		{
+			name: "same ID reschedules",
+			add:  []*Event{delayedEvent("a", base, time.Minute), delayedEvent("b", base, 2*time.Minute), delayedEvent("a", base, 3*time.Minute)},
+			want: []string{"b", "a"},
+		},
+		{name: "empty", want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, _ := newDelayQueue("", testLogger())
+			for _, event := range tt.add {
+				if err := q.add(event); err != nil {
+					t.Fatalf("add: %v", err)
+				}
+			}
+			for _, id := range tt.cancel {
+				if removed, err := q.cancel(id); err != nil || !removed {
+					t.Fatalf("cancel(%s) = %v, %v", id, removed, err)
+				}
+			}
+
+			if got := delayedIDs(q.list()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("list = %v, want %v", got, tt.want)
+			}
+			if q.Len() != len(tt.want) {
+				t.Errorf("Len = %d, want %d", q.Len(), len(tt.want))
+			}
+			next, ok := q.next()
+			if ok != (len(tt.want) > 0) || (ok && next.ID != tt.want[0]) {
+				t.Errorf("next = %v, %v; want %v", next, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestDelayQueueCancelMissing(t *testing.T) {
+	q, _ := newDelayQueue("", testLogger())
+	if removed, err := q.cancel("missing"); removed || err != nil {
+		t.Errorf("cancel = %v, %v; want false, nil", removed, err)
+	}
+}
+
+func TestDelayQueuePersistence(t *testing.T) {
+	base := time.Now().Add(time.Hour)
+	writeFile := func(content string) func(t *testing.T, file string) {
+		return func(t *testing.T, file string) {
+			if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	tests := []struct {
+		name    string
+		setup   func(t *testing.T, file string)
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "saved events",
+			setup: func(t *testing.T, file string) {
+				q, err := newDelayQueue(file, testLogger())
+				if err != nil {
+					t.Fatalf("newDelayQueue: %v", err)
+				}
+				q.add(delayedEvent("b", base, 2*time.Minute))
+				q.add(delayedEvent("a", base, time.Minute))
+				q.add(delayedEvent("c", base, 3*time.Minute))
+				q.cancel("c")
+			},
+			want: []string{"a", "b"},
+		},
+		{name: "missing file", setup: func(t *testing.T, file string) {}, want: []string{}},
+		{name: "empty file", setup: writeFile(""), want: []string{}},
+		{name: "events without NotBefore are skipped", setup: writeFile(`[{"id":"x","type":"message"}]`), want: []string{}},
+		{name: "corrupt file", setup: writeFile("{not json"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "events.json")
+			tt.setup(t, file)
+
+			q, err := newDelayQueue(file, testLogger())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newDelayQueue err = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := delayedIDs(q.list()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loaded %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// recordingLoop starts a loop that records the IDs of processed events in order
+func recordingLoop(t *testing.T, config *EventLoopConfig) (*EventLoop, func() []string) {
+	t.Helper()
+	el := startTestLoop(t, nil, config)
+
+	var mu sync.Mutex
+	var ids []string
+	el.RegisterHandler(&funcEventHandler{handle: func(ctx context.Context, event *Event) error {
+		mu.Lock()
+		ids = append(ids, event.ID)
+		mu.Unlock()
+		return nil
+	}})
+	return el, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), ids...)
+	}
+}
+
+func TestEventLoopDeliversDelayedEvents(t *testing.T) {
+	el, processed := recordingLoop(t, &EventLoopConfig{Workers: 1})
+
+	for i, delay := range []time.Duration{90 * time.Millisecond, 30 * time.Millisecond, 60 * time.Millisecond} {
+		if err := el.EmitAfter(&Event{ID: fmt.Sprintf("delayed-%d", i), Type: EventTypeMessage}, delay); err != nil {
+			t.Fatalf("EmitAfter: %v", err)
+		}
+	}
+	past := time.Now().Add(-time.Minute)
+	el.Emit(&Event{ID: "overdue", Type: EventTypeMessage, NotBefore: &past})
+	el.Emit(&Event{ID: "immediate", Type: EventTypeMessage})
+
+	waitFor(t, time.Second, "undelayed events", func() bool { return len(processed()) == 2 })
+	if el.GetDelayedCount() != 3 {
+		t.Errorf("GetDelayedCount = %d, want 3", el.GetDelayedCount())
+	}
+
+	waitFor(t, 2*time.Second, "delayed events", func() bool { return len(processed()) == 5 })
+	want := []string{"overdue", "immediate", "delayed-1", "delayed-2", "delayed-0"}
+	if got := processed(); !reflect.DeepEqual(got, want) {
+		t.Errorf("processed %v, want %v", got, want)
+	}
+	if el.GetDelayedCount() != 0 {
+		t.Errorf("GetDelayedCount = %d after delivery", el.GetDelayedCount())
+	}
+}
+
+func TestEventLoopCancelDelayed(t *testing.T) {
+	el, processed := recordingLoop(t, nil)
+
+	el.EmitAfter(&Event{ID: "cancelled", Type: EventTypeMessage}, 50*time.Millisecond)
+	el.EmitAfter(&Event{ID: "kept", Type: EventTypeMessage}, 50*time.Millisecond)
+	if err := el.CancelDelayed("cancelled"); err != nil {
+		t.Fatalf("CancelDelayed: %v", err)
+	}
+	if err := el.CancelDelayed("cancelled"); !errors.Is(err, ErrDelayedEventNotFound) {
+		t.Errorf("second CancelDelayed = %v, want ErrDelayedEventNotFound", err)
+	}
+
+	waitFor(t, 2*time.Second, "kept event", func() bool { return len(processed()) == 1 })
+	time.Sleep(50 * time.Millisecond)
+	if got := processed(); !reflect.DeepEqual(got, []string{"kept"}) {
+		t.Errorf("processed %v, want only the kept event", got)
+	}
+}
+
+func TestEventLoopDelayedRetryWaitsWhileQueueIsFull(t *testing.T) {
+	logger, hook := logtest.NewNullLogger()
+	file := filepath.Join(t.TempDir(), "delayed.json")
+	el := startTestLoop(t, logger, &EventLoopConfig{Workers: 1, MaxQueueSize: 1, DelayFile: file})
+
+	block := make(chan struct{})
+	defer close(block)
+	var delivered atomic.Bool
+	el.RegisterHandler(&funcEventHandler{handle: func(ctx context.Context, event *Event) error {
+		switch event.ID {
+		case "blocker":
+			<-block
+		case "reminder":
+			delivered.Store(true)
+		}
+		return nil
+	}})
+	el.Emit(&Event{ID: "blocker", Type: EventTypeMessage})
+	waitFor(t, time.Second, "blocker in flight", func() bool { return el.GetInFlight() == 1 })
+	el.Emit(&Event{ID: "queued", Type: EventTypeMessage})
+
+	if err := el.EmitAfter(&Event{ID: "reminder", Type: EventTypeMessage}, 10*time.Millisecond); err != nil {
+		t.Fatalf("EmitAfter: %v", err)
+	}
+	retries := func() int {
+		n := 0
+		for _, entry := range hook.AllEntries() {
+			if entry.Message == "Failed to deliver delayed event, retrying" {
+				n++
+			}
+		}
+		return n
+	}
+	waitFor(t, time.Second, "first delivery attempt", func() bool { return retries() > 0 })
+	time.Sleep(300 * time.Millisecond)
+	if n := retries(); n != 1 {
+		t.Errorf("%d delivery attempts within the retry interval, want 1", n)
+	}
+	if got := delayedIDs(el.DelayedEvents()); !reflect.DeepEqual(got, []string{"reminder"}) {
+		t.Errorf("delayed events = %v, want the reminder put back", got)
+	}
+	reloaded, _ := newDelayQueue(file, testLogger())
+	if reloaded.Len() != 1 {
+		t.Errorf("%d delayed events persisted, want 1", reloaded.Len())
+	}
+
+	block <- struct{}{}
+	waitFor(t, 3*time.Second, "reminder delivered", delivered.Load)
+}
+
+func TestEventLoopDelayedEventsSurviveRestart(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "delayed.json")
+
+	first := startTestLoop(t, nil, &EventLoopConfig{DelayFile: file})
+	if err := first.EmitAfter(&Event{ID: "reminder", Type: EventTypeMessage}, 300*time.Millisecond); err != nil {
+		t.Fatalf("EmitAfter: %v", err)
+	}
+	first.Stop()
+
+	second, processed := recordingLoop(t, &EventLoopConfig{DelayFile: file})
+	if got := delayedIDs(second.DelayedEvents()); !reflect.DeepEqual(got, []string{"reminder"}) {
+		t.Fatalf("delayed events after restart = %v", got)
+	}
+	waitFor(t, 2*time.Second, "reminder delivered", func() bool { return len(processed()) == 1 })
+
+	reloaded, _ := newDelayQueue(file, testLogger())
+	if reloaded.Len() != 0 {
+		t.Errorf("delivered event still persisted")
+	}
+}
+
+func TestDelayedEventEndpoints(t *testing.T) {
+	el := startTestLoop(t, nil, nil)
+	el.RegisterHandler(&funcEventHandler{})
+	ws := newTestWebServer(t, el)
+
+	deliverAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	rec := serveTestRequest(ws, "POST", "/api/v1/events", fmt.Sprintf(`{"type":"message","deliver_at":%q}`, deliverAt.Format(time.RFC3339)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST status = %d: %s", rec.Code, rec.Body)
+	}
+	var created eventResponse
+	json.Unmarshal(rec.Body.Bytes(), &created)
+	if created.DeliverAt == nil || !created.DeliverAt.Equal(deliverAt) {
+		t.Errorf("deliver_at = %v, want %v", created.DeliverAt, deliverAt)
+	}
+
+	rec = serveTestRequest(ws, "GET", "/api/v1/events/delayed", "")
+	var delayed []*Event
+	if err := json.Unmarshal(rec.Body.Bytes(), &delayed); err != nil || len(delayed) != 1 || delayed[0].ID != created.ID {
+		t.Fatalf("delayed list = %s", rec.Body)
+	}
+
+	tests := []struct {
+		name       string
+		id         string
+		wantStatus int
+	}{
+		{name: "cancel", id: created.ID, wantStatus: http.StatusNoContent},
+		{name: "cancel again", id: created.ID, wantStatus: http.StatusNotFound},
+		{name: "cancel missing", id: "missing", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := serveTestRequest(ws, "DELETE", "/api/v1/events/delayed/"+tt.id, ""); rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+	if el.GetDelayedCount() != 0 {
+		t.Errorf("GetDelayedCount = %d after cancelling", el.GetDelayedCount())
+	}
+}
+
+func TestDelayedEventEndpointsWithoutEventLoop(t *testing.T) {
+	ws := newTestWebServer(t, nil)
+
+	tests := []struct {
+		method string
+		url    string
+	}{
+		{method: "GET", url: "/api/v1/events/delayed"},
+		{method: "DELETE", url: "/api/v1/events/delayed/missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			if rec := serveTestRequest(ws, tt.method, tt.url, ""); rec.Code != http.StatusServiceUnavailable {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+			}
+		})
+	}
+}
@@ -0,0 +1,313 @@
+package core
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// HandlerRecord describes a single handler invocation for an event
+type HandlerRecord struct {
+	Handler  string        `json:"handler"`
+	Duration time.Duration `json:"duration"`
+	Attempts int           `json:"attempts"`
+	Error    string        `json:"error,omitempty"`
+	Stack    string        `json:"stack,omitempty"` // set when the handler panicked
+}
+
+// EventRecord is a processed event together with its handler outcomes
+type EventRecord struct {
+	Seq         uint64          `json:"seq"`
+	Event       *Event          `json:"event"`
+	Handlers    []HandlerRecord `json:"handlers"`
+	Handled     bool            `json:"handled"` // a handler accepted the event; failures are reported in Handlers
+	Duration    time.Duration   `json:"duration"`
+	ProcessedAt time.Time       `json:"processed_at"`
+}
+
+// EventHistoryConfig holds event history configuration
+type EventHistoryConfig struct {
+	Capacity int    `yaml:"capacity"`
+	File     string `yaml:"file"` // optional JSON lines file, empty keeps history in memory only
+}
+
+// EventHistoryQuery filters and paginates the event history.
+// Results are returned newest first; Cursor is the NextCursor of a previous page.
+type EventHistoryQuery struct {
+	Types         []EventType
+	Since         time.Time
+	Until         time.Time
+	MetadataKey   string
+	MetadataValue string
+	Cursor        string
+	Limit         int
+}
+
+// EventHistoryPage is a single page of history query results
+type EventHistoryPage struct {
+	Events     []*EventRecord `json:"events"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+const (
+	defaultEventHistoryCapacity = 1000
+	defaultEventHistoryLimit    = 50
+	maxEventHistoryLimit        = 500
+)
+
+// EventHistory keeps a bounded log of processed events
+type EventHistory struct {
+	records []*EventRecord
+	nextSeq uint64
+	mutex   sync.RWMutex
+	logger  *logrus.Logger
+	config  *EventHistoryConfig
+
+	// fileLines counts the records in the persisted file, used to decide when to compact it
+	fileLines int
+}
+
+// NewEventHistory creates a new event history, loading persisted records if configured
+func NewEventHistory(logger *logrus.Logger, config *EventHistoryConfig) (*EventHistory, error) {
+	if logger == nil {
+		logger = logrus.New()
+	}
+	if config == nil {
+		config = &EventHistoryConfig{}
+	}
+	if config.Capacity <= 0 {
+		config.Capacity = defaultEventHistoryCapacity
+	}
+
+	eh := &EventHistory{
+		records: make([]*EventRecord, 0, config.Capacity),
+		nextSeq: 1,
+		logger:  logger,
+		config:  config,
+	}
+
+	if config.File != "" {
+		if err := eh.load(); err != nil {
+			return nil, err
+		}
+	}
+
+	return eh, nil
+}
+
+// Record appends a processed event to the history
+func (eh *EventHistory) Record(record *EventRecord) {
+	eh.mutex.Lock()
+	defer eh.mutex.Unlock()
+
+	record.Seq = eh.nextSeq
+	eh.nextSeq++
+
+	eh.records = append(eh.records, record)
+	if len(eh.records) > eh.config.Capacity {
+		// Drop the oldest records, copying so the backing array does not grow forever
+		kept := make([]*EventRecord, eh.config.Capacity, eh.config.Capacity)
+		copy(kept, eh.records[len(eh.records)-eh.config.Capacity:])
+		eh.records = kept
+	}
+
+	if eh.config.File != "" {
+		if err := eh.persist(record); err != nil {
+			eh.logger.WithError(err).Warn("Failed to persist event history")
+		}
+	}
+}
+
+// Query returns the records matching the query, newest first
+func (eh *EventHistory) Query(query EventHistoryQuery) (*EventHistoryPage, error) {
+	limit := query.Limit
+	if limit <= 0 {
+		limit = defaultEventHistoryLimit
+	}
+	if limit > maxEventHistoryLimit {
+		limit = maxEventHistoryLimit
+	}
+
+	var before uint64
+	if query.Cursor != "" {
+		seq, err := strconv.ParseUint(query.Cursor, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor: %s", query.Cursor)
+		}
+		before = seq
+	}
+
+	eh.mutex.RLock()
+	defer eh.mutex.RUnlock()
+
+	page := &EventHistoryPage{Events: make([]*EventRecord, 0, limit)}
+	for i := len(eh.records) - 1; i >= 0; i-- {
+		record := eh.records[i]
+		if before != 0 && record.Seq >= before {
+			continue
+		}
+		if !query.matches(record) {
+			continue
+		}
+		if len(page.Events) == limit {
+			page.NextCursor = strconv.FormatUint(page.Events[limit-1].Seq, 10)
+			break
+		}
+		page.Events = append(page.Events, record)
+	}
+
+	return page, nil
+}
+
+// Len returns the number of records currently held
+func (eh *EventHistory) Len() int {
+	eh.mutex.RLock()
+	defer eh.mutex.RUnlock()
+	return len(eh.records)
+}
+
+// matches checks whether a record satisfies the query filters
+func (q EventHistoryQuery) matches(record *EventRecord) bool {
+	event := record.Event
+	if event == nil {
+		return false
+	}
+
+	if len(q.Types) > 0 {
+		found := false
+		for _, t := range q.Types {
+			if event.Type == t {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if !q.Since.IsZero() && event.Timestamp.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && event.Timestamp.After(q.Until) {
+		return false
+	}
+
+	if q.MetadataKey != "" {
+		value, ok := event.Metadata[q.MetadataKey]
+		if !ok {
+			return false
+		}
+		if q.MetadataValue != "" && fmt.Sprintf("%v", value) != q.MetadataValue {
+			return false
+		}
+	}
+
+	return true
+}
+
+// persist appends a record to the history file, compacting it when it grows past twice the capacity
+func (eh *EventHistory) persist(record *EventRecord) error {
+	if eh.fileLines >= 2*eh.config.Capacity {
+		return eh.compact()
+	}
+
+	dir := filepath.Dir(eh.config.File)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event record: %w", err)
+	}
+
+	f, err := os.OpenFile(eh.config.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open event history file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write event history file: %w", err)
+	}
+
+	eh.fileLines++
+	return nil
+}
+
+// compact rewrites the history file with only the records currently held
+func (eh *EventHistory) compact() error {
+	var buf []byte
+	for _, record := range eh.records {
+		data, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("failed to marshal event record: %w", err)
+		}
+		buf = append(buf, data...)
+		buf = append(buf, '\n')
+	}
+
+	tmp := eh.config.File + ".tmp"
+	if err := os.WriteFile(tmp, buf, 0644); err != nil {
+		return fmt.Errorf("failed to write event history file: %w", err)
+	}
+	if err := os.Rename(tmp, eh.config.File); err != nil {
+		return fmt.Errorf("failed to replace event history file: %w", err)
+	}
+
+	eh.fileLines = len(eh.records)
+	eh.logger.Debugf("Compacted event history file %s", eh.config.File)
+	return nil
+}
+
+// load reads persisted records from the history file
+func (eh *EventHistory) load() error {
+	f, err := os.Open(eh.config.File)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// File doesn't exist, that's okay
+			return nil
+		}
+		return fmt.Errorf("failed to open event history file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var record EventRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			eh.logger.WithError(err).Warn("Skipping corrupt event history record")
+			continue
+		}
+
+		eh.records = append(eh.records, &record)
+		if record.Seq >= eh.nextSeq {
+			eh.nextSeq = record.Seq + 1
+		}
+		eh.fileLines++
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read event history file: %w", err)
+	}
+
+	if len(eh.records) > eh.config.Capacity {
+		eh.records = eh.records[len(eh.records)-eh.config.Capacity:]
+	}
+
+	eh.logger.Infof("Loaded %d event history records from %s", len(eh.records), eh.config.File)
+	return nil
+}
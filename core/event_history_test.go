@@ -0,0 +1,304 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fillHistory records n events alternating between message and system types,
+// one second apart starting at base
+func fillHistory(t *testing.T, eh *EventHistory, base time.Time, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		eventType := EventTypeMessage
+		if i%2 == 1 {
+			eventType = EventTypeSystem
+		}
+		eh.Record(&EventRecord{Event: &Event{
+			ID:        fmt.Sprintf("ev-%d", i),
+			Type:      eventType,
+			Timestamp: base.Add(time.Duration(i) * time.Second),
+			Metadata:  map[string]interface{}{"session_id": fmt.Sprintf("s%d", i%3)},
+		}})
+	}
+}
+
+func eventIDs(records []*EventRecord) []string {
+	ids := make([]string, len(records))
+	for i, record := range records {
+		ids[i] = record.Event.ID
+	}
+	return ids
+}
+
+func TestEventHistoryQuery(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	eh, err := NewEventHistory(testLogger(), &EventHistoryConfig{Capacity: 10})
+	if err != nil {
+		t.Fatalf("NewEventHistory: %v", err)
+	}
+	fillHistory(t, eh, base, 6)
+
+	tests := []struct {
+		name  string
+		query EventHistoryQuery
+		want  []string
+	}{
+		{"all newest first", EventHistoryQuery{}, []string{"ev-5", "ev-4", "ev-3", "ev-2", "ev-1", "ev-0"}},
+		{"by type", EventHistoryQuery{Types: []EventType{EventTypeSystem}}, []string{"ev-5", "ev-3", "ev-1"}},
+		{"several types", EventHistoryQuery{Types: []EventType{EventTypeSystem, EventTypeMessage}, Limit: 2}, []string{"ev-5", "ev-4"}},
+		{"since", EventHistoryQuery{Since: base.Add(4 * time.Second)}, []string{"ev-5", "ev-4"}},
+		{"until", EventHistoryQuery{Until: base.Add(1 * time.Second)}, []string{"ev-1", "ev-0"}},
+		{"time range", EventHistoryQuery{Since: base.Add(2 * time.Second), Until: base.Add(3 * time.Second)}, []string{"ev-3", "ev-2"}},
+		{"metadata key", EventHistoryQuery{MetadataKey: "session_id"}, []string{"ev-5", "ev-4", "ev-3", "ev-2", "ev-1", "ev-0"}},
+		{"metadata value", EventHistoryQuery{MetadataKey: "session_id", MetadataValue: "s1"}, []string{"ev-4", "ev-1"}},
+		{"missing metadata key", EventHistoryQuery{MetadataKey: "user"}, []string{}},
+		{"cursor", EventHistoryQuery{Cursor: "3"}, []string{"ev-1", "ev-0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := eh.Query(tt.query)
+			if err != nil {
+				t.Fatalf("Query: %v", err)
+			}
+			if got := eventIDs(page.Events); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("events = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := eh.Query(EventHistoryQuery{Cursor: "abc"}); err == nil {
+		t.Error("Query accepted an invalid cursor")
+	}
+}
+
+func TestEventHistoryPagination(t *testing.T) {
+	eh, _ := NewEventHistory(testLogger(), &EventHistoryConfig{Capacity: 10})
+	fillHistory(t, eh, time.Now(), 5)
+
+	var pages [][]string
+	query := EventHistoryQuery{Limit: 2}
+	for {
+		page, err := eh.Query(query)
+		if err != nil {
+			t.Fatalf("Query: %v", err)
+		}
+		pages = append(pages, eventIDs(page.Events))
+		if page.NextCursor == "" {
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+
+	want := [][]string{{"ev-4", "ev-3"}, {"ev-2", "ev-1"}, {"ev-0"}}
+	if fmt.Sprint(pages) != fmt.Sprint(want) {
+		t.Errorf("pages = %v, want %v", pages, want)
+	}
+}
+
+func TestEventHistoryCapacity(t *testing.T) {
+	eh, _ := NewEventHistory(testLogger(), &EventHistoryConfig{Capacity: 3})
+	fillHistory(t, eh, time.Now(), 5)
+
+	if eh.Len() != 3 {
+		t.Fatalf("Len = %d, want 3", eh.Len())
+	}
+	page, _ := eh.Query(EventHistoryQuery{})
+	if got := eventIDs(page.Events); fmt.Sprint(got) != "[ev-4 ev-3 ev-2]" {
+		t.Errorf("events = %v, want the three newest", got)
+	}
+}
+
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open %s: %v", path, err)
+	}
+	defer f.Close()
+	n := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		n++
+	}
+	return n
+}
+
+func TestEventHistoryPersistence(t *testing.T) {
+	tests := []struct {
+		name      string
+		capacity  int
+		records   int
+		wantLines int
+		wantLen   int
+	}{
+		{name: "appends below the compaction threshold", capacity: 5, records: 4, wantLines: 4, wantLen: 4},
+		{name: "compacts at twice the capacity", capacity: 3, records: 7, wantLines: 3, wantLen: 3},
+		{name: "appends after compaction", capacity: 3, records: 9, wantLines: 5, wantLen: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "history", "events.jsonl")
+			config := &EventHistoryConfig{Capacity: tt.capacity, File: file}
+			eh, err := NewEventHistory(testLogger(), config)
+			if err != nil {
+				t.Fatalf("NewEventHistory: %v", err)
+			}
+			fillHistory(t, eh, time.Now(), tt.records)
+
+			if got := countLines(t, file); got != tt.wantLines {
+				t.Errorf("file has %d lines, want %d", got, tt.wantLines)
+			}
+
+			reloaded, err := NewEventHistory(testLogger(), &EventHistoryConfig{Capacity: tt.capacity, File: file})
+			if err != nil {
+				t.Fatalf("reload: %v", err)
+			}
+			if reloaded.Len() != tt.wantLen {
+				t.Errorf("reloaded Len = %d, want %d", reloaded.Len(), tt.wantLen)
+			}
+			page, _ := reloaded.Query(EventHistoryQuery{Limit: 1})
+			if want := fmt.Sprintf("ev-%d", tt.records-1); page.Events[0].Event.ID != want {
+				t.Errorf("newest reloaded event = %s, want %s", page.Events[0].Event.ID, want)
+			}
+
+			// Sequence numbers continue after a reload so cursors stay valid
+			reloaded.Record(&EventRecord{Event: &Event{ID: "after"}})
+			page, _ = reloaded.Query(EventHistoryQuery{Limit: 1})
+			if page.Events[0].Seq != uint64(tt.records+1) {
+				t.Errorf("Seq after reload = %d, want %d", page.Events[0].Seq, tt.records+1)
+			}
+		})
+	}
+}
+
+func TestEventHistoryLoadSkipsCorruptLines(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "events.jsonl")
+	content := `{"seq":1,"event":{"id":"ev-1","type":"message"}}
+not json
+{"seq":2,"event":{"id":"ev-2","type":"message"}}
+`
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	eh, err := NewEventHistory(testLogger(), &EventHistoryConfig{File: file})
+	if err != nil {
+		t.Fatalf("NewEventHistory: %v", err)
+	}
+	if eh.Len() != 2 {
+		t.Errorf("Len = %d, want 2", eh.Len())
+	}
+}
+
+func TestEventLoopRecordsHistory(t *testing.T) {
+	el := startTestLoop(t, nil, nil)
+	eh, _ := NewEventHistory(testLogger(), nil)
+	el.SetHistory(eh)
+
+	el.RegisterHandler(&funcEventHandler{types: []EventType{EventTypeMessage}})
+	el.RegisterHandler(&funcEventHandler{types: []EventType{EventTypeMessage}, handle: func(ctx context.Context, event *Event) error {
+		return errors.New("boom")
+	}})
+
+	tests := []struct {
+		name         string
+		eventType    EventType
+		wantHandled  bool
+		wantHandlers int
+		wantErrors   int
+	}{
+		{name: "handled with one failure", eventType: EventTypeMessage, wantHandled: true, wantHandlers: 2, wantErrors: 1},
+		{name: "unhandled", eventType: EventTypeCron, wantHandled: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := &Event{Type: tt.eventType}
+			if err := el.Emit(event); err != nil {
+				t.Fatalf("Emit: %v", err)
+			}
+
+			var record *EventRecord
+			waitFor(t, 2*time.Second, "history record", func() bool {
+				page, _ := eh.Query(EventHistoryQuery{Types: []EventType{tt.eventType}, Limit: 1})
+				if len(page.Events) == 1 && page.Events[0].Event.ID == event.ID {
+					record = page.Events[0]
+					return true
+				}
+				return false
+			})
+
+			if record.Handled != tt.wantHandled {
+				t.Errorf("Handled = %v, want %v", record.Handled, tt.wantHandled)
+			}
+			if len(record.Handlers) != tt.wantHandlers {
+				t.Fatalf("%d handler records, want %d", len(record.Handlers), tt.wantHandlers)
+			}
+			errs := 0
+			for _, h := range record.Handlers {
+				if h.Handler == "" {
+					t.Error("handler record has no name")
+				}
+				if h.Error != "" {
+					errs++
+				}
+			}
+			if errs != tt.wantErrors {
+				t.Errorf("%d failed handlers, want %d", errs, tt.wantErrors)
+			}
+		})
+	}
+}
+
+func TestParseEventHistoryQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		want    EventHistoryQuery
+		wantErr bool
+	}{
+		{
+			name: "types repeated and comma separated",
+			url:  "/api/v1/events?type=message,%20system&type=cron",
+			want: EventHistoryQuery{Types: []EventType{EventTypeMessage, EventTypeSystem, EventTypeCron}},
+		},
+		{
+			name: "metadata, cursor and limit",
+			url:  "/api/v1/events?metadata_key=session_id&metadata_value=s1&cursor=7&limit=20",
+			want: EventHistoryQuery{MetadataKey: "session_id", MetadataValue: "s1", Cursor: "7", Limit: 20},
+		},
+		{
+			name: "time range",
+			url:  "/api/v1/events?since=2024-01-01T00:00:00Z&until=2024-01-02T00:00:00Z",
+			want: EventHistoryQuery{
+				Since: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+				Until: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{name: "invalid since", url: "/api/v1/events?since=yesterday", wantErr: true},
+		{name: "invalid until", url: "/api/v1/events?until=1", wantErr: true},
+		{name: "negative limit", url: "/api/v1/events?limit=-1", wantErr: true},
+		{name: "non numeric limit", url: "/api/v1/events?limit=ten", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseEventHistoryQuery(httptest.NewRequest("GET", tt.url, nil))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if fmt.Sprintf("%+v", got) != fmt.Sprintf("%+v", tt.want) {
+				t.Errorf("query = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,327 @@
+package core
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultJournalCompactThreshold 确认多少条记录后压缩日志文件
+const DefaultJournalCompactThreshold = 1000
+
+const (
+	journalOpEmit = "emit"
+	journalOpAck  = "ack"
+)
+
+// journalRecord 日志文件中的一行记录。
+// 记录按Seq匹配，同一ID的事件可以多次入队（例如重新投递的死信）。
+// Seq从1开始，没有Seq的记录视为损坏。
+type journalRecord struct {
+	Op    string `json:"op"`
+	Seq   uint64 `json:"seq,omitempty"`
+	ID    string `json:"id"`
+	Event *Event `json:"event,omitempty"`
+}
+
+// journalEntry 尚未确认的事件
+type journalEntry struct {
+	seq   uint64
+	event *Event
+}
+
+// eventJournal 事件预写日志。
+// Emit在事件入队前追加emit记录，事件处理完成后追加ack记录；
+// 重启时重放所有未确认的事件。确认的记录累积到阈值后压缩日志文件。
+type eventJournal struct {
+	path             string
+	sync             bool
+	compactThreshold int
+	logger           *logrus.Logger
+
+	mu      sync.Mutex
+	file    *os.File
+	pending map[uint64]*journalEntry
+	nextSeq uint64 // 下一个emit记录的序号，从1开始
+	acked   int    // 上次压缩后确认的记录数
+}
+
+// openEventJournal 打开日志文件并返回需要重放的未确认事件（按写入顺序）
+func openEventJournal(path string, syncWrites bool, compactThreshold int, logger *logrus.Logger) (*eventJournal, []*Event, error) {
+	if compactThreshold <= 0 {
+		compactThreshold = DefaultJournalCompactThreshold
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, nil, fmt.Errorf("failed to create journal directory: %w", err)
+	}
+
+	j := &eventJournal{
+		path:             path,
+		sync:             syncWrites,
+		compactThreshold: compactThreshold,
+		logger:           logger,
+		pending:          make(map[uint64]*journalEntry),
+		nextSeq:          1,
+	}
+
+	if err := j.load(); err != nil {
+		return nil, nil, err
+	}
+
+	// 重写日志文件，丢弃已确认的记录
+	if err := j.compactLocked(); err != nil {
+		return nil, nil, err
+	}
+
+	replay := j.pendingEvents()
+	if len(replay) > 0 {
+		logger.Infof("Replaying %d unacknowledged events from %s", len(replay), path)
+	}
+	return j, replay, nil
+}
+
+// append 写入一条emit记录，并把记录的序号保存在事件中供ack使用
+func (j *eventJournal) append(event *Event) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	seq := j.nextSeq
+	if err := j.writeLocked(journalRecord{Op: journalOpEmit, Seq: seq, ID: event.ID, Event: event}); err != nil {
+		return err
+	}
+
+	event.journalSeq = seq
+	j.pending[seq] = &journalEntry{seq: seq, event: event}
+	j.nextSeq++
+	return nil
+}
+
+// ack 确认事件已处理完成
+func (j *eventJournal) ack(event *Event) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	seq := event.journalSeq
+	if _, ok := j.pending[seq]; !ok {
+		return nil
+	}
+
+	if err := j.writeLocked(journalRecord{Op: journalOpAck, Seq: seq, ID: event.ID}); err != nil {
+		return err
+	}
+
+	delete(j.pending, seq)
+	j.acked++
+	if j.acked >= j.compactThreshold {
+		return j.compactLocked()
+	}
+	return nil
+}
+
+// Len 返回尚未确认的事件数量
+func (j *eventJournal) Len() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return len(j.pending)
+}
+
+// close 关闭日志文件
+func (j *eventJournal) close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
+
+// writeLocked 追加一条记录，调用者需持有j.mu
+func (j *eventJournal) writeLocked(record journalRecord) error {
+	if j.file == nil {
+		return fmt.Errorf("event journal is closed")
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal journal record: %w", err)
+	}
+
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	if j.sync {
+		if err := j.file.Sync(); err != nil {
+			return fmt.Errorf("failed to sync journal: %w", err)
+		}
+	}
+	return nil
+}
+
+// compactLocked 用未确认的事件重写日志文件，调用者需持有j.mu。
+// 新文件在替换前就已打开用于追加，任何一步失败时都继续使用原来的文件。
+func (j *eventJournal) compactLocked() error {
+	tmp := j.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create journal: %w", err)
+	}
+	discard := func() {
+		f.Close()
+		os.Remove(tmp)
+	}
+
+	w := bufio.NewWriter(f)
+	for _, entry := range j.pendingEntries() {
+		event := entry.event
+		data, err := json.Marshal(journalRecord{Op: journalOpEmit, Seq: entry.seq, ID: event.ID, Event: event})
+		if err != nil {
+			discard()
+			return fmt.Errorf("failed to marshal journal record: %w", err)
+		}
+		w.Write(data)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		discard()
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		discard()
+		return fmt.Errorf("failed to sync journal: %w", err)
+	}
+	if err := os.Rename(tmp, j.path); err != nil {
+		discard()
+		return fmt.Errorf("failed to replace journal: %w", err)
+	}
+
+	if j.file != nil {
+		j.file.Close()
+	}
+	j.file = f
+	j.acked = 0
+	j.logger.Debugf("Compacted event journal %s, %d pending events", j.path, len(j.pending))
+	return nil
+}
+
+// pendingEntries 按写入顺序返回未确认的记录
+func (j *eventJournal) pendingEntries() []*journalEntry {
+	entries := make([]*journalEntry, 0, len(j.pending))
+	for _, entry := range j.pending {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(a, b int) bool {
+		return entries[a].seq < entries[b].seq
+	})
+	return entries
+}
+
+// pendingEvents 按写入顺序返回未确认的事件
+func (j *eventJournal) pendingEvents() []*Event {
+	entries := j.pendingEntries()
+	events := make([]*Event, len(entries))
+	for i, entry := range entries {
+		events[i] = entry.event
+	}
+	return events
+}
+
+// load 读取日志文件，重建未确认的事件集合
+func (j *eventJournal) load() error {
+	f, err := os.Open(j.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// File doesn't exist, that's okay
+			return nil
+		}
+		return fmt.Errorf("failed to open journal: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var record journalRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			// 崩溃时最后一行可能只写了一半
+			j.logger.WithError(err).Warn("Skipping corrupt journal record")
+			continue
+		}
+		if record.Seq == 0 {
+			j.logger.WithField("event_id", record.ID).Warn("Skipping corrupt journal record without sequence number")
+			continue
+		}
+
+		switch record.Op {
+		case journalOpEmit:
+			if record.Event == nil {
+				continue
+			}
+			seq := record.Seq
+			if seq >= j.nextSeq {
+				j.nextSeq = seq + 1
+			}
+			record.Event.journalSeq = seq
+			j.pending[seq] = &journalEntry{seq: seq, event: record.Event}
+		case journalOpAck:
+			delete(j.pending, record.Seq)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read journal: %w", err)
+	}
+	return nil
+}
+
+// journalEmit 将事件写入预写日志，没有ID的事件会被分配ID
+func (el *EventLoop) journalEmit(event *Event) error {
+	if el.journal == nil {
+		return nil
+	}
+	if event.ID == "" {
+		event.ID = GenerateMessageID()
+	}
+	if err := el.journal.append(event); err != nil {
+		el.logger.WithError(err).WithField("event_id", event.ID).Error("Failed to journal event")
+		return err
+	}
+	return nil
+}
+
+// journalAck 在预写日志中确认事件
+func (el *EventLoop) journalAck(event *Event) {
+	if el.journal == nil {
+		return
+	}
+	if err := el.journal.ack(event); err != nil {
+		el.logger.WithError(err).WithField("event_id", event.ID).Warn("Failed to acknowledge journaled event")
+	}
+}
+
+// runReplay 将启动时未确认的事件重新放入队列
+func (el *EventLoop) runReplay() {
+	defer el.wg.Done()
+
+	replay := el.replay
+	el.replay = nil
+	for _, event := range replay {
+		if err := el.queueFor(event).push(el.ctx, event); err != nil {
+			return
+		}
+		el.publishEmitted(event)
+	}
+	el.logger.Infof("Replayed %d journaled events", len(replay))
+}
@@ -0,0 +1,299 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func openTestJournal(t *testing.T, path string, threshold int) (*eventJournal, []*Event) {
+	t.Helper()
+	j, replay, err := openEventJournal(path, false, threshold, testLogger())
+	if err != nil {
+		t.Fatalf("openEventJournal: %v", err)
+	}
+	t.Cleanup(func() { j.close() })
+	return j, replay
+}
+
+func replayIDs(events []*Event) []string {
+	ids := make([]string, len(events))
+	for i, event := range events {
+		ids[i] = event.ID
+	}
+	return ids
+}
+
+func TestEventJournalReplay(t *testing.T) {
+	tests := []struct {
+		name       string
+		emit       []string
+		ack        []int // indexes into emit
+		wantReplay []string
+	}{
+		{name: "empty", wantReplay: []string{}},
+		{name: "all acknowledged", emit: []string{"a", "b"}, ack: []int{0, 1}, wantReplay: []string{}},
+		{name: "pending in emit order", emit: []string{"a", "b", "c", "d"}, ack: []int{2, 0}, wantReplay: []string{"b", "d"}},
+		{name: "duplicate ID acknowledged by seq", emit: []string{"a", "x", "a"}, ack: []int{2}, wantReplay: []string{"a", "x"}},
+		{name: "both duplicates acknowledged", emit: []string{"a", "a"}, ack: []int{1, 0}, wantReplay: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "journal", "events.log")
+			j, replay := openTestJournal(t, path, 0)
+			if len(replay) != 0 {
+				t.Fatalf("new journal replays %v", replayIDs(replay))
+			}
+
+			events := make([]*Event, len(tt.emit))
+			for i, id := range tt.emit {
+				events[i] = &Event{ID: id, Type: EventTypeMessage, Data: fmt.Sprintf("payload-%d", i)}
+				if err := j.append(events[i]); err != nil {
+					t.Fatalf("append: %v", err)
+				}
+			}
+			for _, i := range tt.ack {
+				if err := j.ack(events[i]); err != nil {
+					t.Fatalf("ack: %v", err)
+				}
+			}
+			if j.Len() != len(tt.wantReplay) {
+				t.Errorf("Len = %d, want %d", j.Len(), len(tt.wantReplay))
+			}
+			j.close()
+
+			reopened, replay := openTestJournal(t, path, 0)
+			if got := replayIDs(replay); fmt.Sprint(got) != fmt.Sprint(tt.wantReplay) {
+				t.Fatalf("replay = %v, want %v", got, tt.wantReplay)
+			}
+			// Opening compacts the file down to the pending events
+			if got := countLines(t, path); got != len(tt.wantReplay) {
+				t.Errorf("journal has %d lines after reopening, want %d", got, len(tt.wantReplay))
+			}
+
+			// Replayed events can be acknowledged and new ones get fresh sequence numbers
+			for _, event := range replay {
+				if err := reopened.ack(event); err != nil {
+					t.Fatalf("ack replayed: %v", err)
+				}
+			}
+			fresh := &Event{ID: "fresh"}
+			if err := reopened.append(fresh); err != nil {
+				t.Fatalf("append: %v", err)
+			}
+			for _, event := range replay {
+				if fresh.journalSeq <= event.journalSeq {
+					t.Errorf("fresh seq %d not after replayed seq %d", fresh.journalSeq, event.journalSeq)
+				}
+			}
+			if reopened.Len() != 1 {
+				t.Errorf("Len = %d, want only the fresh event", reopened.Len())
+			}
+		})
+	}
+}
+
+func TestEventJournalReplayKeepsEventData(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.log")
+	j, _ := openTestJournal(t, path, 0)
+	j.append(&Event{
+		ID:            "a",
+		Type:          EventTypeSystem,
+		Data:          "payload",
+		Priority:      PriorityHigh,
+		CorrelationID: "req-1",
+		Metadata:      map[string]interface{}{"session_id": "s1"},
+	})
+	j.close()
+
+	_, replay := openTestJournal(t, path, 0)
+	if len(replay) != 1 {
+		t.Fatalf("replay = %v, want one event", replayIDs(replay))
+	}
+	event := replay[0]
+	if event.Type != EventTypeSystem || event.Data != "payload" || event.Priority != PriorityHigh ||
+		event.CorrelationID != "req-1" || event.Metadata["session_id"] != "s1" {
+		t.Errorf("replayed event = %+v", event)
+	}
+}
+
+func TestEventJournalCompaction(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int
+		emit      int
+		ack       int
+		wantLines int
+	}{
+		{name: "below threshold appends", threshold: 5, emit: 4, ack: 3, wantLines: 7},
+		{name: "at threshold compacts", threshold: 3, emit: 4, ack: 3, wantLines: 1},
+		{name: "appends after compaction", threshold: 2, emit: 5, ack: 3, wantLines: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "events.log")
+			j, _ := openTestJournal(t, path, tt.threshold)
+
+			events := make([]*Event, tt.emit)
+			for i := range events {
+				events[i] = &Event{ID: fmt.Sprintf("e%d", i)}
+				j.append(events[i])
+			}
+			for i := 0; i < tt.ack; i++ {
+				j.ack(events[i])
+			}
+
+			if got := countLines(t, path); got != tt.wantLines {
+				t.Errorf("journal has %d lines, want %d", got, tt.wantLines)
+			}
+			if j.Len() != tt.emit-tt.ack {
+				t.Errorf("Len = %d, want %d", j.Len(), tt.emit-tt.ack)
+			}
+			if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+				t.Error("temporary compaction file left behind")
+			}
+		})
+	}
+}
+
+func TestEventJournalLoad(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		wantReplay []string
+	}{
+		{
+			name: "records without seq are corrupt",
+			content: `{"op":"emit","id":"a","event":{"id":"a","type":"message"}}
+{"op":"emit","seq":1,"id":"b","event":{"id":"b","type":"message"}}
+{"op":"emit","seq":2,"id":"c","event":{"id":"c","type":"message"}}
+{"op":"ack","id":"b"}
+`,
+			wantReplay: []string{"b", "c"},
+		},
+		{
+			name: "torn last line",
+			content: `{"op":"emit","seq":1,"id":"a","event":{"id":"a","type":"message"}}
+{"op":"emit","seq":2,"id":"b","event":{"id":"b","ty`,
+			wantReplay: []string{"a"},
+		},
+		{
+			name: "emit without event",
+			content: `{"op":"emit","seq":1,"id":"a"}
+{"op":"emit","seq":2,"id":"b","event":{"id":"b","type":"message"}}
+`,
+			wantReplay: []string{"b"},
+		},
+		{
+			name: "ack by seq",
+			content: `{"op":"emit","seq":4,"id":"a","event":{"id":"a","type":"message"}}
+{"op":"emit","seq":7,"id":"a","event":{"id":"a","type":"message"}}
+{"op":"ack","seq":4,"id":"a"}
+`,
+			wantReplay: []string{"a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "events.log")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, replay := openTestJournal(t, path, 0)
+			if got := replayIDs(replay); fmt.Sprint(got) != fmt.Sprint(tt.wantReplay) {
+				t.Errorf("replay = %v, want %v", got, tt.wantReplay)
+			}
+		})
+	}
+}
+
+func TestEventLoopJournalSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.log")
+	config := func() *EventLoopConfig {
+		return &EventLoopConfig{Workers: 1, JournalFile: path, JournalSync: true}
+	}
+
+	first := startTestLoop(t, nil, config())
+	done := make(chan struct{}, 1)
+	first.RegisterHandler(&funcEventHandler{handle: func(ctx context.Context, event *Event) error {
+		if event.ID == "done" {
+			done <- struct{}{}
+			return nil
+		}
+		// Still running when the loop stops
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+
+	for _, id := range []string{"done", "interrupted", "queued"} {
+		if err := first.Emit(&Event{ID: id, Type: EventTypeMessage}); err != nil {
+			t.Fatalf("Emit %s: %v", id, err)
+		}
+	}
+	<-done
+	waitFor(t, time.Second, "acknowledgement", func() bool { return first.GetJournalPending() == 2 })
+	first.Stop()
+
+	second := NewEventLoopWithConfig(context.Background(), testLogger(), config())
+	if got := second.GetJournalPending(); got != 2 {
+		t.Errorf("GetJournalPending before replay = %d, want 2", got)
+	}
+
+	var mu sync.Mutex
+	var processed []string
+	second.RegisterHandler(&funcEventHandler{handle: func(ctx context.Context, event *Event) error {
+		mu.Lock()
+		processed = append(processed, event.ID)
+		mu.Unlock()
+		return nil
+	}})
+	emitted, unsubscribe := second.Subscribe(nil)
+	defer unsubscribe()
+
+	if err := second.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(second.Stop)
+
+	waitFor(t, 2*time.Second, "replayed events", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(processed) == 2
+	})
+	mu.Lock()
+	if got := strings.Join(processed, ","); got != "interrupted,queued" {
+		t.Errorf("replayed %s, want interrupted,queued", got)
+	}
+	mu.Unlock()
+	waitFor(t, time.Second, "replayed acknowledgements", func() bool { return second.GetJournalPending() == 0 })
+
+	// Replayed events are announced to subscribers like newly emitted ones
+	for _, want := range []string{"interrupted", "queued"} {
+		select {
+		case event := <-emitted:
+			if event.ID != want {
+				t.Errorf("emitted %s, want %s", event.ID, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("replayed event %s not published", want)
+		}
+	}
+}
+
+func TestEventLoopJournalAcksRejectedEvents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.log")
+	el, _, _ := saturatedLoop(t, &EventLoopConfig{MaxQueueSize: 1, JournalFile: path})
+
+	before := el.GetJournalPending()
+	if err := el.Emit(&Event{Type: EventTypeMessage}); err == nil {
+		t.Fatal("Emit succeeded on a full queue")
+	}
+	if got := el.GetJournalPending(); got != before {
+		t.Errorf("GetJournalPending = %d after a rejected emit, want %d", got, before)
+	}
+}
@@ -2,7 +2,11 @@ package core
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -26,50 +30,293 @@ type Event struct {
 	Timestamp time.Time              `json:"timestamp"`
 	Data      interface{}            `json:"data"`
 	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	Priority  EventPriority          `json:"priority,omitempty"`
+	NotBefore *time.Time             `json:"not_before,omitempty"` // 设置后事件在该时间之前不会被处理
+
+	CorrelationID string `json:"correlation_id,omitempty"` // 同一用户请求派生的所有事件、消息和工具调用共享该ID
+	CausationID   string `json:"causation_id,omitempty"`   // 直接导致该事件的事件或消息ID
+
+	journalSeq uint64 // 预写日志中emit记录的序号，未写入日志时为0
 }
 
-// EventHandler 定义事件处理器接口
+// EventHandler 定义事件处理器接口。Handle必须在ctx结束后尽快返回
 type EventHandler interface {
 	Handle(ctx context.Context, event *Event) error
 	CanHandle(eventType EventType) bool
 }
 
+// EventCompletionHandler 可选接口，处理器的最后一次尝试结束后调用一次，err为最终结果
+type EventCompletionHandler interface {
+	EventCompleted(event *Event, err error)
+}
+
+// eventHandlerEntry 已注册的事件处理器
+type eventHandlerEntry struct {
+	id      HandlerID
+	name    string // 注册时的处理器类型名，替换处理器时保留以便死信重新投递
+	handler EventHandler
+	stats   *handlerStats
+}
+
+// EventLoopConfig 事件循环配置
+type EventLoopConfig struct {
+	MaxQueueSize    int    `yaml:"max_queue_size"`
+	Workers         int    `yaml:"workers"`          // 并发worker数量
+	PartitionKey    string `yaml:"partition_key"`    // 用于保序的元数据键，缺省时按事件类型保序
+	StarvationLimit int    `yaml:"starvation_limit"` // 高优先级连续处理的最大次数
+
+	OverflowPolicy OverflowPolicy `yaml:"overflow_policy"` // 队列已满时Emit的处理策略，默认reject
+	BlockTimeout   time.Duration  `yaml:"block_timeout"`   // block策略下的最长等待时间
+	SpillFile      string         `yaml:"spill_file"`      // spill策略使用的溢出文件
+
+	JournalFile             string `yaml:"journal_file"`              // 预写日志文件，为空时不启用
+	JournalSync             bool   `yaml:"journal_sync"`              // 每次写入后fsync
+	JournalCompactThreshold int    `yaml:"journal_compact_threshold"` // 确认多少条记录后压缩日志
+
+	Retry          *RetryPolicy  `yaml:"retry"`           // 处理器失败时的默认重试策略，为空时使用DefaultRetryPolicy
+	HandlerTimeout time.Duration `yaml:"handler_timeout"` // 处理器单次执行的超时时间，为空时使用DefaultHandlerTimeout
+
+	DelayFile string `yaml:"delay_file"` // 延迟事件的持久化文件，为空时只保存在内存中
+}
+
+// DefaultPartitionKey 默认的分区元数据键
+const DefaultPartitionKey = "session_id"
+
 // EventLoop 事件循环核心
 type EventLoop struct {
 	ctx       context.Context
 	cancel    context.CancelFunc
-	events    chan *Event
-	handlers  []EventHandler
+	handlers  []*eventHandlerEntry
+	handlerID HandlerID // 最近分配的处理器句柄
 	wg        sync.WaitGroup
 	logger    *logrus.Logger
 	mu        sync.RWMutex
 	running   bool
-	maxQueue  int
+
+	subscribers       *subscribers
+	subscriberDropped atomic.Int64
+
+	history     *EventHistory
+	deadLetters *DeadLetterStore
+	retry       *RetryPolicy
+	tracer      *Tracer
+
+	handlerTimeout time.Duration
+
+	// 同一分区的事件总是放入同一个worker的队列，从而保证顺序；
+	// 一个分区处理缓慢只会占满自己的队列，不影响其他worker
+	workers      []*priorityLanes
+	partitionKey string
+	inFlight     atomic.Int64
+
+	overflow     OverflowPolicy
+	blockTimeout time.Duration
+	spill        *eventSpill
+	dropped      atomic.Int64
+
+	journal *eventJournal
+	replay  []*Event // 启动时需要重放的未确认事件
+
+	delayed *delayQueue
 }
 
 // NewEventLoop 创建新的事件循环
 func NewEventLoop(ctx context.Context, logger *logrus.Logger, maxQueueSize int) *EventLoop {
+	return NewEventLoopWithConfig(ctx, logger, &EventLoopConfig{MaxQueueSize: maxQueueSize})
+}
+
+// NewEventLoopWithConfig 根据配置创建新的事件循环
+func NewEventLoopWithConfig(ctx context.Context, logger *logrus.Logger, config *EventLoopConfig) *EventLoop {
+	if config == nil {
+		config = &EventLoopConfig{}
+	}
+	maxQueueSize := config.MaxQueueSize
 	if maxQueueSize <= 0 {
 		maxQueueSize = 1000
 	}
+	workers := config.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	partitionKey := config.PartitionKey
+	if partitionKey == "" {
+		partitionKey = DefaultPartitionKey
+	}
+	if logger == nil {
+		logger = logrus.New()
+	}
+	retry := config.Retry
+	if retry == nil {
+		retry = DefaultRetryPolicy()
+	}
+	handlerTimeout := config.HandlerTimeout
+	if handlerTimeout <= 0 {
+		handlerTimeout = DefaultHandlerTimeout
+	}
+	blockTimeout := config.BlockTimeout
+	if blockTimeout <= 0 {
+		blockTimeout = DefaultBlockTimeout
+	}
+	overflow := config.OverflowPolicy
+	if overflow == "" {
+		overflow = OverflowReject
+	}
+
+	var spill *eventSpill
+	if overflow == OverflowSpill {
+		var err error
+		if config.SpillFile == "" {
+			err = fmt.Errorf("spill file not configured")
+		} else {
+			spill, err = newEventSpill(config.SpillFile, logger)
+		}
+		if err != nil {
+			logger.WithError(err).Warn("Event spill unavailable, falling back to reject policy")
+			overflow = OverflowReject
+		}
+	}
 	
+	var journal *eventJournal
+	var replay []*Event
+	if config.JournalFile != "" {
+		var err error
+		journal, replay, err = openEventJournal(config.JournalFile, config.JournalSync, config.JournalCompactThreshold, logger)
+		if err != nil {
+			logger.WithError(err).Warn("Event journal unavailable, queued events will not survive restarts")
+			journal, replay = nil, nil
+		}
+	}
+	
+	delayed, err := newDelayQueue(config.DelayFile, logger)
+	if err != nil {
+		logger.WithError(err).Warn("Delayed events file unavailable, delayed events will not survive restarts")
+		delayed, _ = newDelayQueue("", logger)
+	}
+
 	ctx, cancel := context.WithCancel(ctx)
+
+	// 每个worker拥有自己的队列，总容量与配置的队列大小相当，溢出策略按worker队列分别生效
+	workerQueueSize := maxQueueSize / workers
+	if workerQueueSize < 1 {
+		workerQueueSize = 1
+	}
+	workerQueues := make([]*priorityLanes, workers)
+	for i := range workerQueues {
+		workerQueues[i] = newPriorityLanes(workerQueueSize, config.StarvationLimit)
+	}
 	
 	return &EventLoop{
-		ctx:      ctx,
-		cancel:   cancel,
-		events:   make(chan *Event, maxQueueSize),
-		handlers: make([]EventHandler, 0),
-		logger:   logger,
-		maxQueue: maxQueueSize,
+		ctx:          ctx,
+		cancel:       cancel,
+		handlers:     make([]*eventHandlerEntry, 0),
+		logger:       logger,
+		workers:      workerQueues,
+		partitionKey: partitionKey,
+		overflow:     overflow,
+		blockTimeout: blockTimeout,
+		spill:        spill,
+		journal:      journal,
+		replay:       replay,
+		delayed:      delayed,
+		subscribers:  newSubscribers(),
+		retry:        retry,
+
+		handlerTimeout: handlerTimeout,
+	}
+}
+
+// RegisterHandler 注册事件处理器，返回的句柄用于注销和替换
+func (el *EventLoop) RegisterHandler(handler EventHandler) HandlerID {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+
+	el.handlerID++
+	entry := &eventHandlerEntry{
+		id:      el.handlerID,
+		name:    handlerName(handler),
+		handler: handler,
+		stats:   &handlerStats{},
+	}
+	el.handlers = append(el.handlers, entry)
+	return entry.id
+}
+
+// UnregisterHandler 注销事件处理器，正在处理的事件不受影响，处理器不存在时返回false
+func (el *EventLoop) UnregisterHandler(id HandlerID) bool {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+
+	for i, entry := range el.handlers {
+		if entry.id == id {
+			handlers := make([]*eventHandlerEntry, 0, len(el.handlers)-1)
+			handlers = append(handlers, el.handlers[:i]...)
+			el.handlers = append(handlers, el.handlers[i+1:]...)
+			return true
+		}
 	}
+	return false
 }
 
-// RegisterHandler 注册事件处理器
-func (el *EventLoop) RegisterHandler(handler EventHandler) {
+// ReplaceHandler 原子地替换事件处理器，保留句柄、名称、执行顺序和调用统计
+func (el *EventLoop) ReplaceHandler(id HandlerID, handler EventHandler) error {
 	el.mu.Lock()
 	defer el.mu.Unlock()
-	el.handlers = append(el.handlers, handler)
+
+	for i, entry := range el.handlers {
+		if entry.id == id {
+			replacement := *entry
+			replacement.handler = handler
+			el.handlers[i] = &replacement
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %d", ErrHandlerNotRegistered, id)
+}
+
+// Handlers 返回所有已注册的事件处理器及其调用统计，按执行顺序排列
+func (el *EventLoop) Handlers() []HandlerInfo {
+	el.mu.RLock()
+	entries := append([]*eventHandlerEntry(nil), el.handlers...)
+	el.mu.RUnlock()
+
+	infos := make([]HandlerInfo, 0, len(entries))
+	for _, entry := range entries {
+		info := HandlerInfo{
+			ID:      entry.id,
+			Name:    entry.name,
+			Types:   []string{},
+			Dynamic: true,
+			Stats:   entry.stats.snapshot(),
+		}
+		for _, eventType := range knownEventTypes {
+			if entry.handler.CanHandle(eventType) {
+				info.Types = append(info.Types, string(eventType))
+			}
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// SetHistory 设置事件历史记录，处理过的事件及处理器结果会被记录
+func (el *EventLoop) SetHistory(history *EventHistory) {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	el.history = history
+}
+
+// History 获取事件历史记录，未设置时返回nil
+func (el *EventLoop) History() *EventHistory {
+	el.mu.RLock()
+	defer el.mu.RUnlock()
+	return el.history
+}
+
+// SetTracer 设置追踪器，处理过的事件会作为span记录
+func (el *EventLoop) SetTracer(tracer *Tracer) {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	el.tracer = tracer
 }
 
 // Start 启动事件循环
@@ -82,9 +329,20 @@ func (el *EventLoop) Start() error {
 	el.running = true
 	el.mu.Unlock()
 
-	el.logger.Info("Starting event loop")
-	el.wg.Add(1)
-	go el.run()
+	el.logger.WithField("workers", len(el.workers)).Info("Starting event loop")
+	el.wg.Add(1 + len(el.workers))
+	go el.runDelayed()
+	for _, queue := range el.workers {
+		go el.runWorker(queue)
+	}
+	if el.spill != nil {
+		el.wg.Add(1)
+		go el.runSpillDrain()
+	}
+	if len(el.replay) > 0 {
+		el.wg.Add(1)
+		go el.runReplay()
+	}
 
 	return nil
 }
@@ -100,88 +358,343 @@ func (el *EventLoop) Stop() {
 	el.mu.Unlock()
 
 	el.logger.Info("Stopping event loop")
+	// 不关闭队列通道，避免与并发的Emit竞争；run通过ctx退出
 	el.cancel()
-	close(el.events)
 	el.wg.Wait()
+	el.subscribers.closeAll()
+
+	if el.journal != nil {
+		if err := el.journal.close(); err != nil {
+			el.logger.WithError(err).Warn("Failed to close event journal")
+		}
+	}
 }
 
-// Emit 发送事件到事件循环
+// Emit 发送事件到事件循环，队列已满时按配置的溢出策略处理。
+// 设置了未来NotBefore的事件进入延迟队列，到期后再入队。
 func (el *EventLoop) Emit(event *Event) error {
-	el.mu.RLock()
-	if !el.running {
-		el.mu.RUnlock()
-		return ErrEventLoopNotRunning
+	if err := el.checkRunning(); err != nil {
+		return err
+	}
+	stampEvent(event)
+	if event.isDelayed(time.Now()) {
+		return el.emitDelayed(event)
+	}
+	return el.enqueue(event)
+}
+
+// enqueue 将事件放入队列，队列已满时按配置的溢出策略处理
+func (el *EventLoop) enqueue(event *Event) error {
+	// 先写入预写日志再入队
+	if err := el.journalEmit(event); err != nil {
+		return err
 	}
-	el.mu.RUnlock()
 
+	var err error
+	switch el.overflow {
+	case OverflowBlock:
+		ctx, cancel := context.WithTimeout(context.Background(), el.blockTimeout)
+		err = el.pushWait(ctx, event)
+		cancel()
+	case OverflowDropOldest:
+		err = el.emitDropOldest(event)
+	case OverflowSpill:
+		err = el.emitSpill(event)
+	default:
+		if !el.queueFor(event).tryPush(event) {
+			err = ErrEventQueueFull
+		}
+	}
+
+	if err != nil {
+		// 未入队的事件由调用者负责，不需要重放
+		el.journalAck(event)
+		return err
+	}
+	el.publishEmitted(event)
+	return nil
+}
+
+// EmitWait 发送事件，队列已满时阻塞直到有空间、ctx结束或事件循环停止
+func (el *EventLoop) EmitWait(ctx context.Context, event *Event) error {
+	if err := el.checkRunning(); err != nil {
+		return err
+	}
+	stampEvent(event)
+	if event.isDelayed(time.Now()) {
+		return el.emitDelayed(event)
+	}
+	if err := el.journalEmit(event); err != nil {
+		return err
+	}
+
+	if err := el.pushWait(ctx, event); err != nil {
+		el.journalAck(event)
+		return err
+	}
+	el.publishEmitted(event)
+	return nil
+}
+
+// pushWait 将事件放入队列，队列已满时阻塞直到有空间、ctx结束或事件循环停止
+func (el *EventLoop) pushWait(ctx context.Context, event *Event) error {
+	queue := el.queueFor(event)
 	select {
-	case el.events <- event:
+	case queue.slots <- struct{}{}:
+		queue.put(event)
 		return nil
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return ErrEmitTimeout
+		}
+		return ctx.Err()
 	case <-el.ctx.Done():
-		return el.ctx.Err()
-	default:
-		return ErrEventQueueFull
+		return ErrEventLoopNotRunning
 	}
 }
 
-// run 事件循环主运行函数
-func (el *EventLoop) run() {
-	defer el.wg.Done()
+// EmitWithTimeout 发送事件，队列已满时最多等待timeout，超时返回ErrEmitTimeout
+func (el *EventLoop) EmitWithTimeout(event *Event, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return el.EmitWait(ctx, event)
+}
 
-	for {
-		select {
-		case event, ok := <-el.events:
-			if !ok {
-				el.logger.Info("Event loop channel closed")
-				return
-			}
+// stampEvent 为事件分配ID，没有关联ID的事件作为新请求的起点
+func stampEvent(event *Event) {
+	if event.ID == "" {
+		event.ID = GenerateMessageID()
+	}
+	if event.CorrelationID == "" {
+		event.CorrelationID = event.ID
+	}
+}
 
-			// 处理事件
-			if err := el.handleEvent(event); err != nil {
-				el.logger.WithError(err).WithField("event_id", event.ID).
-					Error("Failed to handle event")
-			}
+// checkRunning 检查事件循环是否可以接收事件
+func (el *EventLoop) checkRunning() error {
+	el.mu.RLock()
+	running := el.running
+	el.mu.RUnlock()
+
+	if !running || el.ctx.Err() != nil {
+		return ErrEventLoopNotRunning
+	}
+	return nil
+}
+
+// runWorker 按顺序处理分配给该worker的事件
+func (el *EventLoop) runWorker(queue *priorityLanes) {
+	defer el.wg.Done()
 
-		case <-el.ctx.Done():
-			el.logger.Info("Event loop context cancelled")
+	for {
+		event, ok := queue.next(el.ctx)
+		if !ok {
 			return
 		}
+
+		el.inFlight.Add(1)
+		// 处理事件
+		record := el.handleEvent(event)
+		el.publishProcessed(record)
+		if el.ctx.Err() == nil {
+			el.journalAck(event)
+		}
+		el.inFlight.Add(-1)
+	}
+}
+
+// PartitionKey 返回事件的分区键，相同分区的事件按顺序处理
+func (el *EventLoop) PartitionKey(event *Event) string {
+	if value, ok := event.Metadata[el.partitionKey]; ok && value != nil {
+		return fmt.Sprintf("%v", value)
 	}
+	return string(event.Type)
+}
+
+// workerIndex 计算事件对应的worker
+func (el *EventLoop) workerIndex(event *Event) int {
+	if len(el.workers) == 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(el.PartitionKey(event)))
+	return int(h.Sum32() % uint32(len(el.workers)))
+}
+
+// queueFor 返回事件所属分区的worker队列
+func (el *EventLoop) queueFor(event *Event) *priorityLanes {
+	return el.workers[el.workerIndex(event)]
 }
 
-// handleEvent 处理单个事件
-func (el *EventLoop) handleEvent(event *Event) error {
+// handleEvent 处理单个事件，返回各处理器的结果
+func (el *EventLoop) handleEvent(event *Event) *EventRecord {
 	el.mu.RLock()
-	handlers := make([]EventHandler, len(el.handlers))
+	handlers := make([]*eventHandlerEntry, len(el.handlers))
 	copy(handlers, el.handlers)
+	history := el.history
+	deadLetters := el.deadLetters
+	tracer := el.tracer
 	el.mu.RUnlock()
 
-	var handled bool
-	for _, handler := range handlers {
-		if handler.CanHandle(event.Type) {
-			if err := handler.Handle(el.ctx, event); err != nil {
-				el.logger.WithError(err).WithField("handler", handler).
+	// 重新投递的死信只交给之前失败的处理器
+	target, _ := event.Metadata[MetadataTargetHandler].(string)
+
+	start := time.Now()
+	records := make([]HandlerRecord, 0, len(handlers))
+	// matched表示有处理器接收了该事件，处理器失败不等于没有处理器
+	var matched bool
+	for _, entry := range handlers {
+		name := entry.name
+		if target != "" && name != target {
+			continue
+		}
+		if entry.handler.CanHandle(event.Type) {
+			matched = true
+			handlerStart := time.Now()
+			attempts, err := el.handleWithRetry(entry.handler, event)
+			entry.stats.observe(handlerStart, err)
+			if completer, ok := entry.handler.(EventCompletionHandler); ok {
+				completer.EventCompleted(event, err)
+			}
+			record := HandlerRecord{
+				Handler:  name,
+				Duration: time.Since(handlerStart),
+				Attempts: attempts,
+			}
+			if err != nil {
+				record.Error = err.Error()
+			}
+			var panicErr *HandlerPanicError
+			if errors.As(err, &panicErr) {
+				record.Stack = panicErr.Stack
+			}
+			records = append(records, record)
+
+			if err != nil {
+				logEntry := el.logger.WithError(err).WithField("handler", name).
+					WithField("event_id", event.ID).
 					WithField("event_type", event.Type).
-					Error("Handler failed")
-				continue
+					WithField("attempts", attempts)
+				if panicErr != nil {
+					logEntry = logEntry.WithField("stack", panicErr.Stack)
+				}
+				logEntry.Error("Handler failed")
+				// 停止时中断的事件由预写日志重放，不进入死信
+				if el.ctx.Err() == nil {
+					el.deadLetter(deadLetters, event, name, attempts, err)
+				}
 			}
-			handled = true
 		}
 	}
 
-	if !handled {
+	if !matched {
 		el.logger.WithField("event_type", event.Type).
 			Warn("No handler found for event")
 	}
 
-	return nil
+	record := &EventRecord{
+		Event:       event,
+		Handlers:    records,
+		Handled:     matched,
+		Duration:    time.Since(start),
+		ProcessedAt: time.Now(),
+	}
+	if history != nil {
+		history.Record(record)
+	}
+
+	span := &TraceSpan{
+		ID:            event.ID,
+		Kind:          TraceSpanEvent,
+		Name:          string(event.Type),
+		CorrelationID: event.CorrelationID,
+		CausationID:   event.CausationID,
+		Timestamp:     start,
+		Duration:      time.Since(start),
+		Attributes: map[string]interface{}{
+			"handled":  matched,
+			"handlers": len(records),
+		},
+	}
+	for _, record := range records {
+		if record.Error != "" {
+			span.Error = record.Error
+			break
+		}
+	}
+	tracer.Record(span)
+
+	return record
 }
 
-// GetQueueLength 获取当前队列长度
+// GetQueueLength 获取当前队列长度，即所有worker队列中等待处理的事件数量
 func (el *EventLoop) GetQueueLength() int {
-	el.mu.RLock()
-	defer el.mu.RUnlock()
-	return len(el.events)
+	return el.GetQueueDepth()
+}
+
+// QueueCapacity 获取所有worker队列的总容量，与GetQueueDepth对应
+func (el *EventLoop) QueueCapacity() int {
+	capacity := 0
+	for _, queue := range el.workers {
+		capacity += queue.cap()
+	}
+	return capacity
+}
+
+// GetQueueDepth 获取所有worker队列中排队的事件总数
+func (el *EventLoop) GetQueueDepth() int {
+	depth := 0
+	for _, queue := range el.workers {
+		depth += queue.len()
+	}
+	return depth
+}
+
+// GetDroppedCount 获取因drop_oldest策略被丢弃的事件数量
+func (el *EventLoop) GetDroppedCount() int64 {
+	return el.dropped.Load()
+}
+
+// GetSpilledCount 获取溢出文件中等待回填的事件数量
+func (el *EventLoop) GetSpilledCount() int {
+	if el.spill == nil {
+		return 0
+	}
+	return el.spill.Len()
+}
+
+// OverflowPolicy 获取当前使用的溢出策略
+func (el *EventLoop) OverflowPolicy() OverflowPolicy {
+	return el.overflow
+}
+
+// GetJournalPending 获取预写日志中尚未确认的事件数量
+func (el *EventLoop) GetJournalPending() int {
+	if el.journal == nil {
+		return 0
+	}
+	return el.journal.Len()
+}
+
+// GetQueueDepthByPriority 获取各优先级排队中的事件数量
+func (el *EventLoop) GetQueueDepthByPriority() map[string]int {
+	depths := make(map[string]int, numLanes)
+	for _, queue := range el.workers {
+		for priority, n := range queue.lenByPriority() {
+			depths[priority] += n
+		}
+	}
+	return depths
+}
+
+// GetInFlight 获取正在处理中的事件数量
+func (el *EventLoop) GetInFlight() int {
+	return int(el.inFlight.Load())
+}
+
+// WorkerCount 获取worker数量
+func (el *EventLoop) WorkerCount() int {
+	return len(el.workers)
 }
 
 // IsRunning 检查事件循环是否正在运行
@@ -189,4 +702,11 @@ func (el *EventLoop) IsRunning() bool {
 	el.mu.RLock()
 	defer el.mu.RUnlock()
 	return el.running
-}
\ No newline at end of file
+}
+
+// HandlerCount 获取已注册的事件处理器数量
+func (el *EventLoop) HandlerCount() int {
+	el.mu.RLock()
+	defer el.mu.RUnlock()
+	return len(el.handlers)
+}
@@ -0,0 +1,195 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEventLoopPartitionKey(t *testing.T) {
+	tests := []struct {
+		name         string
+		partitionKey string
+		event        *Event
+		want         string
+	}{
+		{
+			name:  "default key",
+			event: &Event{Type: EventTypeMessage, Metadata: map[string]interface{}{"session_id": "s1"}},
+			want:  "s1",
+		},
+		{
+			name:  "falls back to the event type",
+			event: &Event{Type: EventTypeCron},
+			want:  "cron",
+		},
+		{
+			name:  "nil value falls back to the event type",
+			event: &Event{Type: EventTypeMessage, Metadata: map[string]interface{}{"session_id": nil}},
+			want:  "message",
+		},
+		{
+			name:  "non string value",
+			event: &Event{Type: EventTypeMessage, Metadata: map[string]interface{}{"session_id": 42}},
+			want:  "42",
+		},
+		{
+			name:         "custom key",
+			partitionKey: "user",
+			event:        &Event{Type: EventTypeMessage, Metadata: map[string]interface{}{"session_id": "s1", "user": "alice"}},
+			want:         "alice",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			el := NewEventLoopWithConfig(context.Background(), testLogger(), &EventLoopConfig{PartitionKey: tt.partitionKey})
+			if got := el.PartitionKey(tt.event); got != tt.want {
+				t.Errorf("PartitionKey = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventLoopWorkerSizing(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       *EventLoopConfig
+		wantWorkers  int
+		wantCapacity int
+	}{
+		{name: "defaults", config: nil, wantWorkers: 1, wantCapacity: 1000},
+		{name: "queue split across workers", config: &EventLoopConfig{MaxQueueSize: 100, Workers: 4}, wantWorkers: 4, wantCapacity: 100},
+		{name: "at least one slot per worker", config: &EventLoopConfig{MaxQueueSize: 2, Workers: 4}, wantWorkers: 4, wantCapacity: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			el := NewEventLoopWithConfig(context.Background(), testLogger(), tt.config)
+			if got := el.WorkerCount(); got != tt.wantWorkers {
+				t.Errorf("WorkerCount = %d, want %d", got, tt.wantWorkers)
+			}
+			if got := el.QueueCapacity(); got != tt.wantCapacity {
+				t.Errorf("QueueCapacity = %d, want %d", got, tt.wantCapacity)
+			}
+		})
+	}
+}
+
+func TestEventLoopKeepsPartitionOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		workers  int
+		sessions int
+		events   int
+	}{
+		{name: "single worker", workers: 1, sessions: 3, events: 30},
+		{name: "more sessions than workers", workers: 4, sessions: 10, events: 20},
+		{name: "more workers than sessions", workers: 8, sessions: 2, events: 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			el := startTestLoop(t, nil, &EventLoopConfig{Workers: tt.workers, MaxQueueSize: 10000})
+
+			var mu sync.Mutex
+			seen := make(map[string][]int)
+			total := 0
+			el.RegisterHandler(&funcEventHandler{handle: func(ctx context.Context, event *Event) error {
+				time.Sleep(time.Duration(rand.Intn(200)) * time.Microsecond)
+				mu.Lock()
+				defer mu.Unlock()
+				session := event.Metadata["session_id"].(string)
+				seen[session] = append(seen[session], event.Data.(int))
+				total++
+				return nil
+			}})
+
+			for i := 0; i < tt.events; i++ {
+				for s := 0; s < tt.sessions; s++ {
+					event := &Event{
+						Type:     EventTypeMessage,
+						Data:     i,
+						Metadata: map[string]interface{}{"session_id": fmt.Sprintf("session-%d", s)},
+					}
+					if err := el.Emit(event); err != nil {
+						t.Fatalf("Emit: %v", err)
+					}
+				}
+			}
+
+			waitFor(t, 5*time.Second, "all events", func() bool {
+				mu.Lock()
+				defer mu.Unlock()
+				return total == tt.events*tt.sessions
+			})
+
+			mu.Lock()
+			defer mu.Unlock()
+			for session, order := range seen {
+				for i, v := range order {
+					if v != i {
+						t.Fatalf("%s processed out of order: %v", session, order)
+					}
+				}
+			}
+		})
+	}
+}
+
+// sessionsOnDifferentWorkers returns two session IDs that hash to different workers
+func sessionsOnDifferentWorkers(t *testing.T, el *EventLoop) (string, string) {
+	t.Helper()
+	first := &Event{Metadata: map[string]interface{}{"session_id": "slow"}}
+	for i := 0; i < 1000; i++ {
+		other := fmt.Sprintf("fast-%d", i)
+		if el.workerIndex(&Event{Metadata: map[string]interface{}{"session_id": other}}) != el.workerIndex(first) {
+			return "slow", other
+		}
+	}
+	t.Fatal("no session maps to a different worker")
+	return "", ""
+}
+
+func TestEventLoopSlowPartitionDoesNotBlockOthers(t *testing.T) {
+	el := startTestLoop(t, nil, &EventLoopConfig{Workers: 4})
+	slow, fast := sessionsOnDifferentWorkers(t, el)
+
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	fastDone := make(chan struct{}, 1)
+	el.RegisterHandler(&funcEventHandler{handle: func(ctx context.Context, event *Event) error {
+		if event.Metadata["session_id"] == slow {
+			<-release
+			return nil
+		}
+		fastDone <- struct{}{}
+		return nil
+	}})
+
+	emit := func(session string) {
+		if err := el.Emit(&Event{Type: EventTypeMessage, Metadata: map[string]interface{}{"session_id": session}}); err != nil {
+			t.Fatalf("Emit: %v", err)
+		}
+	}
+	emit(slow)
+	emit(slow)
+	waitFor(t, 2*time.Second, "slow event in flight", func() bool { return el.GetInFlight() == 1 })
+
+	emit(fast)
+	select {
+	case <-fastDone:
+	case <-time.After(2 * time.Second):
+		t.Fatal("event of another partition waited for the slow partition")
+	}
+
+	// The second slow event is still queued behind the first
+	if depth := el.GetQueueDepth(); depth != 1 {
+		t.Errorf("GetQueueDepth = %d, want 1", depth)
+	}
+	if got := el.GetQueueLength(); got != el.GetQueueDepth() {
+		t.Errorf("GetQueueLength = %d, want it to match GetQueueDepth", got)
+	}
+	// The fast handler signals before it returns, so its event may briefly still count as in flight
+	waitFor(t, 2*time.Second, "only the slow event in flight", func() bool { return el.GetInFlight() == 1 })
+}
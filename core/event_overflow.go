@@ -0,0 +1,256 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// OverflowPolicy 队列已满时Emit的处理策略
+type OverflowPolicy string
+
+const (
+	// OverflowReject 立即返回ErrEventQueueFull
+	OverflowReject OverflowPolicy = "reject"
+	// OverflowBlock 等待队列空间，最多等待BlockTimeout
+	OverflowBlock OverflowPolicy = "block"
+	// OverflowDropOldest 丢弃优先级不高于新事件的最低优先级通道中最早的事件
+	OverflowDropOldest OverflowPolicy = "drop_oldest"
+	// OverflowSpill 将事件写入磁盘，队列有空间时再取回
+	OverflowSpill OverflowPolicy = "spill"
+)
+
+// DefaultBlockTimeout block策略下Emit的默认最长等待时间
+const DefaultBlockTimeout = 5 * time.Second
+
+// spillDrainInterval 检查溢出文件并回填队列的间隔
+const spillDrainInterval = 100 * time.Millisecond
+
+// ParseOverflowPolicy 解析溢出策略，空字符串表示reject
+func ParseOverflowPolicy(s string) (OverflowPolicy, error) {
+	switch policy := OverflowPolicy(s); policy {
+	case "":
+		return OverflowReject, nil
+	case OverflowReject, OverflowBlock, OverflowDropOldest, OverflowSpill:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown overflow policy: %s", s)
+	}
+}
+
+// eventSpill 以JSON行格式保存溢出的事件，按写入顺序取回
+type eventSpill struct {
+	file    string
+	mu      sync.Mutex
+	pending int
+	logger  *logrus.Logger
+}
+
+// newEventSpill 创建溢出存储，已存在的溢出文件会被继续使用
+func newEventSpill(file string, logger *logrus.Logger) (*eventSpill, error) {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create spill directory: %w", err)
+	}
+
+	sp := &eventSpill{file: file, logger: logger}
+
+	data, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read spill file: %w", err)
+	}
+	sp.pending = bytes.Count(data, []byte{'\n'})
+	if sp.pending > 0 {
+		logger.Infof("Found %d spilled events in %s", sp.pending, file)
+	}
+
+	return sp, nil
+}
+
+// pushOrWrite 溢出文件为空且push成功时直接入队，否则追加到溢出文件。
+// 检查和入队在同一把锁内完成，避免与drain交错而打乱顺序。返回事件是否写入了文件。
+func (sp *eventSpill) pushOrWrite(event *Event, push func(*Event) bool) (bool, error) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	if sp.pending == 0 && push(event) {
+		return false, nil
+	}
+	return true, sp.writeLocked(event)
+}
+
+// writeLocked 追加一个事件到溢出文件并同步到磁盘，调用者需持有sp.mu
+func (sp *eventSpill) writeLocked(event *Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal spilled event: %w", err)
+	}
+
+	f, err := os.OpenFile(sp.file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open spill file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write spill file: %w", err)
+	}
+	// 溢出的事件已在预写日志中确认，文件是它们唯一的副本
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync spill file: %w", err)
+	}
+
+	sp.pending++
+	return nil
+}
+
+// hasPending 检查是否有尚未取回的溢出事件
+func (sp *eventSpill) hasPending() bool {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	return sp.pending > 0
+}
+
+// Len 返回尚未取回的溢出事件数量
+func (sp *eventSpill) Len() int {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	return sp.pending
+}
+
+// drain 按顺序把溢出事件交给push，push返回false时停止，剩余事件写回文件
+func (sp *eventSpill) drain(push func(*Event) bool) error {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	if sp.pending == 0 {
+		return nil
+	}
+
+	data, err := os.ReadFile(sp.file)
+	if err != nil {
+		return fmt.Errorf("failed to read spill file: %w", err)
+	}
+
+	var remaining bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	blocked := false
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		if !blocked {
+			var event Event
+			if err := json.Unmarshal(line, &event); err != nil {
+				sp.logger.WithError(err).Warn("Skipping corrupt spilled event")
+				continue
+			}
+			if push(&event) {
+				continue
+			}
+			blocked = true
+		}
+		remaining.Write(line)
+		remaining.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read spill file: %w", err)
+	}
+
+	tmp := sp.file + ".tmp"
+	if err := os.WriteFile(tmp, remaining.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to rewrite spill file: %w", err)
+	}
+	if err := os.Rename(tmp, sp.file); err != nil {
+		return fmt.Errorf("failed to replace spill file: %w", err)
+	}
+	sp.pending = bytes.Count(remaining.Bytes(), []byte{'\n'})
+	return nil
+}
+
+// emitDropOldest 事件所属的worker队列已满时，从不高于该事件优先级的通道中
+// 选择优先级最低的非空通道，丢弃其中最早的事件。
+// 没有可丢弃的事件（队列全部被更高优先级的事件占满）或事件循环已停止时返回ErrEventQueueFull。
+func (el *EventLoop) emitDropOldest(event *Event) error {
+	queue := el.queueFor(event)
+	lane := laneFor(event)
+	for {
+		if queue.tryPush(event) {
+			return nil
+		}
+		select {
+		case <-el.ctx.Done():
+			return ErrEventQueueFull
+		default:
+		}
+		dropped, ok, took := queue.pollLowest(lane)
+		if !took {
+			return ErrEventQueueFull
+		}
+		if ok {
+			el.dropped.Add(1)
+			el.journalAck(dropped)
+			el.logger.WithField("event_id", dropped.ID).
+				WithField("event_type", dropped.Type).
+				Warn("Event queue full, dropped oldest event")
+		}
+	}
+}
+
+// emitSpill 队列已满时将事件写入溢出文件。
+// 溢出文件非空时新事件也写入文件，以保持先进先出的顺序。
+// 溢出文件本身是持久化的，因此溢出的事件在预写日志中直接确认，回填时再重新写入。
+func (el *EventLoop) emitSpill(event *Event) error {
+	spilled, err := el.spill.pushOrWrite(event, el.queueFor(event).tryPush)
+	if err != nil {
+		el.logger.WithError(err).WithField("event_id", event.ID).Error("Failed to spill event")
+		return ErrEventQueueFull
+	}
+	if spilled {
+		el.journalAck(event)
+	}
+	return nil
+}
+
+// runSpillDrain 定期将溢出的事件回填到队列
+func (el *EventLoop) runSpillDrain() {
+	defer el.wg.Done()
+
+	ticker := time.NewTicker(spillDrainInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !el.spill.hasPending() {
+				continue
+			}
+			if err := el.spill.drain(el.pushSpilled); err != nil {
+				el.logger.WithError(err).Warn("Failed to drain spilled events")
+			}
+		case <-el.ctx.Done():
+			return
+		}
+	}
+}
+
+// pushSpilled 将溢出的事件放回队列，队列已满时返回false
+func (el *EventLoop) pushSpilled(event *Event) bool {
+	if err := el.journalEmit(event); err != nil {
+		el.logger.WithError(err).WithField("event_id", event.ID).Warn("Failed to journal spilled event")
+		return false
+	}
+	if !el.queueFor(event).tryPush(event) {
+		el.journalAck(event)
+		return false
+	}
+	return true
+}
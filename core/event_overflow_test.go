@@ -0,0 +1,364 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseOverflowPolicy(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    OverflowPolicy
+		wantErr bool
+	}{
+		{in: "", want: OverflowReject},
+		{in: "reject", want: OverflowReject},
+		{in: "block", want: OverflowBlock},
+		{in: "drop_oldest", want: OverflowDropOldest},
+		{in: "spill", want: OverflowSpill},
+		{in: "drop-oldest", wantErr: true},
+		{in: "BLOCK", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseOverflowPolicy(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseOverflowPolicy(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+// saturatedLoop starts a single worker loop with room for queueSize events and
+// keeps its worker busy until the returned release function is called.
+// The IDs of the other processed events are recorded in order.
+func saturatedLoop(t *testing.T, config *EventLoopConfig) (el *EventLoop, release func(), processed func() []string) {
+	t.Helper()
+	config.Workers = 1
+	el = startTestLoop(t, nil, config)
+
+	block := make(chan struct{})
+	var once sync.Once
+	release = func() { once.Do(func() { close(block) }) }
+	t.Cleanup(release)
+
+	var mu sync.Mutex
+	var ids []string
+	el.RegisterHandler(&funcEventHandler{handle: func(ctx context.Context, event *Event) error {
+		if event.ID == "blocker" {
+			<-block
+			return nil
+		}
+		mu.Lock()
+		ids = append(ids, event.ID)
+		mu.Unlock()
+		return nil
+	}})
+	processed = func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), ids...)
+	}
+
+	if err := el.Emit(&Event{ID: "blocker", Type: EventTypeMessage}); err != nil {
+		t.Fatalf("Emit blocker: %v", err)
+	}
+	waitFor(t, time.Second, "blocker in flight", func() bool { return el.GetInFlight() == 1 })
+	for i := 0; i < el.QueueCapacity(); i++ {
+		if err := el.Emit(&Event{ID: fmt.Sprintf("queued-%d", i), Type: EventTypeMessage}); err != nil {
+			t.Fatalf("Emit queued-%d: %v", i, err)
+		}
+	}
+	return el, release, processed
+}
+
+func TestEventLoopOverflowPolicies(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *EventLoopConfig
+		wantErr     error
+		wantDropped int64
+		wantSpilled int
+		// wantProcessed is the order after the worker is released, nil when the overflowing event is rejected
+		wantProcessed []string
+	}{
+		{
+			name:    "reject",
+			config:  &EventLoopConfig{MaxQueueSize: 2, OverflowPolicy: OverflowReject},
+			wantErr: ErrEventQueueFull,
+		},
+		{
+			name:    "block times out",
+			config:  &EventLoopConfig{MaxQueueSize: 2, OverflowPolicy: OverflowBlock, BlockTimeout: 20 * time.Millisecond},
+			wantErr: ErrEmitTimeout,
+		},
+		{
+			name:          "drop oldest",
+			config:        &EventLoopConfig{MaxQueueSize: 2, OverflowPolicy: OverflowDropOldest},
+			wantDropped:   1,
+			wantProcessed: []string{"queued-1", "overflow"},
+		},
+		{
+			name:          "spill",
+			config:        &EventLoopConfig{MaxQueueSize: 2, OverflowPolicy: OverflowSpill},
+			wantSpilled:   1,
+			wantProcessed: []string{"queued-0", "queued-1", "overflow"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.config.OverflowPolicy == OverflowSpill {
+				tt.config.SpillFile = filepath.Join(t.TempDir(), "spill.jsonl")
+			}
+			el, release, processed := saturatedLoop(t, tt.config)
+
+			err := el.Emit(&Event{ID: "overflow", Type: EventTypeMessage})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Emit = %v, want %v", err, tt.wantErr)
+			}
+			if got := el.GetDroppedCount(); got != tt.wantDropped {
+				t.Errorf("GetDroppedCount = %d, want %d", got, tt.wantDropped)
+			}
+			if got := el.GetSpilledCount(); got != tt.wantSpilled {
+				t.Errorf("GetSpilledCount = %d, want %d", got, tt.wantSpilled)
+			}
+			if got := el.GetQueueDepth(); got > el.QueueCapacity() {
+				t.Errorf("GetQueueDepth = %d exceeds capacity %d", got, el.QueueCapacity())
+			}
+
+			release()
+			want := tt.wantProcessed
+			if want == nil {
+				want = []string{"queued-0", "queued-1"}
+			}
+			waitFor(t, 2*time.Second, "queued events", func() bool { return len(processed()) == len(want) })
+			if got := processed(); fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("processed %v, want %v", got, want)
+			}
+			if el.GetSpilledCount() != 0 {
+				t.Errorf("GetSpilledCount = %d after draining", el.GetSpilledCount())
+			}
+		})
+	}
+}
+
+func TestEventLoopDropOldestAcrossPriorities(t *testing.T) {
+	tests := []struct {
+		name          string
+		priority      EventPriority
+		wantErr       error
+		wantDropped   int64
+		wantProcessed []string
+	}{
+		{
+			name:          "high priority evicts the normal lane",
+			priority:      PriorityHigh,
+			wantDropped:   1,
+			wantProcessed: []string{"overflow", "queued-1"},
+		},
+		{
+			name:          "low priority does not evict higher lanes",
+			priority:      PriorityLow,
+			wantErr:       ErrEventQueueFull,
+			wantProcessed: []string{"queued-0", "queued-1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			el, release, processed := saturatedLoop(t, &EventLoopConfig{MaxQueueSize: 2, OverflowPolicy: OverflowDropOldest})
+
+			// Emit must not spin while the worker is blocked
+			done := make(chan error, 1)
+			go func() { done <- el.Emit(&Event{ID: "overflow", Type: EventTypeMessage, Priority: tt.priority}) }()
+			select {
+			case err := <-done:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Emit = %v, want %v", err, tt.wantErr)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("Emit did not return while the queue was full")
+			}
+			if got := el.GetDroppedCount(); got != tt.wantDropped {
+				t.Errorf("GetDroppedCount = %d, want %d", got, tt.wantDropped)
+			}
+
+			release()
+			waitFor(t, 2*time.Second, "queued events", func() bool { return len(processed()) == len(tt.wantProcessed) })
+			if got := processed(); fmt.Sprint(got) != fmt.Sprint(tt.wantProcessed) {
+				t.Errorf("processed %v, want %v", got, tt.wantProcessed)
+			}
+		})
+	}
+}
+
+func TestEventLoopSpillUnavailableFallsBackToReject(t *testing.T) {
+	el := NewEventLoopWithConfig(context.Background(), testLogger(), &EventLoopConfig{OverflowPolicy: OverflowSpill})
+	if got := el.OverflowPolicy(); got != OverflowReject {
+		t.Errorf("OverflowPolicy = %s, want reject without a spill file", got)
+	}
+}
+
+func TestEmitWait(t *testing.T) {
+	tests := []struct {
+		name    string
+		emit    func(el *EventLoop, event *Event) error
+		wantErr error
+	}{
+		{
+			name: "context cancelled",
+			emit: func(el *EventLoop, event *Event) error {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return el.EmitWait(ctx, event)
+			},
+			wantErr: context.Canceled,
+		},
+		{
+			name: "context deadline",
+			emit: func(el *EventLoop, event *Event) error {
+				ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+				defer cancel()
+				return el.EmitWait(ctx, event)
+			},
+			wantErr: ErrEmitTimeout,
+		},
+		{
+			name: "with timeout",
+			emit: func(el *EventLoop, event *Event) error {
+				return el.EmitWithTimeout(event, 20*time.Millisecond)
+			},
+			wantErr: ErrEmitTimeout,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			el, _, _ := saturatedLoop(t, &EventLoopConfig{MaxQueueSize: 1})
+			if err := tt.emit(el, &Event{Type: EventTypeMessage}); !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEmitWaitUnblocksWhenSpaceFrees(t *testing.T) {
+	el, release, processed := saturatedLoop(t, &EventLoopConfig{MaxQueueSize: 1})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- el.EmitWait(context.Background(), &Event{ID: "waiting", Type: EventTypeMessage})
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("EmitWait returned %v while the queue was full", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	release()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("EmitWait: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("EmitWait still blocked after the queue drained")
+	}
+	waitFor(t, time.Second, "waiting event", func() bool { return len(processed()) == 2 })
+}
+
+func TestEventSpillKeepsOrder(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "spill", "events.jsonl")
+	sp, err := newEventSpill(file, testLogger())
+	if err != nil {
+		t.Fatalf("newEventSpill: %v", err)
+	}
+
+	full := func(*Event) bool { return false }
+	var pushed []string
+	accept := func(event *Event) bool {
+		pushed = append(pushed, event.ID)
+		return true
+	}
+
+	// Once something is spilled, later events must queue up behind it even if there is room
+	for _, id := range []string{"e1", "e2"} {
+		if spilled, err := sp.pushOrWrite(&Event{ID: id}, full); err != nil || !spilled {
+			t.Fatalf("pushOrWrite(%s) = %v, %v; want spilled", id, spilled, err)
+		}
+	}
+	if spilled, _ := sp.pushOrWrite(&Event{ID: "e3"}, accept); !spilled {
+		t.Fatal("event bypassed pending spilled events")
+	}
+	if sp.Len() != 3 {
+		t.Fatalf("Len = %d, want 3", sp.Len())
+	}
+
+	// A reopened spill picks up the pending events
+	reopened, err := newEventSpill(file, testLogger())
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if reopened.Len() != 3 {
+		t.Fatalf("reopened Len = %d, want 3", reopened.Len())
+	}
+
+	// Drain stops at the first refused event and keeps the rest
+	n := 0
+	if err := reopened.drain(func(event *Event) bool {
+		if n == 2 {
+			return false
+		}
+		n++
+		return accept(event)
+	}); err != nil {
+		t.Fatalf("drain: %v", err)
+	}
+	if fmt.Sprint(pushed) != "[e1 e2]" || reopened.Len() != 1 {
+		t.Fatalf("pushed %v with %d left, want [e1 e2] with 1 left", pushed, reopened.Len())
+	}
+
+	if err := reopened.drain(accept); err != nil {
+		t.Fatalf("drain: %v", err)
+	}
+	if fmt.Sprint(pushed) != "[e1 e2 e3]" || reopened.hasPending() {
+		t.Errorf("pushed %v, pending %v; want all three drained", pushed, reopened.hasPending())
+	}
+	if spilled, _ := reopened.pushOrWrite(&Event{ID: "e4"}, accept); spilled {
+		t.Error("event spilled although the spill is empty and the queue has room")
+	}
+}
+
+func TestPostEventQueueFull(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		wantStatus     int
+		wantRetryAfter string
+	}{
+		{name: "queue saturated", body: `{"type":"message"}`, wantStatus: http.StatusTooManyRequests, wantRetryAfter: "1"},
+		{name: "invalid json", body: `{`, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			el, _, _ := saturatedLoop(t, &EventLoopConfig{MaxQueueSize: 1})
+			ws := newTestWebServer(t, el)
+
+			rec := serveTestRequest(ws, "POST", "/api/v1/events", tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("Retry-After = %q, want %q", got, tt.wantRetryAfter)
+			}
+		})
+	}
+}
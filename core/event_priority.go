@@ -0,0 +1,226 @@
+package core
+
+import (
+	"context"
+)
+
+// EventPriority 事件优先级，零值表示按事件类型使用默认优先级
+type EventPriority int
+
+const (
+	PriorityDefault EventPriority = iota
+	PriorityLow
+	PriorityNormal
+	PriorityHigh
+)
+
+// DefaultStarvationLimit 高优先级事件连续被处理的最大次数，超过后让出一次给低优先级事件
+const DefaultStarvationLimit = 8
+
+// 优先级通道的下标，越小优先级越高
+const (
+	laneHigh = iota
+	laneNormal
+	laneLow
+	numLanes
+)
+
+// String 返回优先级名称
+func (p EventPriority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	case PriorityHigh:
+		return "high"
+	default:
+		return "default"
+	}
+}
+
+// DefaultPriorityForType 返回事件类型的默认优先级，系统和心跳事件优先处理
+func DefaultPriorityForType(eventType EventType) EventPriority {
+	switch eventType {
+	case EventTypeSystem, EventTypeHeartbeat:
+		return PriorityHigh
+	default:
+		return PriorityNormal
+	}
+}
+
+// EffectivePriority 返回事件实际使用的优先级
+func (e *Event) EffectivePriority() EventPriority {
+	if e.Priority != PriorityDefault {
+		return e.Priority
+	}
+	return DefaultPriorityForType(e.Type)
+}
+
+// laneFor 返回事件所属的优先级通道
+func laneFor(event *Event) int {
+	switch event.EffectivePriority() {
+	case PriorityHigh:
+		return laneHigh
+	case PriorityLow:
+		return laneLow
+	default:
+		return laneNormal
+	}
+}
+
+// priorityLanes 按优先级分组的事件队列。
+// 总是优先取出高优先级事件，但在连续取出starvationLimit个高优先级事件后，
+// 若低优先级队列有积压则让出一次，避免低优先级事件饿死。
+// 同一通道内保持先进先出顺序。
+// 各通道共享slots限定的总容量，因此无论优先级如何分布，排队的事件总数不超过size。
+type priorityLanes struct {
+	lanes           [numLanes]chan *Event
+	slots           chan struct{} // 每个排队的事件占用一个槽位
+	starvationLimit int
+	streak          int // 仅由消费者goroutine访问
+}
+
+// newPriorityLanes 创建总容量为size的优先级队列
+func newPriorityLanes(size, starvationLimit int) *priorityLanes {
+	if starvationLimit <= 0 {
+		starvationLimit = DefaultStarvationLimit
+	}
+	pl := &priorityLanes{
+		slots:           make(chan struct{}, size),
+		starvationLimit: starvationLimit,
+	}
+	for i := range pl.lanes {
+		pl.lanes[i] = make(chan *Event, size)
+	}
+	return pl
+}
+
+// put 将已占用槽位的事件放入所属通道，通道容量与槽位数相同，因此不会阻塞
+func (pl *priorityLanes) put(event *Event) {
+	pl.lanes[laneFor(event)] <- event
+}
+
+// tryPush 非阻塞地放入事件，队列已满时返回false
+func (pl *priorityLanes) tryPush(event *Event) bool {
+	select {
+	case pl.slots <- struct{}{}:
+		pl.put(event)
+		return true
+	default:
+		return false
+	}
+}
+
+// push 放入事件，队列已满时阻塞直到有空间或ctx结束
+func (pl *priorityLanes) push(ctx context.Context, event *Event) error {
+	select {
+	case pl.slots <- struct{}{}:
+		pl.put(event)
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release 取出事件后归还其槽位
+func (pl *priorityLanes) release(ok bool) {
+	if ok {
+		<-pl.slots
+	}
+}
+
+// next 取出下一个事件，队列为空时阻塞。队列关闭或ctx结束时返回false
+func (pl *priorityLanes) next(ctx context.Context) (*Event, bool) {
+	// 防饿死：高优先级连续处理过多时，先检查较低优先级的通道
+	if pl.streak >= pl.starvationLimit {
+		for lane := laneNormal; lane < numLanes; lane++ {
+			if event, ok, took := pl.poll(lane); took {
+				pl.streak = 0
+				return event, ok
+			}
+		}
+		pl.streak = 0
+	}
+
+	for lane := 0; lane < numLanes; lane++ {
+		if event, ok, took := pl.poll(lane); took {
+			if ok && pl.hasPendingBelow(lane) {
+				pl.streak++
+			} else {
+				pl.streak = 0
+			}
+			return event, ok
+		}
+	}
+
+	// 所有通道为空，等待任意通道
+	pl.streak = 0
+	select {
+	case event, ok := <-pl.lanes[laneHigh]:
+		pl.release(ok)
+		return event, ok
+	case event, ok := <-pl.lanes[laneNormal]:
+		pl.release(ok)
+		return event, ok
+	case event, ok := <-pl.lanes[laneLow]:
+		pl.release(ok)
+		return event, ok
+	case <-ctx.Done():
+		return nil, false
+	}
+}
+
+// poll 非阻塞地从指定通道取出事件，took表示是否取到（包括通道已关闭）
+func (pl *priorityLanes) poll(lane int) (event *Event, ok bool, took bool) {
+	select {
+	case event, ok = <-pl.lanes[lane]:
+		pl.release(ok)
+		return event, ok, true
+	default:
+		return nil, false, false
+	}
+}
+
+// pollLowest 从优先级不高于lane的通道中，由低到高非阻塞地取出最早的事件
+func (pl *priorityLanes) pollLowest(lane int) (event *Event, ok bool, took bool) {
+	for l := numLanes - 1; l >= lane; l-- {
+		if event, ok, took = pl.poll(l); took {
+			return event, ok, took
+		}
+	}
+	return nil, false, false
+}
+
+// hasPendingBelow 检查低于指定优先级的通道是否有积压
+func (pl *priorityLanes) hasPendingBelow(lane int) bool {
+	for l := lane + 1; l < numLanes; l++ {
+		if len(pl.lanes[l]) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// len 返回所有通道中排队的事件数量
+func (pl *priorityLanes) len() int {
+	n := 0
+	for _, lane := range pl.lanes {
+		n += len(lane)
+	}
+	return n
+}
+
+// cap 返回队列的总容量
+func (pl *priorityLanes) cap() int {
+	return cap(pl.slots)
+}
+
+// lenByPriority 返回各优先级排队的事件数量
+func (pl *priorityLanes) lenByPriority() map[string]int {
+	return map[string]int{
+		PriorityHigh.String():   len(pl.lanes[laneHigh]),
+		PriorityNormal.String(): len(pl.lanes[laneNormal]),
+		PriorityLow.String():    len(pl.lanes[laneLow]),
+	}
+}
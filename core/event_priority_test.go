@@ -0,0 +1,233 @@
+package core
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEffectivePriority(t *testing.T) {
+	tests := []struct {
+		name  string
+		event *Event
+		want  EventPriority
+	}{
+		{"system defaults to high", &Event{Type: EventTypeSystem}, PriorityHigh},
+		{"heartbeat defaults to high", &Event{Type: EventTypeHeartbeat}, PriorityHigh},
+		{"message defaults to normal", &Event{Type: EventTypeMessage}, PriorityNormal},
+		{"custom type defaults to normal", &Event{Type: EventType("webhook")}, PriorityNormal},
+		{"explicit low", &Event{Type: EventTypeSystem, Priority: PriorityLow}, PriorityLow},
+		{"explicit high", &Event{Type: EventTypeMessage, Priority: PriorityHigh}, PriorityHigh},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.event.EffectivePriority(); got != tt.want {
+				t.Errorf("EffectivePriority = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// laneEvent builds an event with an explicit priority, identified by id
+func laneEvent(id string, priority EventPriority) *Event {
+	return &Event{ID: id, Type: EventTypeMessage, Priority: priority}
+}
+
+func TestPriorityLanesOrder(t *testing.T) {
+	tests := []struct {
+		name            string
+		starvationLimit int
+		events          []*Event
+		want            []string
+	}{
+		{
+			name: "higher priority first, FIFO within a lane",
+			events: []*Event{
+				laneEvent("l1", PriorityLow),
+				laneEvent("n1", PriorityNormal),
+				laneEvent("h1", PriorityHigh),
+				laneEvent("n2", PriorityNormal),
+				laneEvent("h2", PriorityHigh),
+			},
+			want: []string{"h1", "h2", "n1", "n2", "l1"},
+		},
+		{
+			name:            "starvation limit yields to lower lanes",
+			starvationLimit: 2,
+			events: []*Event{
+				laneEvent("h1", PriorityHigh),
+				laneEvent("h2", PriorityHigh),
+				laneEvent("h3", PriorityHigh),
+				laneEvent("h4", PriorityHigh),
+				laneEvent("h5", PriorityHigh),
+				laneEvent("n1", PriorityNormal),
+				laneEvent("n2", PriorityNormal),
+			},
+			want: []string{"h1", "h2", "n1", "h3", "h4", "n2", "h5"},
+		},
+		{
+			name:            "starvation yields to the next waiting lane",
+			starvationLimit: 1,
+			events: []*Event{
+				laneEvent("h1", PriorityHigh),
+				laneEvent("h2", PriorityHigh),
+				laneEvent("l1", PriorityLow),
+			},
+			want: []string{"h1", "l1", "h2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pl := newPriorityLanes(len(tt.events), tt.starvationLimit)
+			for _, event := range tt.events {
+				if !pl.tryPush(event) {
+					t.Fatalf("tryPush(%s) failed", event.ID)
+				}
+			}
+
+			var got []string
+			for range tt.events {
+				event, ok := pl.next(context.Background())
+				if !ok {
+					t.Fatal("next returned no event")
+				}
+				got = append(got, event.ID)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Fatalf("order = %v, want %v", got, tt.want)
+				}
+			}
+			if pl.len() != 0 {
+				t.Errorf("len = %d after draining", pl.len())
+			}
+		})
+	}
+}
+
+func TestPriorityLanesSharedCapacity(t *testing.T) {
+	pl := newPriorityLanes(3, 0)
+	if pl.cap() != 3 {
+		t.Fatalf("cap = %d, want 3", pl.cap())
+	}
+
+	pushed := []*Event{
+		laneEvent("h1", PriorityHigh),
+		laneEvent("n1", PriorityNormal),
+		laneEvent("l1", PriorityLow),
+	}
+	for _, event := range pushed {
+		if !pl.tryPush(event) {
+			t.Fatalf("tryPush(%s) failed below capacity", event.ID)
+		}
+	}
+	// Every lane has room of its own, but the shared capacity is used up
+	if pl.tryPush(laneEvent("h2", PriorityHigh)) {
+		t.Fatal("tryPush succeeded past the shared capacity")
+	}
+
+	want := map[string]int{"high": 1, "normal": 1, "low": 1}
+	for priority, n := range pl.lenByPriority() {
+		if want[priority] != n {
+			t.Errorf("lenByPriority[%s] = %d, want %d", priority, n, want[priority])
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := pl.push(ctx, laneEvent("h2", PriorityHigh)); err == nil {
+		t.Fatal("push did not wait for a free slot")
+	}
+
+	// Taking an event frees its slot for any lane
+	if _, ok := pl.next(context.Background()); !ok {
+		t.Fatal("next returned no event")
+	}
+	if !pl.tryPush(laneEvent("l2", PriorityLow)) {
+		t.Error("tryPush failed after a slot was released")
+	}
+}
+
+func TestPriorityLanesNextWaits(t *testing.T) {
+	pl := newPriorityLanes(1, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, ok := pl.next(ctx); ok {
+		t.Fatal("next returned an event from an empty queue")
+	}
+
+	got := make(chan *Event, 1)
+	go func() {
+		event, _ := pl.next(context.Background())
+		got <- event
+	}()
+	time.Sleep(10 * time.Millisecond)
+	pl.tryPush(laneEvent("n1", PriorityNormal))
+
+	select {
+	case event := <-got:
+		if event.ID != "n1" {
+			t.Errorf("next = %s, want n1", event.ID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("next did not wake up for a pushed event")
+	}
+}
+
+func TestEventLoopDrainsHigherPriorityFirst(t *testing.T) {
+	el := startTestLoop(t, nil, &EventLoopConfig{})
+
+	block := make(chan struct{})
+	var mu sync.Mutex
+	var order []string
+	el.RegisterHandler(&funcEventHandler{handle: func(ctx context.Context, event *Event) error {
+		if event.ID == "blocker" {
+			<-block
+			return nil
+		}
+		mu.Lock()
+		order = append(order, event.ID)
+		mu.Unlock()
+		return nil
+	}})
+
+	// Keep the single worker busy while the backlog builds up
+	el.Emit(&Event{ID: "blocker", Type: EventTypeMessage})
+	waitFor(t, time.Second, "blocker in flight", func() bool { return el.GetInFlight() == 1 })
+
+	backlog := []*Event{
+		{ID: "msg-1", Type: EventTypeMessage},
+		{ID: "bulk", Type: EventTypeMessage, Priority: PriorityLow},
+		{ID: "msg-2", Type: EventTypeMessage},
+		{ID: "heartbeat", Type: EventTypeHeartbeat},
+		{ID: "shutdown", Type: EventTypeSystem},
+	}
+	for _, event := range backlog {
+		if err := el.Emit(event); err != nil {
+			t.Fatalf("Emit: %v", err)
+		}
+	}
+
+	depths := el.GetQueueDepthByPriority()
+	if depths["high"] != 2 || depths["normal"] != 2 || depths["low"] != 1 {
+		t.Errorf("GetQueueDepthByPriority = %v", depths)
+	}
+
+	close(block)
+	waitFor(t, time.Second, "backlog", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(order) == len(backlog)
+	})
+
+	want := []string{"heartbeat", "shutdown", "msg-1", "msg-2", "bulk"}
+	mu.Lock()
+	defer mu.Unlock()
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("order = %v, want %v", order, want)
+		}
+	}
+}
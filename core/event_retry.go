@@ -0,0 +1,141 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy 事件处理器失败后的重试策略，采用带抖动的指数退避。超时的处理器不重试。
+type RetryPolicy struct {
+	MaxAttempts    int           `yaml:"max_attempts"`    // 包括首次执行在内的最大尝试次数
+	InitialBackoff time.Duration `yaml:"initial_backoff"` // 第一次重试前的等待时间
+	MaxBackoff     time.Duration `yaml:"max_backoff"`     // 等待时间上限
+	Multiplier     float64       `yaml:"multiplier"`      // 每次重试等待时间的倍数
+	Jitter         float64       `yaml:"jitter"`          // 随机抖动比例，0到1之间
+}
+
+// DefaultRetryPolicy 返回默认的重试策略
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+}
+
+// RetryPolicyProvider 可由EventHandler实现，为该处理器指定独立的重试策略
+type RetryPolicyProvider interface {
+	RetryPolicy() *RetryPolicy
+}
+
+// Backoff 计算第attempt次失败后的等待时间（attempt从1开始）
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	backoff := p.baseBackoff(attempt)
+	if backoff > 0 && p.Jitter > 0 {
+		// 在[1-jitter, 1+jitter]范围内随机缩放
+		backoff *= 1 + p.Jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(backoff)
+}
+
+// baseBackoff 返回第attempt次失败后不含抖动的等待时间
+func (p *RetryPolicy) baseBackoff(attempt int) float64 {
+	if p.InitialBackoff <= 0 {
+		return 0
+	}
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	backoff := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+	return backoff
+}
+
+// maxTotalBackoff 返回用尽所有尝试时各次退避等待之和的上限（按最大抖动计算）
+func (p *RetryPolicy) maxTotalBackoff() time.Duration {
+	if p == nil {
+		return 0
+	}
+	var total float64
+	for attempt := 1; attempt < p.attempts(); attempt++ {
+		total += p.baseBackoff(attempt) * (1 + math.Max(p.Jitter, 0))
+	}
+	return time.Duration(total)
+}
+
+// attempts 返回有效的最大尝试次数
+func (p *RetryPolicy) attempts() int {
+	if p == nil || p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// handlerName 返回处理器名称，用于历史记录和死信
+func handlerName(handler EventHandler) string {
+	return fmt.Sprintf("%T", handler)
+}
+
+// retryPolicyFor 返回处理器使用的重试策略
+func (el *EventLoop) retryPolicyFor(handler EventHandler) *RetryPolicy {
+	if provider, ok := handler.(RetryPolicyProvider); ok {
+		if policy := provider.RetryPolicy(); policy != nil {
+			return policy
+		}
+	}
+	return el.retry
+}
+
+// handleWithRetry 执行处理器，失败时按重试策略重试，返回最后一次的错误和尝试次数
+func (el *EventLoop) handleWithRetry(handler EventHandler, event *Event) (int, error) {
+	policy := el.retryPolicyFor(handler)
+	maxAttempts := policy.attempts()
+
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		err = invokeSafely(el.ctx, handlerName(handler), handlerTimeout(handler, el.handlerTimeout), func(ctx context.Context) error {
+			return handler.Handle(ContextWithTrace(ctx, event.CorrelationID, event.ID), event)
+		})
+		if err == nil {
+			return attempt, nil
+		}
+		// 超时的尝试可能仍在后台运行，重试会让两次尝试并发执行
+		if attempt == maxAttempts || errors.Is(err, ErrHandlerTimeout) {
+			return attempt, err
+		}
+
+		backoff := policy.Backoff(attempt)
+		el.logger.WithError(err).
+			WithField("handler", handlerName(handler)).
+			WithField("event_id", event.ID).
+			WithField("attempt", attempt).
+			Warnf("Handler failed, retrying in %s", backoff)
+
+		if sleepContext(el.ctx, backoff) != nil {
+			return attempt, err
+		}
+	}
+	return maxAttempts, err
+}
+
+// sleepContext 在ctx结束前等待d
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,180 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  RetryPolicy
+		attempt int
+		want    time.Duration
+	}{
+		{name: "first retry", policy: RetryPolicy{InitialBackoff: 100 * time.Millisecond, Multiplier: 2}, attempt: 1, want: 100 * time.Millisecond},
+		{name: "exponential", policy: RetryPolicy{InitialBackoff: 100 * time.Millisecond, Multiplier: 2}, attempt: 3, want: 400 * time.Millisecond},
+		{name: "capped", policy: RetryPolicy{InitialBackoff: 100 * time.Millisecond, Multiplier: 2, MaxBackoff: 250 * time.Millisecond}, attempt: 3, want: 250 * time.Millisecond},
+		{name: "multiplier below one is constant", policy: RetryPolicy{InitialBackoff: 100 * time.Millisecond, Multiplier: 0.5}, attempt: 4, want: 100 * time.Millisecond},
+		{name: "no initial backoff", policy: RetryPolicy{Multiplier: 2, Jitter: 0.5}, attempt: 2, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Backoff(tt.attempt); got != tt.want {
+				t.Errorf("Backoff(%d) = %s, want %s", tt.attempt, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoffJitter(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 100 * time.Millisecond, Multiplier: 2, Jitter: 0.2}
+	for i := 0; i < 100; i++ {
+		got := policy.Backoff(2)
+		if got < 160*time.Millisecond || got > 240*time.Millisecond {
+			t.Fatalf("Backoff(2) = %s, want within 20%% of 200ms", got)
+		}
+	}
+}
+
+func TestRetryPolicyAttempts(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      *RetryPolicy
+		want        int
+		wantBackoff time.Duration
+	}{
+		{name: "nil", policy: nil, want: 1},
+		{name: "zero", policy: &RetryPolicy{}, want: 1},
+		{name: "three", policy: &RetryPolicy{MaxAttempts: 3, InitialBackoff: 10 * time.Millisecond, Multiplier: 2}, want: 3, wantBackoff: 30 * time.Millisecond},
+		{name: "jitter widens the bound", policy: &RetryPolicy{MaxAttempts: 2, InitialBackoff: 10 * time.Millisecond, Jitter: 0.5}, want: 2, wantBackoff: 15 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.attempts(); got != tt.want {
+				t.Errorf("attempts = %d, want %d", got, tt.want)
+			}
+			if got := tt.policy.maxTotalBackoff(); got != tt.wantBackoff {
+				t.Errorf("maxTotalBackoff = %s, want %s", got, tt.wantBackoff)
+			}
+		})
+	}
+}
+
+// retryingEventHandler is an EventHandler with its own retry policy
+type retryingEventHandler struct {
+	funcEventHandler
+	policy *RetryPolicy
+}
+
+func (h *retryingEventHandler) RetryPolicy() *RetryPolicy {
+	return h.policy
+}
+
+// slowEventHandler is an EventHandler with its own timeout
+type slowEventHandler struct {
+	funcEventHandler
+	timeout time.Duration
+}
+
+func (h *slowEventHandler) HandlerTimeout() time.Duration {
+	return h.timeout
+}
+
+func TestEventLoopRetriesFailingHandlers(t *testing.T) {
+	fastRetry := &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+
+	tests := []struct {
+		name         string
+		handler      func(fail func(ctx context.Context, event *Event) error) EventHandler
+		failures     int32 // attempts that fail before the handler succeeds
+		wantAttempts int
+		wantDead     bool
+	}{
+		{
+			name: "succeeds after retries",
+			handler: func(fail func(context.Context, *Event) error) EventHandler {
+				return &funcEventHandler{handle: fail}
+			},
+			failures:     2,
+			wantAttempts: 3,
+		},
+		{
+			name: "exhausts retries",
+			handler: func(fail func(context.Context, *Event) error) EventHandler {
+				return &funcEventHandler{handle: fail}
+			},
+			failures:     10,
+			wantAttempts: 3,
+			wantDead:     true,
+		},
+		{
+			name: "handler policy overrides the loop policy",
+			handler: func(fail func(context.Context, *Event) error) EventHandler {
+				return &retryingEventHandler{funcEventHandler{handle: fail}, &RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Millisecond}}
+			},
+			failures:     10,
+			wantAttempts: 5,
+			wantDead:     true,
+		},
+		{
+			name: "timeouts are not retried",
+			handler: func(fail func(context.Context, *Event) error) EventHandler {
+				return &slowEventHandler{funcEventHandler{handle: func(ctx context.Context, event *Event) error {
+					fail(ctx, event)
+					<-ctx.Done()
+					return ctx.Err()
+				}}, 10 * time.Millisecond}
+			},
+			failures:     10,
+			wantAttempts: 1,
+			wantDead:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			el := startTestLoop(t, nil, &EventLoopConfig{Retry: fastRetry})
+			store, _ := NewDeadLetterStore(testLogger(), nil)
+			el.SetDeadLetterStore(store)
+			history, _ := NewEventHistory(testLogger(), nil)
+			el.SetHistory(history)
+
+			var calls atomic.Int32
+			el.RegisterHandler(tt.handler(func(ctx context.Context, event *Event) error {
+				if calls.Add(1) <= tt.failures {
+					return errors.New("boom")
+				}
+				return nil
+			}))
+
+			if err := el.Emit(&Event{Type: EventTypeMessage}); err != nil {
+				t.Fatalf("Emit: %v", err)
+			}
+			waitFor(t, 2*time.Second, "event processed", func() bool { return history.Len() == 1 })
+
+			if got := int(calls.Load()); got != tt.wantAttempts {
+				t.Errorf("handler called %d times, want %d", got, tt.wantAttempts)
+			}
+			page, _ := history.Query(EventHistoryQuery{})
+			record := page.Events[0]
+			if !record.Handled {
+				t.Error("a failing handler should still count as handled")
+			}
+			if got := record.Handlers[0].Attempts; got != tt.wantAttempts {
+				t.Errorf("recorded %d attempts, want %d", got, tt.wantAttempts)
+			}
+			if got := store.Len() == 1; got != tt.wantDead {
+				t.Fatalf("dead lettered = %v, want %v", got, tt.wantDead)
+			}
+			if tt.wantDead {
+				letter := store.List()[0]
+				if letter.Attempts != tt.wantAttempts || letter.Handler != record.Handlers[0].Handler || letter.Error == "" {
+					t.Errorf("dead letter = %+v", letter)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package core
+
+import (
+	"sync"
+)
+
+// EventFilter 订阅过滤器，返回true的事件才会发送给订阅者，为nil时接收所有事件
+type EventFilter func(event *Event) bool
+
+// SubscriberDropPolicy 订阅者缓冲区已满时的丢弃策略
+type SubscriberDropPolicy string
+
+const (
+	// SubscriberDropNewest 丢弃新事件，保留缓冲区中的旧事件
+	SubscriberDropNewest SubscriberDropPolicy = "drop_newest"
+	// SubscriberDropOldest 丢弃缓冲区中最旧的事件，为新事件腾出空间
+	SubscriberDropOldest SubscriberDropPolicy = "drop_oldest"
+)
+
+// DefaultSubscriberBuffer 订阅者缓冲区的默认大小
+const DefaultSubscriberBuffer = 256
+
+// SubscribeOptions 订阅选项
+type SubscribeOptions struct {
+	Buffer     int                  // 缓冲区大小，默认DefaultSubscriberBuffer
+	DropPolicy SubscriberDropPolicy // 缓冲区已满时的丢弃策略，默认drop_newest
+}
+
+// EventTypeFilter 返回只接收指定类型事件的过滤器
+func EventTypeFilter(types ...EventType) EventFilter {
+	return func(event *Event) bool {
+		for _, t := range types {
+			if event.Type == t {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// eventSubscriber 单个订阅者，events和records只有一个不为nil
+type eventSubscriber struct {
+	filter  EventFilter
+	policy  SubscriberDropPolicy
+	events  chan *Event
+	records chan *EventRecord
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// subscribers 事件循环的订阅者集合
+type subscribers struct {
+	mu        sync.RWMutex
+	emitted   map[*eventSubscriber]struct{}
+	processed map[*eventSubscriber]struct{}
+}
+
+func newSubscribers() *subscribers {
+	return &subscribers{
+		emitted:   make(map[*eventSubscriber]struct{}),
+		processed: make(map[*eventSubscriber]struct{}),
+	}
+}
+
+func newEventSubscriber(filter EventFilter, opts SubscribeOptions) *eventSubscriber {
+	if opts.DropPolicy == "" {
+		opts.DropPolicy = SubscriberDropNewest
+	}
+	return &eventSubscriber{filter: filter, policy: opts.DropPolicy}
+}
+
+func subscriberBuffer(opts SubscribeOptions) int {
+	if opts.Buffer <= 0 {
+		return DefaultSubscriberBuffer
+	}
+	return opts.Buffer
+}
+
+// Subscribe 订阅进入事件循环的事件，返回的函数用于取消订阅并关闭通道。
+// 订阅者不计入处理器，慢订阅者按drop_newest策略丢弃事件，不会阻塞事件循环。
+func (el *EventLoop) Subscribe(filter EventFilter) (<-chan *Event, func()) {
+	return el.SubscribeWithOptions(filter, SubscribeOptions{})
+}
+
+// SubscribeWithOptions 按指定的缓冲区大小和丢弃策略订阅进入事件循环的事件
+func (el *EventLoop) SubscribeWithOptions(filter EventFilter, opts SubscribeOptions) (<-chan *Event, func()) {
+	sub := newEventSubscriber(filter, opts)
+	sub.events = make(chan *Event, subscriberBuffer(opts))
+	return sub.events, el.subscribers.add(el.subscribers.emitted, sub)
+}
+
+// SubscribeProcessed 订阅处理完成的事件，通知中包含各处理器的结果和耗时
+func (el *EventLoop) SubscribeProcessed(filter EventFilter, opts SubscribeOptions) (<-chan *EventRecord, func()) {
+	sub := newEventSubscriber(filter, opts)
+	sub.records = make(chan *EventRecord, subscriberBuffer(opts))
+	return sub.records, el.subscribers.add(el.subscribers.processed, sub)
+}
+
+// GetSubscriberCount 获取当前的订阅者数量
+func (el *EventLoop) GetSubscriberCount() int {
+	el.subscribers.mu.RLock()
+	defer el.subscribers.mu.RUnlock()
+	return len(el.subscribers.emitted) + len(el.subscribers.processed)
+}
+
+// GetSubscriberDropped 获取因订阅者过慢而丢弃的通知数量
+func (el *EventLoop) GetSubscriberDropped() int64 {
+	return el.subscriberDropped.Load()
+}
+
+// add 注册订阅者并返回取消订阅函数
+func (s *subscribers) add(set map[*eventSubscriber]struct{}, sub *eventSubscriber) func() {
+	s.mu.Lock()
+	set[sub] = struct{}{}
+	s.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			delete(set, sub)
+			s.mu.Unlock()
+			sub.close()
+		})
+	}
+}
+
+// closeAll 取消所有订阅，事件循环停止时调用
+func (s *subscribers) closeAll() {
+	s.mu.Lock()
+	subs := make([]*eventSubscriber, 0, len(s.emitted)+len(s.processed))
+	for sub := range s.emitted {
+		subs = append(subs, sub)
+	}
+	for sub := range s.processed {
+		subs = append(subs, sub)
+	}
+	s.emitted = make(map[*eventSubscriber]struct{})
+	s.processed = make(map[*eventSubscriber]struct{})
+	s.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.close()
+	}
+}
+
+// snapshot 复制订阅者列表，避免发送时持有锁
+func (s *subscribers) snapshot(set map[*eventSubscriber]struct{}) []*eventSubscriber {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	subs := make([]*eventSubscriber, 0, len(set))
+	for sub := range set {
+		subs = append(subs, sub)
+	}
+	return subs
+}
+
+// publishEmitted 通知订阅者有事件进入事件循环
+func (el *EventLoop) publishEmitted(event *Event) {
+	for _, sub := range el.subscribers.snapshot(el.subscribers.emitted) {
+		if sub.filter != nil && !sub.filter(event) {
+			continue
+		}
+		if !sub.sendEvent(event) {
+			el.subscriberDropped.Add(1)
+		}
+	}
+}
+
+// publishProcessed 通知订阅者事件已处理完成
+func (el *EventLoop) publishProcessed(record *EventRecord) {
+	for _, sub := range el.subscribers.snapshot(el.subscribers.processed) {
+		if sub.filter != nil && !sub.filter(record.Event) {
+			continue
+		}
+		if !sub.sendRecord(record) {
+			el.subscriberDropped.Add(1)
+		}
+	}
+}
+
+// sendEvent 非阻塞地发送事件，缓冲区已满时按丢弃策略处理，有事件被丢弃时返回false
+func (sub *eventSubscriber) sendEvent(event *Event) bool {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if sub.closed {
+		return true
+	}
+
+	select {
+	case sub.events <- event:
+		return true
+	default:
+	}
+	if sub.policy == SubscriberDropOldest {
+		select {
+		case <-sub.events:
+		default:
+		}
+		select {
+		case sub.events <- event:
+		default:
+		}
+	}
+	return false
+}
+
+// sendRecord 非阻塞地发送处理结果，缓冲区已满时按丢弃策略处理，有通知被丢弃时返回false
+func (sub *eventSubscriber) sendRecord(record *EventRecord) bool {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if sub.closed {
+		return true
+	}
+
+	select {
+	case sub.records <- record:
+		return true
+	default:
+	}
+	if sub.policy == SubscriberDropOldest {
+		select {
+		case <-sub.records:
+		default:
+		}
+		select {
+		case sub.records <- record:
+		default:
+		}
+	}
+	return false
+}
+
+// close 关闭订阅者的通道
+func (sub *eventSubscriber) close() {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	if sub.events != nil {
+		close(sub.events)
+	}
+	if sub.records != nil {
+		close(sub.records)
+	}
+}
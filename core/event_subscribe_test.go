@@ -0,0 +1,217 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEventTypeFilter(t *testing.T) {
+	tests := []struct {
+		name  string
+		types []EventType
+		event EventType
+		want  bool
+	}{
+		{name: "match", types: []EventType{EventTypeMessage}, event: EventTypeMessage, want: true},
+		{name: "one of several", types: []EventType{EventTypeCron, EventTypeSystem}, event: EventTypeSystem, want: true},
+		{name: "no match", types: []EventType{EventTypeCron}, event: EventTypeMessage},
+		{name: "no types", event: EventTypeMessage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EventTypeFilter(tt.types...)(&Event{Type: tt.event}); got != tt.want {
+				t.Errorf("filter = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubscriberDropPolicies(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        SubscribeOptions
+		wantKept    []string
+		wantDropped int
+	}{
+		{name: "drop newest by default", opts: SubscribeOptions{Buffer: 2}, wantKept: []string{"e0", "e1"}, wantDropped: 2},
+		{name: "drop oldest", opts: SubscribeOptions{Buffer: 2, DropPolicy: SubscriberDropOldest}, wantKept: []string{"e2", "e3"}, wantDropped: 2},
+		{name: "room for all", opts: SubscribeOptions{Buffer: 8}, wantKept: []string{"e0", "e1", "e2", "e3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub := newEventSubscriber(nil, tt.opts)
+			sub.events = make(chan *Event, subscriberBuffer(tt.opts))
+
+			dropped := 0
+			for i := 0; i < 4; i++ {
+				if !sub.sendEvent(&Event{ID: fmt.Sprintf("e%d", i)}) {
+					dropped++
+				}
+			}
+			sub.close()
+
+			var kept []string
+			for event := range sub.events {
+				kept = append(kept, event.ID)
+			}
+			if !reflect.DeepEqual(kept, tt.wantKept) {
+				t.Errorf("kept %v, want %v", kept, tt.wantKept)
+			}
+			if dropped != tt.wantDropped {
+				t.Errorf("dropped %d, want %d", dropped, tt.wantDropped)
+			}
+		})
+	}
+}
+
+func TestSubscriberSendAfterClose(t *testing.T) {
+	sub := newEventSubscriber(nil, SubscribeOptions{})
+	sub.records = make(chan *EventRecord, 1)
+	sub.close()
+	sub.close()
+	if !sub.sendRecord(&EventRecord{Event: &Event{}}) {
+		t.Error("a send to a closed subscriber counted as a drop")
+	}
+}
+
+func TestEventLoopSubscribe(t *testing.T) {
+	el := startTestLoop(t, nil, nil)
+	el.RegisterHandler(&funcEventHandler{types: []EventType{EventTypeMessage}})
+
+	all, unsubscribeAll := el.Subscribe(nil)
+	defer unsubscribeAll()
+	cron, unsubscribeCron := el.Subscribe(EventTypeFilter(EventTypeCron))
+	defer unsubscribeCron()
+
+	el.Emit(&Event{ID: "msg", Type: EventTypeMessage})
+	el.Emit(&Event{ID: "tick", Type: EventTypeCron})
+
+	for _, want := range []string{"msg", "tick"} {
+		if event := receiveEvent(t, all); event.ID != want {
+			t.Errorf("all subscriber got %s, want %s", event.ID, want)
+		}
+	}
+	if event := receiveEvent(t, cron); event.ID != "tick" {
+		t.Errorf("cron subscriber got %s, want tick", event.ID)
+	}
+	select {
+	case event := <-cron:
+		t.Errorf("cron subscriber also got %s", event.ID)
+	default:
+	}
+}
+
+func receiveEvent(t *testing.T, ch <-chan *Event) *Event {
+	t.Helper()
+	select {
+	case event := <-ch:
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for an event")
+		return nil
+	}
+}
+
+func TestEventLoopSubscribeProcessed(t *testing.T) {
+	el := startTestLoop(t, nil, &EventLoopConfig{Retry: &RetryPolicy{MaxAttempts: 1}})
+	el.RegisterHandler(&funcEventHandler{types: []EventType{EventTypeMessage}, handle: func(ctx context.Context, event *Event) error {
+		time.Sleep(5 * time.Millisecond)
+		if event.ID == "bad" {
+			return errors.New("boom")
+		}
+		return nil
+	}})
+
+	records, unsubscribe := el.SubscribeProcessed(nil, SubscribeOptions{})
+	defer unsubscribe()
+
+	tests := []struct {
+		name        string
+		event       *Event
+		wantHandled bool
+		wantError   bool
+	}{
+		{name: "success", event: &Event{ID: "good", Type: EventTypeMessage}, wantHandled: true},
+		{name: "failure", event: &Event{ID: "bad", Type: EventTypeMessage}, wantHandled: true, wantError: true},
+		{name: "subscribers do not count as handlers", event: &Event{ID: "unhandled", Type: EventTypeSystem}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			el.Emit(tt.event)
+			var record *EventRecord
+			select {
+			case record = <-records:
+			case <-time.After(2 * time.Second):
+				t.Fatal("timed out waiting for a record")
+			}
+
+			if record.Event.ID != tt.event.ID || record.Handled != tt.wantHandled {
+				t.Fatalf("record = %s handled %v, want %s handled %v", record.Event.ID, record.Handled, tt.event.ID, tt.wantHandled)
+			}
+			if !tt.wantHandled {
+				return
+			}
+			handler := record.Handlers[0]
+			if (handler.Error != "") != tt.wantError {
+				t.Errorf("handler error = %q, want error %v", handler.Error, tt.wantError)
+			}
+			if handler.Duration < 5*time.Millisecond || record.Duration < handler.Duration {
+				t.Errorf("durations: handler %s, event %s", handler.Duration, record.Duration)
+			}
+		})
+	}
+}
+
+func TestSlowSubscriberDoesNotBlockLoop(t *testing.T) {
+	el := startTestLoop(t, nil, nil)
+	var handled atomic.Int32
+	el.RegisterHandler(&funcEventHandler{handle: func(ctx context.Context, event *Event) error {
+		handled.Add(1)
+		return nil
+	}})
+
+	_, unsubscribe := el.SubscribeWithOptions(nil, SubscribeOptions{Buffer: 1})
+	defer unsubscribe()
+	_, unsubscribeProcessed := el.SubscribeProcessed(nil, SubscribeOptions{Buffer: 1})
+	defer unsubscribeProcessed()
+
+	for i := 0; i < 10; i++ {
+		if err := el.Emit(&Event{Type: EventTypeMessage}); err != nil {
+			t.Fatalf("Emit: %v", err)
+		}
+	}
+	waitFor(t, 2*time.Second, "all events handled", func() bool { return handled.Load() == 10 })
+	waitFor(t, time.Second, "dropped notifications", func() bool { return el.GetSubscriberDropped() == 18 })
+}
+
+func TestUnsubscribe(t *testing.T) {
+	el := startTestLoop(t, nil, nil)
+	events, unsubscribe := el.Subscribe(nil)
+	records, unsubscribeProcessed := el.SubscribeProcessed(nil, SubscribeOptions{})
+	if el.GetSubscriberCount() != 2 {
+		t.Fatalf("GetSubscriberCount = %d, want 2", el.GetSubscriberCount())
+	}
+
+	unsubscribe()
+	unsubscribe()
+	if _, ok := <-events; ok {
+		t.Error("event channel still open after unsubscribe")
+	}
+	if el.GetSubscriberCount() != 1 {
+		t.Errorf("GetSubscriberCount = %d, want 1", el.GetSubscriberCount())
+	}
+
+	el.Stop()
+	if _, ok := <-records; ok {
+		t.Error("record channel still open after Stop")
+	}
+	unsubscribeProcessed()
+	if el.GetSubscriberCount() != 0 {
+		t.Errorf("GetSubscriberCount = %d after Stop", el.GetSubscriberCount())
+	}
+}
@@ -0,0 +1,84 @@
+package core
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// HandlerID 注册处理器时返回的句柄，用于注销和替换处理器
+type HandlerID uint64
+
+// HandlerStats 处理器的调用统计
+type HandlerStats struct {
+	Invocations     uint64    `json:"invocations"`
+	Failures        uint64    `json:"failures"`
+	TotalDurationMs float64   `json:"total_duration_ms"`
+	AvgDurationMs   float64   `json:"avg_duration_ms"`
+	LastInvoked     time.Time `json:"last_invoked,omitempty"`
+	LastError       string    `json:"last_error,omitempty"`
+}
+
+// HandlerInfo 已注册处理器的描述，用于内省
+type HandlerInfo struct {
+	ID       HandlerID    `json:"id"`
+	Name     string       `json:"name"`
+	Types    []string     `json:"types"`
+	Dynamic  bool         `json:"dynamic,omitempty"`  // 通过CanHandle匹配，Types只列出内置类型中能处理的部分
+	Priority *int         `json:"priority,omitempty"` // 只有消息处理器有优先级
+	Stats    HandlerStats `json:"stats"`
+}
+
+// knownMessageTypes 内置的消息类型，用于列出只实现了CanHandle的处理器能处理的类型
+var knownMessageTypes = []MessageType{
+	MessageTypeUserInput,
+	MessageTypeSystemEvent,
+	MessageTypeToolResponse,
+	MessageTypeAgentMessage,
+	MessageTypeExternalEvent,
+	MessageTypeMemoryStore,
+	MessageTypeMemoryGet,
+	MessageTypeMemoryDelete,
+}
+
+// knownEventTypes 内置的事件类型，用于列出事件处理器能处理的类型
+var knownEventTypes = []EventType{
+	EventTypeMessage,
+	EventTypeToolCall,
+	EventTypeSystem,
+	EventTypeHeartbeat,
+	EventTypeCron,
+	EventTypeMessageResult,
+}
+
+// handlerStats 并发安全的调用统计
+type handlerStats struct {
+	mu    sync.Mutex
+	stats HandlerStats
+}
+
+// observe 记录一次调用，ErrStopPropagation不计为失败
+func (s *handlerStats) observe(start time.Time, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stats.Invocations++
+	s.stats.TotalDurationMs += float64(time.Since(start)) / float64(time.Millisecond)
+	s.stats.LastInvoked = start
+	if err != nil && !errors.Is(err, ErrStopPropagation) {
+		s.stats.Failures++
+		s.stats.LastError = err.Error()
+	}
+}
+
+// snapshot 返回统计副本
+func (s *handlerStats) snapshot() HandlerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := s.stats
+	if stats.Invocations > 0 {
+		stats.AvgDurationMs = stats.TotalDurationMs / float64(stats.Invocations)
+	}
+	return stats
+}
@@ -0,0 +1,236 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHandlerStats(t *testing.T) {
+	tests := []struct {
+		name         string
+		errs         []error
+		wantFailures uint64
+		wantLast     string
+	}{
+		{name: "successes", errs: []error{nil, nil}},
+		{name: "failures", errs: []error{errors.New("first"), nil, errors.New("second")}, wantFailures: 2, wantLast: "second"},
+		{name: "stop propagation is not a failure", errs: []error{ErrStopPropagation}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stats handlerStats
+			if got := stats.snapshot(); got.AvgDurationMs != 0 || got.Invocations != 0 {
+				t.Errorf("empty stats = %+v", got)
+			}
+			for _, err := range tt.errs {
+				stats.observe(time.Now().Add(-time.Millisecond), err)
+			}
+
+			got := stats.snapshot()
+			if got.Invocations != uint64(len(tt.errs)) || got.Failures != tt.wantFailures || got.LastError != tt.wantLast {
+				t.Errorf("stats = %+v", got)
+			}
+			if got.AvgDurationMs < 1 || got.TotalDurationMs < got.AvgDurationMs {
+				t.Errorf("durations = total %f avg %f", got.TotalDurationMs, got.AvgDurationMs)
+			}
+		})
+	}
+}
+
+func TestRouterUnregisterHandler(t *testing.T) {
+	var calls []string
+	router := NewMessageRouter()
+	first := router.RegisterHandler(&funcMessageHandler{priority: 1, handle: func(ctx context.Context, msg *Message) error {
+		calls = append(calls, "first")
+		return nil
+	}})
+	router.RegisterHandler(&funcMessageHandler{priority: 2, handle: func(ctx context.Context, msg *Message) error {
+		calls = append(calls, "second")
+		return nil
+	}})
+
+	if !router.UnregisterHandler(first) {
+		t.Fatal("UnregisterHandler returned false")
+	}
+	if router.UnregisterHandler(first) {
+		t.Error("a second UnregisterHandler returned true")
+	}
+	router.Route(context.Background(), &Message{ID: "m1", Type: MessageTypeUserInput})
+	if !reflect.DeepEqual(calls, []string{"second"}) {
+		t.Errorf("handlers called %v, want only the remaining one", calls)
+	}
+}
+
+func TestRouterReplaceHandler(t *testing.T) {
+	var calls []string
+	record := func(name string) func(ctx context.Context, msg *Message) error {
+		return func(ctx context.Context, msg *Message) error {
+			calls = append(calls, name)
+			return nil
+		}
+	}
+
+	router := NewMessageRouter()
+	id, _ := router.RegisterNamedHandler("plugin", &funcMessageHandler{priority: 1, handle: record("v1")})
+	router.RegisterHandler(&funcMessageHandler{priority: 5, handle: record("other")})
+	router.Route(context.Background(), &Message{ID: "m1", Type: MessageTypeUserInput})
+
+	// The new version has a lower priority and moves behind the other handler
+	if err := router.ReplaceHandler(id, &funcMessageHandler{priority: 10, handle: record("v2")}); err != nil {
+		t.Fatalf("ReplaceHandler: %v", err)
+	}
+	calls = nil
+	router.Route(context.Background(), &Message{ID: "m2", Type: MessageTypeUserInput, Target: "plugin"})
+	router.Route(context.Background(), &Message{ID: "m3", Type: MessageTypeUserInput})
+	if want := []string{"v2", "other", "v2"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("handlers called %v, want %v", calls, want)
+	}
+
+	info := router.Handlers()[1]
+	if info.ID != id || info.Name != "plugin" || *info.Priority != 10 || info.Stats.Invocations != 3 {
+		t.Errorf("replaced handler info = %+v, want the handle, name and stats kept", info)
+	}
+	if err := router.ReplaceHandler(HandlerID(999), &funcMessageHandler{}); !errors.Is(err, ErrHandlerNotRegistered) {
+		t.Errorf("ReplaceHandler(missing) = %v, want ErrHandlerNotRegistered", err)
+	}
+}
+
+func TestRouterReplaceDuringRoute(t *testing.T) {
+	router := NewMessageRouter()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	id := router.RegisterHandler(&funcMessageHandler{handle: func(ctx context.Context, msg *Message) error {
+		close(started)
+		<-release
+		return nil
+	}})
+
+	done := make(chan error, 1)
+	go func() { done <- router.Route(context.Background(), &Message{ID: "m1", Type: MessageTypeUserInput}) }()
+	<-started
+
+	// Registration changes do not wait for, or disturb, the running call
+	var replaced atomic.Bool
+	if err := router.ReplaceHandler(id, &funcMessageHandler{handle: func(ctx context.Context, msg *Message) error {
+		replaced.Store(true)
+		return nil
+	}}); err != nil {
+		t.Fatalf("ReplaceHandler: %v", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("Route: %v", err)
+	}
+	if replaced.Load() {
+		t.Error("the running call switched to the new handler")
+	}
+
+	router.Route(context.Background(), &Message{ID: "m2", Type: MessageTypeUserInput})
+	if !replaced.Load() {
+		t.Error("the next message did not reach the new handler")
+	}
+}
+
+func TestEventLoopUnregisterAndReplaceHandler(t *testing.T) {
+	el := startTestLoop(t, nil, nil)
+	history, _ := NewEventHistory(testLogger(), nil)
+	el.SetHistory(history)
+
+	var mu sync.Mutex
+	var calls []string
+	record := func(name string) func(ctx context.Context, event *Event) error {
+		return func(ctx context.Context, event *Event) error {
+			mu.Lock()
+			calls = append(calls, name)
+			mu.Unlock()
+			return nil
+		}
+	}
+	emit := func(n int) {
+		t.Helper()
+		el.Emit(&Event{Type: EventTypeMessage})
+		waitFor(t, time.Second, "event processed", func() bool { return history.Len() == n })
+	}
+
+	first := el.RegisterHandler(&funcEventHandler{handle: record("first")})
+	second := el.RegisterHandler(&funcEventHandler{handle: record("second")})
+	emit(1)
+
+	if err := el.ReplaceHandler(first, &funcEventHandler{handle: record("first-v2")}); err != nil {
+		t.Fatalf("ReplaceHandler: %v", err)
+	}
+	emit(2)
+
+	if !el.UnregisterHandler(second) || el.UnregisterHandler(second) {
+		t.Fatal("UnregisterHandler did not remove the handler exactly once")
+	}
+	emit(3)
+
+	mu.Lock()
+	got := append([]string(nil), calls...)
+	mu.Unlock()
+	if want := []string{"first", "second", "first-v2", "second", "first-v2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("handlers called %v, want %v", got, want)
+	}
+
+	infos := el.Handlers()
+	if len(infos) != 1 || infos[0].ID != first || infos[0].Stats.Invocations != 3 {
+		t.Errorf("handlers = %+v, want the replaced handler with its stats", infos)
+	}
+	if err := el.ReplaceHandler(second, &funcEventHandler{}); !errors.Is(err, ErrHandlerNotRegistered) {
+		t.Errorf("ReplaceHandler(unregistered) = %v, want ErrHandlerNotRegistered", err)
+	}
+}
+
+func TestHandlersEndpoint(t *testing.T) {
+	el := startTestLoop(t, nil, nil)
+	el.RegisterHandler(&funcEventHandler{types: []EventType{EventTypeCron, EventTypeSystem}})
+	ws := newTestWebServer(t, el)
+
+	router := NewMessageRouter()
+	router.RegisterNamedHandler("memory", &typedMessageHandler{funcMessageHandler{priority: 3}, []MessageType{"memory_*"}})
+	router.Route(context.Background(), &Message{ID: "m1", Type: MessageTypeMemoryGet})
+	ws.agent.messageRouter = router
+
+	rec := serveTestRequest(ws, "GET", "/api/v1/handlers", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	var resp handlersResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		infos        []HandlerInfo
+		wantName     string
+		wantTypes    []string
+		wantPriority bool
+		wantCalls    uint64
+	}{
+		{name: "message handler", infos: resp.MessageHandlers, wantName: "memory", wantTypes: []string{"memory_*"}, wantPriority: true, wantCalls: 1},
+		{name: "event handler", infos: resp.EventHandlers, wantName: handlerName(&funcEventHandler{}), wantTypes: []string{"system", "cron"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if len(tt.infos) != 1 {
+				t.Fatalf("%d handlers, want 1", len(tt.infos))
+			}
+			info := tt.infos[0]
+			if info.Name != tt.wantName || !reflect.DeepEqual(info.Types, tt.wantTypes) {
+				t.Errorf("info = %+v, want %s handling %v", info, tt.wantName, tt.wantTypes)
+			}
+			if (info.Priority != nil) != tt.wantPriority || info.Stats.Invocations != tt.wantCalls {
+				t.Errorf("priority %v, invocations %d", info.Priority, info.Stats.Invocations)
+			}
+		})
+	}
+}
@@ -14,6 +14,16 @@ func (h *ExampleHandler) CanHandle(msgType core.MessageType) bool {
 	return msgType == core.MessageType("example")
 }
 
+// MessageTypes declares the message types this handler serves
+func (h *ExampleHandler) MessageTypes() []core.MessageType {
+	return []core.MessageType{"example"}
+}
+
+// Priority returns the handler priority
+func (h *ExampleHandler) Priority() int {
+	return 100
+}
+
 // Handle processes example messages
 func (h *ExampleHandler) Handle(ctx context.Context, msg *core.Message) error {
 	// Convert payload to map for safe access
@@ -0,0 +1,288 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// HealthStatus summarises the agent's liveness
+type HealthStatus string
+
+const (
+	HealthHealthy   HealthStatus = "healthy"
+	HealthDegraded  HealthStatus = "degraded"
+	HealthUnhealthy HealthStatus = "unhealthy"
+)
+
+const (
+	// DefaultHeartbeatInterval is how often heartbeat events are emitted
+	DefaultHeartbeatInterval = 10 * time.Second
+	// DefaultHeartbeatStallTimeout is how long a heartbeat may stay unprocessed before the loop counts as stalled
+	DefaultHeartbeatStallTimeout = 30 * time.Second
+	// DefaultHeartbeatDegradedLatency is the end-to-end latency above which the loop counts as degraded
+	DefaultHeartbeatDegradedLatency = time.Second
+
+	// degradedQueueRatio is the queue fill ratio above which the loop counts as degraded
+	degradedQueueRatio = 0.8
+	// maxOutstandingHeartbeats bounds the heartbeats tracked while the loop is stalled
+	maxOutstandingHeartbeats = 100
+)
+
+// HeartbeatConfig holds heartbeat and watchdog configuration
+type HeartbeatConfig struct {
+	Interval        time.Duration `yaml:"interval"`
+	StallTimeout    time.Duration `yaml:"stall_timeout"`
+	DegradedLatency time.Duration `yaml:"degraded_latency"`
+}
+
+// HeartbeatStatus is a snapshot of the heartbeat producer and watchdog
+type HeartbeatStatus struct {
+	Status        HealthStatus `json:"status"`
+	Reasons       []string     `json:"reasons,omitempty"`
+	Stalled       bool         `json:"stalled"`
+	LastSent      time.Time    `json:"last_sent,omitempty"`
+	LastProcessed time.Time    `json:"last_processed,omitempty"`
+	LastLatencyMs float64      `json:"last_latency_ms"`
+	Outstanding   int          `json:"outstanding"`
+	Sent          uint64       `json:"sent"`
+	Processed     uint64       `json:"processed"`
+	Failed        uint64       `json:"failed"`
+}
+
+// Heartbeat periodically emits heartbeat events through the event loop, measures
+// how long they take to be processed and flags the loop as stalled when they stop
+// coming back.
+type Heartbeat struct {
+	eventLoop *EventLoop
+	logger    *logrus.Logger
+	config    *HeartbeatConfig
+
+	mu            sync.Mutex
+	outstanding   map[string]time.Time
+	lastSent      time.Time
+	lastProcessed time.Time
+	lastLatency   time.Duration
+	lastEmitErr   error
+	stalled       bool
+	sent          uint64
+	processed     uint64
+	failed        uint64
+}
+
+// NewHeartbeat creates a heartbeat producer for the event loop
+func NewHeartbeat(logger *logrus.Logger, eventLoop *EventLoop, config *HeartbeatConfig) *Heartbeat {
+	if logger == nil {
+		logger = logrus.New()
+	}
+	if config == nil {
+		config = &HeartbeatConfig{}
+	}
+	if config.Interval <= 0 {
+		config.Interval = DefaultHeartbeatInterval
+	}
+	if config.StallTimeout <= 0 {
+		config.StallTimeout = DefaultHeartbeatStallTimeout
+	}
+	if config.DegradedLatency <= 0 {
+		config.DegradedLatency = DefaultHeartbeatDegradedLatency
+	}
+
+	h := &Heartbeat{
+		eventLoop:   eventLoop,
+		logger:      logger,
+		config:      config,
+		outstanding: make(map[string]time.Time),
+	}
+	// Observe processed heartbeats asynchronously so the watchdog never holds up a worker;
+	// the subscription ends when the event loop stops
+	records, _ := eventLoop.SubscribeProcessed(EventTypeFilter(EventTypeHeartbeat), SubscribeOptions{
+		Buffer:     maxOutstandingHeartbeats,
+		DropPolicy: SubscriberDropOldest,
+	})
+	go h.observe(records)
+	return h
+}
+
+// observe records the latency of processed heartbeats until the subscription is closed
+func (h *Heartbeat) observe(records <-chan *EventRecord) {
+	for record := range records {
+		h.onEvent(record.Event)
+	}
+}
+
+// Start emits heartbeats and runs the watchdog until ctx is done
+func (h *Heartbeat) Start(ctx context.Context) {
+	ticker := time.NewTicker(h.config.Interval)
+	defer ticker.Stop()
+
+	h.beat()
+	for {
+		select {
+		case <-ticker.C:
+			h.watch()
+			h.beat()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// beat emits a single heartbeat event
+func (h *Heartbeat) beat() {
+	now := time.Now()
+	id := GenerateMessageID()
+	event := &Event{
+		ID:        id,
+		Type:      EventTypeHeartbeat,
+		Timestamp: now,
+	}
+
+	h.mu.Lock()
+	h.outstanding[id] = now
+	if len(h.outstanding) > maxOutstandingHeartbeats {
+		h.forgetOldestLocked()
+	}
+	h.lastSent = now
+	h.sent++
+	h.mu.Unlock()
+
+	err := h.eventLoop.Emit(event)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastEmitErr = err
+	if err != nil {
+		delete(h.outstanding, id)
+		h.failed++
+		h.logger.WithError(err).Warn("Failed to emit heartbeat")
+	}
+}
+
+// onEvent records the latency of processed heartbeats
+func (h *Heartbeat) onEvent(event *Event) {
+	if event.Type != EventTypeHeartbeat {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sentAt, ok := h.outstanding[event.ID]
+	if !ok {
+		// Replayed from the journal or emitted by someone else
+		return
+	}
+
+	now := time.Now()
+	h.lastProcessed = now
+	h.lastLatency = now.Sub(sentAt)
+	h.processed++
+
+	// Heartbeats share a partition and are processed in order, so older ones still
+	// outstanding were lost (for example dropped by the overflow policy)
+	for otherID, otherSentAt := range h.outstanding {
+		if !otherSentAt.After(sentAt) {
+			delete(h.outstanding, otherID)
+		}
+	}
+}
+
+// watch logs transitions into and out of the stalled state
+func (h *Heartbeat) watch() {
+	h.mu.Lock()
+	oldest := h.oldestOutstandingLocked()
+	stalled := !oldest.IsZero() && time.Since(oldest) > h.config.StallTimeout
+	changed := stalled != h.stalled
+	h.stalled = stalled
+	h.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	if stalled {
+		h.logger.Errorf("Event loop stalled: heartbeat unprocessed for %s", time.Since(oldest).Round(time.Millisecond))
+	} else {
+		h.logger.Info("Event loop recovered, heartbeats are being processed again")
+	}
+}
+
+// Status evaluates the current health of the event loop
+func (h *Heartbeat) Status() HeartbeatStatus {
+	h.mu.Lock()
+	status := HeartbeatStatus{
+		LastSent:      h.lastSent,
+		LastProcessed: h.lastProcessed,
+		LastLatencyMs: float64(h.lastLatency) / float64(time.Millisecond),
+		Outstanding:   len(h.outstanding),
+		Sent:          h.sent,
+		Processed:     h.processed,
+		Failed:        h.failed,
+	}
+	oldest := h.oldestOutstandingLocked()
+	latency := h.lastLatency
+	emitErr := h.lastEmitErr
+	h.mu.Unlock()
+
+	var unhealthy, degraded []string
+	if !h.eventLoop.IsRunning() {
+		unhealthy = append(unhealthy, "event loop is not running")
+	}
+	if !oldest.IsZero() {
+		if age := time.Since(oldest); age > h.config.StallTimeout {
+			status.Stalled = true
+			unhealthy = append(unhealthy, fmt.Sprintf("heartbeat unprocessed for %s", age.Round(time.Millisecond)))
+		} else if age > h.config.DegradedLatency {
+			degraded = append(degraded, fmt.Sprintf("heartbeat pending for %s", age.Round(time.Millisecond)))
+		}
+	}
+	if latency > h.config.DegradedLatency {
+		degraded = append(degraded, fmt.Sprintf("heartbeat latency %s", latency.Round(time.Millisecond)))
+	}
+	if emitErr != nil {
+		degraded = append(degraded, fmt.Sprintf("heartbeat emit failed: %v", emitErr))
+	}
+	if capacity := h.eventLoop.QueueCapacity(); capacity > 0 {
+		if length := h.eventLoop.GetQueueDepth(); float64(length) >= degradedQueueRatio*float64(capacity) {
+			degraded = append(degraded, fmt.Sprintf("event queue %d/%d", length, capacity))
+		}
+	}
+
+	switch {
+	case len(unhealthy) > 0:
+		status.Status = HealthUnhealthy
+	case len(degraded) > 0:
+		status.Status = HealthDegraded
+	default:
+		status.Status = HealthHealthy
+	}
+	status.Reasons = append(unhealthy, degraded...)
+	return status
+}
+
+// oldestOutstandingLocked returns when the oldest unprocessed heartbeat was sent; callers must hold h.mu
+func (h *Heartbeat) oldestOutstandingLocked() time.Time {
+	var oldest time.Time
+	for _, sentAt := range h.outstanding {
+		if oldest.IsZero() || sentAt.Before(oldest) {
+			oldest = sentAt
+		}
+	}
+	return oldest
+}
+
+// forgetOldestLocked stops tracking the oldest unprocessed heartbeat; callers must hold h.mu
+func (h *Heartbeat) forgetOldestLocked() {
+	var oldestID string
+	var oldest time.Time
+	for id, sentAt := range h.outstanding {
+		if oldestID == "" || sentAt.Before(oldest) {
+			oldestID = id
+			oldest = sentAt
+		}
+	}
+	delete(h.outstanding, oldestID)
+}
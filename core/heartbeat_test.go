@@ -0,0 +1,248 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestNewHeartbeatDefaults(t *testing.T) {
+	h := NewHeartbeat(testLogger(), startTestLoop(t, nil, nil), nil)
+	if h.config.Interval != DefaultHeartbeatInterval ||
+		h.config.StallTimeout != DefaultHeartbeatStallTimeout ||
+		h.config.DegradedLatency != DefaultHeartbeatDegradedLatency {
+		t.Errorf("config = %+v, want the defaults", h.config)
+	}
+}
+
+func TestHeartbeatMeasuresLatency(t *testing.T) {
+	el := startTestLoop(t, nil, nil)
+	h := NewHeartbeat(testLogger(), el, &HeartbeatConfig{})
+
+	h.beat()
+	waitFor(t, time.Second, "heartbeat processed", func() bool { return h.Status().Processed == 1 })
+
+	status := h.Status()
+	if status.Status != HealthHealthy || len(status.Reasons) != 0 {
+		t.Errorf("status = %s %v, want healthy", status.Status, status.Reasons)
+	}
+	if status.Sent != 1 || status.Outstanding != 0 || status.Failed != 0 {
+		t.Errorf("counters = %+v", status)
+	}
+	if status.LastProcessed.Before(status.LastSent) || status.LastLatencyMs < 0 {
+		t.Errorf("latency bookkeeping = %+v", status)
+	}
+}
+
+func TestHeartbeatSubscribesToProcessedEvents(t *testing.T) {
+	el := startTestLoop(t, nil, nil)
+	NewHeartbeat(testLogger(), el, nil)
+	if got := el.GetSubscriberCount(); got != 1 {
+		t.Fatalf("subscribers = %d, want the heartbeat watchdog", got)
+	}
+	el.Stop()
+	if got := el.GetSubscriberCount(); got != 0 {
+		t.Errorf("subscribers after Stop = %d, want 0", got)
+	}
+}
+
+func TestHeartbeatIgnoresForeignHeartbeats(t *testing.T) {
+	el := startTestLoop(t, nil, nil)
+	h := NewHeartbeat(testLogger(), el, nil)
+
+	h.onEvent(&Event{ID: "replayed", Type: EventTypeHeartbeat})
+	h.onEvent(&Event{ID: "other", Type: EventTypeMessage})
+	if got := h.Status().Processed; got != 0 {
+		t.Errorf("processed = %d, want 0", got)
+	}
+}
+
+func TestHeartbeatForgetsLostHeartbeats(t *testing.T) {
+	el := startTestLoop(t, nil, nil)
+	h := NewHeartbeat(testLogger(), el, nil)
+
+	now := time.Now()
+	h.outstanding["lost"] = now.Add(-2 * time.Second)
+	h.outstanding["processed"] = now.Add(-time.Second)
+	h.outstanding["pending"] = now
+
+	h.onEvent(&Event{ID: "processed", Type: EventTypeHeartbeat})
+	if _, ok := h.outstanding["lost"]; ok {
+		t.Error("an older heartbeat is still outstanding after a newer one was processed")
+	}
+	if _, ok := h.outstanding["pending"]; !ok {
+		t.Error("a newer heartbeat was forgotten")
+	}
+}
+
+func TestHeartbeatBoundsOutstanding(t *testing.T) {
+	el := NewEventLoop(context.Background(), testLogger(), 10) // not started, so emits fail
+	h := NewHeartbeat(testLogger(), el, nil)
+
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i < maxOutstandingHeartbeats; i++ {
+		h.outstanding[fmt.Sprintf("hb-%d", i)] = start.Add(time.Duration(i) * time.Second)
+	}
+	h.beat()
+
+	// The new heartbeat pushed out the oldest one and was then dropped because its emit failed
+	status := h.Status()
+	if status.Outstanding != maxOutstandingHeartbeats-1 {
+		t.Errorf("outstanding = %d, want %d", status.Outstanding, maxOutstandingHeartbeats-1)
+	}
+	if _, ok := h.outstanding["hb-0"]; ok {
+		t.Error("the oldest heartbeat was not forgotten")
+	}
+	if status.Failed != 1 {
+		t.Errorf("failed = %d, want 1", status.Failed)
+	}
+}
+
+func TestHeartbeatStatus(t *testing.T) {
+	tests := []struct {
+		name        string
+		stopped     bool
+		pendingFor  time.Duration // age of the single outstanding heartbeat, 0 for none
+		latency     time.Duration
+		emitErr     error
+		fillQueue   bool
+		want        HealthStatus
+		wantStalled bool
+		wantReasons int
+	}{
+		{name: "healthy", want: HealthHealthy},
+		{name: "slow heartbeat", latency: 2 * time.Second, want: HealthDegraded, wantReasons: 1},
+		{name: "pending heartbeat", pendingFor: 5 * time.Second, want: HealthDegraded, wantReasons: 1},
+		{name: "emit failed", emitErr: ErrEventQueueFull, want: HealthDegraded, wantReasons: 1},
+		{name: "queue nearly full", fillQueue: true, want: HealthDegraded, wantReasons: 1},
+		{name: "stalled", pendingFor: 2 * time.Minute, want: HealthUnhealthy, wantStalled: true, wantReasons: 1},
+		{name: "stalled and slow", pendingFor: 2 * time.Minute, latency: 2 * time.Second, want: HealthUnhealthy, wantStalled: true, wantReasons: 2},
+		{name: "loop stopped", stopped: true, want: HealthUnhealthy, wantReasons: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var el *EventLoop
+			if tt.fillQueue {
+				el, _, _ = saturatedLoop(t, &EventLoopConfig{MaxQueueSize: 10})
+			} else {
+				el = startTestLoop(t, nil, nil)
+			}
+			h := NewHeartbeat(testLogger(), el, &HeartbeatConfig{StallTimeout: time.Minute, DegradedLatency: time.Second})
+			if tt.pendingFor > 0 {
+				h.outstanding["pending"] = time.Now().Add(-tt.pendingFor)
+			}
+			h.lastLatency = tt.latency
+			h.lastEmitErr = tt.emitErr
+			if tt.stopped {
+				el.Stop()
+			}
+
+			status := h.Status()
+			if status.Status != tt.want {
+				t.Errorf("status = %s, want %s (reasons %v)", status.Status, tt.want, status.Reasons)
+			}
+			if status.Stalled != tt.wantStalled {
+				t.Errorf("stalled = %v, want %v", status.Stalled, tt.wantStalled)
+			}
+			if len(status.Reasons) != tt.wantReasons {
+				t.Errorf("reasons = %v, want %d", status.Reasons, tt.wantReasons)
+			}
+		})
+	}
+}
+
+func TestHeartbeatWatchdogLogsTransitions(t *testing.T) {
+	logger, hook := logtest.NewNullLogger()
+	el := startTestLoop(t, nil, nil)
+	h := NewHeartbeat(logger, el, &HeartbeatConfig{StallTimeout: time.Second})
+
+	h.watch()
+	if len(hook.AllEntries()) != 0 {
+		t.Fatalf("watchdog logged without a transition: %v", hook.AllEntries())
+	}
+
+	h.outstanding["stuck"] = time.Now().Add(-time.Minute)
+	h.watch()
+	h.watch()
+	if entries := hook.AllEntries(); len(entries) != 1 || entries[0].Level != logrus.ErrorLevel {
+		t.Fatalf("entries after stalling = %v, want one error", entries)
+	}
+
+	h.onEvent(&Event{ID: "stuck", Type: EventTypeHeartbeat})
+	h.watch()
+	if entry := hook.LastEntry(); len(hook.AllEntries()) != 2 || entry.Level != logrus.InfoLevel {
+		t.Errorf("entries after recovery = %v, want an info entry", hook.AllEntries())
+	}
+}
+
+func TestHeartbeatStartEmitsPeriodically(t *testing.T) {
+	el := startTestLoop(t, nil, nil)
+	h := NewHeartbeat(testLogger(), el, &HeartbeatConfig{Interval: 10 * time.Millisecond})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		h.Start(ctx)
+		close(done)
+	}()
+	waitFor(t, 2*time.Second, "several heartbeats", func() bool { return h.Status().Processed >= 3 })
+	cancel()
+	<-done
+}
+
+func TestHealthEndpoint(t *testing.T) {
+	tests := []struct {
+		name          string
+		stopped       bool
+		heartbeat     bool
+		stuck         bool
+		wantCode      int
+		wantStatus    HealthStatus
+		wantHeartbeat bool
+	}{
+		{name: "healthy without heartbeat", wantCode: http.StatusOK, wantStatus: HealthHealthy},
+		{name: "loop stopped", stopped: true, wantCode: http.StatusServiceUnavailable, wantStatus: HealthUnhealthy},
+		{name: "healthy heartbeat", heartbeat: true, wantCode: http.StatusOK, wantStatus: HealthHealthy, wantHeartbeat: true},
+		{name: "stalled heartbeat", heartbeat: true, stuck: true, wantCode: http.StatusServiceUnavailable, wantStatus: HealthUnhealthy, wantHeartbeat: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			el := startTestLoop(t, nil, nil)
+			ws := newTestWebServer(t, el)
+			ws.agent.startedAt = time.Now().Add(-time.Hour)
+			if tt.heartbeat {
+				ws.agent.heartbeat = NewHeartbeat(testLogger(), el, &HeartbeatConfig{StallTimeout: time.Second})
+				if tt.stuck {
+					ws.agent.heartbeat.outstanding["stuck"] = time.Now().Add(-time.Minute)
+				}
+			}
+			if tt.stopped {
+				el.Stop()
+			}
+
+			rec := serveTestRequest(ws, "GET", "/health", "")
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status code = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			var resp healthResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if resp.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", resp.Status, tt.wantStatus)
+			}
+			if (resp.Heartbeat != nil) != tt.wantHeartbeat {
+				t.Errorf("heartbeat = %+v, want present %v", resp.Heartbeat, tt.wantHeartbeat)
+			}
+			if resp.UptimeSeconds < 3600 || resp.QueueCapacity == 0 {
+				t.Errorf("uptime %.0fs, capacity %d", resp.UptimeSeconds, resp.QueueCapacity)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package core
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"clawdlocal/config"
+)
+
+// testLogger returns a logger that discards its output
+func testLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+// startTestLoop creates and starts an event loop that is stopped when the test ends
+func startTestLoop(t *testing.T, logger *logrus.Logger, config *EventLoopConfig) *EventLoop {
+	t.Helper()
+	if logger == nil {
+		logger = testLogger()
+	}
+	el := NewEventLoopWithConfig(context.Background(), logger, config)
+	if err := el.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(el.Stop)
+	return el
+}
+
+// newTestWebServer creates a web server for an agent that only has an event loop
+func newTestWebServer(t *testing.T, el *EventLoop) *WebServer {
+	t.Helper()
+	logger := testLogger()
+	if el != nil {
+		logger = el.logger
+	}
+	agent := &Agent{
+		logger:    logger,
+		config:    &config.Config{},
+		eventLoop: el,
+	}
+	ws, err := NewWebServer(agent, nil)
+	if err != nil {
+		t.Fatalf("NewWebServer: %v", err)
+	}
+	return ws
+}
+
+// serveTestRequest sends a request through the web server's routes
+func serveTestRequest(ws *WebServer, method, url, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	rec := httptest.NewRecorder()
+	ws.router.ServeHTTP(rec, req)
+	return rec
+}
+
+// waitFor polls cond until it returns true or the timeout expires
+func waitFor(t *testing.T, timeout time.Duration, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// funcEventHandler is an EventHandler backed by a function
+type funcEventHandler struct {
+	types  []EventType // nil handles every type
+	handle func(ctx context.Context, event *Event) error
+}
+
+func (h *funcEventHandler) Handle(ctx context.Context, event *Event) error {
+	if h.handle == nil {
+		return nil
+	}
+	return h.handle(ctx, event)
+}
+
+func (h *funcEventHandler) CanHandle(eventType EventType) bool {
+	if h.types == nil {
+		return true
+	}
+	for _, t := range h.types {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// funcMessageHandler is a MessageHandler backed by a function
+type funcMessageHandler struct {
+	priority int
+	types    []MessageType // nil handles every type
+	handle   func(ctx context.Context, msg *Message) error
+}
+
+func (h *funcMessageHandler) Handle(ctx context.Context, msg *Message) error {
+	if h.handle == nil {
+		return nil
+	}
+	return h.handle(ctx, msg)
+}
+
+func (h *funcMessageHandler) CanHandle(msgType MessageType) bool {
+	if h.types == nil {
+		return true
+	}
+	for _, t := range h.types {
+		if t == msgType {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *funcMessageHandler) Priority() int {
+	return h.priority
+}
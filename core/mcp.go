@@ -0,0 +1,143 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// MCPProtocolVersion is the Model Context Protocol revision implemented by ClawdLocal
+const MCPProtocolVersion = "2025-03-26"
+
+// mcpSupportedVersions are the protocol revisions accepted during initialization
+var mcpSupportedVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// JSON-RPC error codes used by MCP
+const (
+	JSONRPCParseError     = -32700
+	JSONRPCInvalidRequest = -32600
+	JSONRPCMethodNotFound = -32601
+	JSONRPCInvalidParams  = -32602
+	JSONRPCInternalError  = -32603
+
+	MCPResourceNotFound = -32002
+)
+
+// jsonrpcMessage is a JSON-RPC 2.0 request, notification or response.
+// Requests have an ID and a method, notifications only a method.
+type jsonrpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *JSONRPCError   `json:"error,omitempty"`
+}
+
+// isRequest reports whether the message expects a response
+func (m *jsonrpcMessage) isRequest() bool {
+	return m.Method != "" && len(m.ID) > 0
+}
+
+// JSONRPCError is the error object of a JSON-RPC response
+type JSONRPCError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *JSONRPCError) Error() string {
+	return fmt.Sprintf("json-rpc error %d: %s", e.Code, e.Message)
+}
+
+// MCPImplementation identifies an MCP client or server
+type MCPImplementation struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// MCPInitializeParams are the params of the initialize request
+type MCPInitializeParams struct {
+	ProtocolVersion string                 `json:"protocolVersion"`
+	Capabilities    map[string]interface{} `json:"capabilities"`
+	ClientInfo      MCPImplementation      `json:"clientInfo"`
+}
+
+// MCPInitializeResult is the result of the initialize request
+type MCPInitializeResult struct {
+	ProtocolVersion string                 `json:"protocolVersion"`
+	Capabilities    map[string]interface{} `json:"capabilities"`
+	ServerInfo      MCPImplementation      `json:"serverInfo"`
+	Instructions    string                 `json:"instructions,omitempty"`
+}
+
+// MCPListToolsResult is the result of tools/list
+type MCPListToolsResult struct {
+	Tools      []MCPTool `json:"tools"`
+	NextCursor string    `json:"nextCursor,omitempty"`
+}
+
+// MCPCallToolParams are the params of tools/call
+type MCPCallToolParams struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+}
+
+// MCPContent is a content block of a tool result. ClawdLocal produces text blocks;
+// other block types are kept as received.
+type MCPContent struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	Data     string `json:"data,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+}
+
+// MCPCallToolResult is the result of tools/call. Tool failures are reported with
+// IsError rather than as JSON-RPC errors so the model can see them.
+type MCPCallToolResult struct {
+	Content []MCPContent `json:"content"`
+	IsError bool         `json:"isError,omitempty"`
+}
+
+// MCPResource describes a resource returned by resources/list
+type MCPResource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+// MCPResourceTemplate describes a family of resources returned by resources/templates/list
+type MCPResourceTemplate struct {
+	URITemplate string `json:"uriTemplate"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+// MCPListResourcesResult is the result of resources/list
+type MCPListResourcesResult struct {
+	Resources  []MCPResource `json:"resources"`
+	NextCursor string        `json:"nextCursor,omitempty"`
+}
+
+// MCPListResourceTemplatesResult is the result of resources/templates/list
+type MCPListResourceTemplatesResult struct {
+	ResourceTemplates []MCPResourceTemplate `json:"resourceTemplates"`
+}
+
+// MCPReadResourceParams are the params of resources/read
+type MCPReadResourceParams struct {
+	URI string `json:"uri"`
+}
+
+// MCPResourceContents is the content of a resource returned by resources/read
+type MCPResourceContents struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text"`
+}
+
+// MCPReadResourceResult is the result of resources/read
+type MCPReadResourceResult struct {
+	Contents []MCPResourceContents `json:"contents"`
+}
@@ -0,0 +1,391 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// mcpCloseTimeout is how long a server may take to exit after its stdin is closed
+const mcpCloseTimeout = 2 * time.Second
+
+// mcpReplyBuffer bounds the responses to server requests waiting to be written
+const mcpReplyBuffer = 16
+
+// MCPStdioServer describes an MCP server subprocess speaking the stdio transport
+type MCPStdioServer struct {
+	Name    string            // imported tools are registered as <Name>.<tool>
+	Command string            // executable to run
+	Args    []string          // command line arguments
+	Env     map[string]string // added to the agent's environment
+	Dir     string            // working directory, empty uses the agent's
+}
+
+// MCPClient is a JSON-RPC connection to an MCP server subprocess
+type MCPClient struct {
+	server *MCPStdioServer
+	logger *logrus.Logger
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+
+	writeMu sync.Mutex
+	replies chan *jsonrpcMessage // responses to server requests, written by writeReplies
+
+	mu      sync.Mutex
+	nextID  int64
+	pending map[string]chan *jsonrpcMessage
+	closed  bool
+
+	notify func(method string, params json.RawMessage)
+
+	done chan struct{} // closed once the process has exited
+	err  error         // exit status, set before done is closed
+}
+
+// StartMCPClient starts the server process. notify, if not nil, receives the
+// notifications sent by the server and must not block.
+func StartMCPClient(logger *logrus.Logger, server *MCPStdioServer, notify func(method string, params json.RawMessage)) (*MCPClient, error) {
+	cmd := exec.Command(server.Command, server.Args...)
+	cmd.Dir = server.Dir
+	if len(server.Env) > 0 {
+		cmd.Env = os.Environ()
+		for key, value := range server.Env {
+			cmd.Env = append(cmd.Env, key+"="+value)
+		}
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start MCP server %s: %w", server.Name, err)
+	}
+
+	c := &MCPClient{
+		server:  server,
+		logger:  logger,
+		cmd:     cmd,
+		stdin:   stdin,
+		pending: make(map[string]chan *jsonrpcMessage),
+		replies: make(chan *jsonrpcMessage, mcpReplyBuffer),
+		notify:  notify,
+		done:    make(chan struct{}),
+	}
+	go c.writeReplies()
+
+	var readers sync.WaitGroup
+	readers.Add(2)
+	go func() {
+		defer readers.Done()
+		c.readLoop(stdout)
+	}()
+	go func() {
+		defer readers.Done()
+		c.logStderr(stderr)
+	}()
+	go func() {
+		// Wait may only be called once the pipes have been drained
+		readers.Wait()
+		c.err = cmd.Wait()
+		c.closePending()
+		close(c.done)
+	}()
+
+	return c, nil
+}
+
+// Done returns a channel that is closed when the server process has exited
+func (c *MCPClient) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the exit status of the server process once Done is closed
+func (c *MCPClient) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+// Close asks the server to exit by closing its stdin and kills it if it does not
+func (c *MCPClient) Close() error {
+	c.stdin.Close()
+	select {
+	case <-c.done:
+	case <-time.After(mcpCloseTimeout):
+		c.cmd.Process.Kill()
+		<-c.done
+	}
+	return nil
+}
+
+// Call sends a request and decodes its result into result, which may be nil.
+// When ctx is cancelled the server is notified and ctx.Err() is returned.
+func (c *MCPClient) Call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrMCPClientClosed
+	}
+	c.nextID++
+	n := c.nextID
+	id := strconv.FormatInt(n, 10)
+	replies := make(chan *jsonrpcMessage, 1)
+	c.pending[id] = replies
+	c.mu.Unlock()
+
+	if err := c.send(json.RawMessage(id), method, params); err != nil {
+		c.forget(id)
+		return err
+	}
+
+	select {
+	case resp, ok := <-replies:
+		if !ok {
+			return ErrMCPClientClosed
+		}
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if result == nil {
+			return nil
+		}
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			return fmt.Errorf("invalid %s result from MCP server %s: %w", method, c.server.Name, err)
+		}
+		return nil
+	case <-ctx.Done():
+		c.forget(id)
+		c.Notify("notifications/cancelled", map[string]interface{}{
+			"requestId": n,
+			"reason":    ctx.Err().Error(),
+		})
+		return ctx.Err()
+	}
+}
+
+// Notify sends a notification
+func (c *MCPClient) Notify(method string, params interface{}) error {
+	return c.send(nil, method, params)
+}
+
+// Initialize performs the initialize handshake
+func (c *MCPClient) Initialize(ctx context.Context, clientInfo MCPImplementation) (*MCPInitializeResult, error) {
+	var result MCPInitializeResult
+	err := c.Call(ctx, "initialize", &MCPInitializeParams{
+		ProtocolVersion: MCPProtocolVersion,
+		Capabilities:    map[string]interface{}{},
+		ClientInfo:      clientInfo,
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	supported := false
+	for _, version := range mcpSupportedVersions {
+		if result.ProtocolVersion == version {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		return nil, fmt.Errorf("MCP server %s uses unsupported protocol version %s", c.server.Name, result.ProtocolVersion)
+	}
+
+	if err := c.Notify("notifications/initialized", nil); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// mcpRemoteTool is a tools/list entry whose schema is decoded separately, since
+// servers may use JSON Schema features JSONSchema does not model
+type mcpRemoteTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	InputSchema json.RawMessage `json:"inputSchema"`
+}
+
+// ListTools returns all tools of the server, following pagination cursors
+func (c *MCPClient) ListTools(ctx context.Context) ([]*Tool, error) {
+	var tools []*Tool
+	cursor := ""
+	for {
+		params := map[string]interface{}{}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		var page struct {
+			Tools      []mcpRemoteTool `json:"tools"`
+			NextCursor string          `json:"nextCursor"`
+		}
+		if err := c.Call(ctx, "tools/list", params, &page); err != nil {
+			return nil, err
+		}
+
+		for _, remote := range page.Tools {
+			tool := &Tool{Name: remote.Name, Description: remote.Description}
+			var schema JSONSchema
+			if len(remote.InputSchema) == 0 {
+				tool.Parameters = ObjectSchema(nil)
+			} else if err := json.Unmarshal(remote.InputSchema, &schema); err != nil {
+				c.logger.WithError(err).Warnf("MCP server %s: tool %s has an unsupported input schema, arguments will not be validated", c.server.Name, remote.Name)
+			} else if err := schema.Compile(); err != nil {
+				// Patterns may use regular expression features Go does not support
+				c.logger.WithError(err).Warnf("MCP server %s: tool %s has an unsupported input schema, arguments will not be validated", c.server.Name, remote.Name)
+			} else {
+				schema.Type = SchemaTypeObject
+				tool.Parameters = &schema
+			}
+			tools = append(tools, tool)
+		}
+
+		if page.NextCursor == "" {
+			return tools, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// CallTool calls a tool on the server
+func (c *MCPClient) CallTool(ctx context.Context, name string, args map[string]interface{}) (*MCPCallToolResult, error) {
+	var result MCPCallToolResult
+	if err := c.Call(ctx, "tools/call", &MCPCallToolParams{Name: name, Arguments: args}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// send writes one message to the server's stdin
+func (c *MCPClient) send(id json.RawMessage, method string, params interface{}) error {
+	msg := &jsonrpcMessage{JSONRPC: "2.0", ID: id, Method: method}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		msg.Params = data
+	}
+	return c.write(msg)
+}
+
+func (c *MCPClient) write(msg *jsonrpcMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if _, err := c.stdin.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("%w: %v", ErrMCPClientClosed, err)
+	}
+	return nil
+}
+
+// forget drops a pending request whose response is no longer wanted
+func (c *MCPClient) forget(id string) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
+// readLoop dispatches responses, server requests and notifications read from stdout
+func (c *MCPClient) readLoop(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), mcpMaxMessageSize)
+	for scanner.Scan() {
+		var msg jsonrpcMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			c.logger.WithError(err).Warnf("MCP server %s sent an invalid message", c.server.Name)
+			continue
+		}
+
+		switch {
+		case msg.Method == "":
+			c.mu.Lock()
+			replies, ok := c.pending[string(msg.ID)]
+			delete(c.pending, string(msg.ID))
+			c.mu.Unlock()
+			if ok {
+				replies <- &msg
+			}
+		case len(msg.ID) > 0:
+			// Server to client requests; only ping is supported
+			resp := &jsonrpcMessage{JSONRPC: "2.0", ID: msg.ID, Result: json.RawMessage("{}")}
+			if msg.Method != "ping" {
+				resp = errorResponse(msg.ID, &JSONRPCError{Code: JSONRPCMethodNotFound, Message: fmt.Sprintf("method not found: %s", msg.Method)})
+			}
+			// Writing here could deadlock with a server that is blocked writing to us
+			select {
+			case c.replies <- resp:
+			default:
+				c.logger.Warnf("MCP server %s sent too many requests, dropping response to %s", c.server.Name, msg.Method)
+			}
+		case c.notify != nil:
+			c.notify(msg.Method, msg.Params)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		c.logger.WithError(err).Warnf("Failed to read from MCP server %s", c.server.Name)
+		// Keep draining so the process is not blocked writing to a full pipe
+		io.Copy(io.Discard, stdout)
+	}
+}
+
+// writeReplies writes the responses queued by readLoop until the process has exited
+func (c *MCPClient) writeReplies() {
+	for {
+		select {
+		case resp := <-c.replies:
+			if err := c.write(resp); err != nil {
+				c.logger.WithError(err).Debugf("Failed to answer MCP server %s", c.server.Name)
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// logStderr forwards the server's stderr to the agent log
+func (c *MCPClient) logStderr(stderr io.Reader) {
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			c.logger.WithField("mcp_server", c.server.Name).Debug(line)
+		}
+	}
+	io.Copy(io.Discard, stderr)
+}
+
+// closePending fails all outstanding requests once the process has exited
+func (c *MCPClient) closePending() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	for id, replies := range c.pending {
+		close(replies)
+		delete(c.pending, id)
+	}
+}
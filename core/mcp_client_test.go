@@ -0,0 +1,531 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+// fakeMCPServerEnv makes the test binary act as an MCP server on stdio instead of running tests
+const fakeMCPServerEnv = "CLAWDLOCAL_TEST_MCP_SERVER"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(fakeMCPServerEnv) != "" {
+		runFakeMCPServer()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runFakeMCPServer serves a fixed set of tools with scripted behaviour until stdin is closed.
+// MCP_TEST_PROTOCOL_VERSION overrides the negotiated protocol version.
+func runFakeMCPServer() {
+	tools := []map[string]interface{}{
+		{"name": "echo", "description": "Echo the text", "inputSchema": map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{"text": map[string]interface{}{"type": "string"}},
+			"required":   []string{"text"},
+		}},
+		{"name": "lookahead", "inputSchema": map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{"x": map[string]interface{}{"type": "string", "pattern": "(?=x)"}},
+		}},
+		{"name": "env"}, {"name": "json"}, {"name": "blocks"}, {"name": "empty"}, {"name": "fail"},
+		{"name": "hang"}, {"name": "cancelled"}, {"name": "crash"}, {"name": "ask_client"}, {"name": "add_tool"},
+	}
+	const pageSize = 5
+
+	out := bufio.NewWriter(os.Stdout)
+	send := func(v interface{}) {
+		data, _ := json.Marshal(v)
+		out.Write(append(data, '\n'))
+		out.Flush()
+	}
+	reply := func(id json.RawMessage, result interface{}) {
+		send(map[string]interface{}{"jsonrpc": "2.0", "id": id, "result": result})
+	}
+	text := func(s string) map[string]interface{} {
+		return map[string]interface{}{"content": []map[string]string{{"type": "text", "text": s}}}
+	}
+
+	fmt.Fprintln(os.Stderr, "fake MCP server started")
+	var cancelled []string
+	var askID json.RawMessage
+	var answers []string
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var msg jsonrpcMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			continue
+		}
+		if msg.Method == "" {
+			// Answers to the requests sent by ask_client
+			answers = append(answers, scanner.Text())
+			if len(answers) == 2 {
+				reply(askID, text(strings.Join(answers, "\n")))
+			}
+			continue
+		}
+
+		switch msg.Method {
+		case "initialize":
+			var params MCPInitializeParams
+			json.Unmarshal(msg.Params, &params)
+			version := params.ProtocolVersion
+			if v := os.Getenv("MCP_TEST_PROTOCOL_VERSION"); v != "" {
+				version = v
+			}
+			reply(msg.ID, map[string]interface{}{
+				"protocolVersion": version,
+				"capabilities":    map[string]interface{}{"tools": map[string]interface{}{"listChanged": true}},
+				"serverInfo":      map[string]string{"name": "fake", "version": "0.1"},
+			})
+		case "notifications/cancelled":
+			var params struct {
+				RequestID int64 `json:"requestId"`
+			}
+			json.Unmarshal(msg.Params, &params)
+			cancelled = append(cancelled, strconv.FormatInt(params.RequestID, 10))
+		case "tools/list":
+			var params struct {
+				Cursor string `json:"cursor"`
+			}
+			json.Unmarshal(msg.Params, &params)
+			start, _ := strconv.Atoi(params.Cursor)
+			end := start + pageSize
+			result := map[string]interface{}{}
+			if end < len(tools) {
+				result["nextCursor"] = strconv.Itoa(end)
+			} else {
+				end = len(tools)
+			}
+			result["tools"] = tools[start:end]
+			reply(msg.ID, result)
+		case "tools/call":
+			var params MCPCallToolParams
+			json.Unmarshal(msg.Params, &params)
+			switch params.Name {
+			case "echo":
+				reply(msg.ID, text(params.Arguments["text"].(string)))
+			case "env":
+				dir, _ := os.Getwd()
+				reply(msg.ID, text(os.Getenv("MCP_TEST_GREETING")+" "+dir))
+			case "json":
+				reply(msg.ID, text(` {"n": 1}`))
+			case "blocks":
+				reply(msg.ID, map[string]interface{}{"content": []map[string]string{
+					{"type": "text", "text": "a"},
+					{"type": "image", "data": "AA==", "mimeType": "image/png"},
+				}})
+			case "empty":
+				reply(msg.ID, map[string]interface{}{"content": []interface{}{}})
+			case "fail":
+				reply(msg.ID, map[string]interface{}{"content": []map[string]string{{"type": "text", "text": "disk full"}}, "isError": true})
+			case "hang":
+			case "cancelled":
+				reply(msg.ID, text(strings.Join(cancelled, ",")))
+			case "crash":
+				os.Exit(3)
+			case "ask_client":
+				askID = msg.ID
+				send(map[string]interface{}{"jsonrpc": "2.0", "id": "s1", "method": "ping"})
+				send(map[string]interface{}{"jsonrpc": "2.0", "id": "s2", "method": "sampling/createMessage"})
+			case "add_tool":
+				tools = append(tools, map[string]interface{}{"name": "added"})
+				send(map[string]interface{}{"jsonrpc": "2.0", "method": "notifications/tools/list_changed"})
+				reply(msg.ID, text("ok"))
+			}
+		}
+	}
+}
+
+// fakeMCPServer describes the test binary running as an MCP server
+func fakeMCPServer(t *testing.T, name string, env ...string) *MCPStdioServer {
+	t.Helper()
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatalf("os.Executable: %v", err)
+	}
+	server := &MCPStdioServer{
+		Name:    name,
+		Command: executable,
+		// Race enabled binaries otherwise sleep for a second before exiting
+		Env: map[string]string{fakeMCPServerEnv: "1", "GORACE": "atexit_sleep_ms=0"},
+	}
+	for i := 0; i+1 < len(env); i += 2 {
+		server.Env[env[i]] = env[i+1]
+	}
+	return server
+}
+
+// startFakeMCPClient starts and initializes a client that is closed when the test ends
+func startFakeMCPClient(t *testing.T, server *MCPStdioServer) *MCPClient {
+	t.Helper()
+	client, err := StartMCPClient(testLogger(), server, nil)
+	if err != nil {
+		t.Fatalf("StartMCPClient: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	info, err := client.Initialize(ctx, MCPImplementation{Name: "test"})
+	if err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	if info.ServerInfo.Name != "fake" {
+		t.Fatalf("server info = %+v", info.ServerInfo)
+	}
+	return client
+}
+
+func TestMCPClientInitialize(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		wantErr string
+	}{
+		{name: "requested version", version: ""},
+		{name: "older supported version", version: "2024-11-05"},
+		{name: "unsupported version", version: "2023-01-01", wantErr: "unsupported protocol version 2023-01-01"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := StartMCPClient(testLogger(), fakeMCPServer(t, "fake", "MCP_TEST_PROTOCOL_VERSION", tt.version), nil)
+			if err != nil {
+				t.Fatalf("StartMCPClient: %v", err)
+			}
+			defer client.Close()
+
+			info, err := client.Initialize(context.Background(), MCPImplementation{Name: "test"})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Initialize = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Initialize: %v", err)
+			}
+			want := tt.version
+			if want == "" {
+				want = MCPProtocolVersion
+			}
+			if info.ProtocolVersion != want {
+				t.Errorf("protocol version = %s, want %s", info.ProtocolVersion, want)
+			}
+		})
+	}
+}
+
+func TestStartMCPClientMissingCommand(t *testing.T) {
+	_, err := StartMCPClient(testLogger(), &MCPStdioServer{Name: "missing", Command: "/nonexistent/mcp-server"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "failed to start MCP server missing") {
+		t.Errorf("StartMCPClient = %v, want a start error", err)
+	}
+}
+
+func TestMCPClientListTools(t *testing.T) {
+	client := startFakeMCPClient(t, fakeMCPServer(t, "fake"))
+	tools, err := client.ListTools(context.Background())
+	if err != nil {
+		t.Fatalf("ListTools: %v", err)
+	}
+
+	byName := make(map[string]*Tool)
+	var names []string
+	for _, tool := range tools {
+		byName[tool.Name] = tool
+		names = append(names, tool.Name)
+	}
+	// The server returns its tools in pages of five
+	if len(names) != 12 || names[0] != "echo" || names[11] != "add_tool" {
+		t.Fatalf("tools = %v, want all twelve tools across pages", names)
+	}
+
+	tests := []struct {
+		tool         string
+		wantSchema   bool
+		wantRequired []string
+	}{
+		{tool: "echo", wantSchema: true, wantRequired: []string{"text"}},
+		{tool: "env", wantSchema: true},
+		{tool: "lookahead", wantSchema: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tool, func(t *testing.T) {
+			params := byName[tt.tool].Parameters
+			if (params != nil) != tt.wantSchema {
+				t.Fatalf("parameters = %+v, want schema %v", params, tt.wantSchema)
+			}
+			if params != nil && (params.Type != SchemaTypeObject || !reflect.DeepEqual(params.Required, tt.wantRequired)) {
+				t.Errorf("parameters = %+v", params)
+			}
+		})
+	}
+	if byName["echo"].Description != "Echo the text" {
+		t.Errorf("description = %q", byName["echo"].Description)
+	}
+}
+
+func TestCallMCPTool(t *testing.T) {
+	dir := t.TempDir()
+	server := fakeMCPServer(t, "fake", "MCP_TEST_GREETING", "hello")
+	server.Dir = dir
+	client := startFakeMCPClient(t, server)
+
+	tests := []struct {
+		tool    string
+		args    map[string]interface{}
+		want    interface{}
+		wantErr string
+	}{
+		{tool: "echo", args: map[string]interface{}{"text": "hi"}, want: "hi"},
+		{tool: "echo", args: map[string]interface{}{"text": "[not json"}, want: "[not json"},
+		{tool: "env", want: "hello " + dir},
+		{tool: "json", want: map[string]interface{}{"n": 1.0}},
+		{tool: "blocks", want: []MCPContent{{Type: "text", Text: "a"}, {Type: "image", Data: "AA==", MimeType: "image/png"}}},
+		{tool: "empty", want: nil},
+		{tool: "fail", wantErr: "disk full"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tool, func(t *testing.T) {
+			got, err := callMCPTool(context.Background(), client, tt.tool, tt.args)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("callMCPTool = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("callMCPTool: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("callMCPTool = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMCPClientCancel(t *testing.T) {
+	client := startFakeMCPClient(t, fakeMCPServer(t, "fake"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.CallTool(ctx, "hang", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("CallTool = %v, want context.DeadlineExceeded", err)
+	}
+
+	// initialize was request 1, so the abandoned call was request 2
+	got, err := callMCPTool(context.Background(), client, "cancelled", nil)
+	if err != nil || got != "2" {
+		t.Errorf("cancelled requests = %v, %v, want 2", got, err)
+	}
+	client.mu.Lock()
+	pending := len(client.pending)
+	client.mu.Unlock()
+	if pending != 0 {
+		t.Errorf("%d requests still pending", pending)
+	}
+}
+
+func TestMCPClientAnswersServerRequests(t *testing.T) {
+	client := startFakeMCPClient(t, fakeMCPServer(t, "fake"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	got, err := callMCPTool(ctx, client, "ask_client", nil)
+	if err != nil {
+		t.Fatalf("callMCPTool: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "ping", want: `{"jsonrpc":"2.0","id":"s1","result":{}}`},
+		{name: "unsupported request", want: `{"jsonrpc":"2.0","id":"s2","error":{"code":-32601,"message":"method not found: sampling/createMessage"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !strings.Contains(got.(string), tt.want) {
+				t.Errorf("answers = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMCPClientServerExit(t *testing.T) {
+	tests := []struct {
+		name     string
+		stop     func(client *MCPClient) error
+		wantErr  error
+		wantExit bool
+	}{
+		{
+			name: "crash during a call",
+			stop: func(client *MCPClient) error {
+				_, err := client.CallTool(context.Background(), "crash", nil)
+				return err
+			},
+			wantErr:  ErrMCPClientClosed,
+			wantExit: true,
+		},
+		{name: "close", stop: func(client *MCPClient) error { return client.Close() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := startFakeMCPClient(t, fakeMCPServer(t, "fake"))
+			if err := tt.stop(client); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("stop = %v, want %v", err, tt.wantErr)
+			}
+
+			select {
+			case <-client.Done():
+			case <-time.After(5 * time.Second):
+				t.Fatal("Done was not closed")
+			}
+			if (client.Err() != nil) != tt.wantExit {
+				t.Errorf("Err = %v, want an exit error %v", client.Err(), tt.wantExit)
+			}
+			if err := client.Call(context.Background(), "ping", nil, nil); !errors.Is(err, ErrMCPClientClosed) {
+				t.Errorf("Call after exit = %v, want ErrMCPClientClosed", err)
+			}
+		})
+	}
+}
+
+func TestMCPImporter(t *testing.T) {
+	tools, _ := NewToolManager(testLogger())
+	importer := NewMCPImporter(testLogger(), tools, &MCPImporterConfig{
+		Servers:    []*MCPStdioServer{fakeMCPServer(t, "fake")},
+		Restart:    &RetryPolicy{InitialBackoff: 10 * time.Millisecond, Multiplier: 1},
+		ClientInfo: MCPImplementation{Name: "test"},
+	})
+	importer.Start(context.Background())
+	defer importer.Stop()
+	waitFor(t, 10*time.Second, "tools imported", func() bool {
+		_, ok := tools.GetTool("fake.echo")
+		return ok
+	})
+
+	tests := []struct {
+		name        string
+		call        *ToolCall
+		want        interface{}
+		wantErr     string
+		wantInvalid bool
+	}{
+		{name: "proxied call", call: &ToolCall{Name: "fake.echo", Args: map[string]interface{}{"text": "hi"}}, want: "hi"},
+		{name: "validated locally", call: &ToolCall{Name: "fake.echo"}, wantInvalid: true},
+		{name: "remote failure", call: &ToolCall{Name: "fake.fail"}, wantErr: "disk full"},
+		{name: "not namespaced", call: &ToolCall{Name: "echo"}, wantErr: "tool echo not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, _ := tools.ExecuteTool(context.Background(), tt.call)
+			if tt.wantInvalid {
+				if len(result.ValidationErrors) == 0 {
+					t.Errorf("result = %+v, want validation errors", result)
+				}
+				return
+			}
+			if result.Error != tt.wantErr || !reflect.DeepEqual(result.Result, tt.want) {
+				t.Errorf("result = %v, %q; want %v, %q", result.Result, result.Error, tt.want, tt.wantErr)
+			}
+		})
+	}
+
+	// tools/list_changed makes the importer list the tools again
+	tools.ExecuteTool(context.Background(), &ToolCall{Name: "fake.add_tool"})
+	waitFor(t, 5*time.Second, "new tool imported", func() bool {
+		_, ok := tools.GetTool("fake.added")
+		return ok
+	})
+
+	importer.Stop()
+	for _, tool := range tools.ListTools() {
+		t.Errorf("tool %s still registered after Stop", tool.Name)
+	}
+}
+
+func TestMCPImporterRestartsCrashedServer(t *testing.T) {
+	logger, hook := logtest.NewNullLogger()
+	tools, _ := NewToolManager(testLogger())
+	importer := NewMCPImporter(logger, tools, &MCPImporterConfig{
+		Servers: []*MCPStdioServer{fakeMCPServer(t, "fake")},
+		Restart: &RetryPolicy{InitialBackoff: 200 * time.Millisecond, Multiplier: 1},
+	})
+	importer.Start(context.Background())
+	defer importer.Stop()
+
+	imported := func() bool {
+		_, ok := tools.GetTool("fake.echo")
+		return ok
+	}
+	waitFor(t, 10*time.Second, "tools imported", imported)
+
+	result, _ := tools.ExecuteTool(context.Background(), &ToolCall{Name: "fake.crash"})
+	if !strings.Contains(result.Error, ErrMCPClientClosed.Error()) {
+		t.Errorf("crash result error = %q", result.Error)
+	}
+	// The dead server's tools are removed until it has been restarted
+	waitFor(t, 5*time.Second, "tools unregistered", func() bool { return !imported() })
+	waitFor(t, 10*time.Second, "tools imported again", imported)
+
+	result, _ = tools.ExecuteTool(context.Background(), &ToolCall{Name: "fake.echo", Args: map[string]interface{}{"text": "back"}})
+	if result.Result != "back" {
+		t.Errorf("result after restart = %+v", result)
+	}
+
+	var restarts int
+	for _, entry := range hook.AllEntries() {
+		if strings.HasPrefix(entry.Message, "MCP server stopped, restarting in") {
+			restarts++
+		}
+	}
+	if restarts != 1 {
+		t.Errorf("%d restarts logged, want 1", restarts)
+	}
+}
+
+func TestMCPImporterGivesUp(t *testing.T) {
+	logger, hook := logtest.NewNullLogger()
+	tools, _ := NewToolManager(testLogger())
+	importer := NewMCPImporter(logger, tools, &MCPImporterConfig{
+		Servers: []*MCPStdioServer{fakeMCPServer(t, "fake", "MCP_TEST_PROTOCOL_VERSION", "2023-01-01")},
+		Restart: &RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond, Multiplier: 1},
+	})
+	importer.Start(context.Background())
+
+	waitFor(t, 10*time.Second, "importer gave up", func() bool {
+		for _, entry := range hook.AllEntries() {
+			if entry.Message == "MCP server still failing after 2 restarts, giving up" {
+				return true
+			}
+		}
+		return false
+	})
+	importer.Stop()
+
+	var failures int
+	for _, entry := range hook.AllEntries() {
+		if err, ok := entry.Data["error"].(error); ok && strings.Contains(err.Error(), "unsupported protocol version") {
+			failures++
+		}
+	}
+	if failures != 3 || len(tools.ListTools()) != 0 {
+		t.Errorf("%d handshake failures logged and %d tools registered, want 3 and none", failures, len(tools.ListTools()))
+	}
+}
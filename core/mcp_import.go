@@ -0,0 +1,234 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// mcpHandshakeTimeout bounds the initialize and tools/list exchange of a started server
+	mcpHandshakeTimeout = 30 * time.Second
+	// mcpStableUptime is how long a server must run before its restart backoff is reset
+	mcpStableUptime = time.Minute
+)
+
+// MCPImporterConfig holds MCP importer configuration
+type MCPImporterConfig struct {
+	Servers    []*MCPStdioServer
+	Restart    *RetryPolicy      // backoff between restarts; MaxAttempts limits consecutive restarts, 0 restarts forever
+	ClientInfo MCPImplementation // reported to the servers during initialization
+}
+
+// MCPImporter runs MCP server subprocesses and registers their tools with the
+// ToolManager as <server>.<tool>. Tools are unregistered while their server is down.
+type MCPImporter struct {
+	logger *logrus.Logger
+	tools  *ToolManager
+	config *MCPImporterConfig
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewMCPImporter creates an MCP importer
+func NewMCPImporter(logger *logrus.Logger, tools *ToolManager, config *MCPImporterConfig) *MCPImporter {
+	if config.Restart == nil {
+		config.Restart = &RetryPolicy{
+			InitialBackoff: time.Second,
+			MaxBackoff:     time.Minute,
+			Multiplier:     2,
+			Jitter:         0.2,
+		}
+	}
+
+	return &MCPImporter{
+		logger: logger,
+		tools:  tools,
+		config: config,
+	}
+}
+
+// Start launches every configured server in the background
+func (im *MCPImporter) Start(ctx context.Context) {
+	ctx, im.cancel = context.WithCancel(ctx)
+	for _, server := range im.config.Servers {
+		im.wg.Add(1)
+		go func(server *MCPStdioServer) {
+			defer im.wg.Done()
+			im.supervise(ctx, server)
+		}(server)
+	}
+}
+
+// Stop shuts the servers down and waits until their tools are unregistered
+func (im *MCPImporter) Stop() {
+	if im.cancel != nil {
+		im.cancel()
+	}
+	im.wg.Wait()
+}
+
+// supervise runs a server and restarts it with backoff whenever it exits or fails its handshake
+func (im *MCPImporter) supervise(ctx context.Context, server *MCPStdioServer) {
+	logger := im.logger.WithField("mcp_server", server.Name)
+	restarts := 0
+
+	for {
+		started := time.Now()
+		err := im.run(ctx, server)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if time.Since(started) >= mcpStableUptime {
+			restarts = 0
+		}
+		restarts++
+		if limit := im.config.Restart.MaxAttempts; limit > 0 && restarts > limit {
+			logger.WithError(err).Errorf("MCP server still failing after %d restarts, giving up", limit)
+			return
+		}
+
+		backoff := im.config.Restart.Backoff(restarts)
+		logger.WithError(err).Warnf("MCP server stopped, restarting in %s", backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// run starts one instance of a server, imports its tools and blocks until the
+// process exits or ctx is cancelled
+func (im *MCPImporter) run(ctx context.Context, server *MCPStdioServer) error {
+	refresh := make(chan struct{}, 1)
+	client, err := StartMCPClient(im.logger, server, func(method string, params json.RawMessage) {
+		if method == "notifications/tools/list_changed" {
+			select {
+			case refresh <- struct{}{}:
+			default:
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	handshakeCtx, cancel := context.WithTimeout(ctx, mcpHandshakeTimeout)
+	info, err := client.Initialize(handshakeCtx, im.config.ClientInfo)
+	if err != nil {
+		cancel()
+		return fmt.Errorf("initialize failed: %w", err)
+	}
+	remote, err := client.ListTools(handshakeCtx)
+	cancel()
+	if err != nil {
+		return fmt.Errorf("tools/list failed: %w", err)
+	}
+
+	registered := im.register(server, client, remote)
+	defer func() {
+		im.unregister(registered)
+	}()
+	im.logger.WithFields(logrus.Fields{
+		"mcp_server":     server.Name,
+		"server_name":    info.ServerInfo.Name,
+		"server_version": info.ServerInfo.Version,
+		"tools":          len(registered),
+	}).Info("Imported tools from MCP server")
+
+	for {
+		select {
+		case <-client.Done():
+			if err := client.Err(); err != nil {
+				return fmt.Errorf("process exited: %w", err)
+			}
+			return errors.New("process exited")
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-refresh:
+			listCtx, cancel := context.WithTimeout(ctx, mcpHandshakeTimeout)
+			remote, err := client.ListTools(listCtx)
+			cancel()
+			if err != nil {
+				im.logger.WithError(err).Warnf("Failed to refresh tools of MCP server %s", server.Name)
+				continue
+			}
+			im.unregister(registered)
+			registered = im.register(server, client, remote)
+		}
+	}
+}
+
+// register adds the remote tools under namespaced names and returns the names registered
+func (im *MCPImporter) register(server *MCPStdioServer, client *MCPClient, remote []*Tool) []string {
+	names := make([]string, 0, len(remote))
+	for _, tool := range remote {
+		remoteName := tool.Name
+		tool.Name = server.Name + "." + remoteName
+		tool.Handler = func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+			return callMCPTool(ctx, client, remoteName, args)
+		}
+
+		if err := im.tools.RegisterTool(tool); err != nil {
+			im.logger.WithError(err).Warnf("Failed to import tool %s from MCP server %s", remoteName, server.Name)
+			continue
+		}
+		names = append(names, tool.Name)
+	}
+	return names
+}
+
+// unregister removes imported tools
+func (im *MCPImporter) unregister(names []string) {
+	for _, name := range names {
+		im.tools.UnregisterTool(name)
+	}
+}
+
+// callMCPTool proxies a tool call. A single text block is returned as a string, or
+// decoded when it holds a JSON object or array; empty results return nil and other
+// results return the content blocks.
+func callMCPTool(ctx context.Context, client *MCPClient, name string, args map[string]interface{}) (interface{}, error) {
+	result, err := client.CallTool(ctx, name, args)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.IsError {
+		texts := make([]string, 0, len(result.Content))
+		for _, content := range result.Content {
+			if content.Type == "text" {
+				texts = append(texts, content.Text)
+			}
+		}
+		if len(texts) == 0 {
+			return nil, fmt.Errorf("tool %s failed", name)
+		}
+		return nil, errors.New(strings.Join(texts, "\n"))
+	}
+
+	if len(result.Content) == 0 {
+		return nil, nil
+	}
+	if len(result.Content) == 1 && result.Content[0].Type == "text" {
+		text := result.Content[0].Text
+		if trimmed := strings.TrimSpace(text); strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+			var decoded interface{}
+			if err := json.Unmarshal([]byte(trimmed), &decoded); err == nil {
+				return decoded, nil
+			}
+		}
+		return text, nil
+	}
+	return result.Content, nil
+}
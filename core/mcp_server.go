@@ -0,0 +1,472 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// MCP transports supported by MCPServer
+const (
+	MCPTransportStdio = "stdio"
+	MCPTransportHTTP  = "http"
+)
+
+// mcpMaxMessageSize limits a single JSON-RPC message read from stdio or HTTP
+const mcpMaxMessageSize = 16 << 20
+
+// MCP resource URI prefixes of memory entries, followed by the escaped key
+const (
+	mcpShortTermURIPrefix = "memory://" + MemoryTierShortTerm + "/"
+	mcpLongTermURIPrefix  = "memory://" + MemoryTierLongTerm + "/"
+)
+
+// MCPServerConfig holds MCP server configuration
+type MCPServerConfig struct {
+	Name    string // reported to clients as serverInfo
+	Version string
+}
+
+// MCPServer serves registered tools and memory entries over the Model Context Protocol
+type MCPServer struct {
+	logger *logrus.Logger
+	tools  *ToolManager
+	memory *MemoryManager
+	info   MCPImplementation
+}
+
+// NewMCPServer creates an MCP server. memory may be nil to serve tools only.
+func NewMCPServer(logger *logrus.Logger, tools *ToolManager, memory *MemoryManager, config *MCPServerConfig) *MCPServer {
+	if config == nil {
+		config = &MCPServerConfig{}
+	}
+	if config.Name == "" {
+		config.Name = "clawdlocal"
+	}
+
+	return &MCPServer{
+		logger: logger,
+		tools:  tools,
+		memory: memory,
+		info:   MCPImplementation{Name: config.Name, Version: config.Version},
+	}
+}
+
+// HandleMessage handles one JSON-RPC message or batch and returns the encoded
+// response, or nil when nothing has to be sent back (notifications and responses)
+func (s *MCPServer) HandleMessage(ctx context.Context, data []byte) []byte {
+	if isJSONArray(data) {
+		var batch []*jsonrpcMessage
+		if err := json.Unmarshal(data, &batch); err != nil || len(batch) == 0 {
+			return encodeJSONRPC(errorResponse(nil, &JSONRPCError{Code: JSONRPCParseError, Message: "invalid batch"}))
+		}
+
+		var responses []*jsonrpcMessage
+		for _, msg := range batch {
+			if resp := s.handle(ctx, msg); resp != nil {
+				responses = append(responses, resp)
+			}
+		}
+		if len(responses) == 0 {
+			return nil
+		}
+		return encodeJSONRPC(responses)
+	}
+
+	var msg jsonrpcMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return encodeJSONRPC(errorResponse(nil, &JSONRPCError{Code: JSONRPCParseError, Message: err.Error()}))
+	}
+	if resp := s.handle(ctx, &msg); resp != nil {
+		return encodeJSONRPC(resp)
+	}
+	return nil
+}
+
+// handle dispatches a single message and returns its response, nil for notifications
+func (s *MCPServer) handle(ctx context.Context, msg *jsonrpcMessage) *jsonrpcMessage {
+	if msg == nil || msg.JSONRPC != "2.0" {
+		return errorResponse(nil, &JSONRPCError{Code: JSONRPCInvalidRequest, Message: "not a JSON-RPC 2.0 message"})
+	}
+	if !msg.isRequest() {
+		// Notifications such as notifications/initialized need no answer
+		return nil
+	}
+
+	result, rpcErr := s.call(ctx, msg.Method, msg.Params)
+	if rpcErr != nil {
+		s.logger.WithFields(logrus.Fields{
+			"method": msg.Method,
+			"code":   rpcErr.Code,
+		}).Debugf("MCP request failed: %s", rpcErr.Message)
+		return errorResponse(msg.ID, rpcErr)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return errorResponse(msg.ID, &JSONRPCError{Code: JSONRPCInternalError, Message: err.Error()})
+	}
+	return &jsonrpcMessage{JSONRPC: "2.0", ID: msg.ID, Result: data}
+}
+
+// call runs an MCP method
+func (s *MCPServer) call(ctx context.Context, method string, params json.RawMessage) (interface{}, *JSONRPCError) {
+	switch method {
+	case "initialize":
+		var p MCPInitializeParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		return s.initialize(&p), nil
+	case "ping":
+		return struct{}{}, nil
+	case "tools/list":
+		return &MCPListToolsResult{Tools: s.tools.MCPTools()}, nil
+	case "tools/call":
+		var p MCPCallToolParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		return s.callTool(ctx, &p)
+	}
+
+	if s.memory != nil {
+		switch method {
+		case "resources/list":
+			return s.listResources(ctx)
+		case "resources/templates/list":
+			return s.listResourceTemplates(), nil
+		case "resources/read":
+			var p MCPReadResourceParams
+			if err := decodeParams(params, &p); err != nil {
+				return nil, err
+			}
+			return s.readResource(ctx, p.URI)
+		}
+	}
+
+	return nil, &JSONRPCError{Code: JSONRPCMethodNotFound, Message: fmt.Sprintf("method not found: %s", method)}
+}
+
+// initialize negotiates the protocol version and announces the server capabilities
+func (s *MCPServer) initialize(p *MCPInitializeParams) *MCPInitializeResult {
+	version := MCPProtocolVersion
+	for _, supported := range mcpSupportedVersions {
+		if p.ProtocolVersion == supported {
+			version = supported
+			break
+		}
+	}
+
+	capabilities := map[string]interface{}{
+		"tools": map[string]interface{}{},
+	}
+	if s.memory != nil {
+		capabilities["resources"] = map[string]interface{}{}
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"client":           p.ClientInfo.Name,
+		"client_version":   p.ClientInfo.Version,
+		"protocol_version": version,
+	}).Info("MCP client initialized")
+
+	return &MCPInitializeResult{
+		ProtocolVersion: version,
+		Capabilities:    capabilities,
+		ServerInfo:      s.info,
+	}
+}
+
+// callTool executes a tool. Tool failures are returned as results with IsError set.
+func (s *MCPServer) callTool(ctx context.Context, p *MCPCallToolParams) (*MCPCallToolResult, *JSONRPCError) {
+	if _, exists := s.tools.GetTool(p.Name); !exists {
+		return nil, &JSONRPCError{Code: JSONRPCInvalidParams, Message: fmt.Sprintf("unknown tool: %s", p.Name)}
+	}
+
+	result, err := s.tools.ExecuteTool(ctx, &ToolCall{Name: p.Name, Args: p.Arguments})
+	if err != nil {
+		return &MCPCallToolResult{Content: []MCPContent{{Type: "text", Text: err.Error()}}, IsError: true}, nil
+	}
+	if result.Error != "" {
+		return &MCPCallToolResult{Content: []MCPContent{{Type: "text", Text: result.Error}}, IsError: true}, nil
+	}
+
+	if result.Result == nil {
+		return &MCPCallToolResult{Content: []MCPContent{}}, nil
+	}
+	text, ok := result.Result.(string)
+	if !ok {
+		data, err := json.Marshal(result.Result)
+		if err != nil {
+			return nil, &JSONRPCError{Code: JSONRPCInternalError, Message: fmt.Sprintf("failed to encode tool result: %v", err)}
+		}
+		text = string(data)
+	}
+	return &MCPCallToolResult{Content: []MCPContent{{Type: "text", Text: text}}}, nil
+}
+
+// listResources returns every live memory entry as a resource, ordered by URI
+func (s *MCPServer) listResources(ctx context.Context) (*MCPListResourcesResult, *JSONRPCError) {
+	shortTerm, err := s.memory.GetAllShortTermMemory(ctx)
+	if err != nil {
+		return nil, &JSONRPCError{Code: JSONRPCInternalError, Message: err.Error()}
+	}
+	longTerm, err := s.memory.GetAllLongTermMemory(ctx)
+	if err != nil {
+		return nil, &JSONRPCError{Code: JSONRPCInternalError, Message: err.Error()}
+	}
+
+	resources := make([]MCPResource, 0, len(shortTerm)+len(longTerm))
+	for _, entry := range shortTerm {
+		resources = append(resources, MCPResource{
+			URI:         mcpShortTermURIPrefix + url.PathEscape(entry.Key),
+			Name:        entry.Key,
+			Description: "Short-term memory entry",
+			MimeType:    "application/json",
+		})
+	}
+	for _, entry := range longTerm {
+		resources = append(resources, MCPResource{
+			URI:         mcpLongTermURIPrefix + url.PathEscape(entry.Key),
+			Name:        entry.Key,
+			Description: "Long-term memory entry",
+			MimeType:    "application/json",
+		})
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].URI < resources[j].URI
+	})
+
+	return &MCPListResourcesResult{Resources: resources}, nil
+}
+
+// listResourceTemplates describes the URIs of memory entries
+func (s *MCPServer) listResourceTemplates() *MCPListResourceTemplatesResult {
+	return &MCPListResourceTemplatesResult{
+		ResourceTemplates: []MCPResourceTemplate{
+			{
+				URITemplate: mcpShortTermURIPrefix + "{key}",
+				Name:        "Short-term memory",
+				Description: "Value stored under key in short-term memory",
+				MimeType:    "application/json",
+			},
+			{
+				URITemplate: mcpLongTermURIPrefix + "{key}",
+				Name:        "Long-term memory",
+				Description: "Value stored under key in long-term memory",
+				MimeType:    "application/json",
+			},
+		},
+	}
+}
+
+// readResource returns the JSON encoded value of a memory entry
+func (s *MCPServer) readResource(ctx context.Context, uri string) (*MCPReadResourceResult, *JSONRPCError) {
+	var value interface{}
+	var found bool
+	var err error
+
+	switch {
+	case strings.HasPrefix(uri, mcpShortTermURIPrefix):
+		key, escErr := url.PathUnescape(strings.TrimPrefix(uri, mcpShortTermURIPrefix))
+		if escErr != nil {
+			return nil, &JSONRPCError{Code: JSONRPCInvalidParams, Message: fmt.Sprintf("invalid resource URI: %s", uri)}
+		}
+		value, found, err = s.memory.GetShortTermMemory(ctx, key)
+	case strings.HasPrefix(uri, mcpLongTermURIPrefix):
+		key, escErr := url.PathUnescape(strings.TrimPrefix(uri, mcpLongTermURIPrefix))
+		if escErr != nil {
+			return nil, &JSONRPCError{Code: JSONRPCInvalidParams, Message: fmt.Sprintf("invalid resource URI: %s", uri)}
+		}
+		value, found, err = s.memory.GetLongTermMemory(ctx, key)
+	}
+	if err != nil {
+		return nil, &JSONRPCError{Code: JSONRPCInternalError, Message: err.Error()}
+	}
+	if !found {
+		return nil, &JSONRPCError{Code: MCPResourceNotFound, Message: "resource not found", Data: map[string]string{"uri": uri}}
+	}
+
+	data, encErr := json.Marshal(value)
+	if encErr != nil {
+		return nil, &JSONRPCError{Code: JSONRPCInternalError, Message: fmt.Sprintf("failed to encode memory value: %v", encErr)}
+	}
+	return &MCPReadResourceResult{
+		Contents: []MCPResourceContents{{URI: uri, MimeType: "application/json", Text: string(data)}},
+	}, nil
+}
+
+// ServeStdio serves newline-delimited JSON-RPC messages from r and writes responses
+// to w until r is exhausted or ctx is cancelled. Requests are handled concurrently so
+// a long tool call does not block pings. Nothing else may write to w.
+func (s *MCPServer) ServeStdio(ctx context.Context, r io.Reader, w io.Writer) error {
+	s.logger.Info("Serving MCP over stdio")
+
+	lines := make(chan []byte)
+	scanErr := make(chan error, 1)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), mcpMaxMessageSize)
+		for scanner.Scan() {
+			line := append([]byte(nil), scanner.Bytes()...)
+			if len(strings.TrimSpace(string(line))) == 0 {
+				continue
+			}
+			select {
+			case lines <- line:
+			case <-ctx.Done():
+				return
+			}
+		}
+		scanErr <- scanner.Err()
+	}()
+
+	var writeMu sync.Mutex
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case line, ok := <-lines:
+			if !ok {
+				wg.Wait()
+				select {
+				case err := <-scanErr:
+					return err
+				default:
+					return nil
+				}
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resp := s.HandleMessage(ctx, line)
+				if resp == nil {
+					return
+				}
+				writeMu.Lock()
+				defer writeMu.Unlock()
+				if _, err := w.Write(append(resp, '\n')); err != nil {
+					s.logger.WithError(err).Error("Failed to write MCP response")
+				}
+			}()
+		}
+	}
+}
+
+// ServeHTTP implements the streamable HTTP transport. Each POST carries one message
+// or batch; responses are returned as a single JSON body rather than an SSE stream.
+func (s *MCPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !localOrigin(r.Header.Get("Origin")) {
+		http.Error(w, "Origin not allowed", http.StatusForbidden)
+		return
+	}
+	if r.Method != http.MethodPost {
+		// No server-initiated stream is offered
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, mcpMaxMessageSize))
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	resp := s.HandleMessage(r.Context(), body)
+	if resp == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+// ListenAndServe serves the streamable HTTP transport at /mcp on addr until ctx is cancelled
+func (s *MCPServer) ListenAndServe(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/mcp", s)
+	server := &http.Server{
+		Addr:    addr,
+		Handler: mux,
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- server.ListenAndServe()
+	}()
+	s.logger.Infof("Serving MCP over HTTP on http://%s/mcp", addr)
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			return err
+		}
+		return ctx.Err()
+	}
+}
+
+// localOrigin reports whether a browser Origin header is absent or points at the
+// local machine, which guards the HTTP transport against DNS rebinding
+func localOrigin(origin string) bool {
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// decodeParams decodes request params, treating missing params as an empty object
+func decodeParams(params json.RawMessage, v interface{}) *JSONRPCError {
+	if len(params) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return &JSONRPCError{Code: JSONRPCInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// errorResponse builds an error response. A nil id is sent as null, as required
+// when the request could not be read.
+func errorResponse(id json.RawMessage, rpcErr *JSONRPCError) *jsonrpcMessage {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	return &jsonrpcMessage{JSONRPC: "2.0", ID: id, Error: rpcErr}
+}
+
+// encodeJSONRPC encodes a message or batch; encoding these types cannot fail
+func encodeJSONRPC(v interface{}) []byte {
+	data, _ := json.Marshal(v)
+	return data
+}
@@ -0,0 +1,348 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestMCPServer returns a server with a few tools and one entry in each memory tier
+func newTestMCPServer(t *testing.T, withMemory bool) *MCPServer {
+	t.Helper()
+	tools, _ := NewToolManager(testLogger())
+	tools.RegisterTool(&Tool{
+		Name:        "echo",
+		Description: "Echo the text",
+		Parameters:  ObjectSchema(map[string]*JSONSchema{"text": {Type: SchemaTypeString}}, "text"),
+		Handler: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+			return args["text"], nil
+		},
+	})
+	tools.RegisterTool(&Tool{Name: "sum", Handler: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+		return map[string]interface{}{"sum": args["a"].(float64) + args["b"].(float64)}, nil
+	}})
+	tools.RegisterTool(&Tool{Name: "nothing", Handler: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+		return nil, nil
+	}})
+	tools.RegisterTool(&Tool{Name: "fail", Handler: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+		return nil, errors.New("disk full")
+	}})
+	tools.RegisterTool(&Tool{Name: "slow", Handler: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+		select {
+		case <-time.After(200 * time.Millisecond):
+			return "done", nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}})
+
+	if !withMemory {
+		return NewMCPServer(testLogger(), tools, nil, &MCPServerConfig{Version: "1.0"})
+	}
+	memory, _ := NewMemoryManager(testLogger(), &MemoryConfig{ShortTermCapacity: 10, LongTermFile: filepath.Join(t.TempDir(), "long_term.json")})
+	memory.SetShortTermMemory(context.Background(), "open file", map[string]interface{}{"path": "a.txt"}, time.Hour)
+	memory.SetLongTermMemory(context.Background(), "color", "blue")
+	return NewMCPServer(testLogger(), tools, memory, &MCPServerConfig{Version: "1.0"})
+}
+
+// assertJSONEqual compares two JSON documents ignoring formatting and key order
+func assertJSONEqual(t *testing.T, got []byte, want string) {
+	t.Helper()
+	if want == "" {
+		if got != nil {
+			t.Errorf("response = %s, want none", got)
+		}
+		return
+	}
+	var g, w interface{}
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("decode response %q: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatalf("decode want %q: %v", want, err)
+	}
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("response =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestMCPHandleMessage(t *testing.T) {
+	server := newTestMCPServer(t, true)
+
+	tests := []struct {
+		name    string
+		request string
+		want    string // empty when no response is expected
+	}{
+		{
+			name:    "initialize with a supported version",
+			request: `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05","capabilities":{},"clientInfo":{"name":"editor","version":"2"}}}`,
+			want:    `{"jsonrpc":"2.0","id":1,"result":{"protocolVersion":"2024-11-05","capabilities":{"tools":{},"resources":{}},"serverInfo":{"name":"clawdlocal","version":"1.0"}}}`,
+		},
+		{
+			name:    "initialize with an unknown version",
+			request: `{"jsonrpc":"2.0","id":"init","method":"initialize","params":{"protocolVersion":"1999-01-01"}}`,
+			want:    `{"jsonrpc":"2.0","id":"init","result":{"protocolVersion":"` + MCPProtocolVersion + `","capabilities":{"tools":{},"resources":{}},"serverInfo":{"name":"clawdlocal","version":"1.0"}}}`,
+		},
+		{name: "ping", request: `{"jsonrpc":"2.0","id":2,"method":"ping"}`, want: `{"jsonrpc":"2.0","id":2,"result":{}}`},
+		{name: "notification", request: `{"jsonrpc":"2.0","method":"notifications/initialized"}`},
+		{name: "response from the client", request: `{"jsonrpc":"2.0","id":3,"result":{}}`},
+		{
+			name:    "parse error",
+			request: `{"jsonrpc":`,
+			want:    `{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"unexpected end of JSON input"}}`,
+		},
+		{
+			name:    "not json-rpc 2.0",
+			request: `{"jsonrpc":"1.0","id":4,"method":"ping"}`,
+			want:    `{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"not a JSON-RPC 2.0 message"}}`,
+		},
+		{
+			name:    "unknown method",
+			request: `{"jsonrpc":"2.0","id":5,"method":"prompts/list"}`,
+			want:    `{"jsonrpc":"2.0","id":5,"error":{"code":-32601,"message":"method not found: prompts/list"}}`,
+		},
+		{
+			name:    "invalid params",
+			request: `{"jsonrpc":"2.0","id":6,"method":"tools/call","params":"echo"}`,
+			want:    `{"jsonrpc":"2.0","id":6,"error":{"code":-32602,"message":"json: cannot unmarshal string into Go value of type core.MCPCallToolParams"}}`,
+		},
+		{
+			name:    "unknown tool",
+			request: `{"jsonrpc":"2.0","id":7,"method":"tools/call","params":{"name":"rm"}}`,
+			want:    `{"jsonrpc":"2.0","id":7,"error":{"code":-32602,"message":"unknown tool: rm"}}`,
+		},
+		{
+			name:    "text result",
+			request: `{"jsonrpc":"2.0","id":8,"method":"tools/call","params":{"name":"echo","arguments":{"text":"hi"}}}`,
+			want:    `{"jsonrpc":"2.0","id":8,"result":{"content":[{"type":"text","text":"hi"}]}}`,
+		},
+		{
+			name:    "structured result is encoded as json text",
+			request: `{"jsonrpc":"2.0","id":9,"method":"tools/call","params":{"name":"sum","arguments":{"a":1,"b":2}}}`,
+			want:    `{"jsonrpc":"2.0","id":9,"result":{"content":[{"type":"text","text":"{\"sum\":3}"}]}}`,
+		},
+		{
+			name:    "empty result",
+			request: `{"jsonrpc":"2.0","id":10,"method":"tools/call","params":{"name":"nothing"}}`,
+			want:    `{"jsonrpc":"2.0","id":10,"result":{"content":[]}}`,
+		},
+		{
+			name:    "tool failure",
+			request: `{"jsonrpc":"2.0","id":11,"method":"tools/call","params":{"name":"fail"}}`,
+			want:    `{"jsonrpc":"2.0","id":11,"result":{"content":[{"type":"text","text":"disk full"}],"isError":true}}`,
+		},
+		{
+			name:    "invalid arguments",
+			request: `{"jsonrpc":"2.0","id":12,"method":"tools/call","params":{"name":"echo","arguments":{}}}`,
+			want:    `{"jsonrpc":"2.0","id":12,"result":{"content":[{"type":"text","text":"invalid arguments for tool echo: text: is required"}],"isError":true}}`,
+		},
+		{
+			name:    "resources list",
+			request: `{"jsonrpc":"2.0","id":13,"method":"resources/list"}`,
+			want: `{"jsonrpc":"2.0","id":13,"result":{"resources":[` +
+				`{"uri":"memory://long_term/color","name":"color","description":"Long-term memory entry","mimeType":"application/json"},` +
+				`{"uri":"memory://short_term/open%20file","name":"open file","description":"Short-term memory entry","mimeType":"application/json"}]}}`,
+		},
+		{
+			name:    "read escaped key",
+			request: `{"jsonrpc":"2.0","id":14,"method":"resources/read","params":{"uri":"memory://short_term/open%20file"}}`,
+			want:    `{"jsonrpc":"2.0","id":14,"result":{"contents":[{"uri":"memory://short_term/open%20file","mimeType":"application/json","text":"{\"path\":\"a.txt\"}"}]}}`,
+		},
+		{
+			name:    "read long term",
+			request: `{"jsonrpc":"2.0","id":15,"method":"resources/read","params":{"uri":"memory://long_term/color"}}`,
+			want:    `{"jsonrpc":"2.0","id":15,"result":{"contents":[{"uri":"memory://long_term/color","mimeType":"application/json","text":"\"blue\""}]}}`,
+		},
+		{
+			name:    "read missing resource",
+			request: `{"jsonrpc":"2.0","id":16,"method":"resources/read","params":{"uri":"memory://long_term/size"}}`,
+			want:    `{"jsonrpc":"2.0","id":16,"error":{"code":-32002,"message":"resource not found","data":{"uri":"memory://long_term/size"}}}`,
+		},
+		{
+			name:    "read foreign uri",
+			request: `{"jsonrpc":"2.0","id":17,"method":"resources/read","params":{"uri":"file:///etc/passwd"}}`,
+			want:    `{"jsonrpc":"2.0","id":17,"error":{"code":-32002,"message":"resource not found","data":{"uri":"file:///etc/passwd"}}}`,
+		},
+		{
+			name:    "read invalid escape",
+			request: `{"jsonrpc":"2.0","id":18,"method":"resources/read","params":{"uri":"memory://long_term/%zz"}}`,
+			want:    `{"jsonrpc":"2.0","id":18,"error":{"code":-32602,"message":"invalid resource URI: memory://long_term/%zz"}}`,
+		},
+		{
+			name:    "batch skips notifications",
+			request: `[{"jsonrpc":"2.0","id":1,"method":"ping"},{"jsonrpc":"2.0","method":"notifications/initialized"},{"jsonrpc":"2.0","id":2,"method":"nope"}]`,
+			want:    `[{"jsonrpc":"2.0","id":1,"result":{}},{"jsonrpc":"2.0","id":2,"error":{"code":-32601,"message":"method not found: nope"}}]`,
+		},
+		{name: "batch of notifications", request: `[{"jsonrpc":"2.0","method":"notifications/initialized"}]`},
+		{
+			name:    "empty batch",
+			request: `[]`,
+			want:    `{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"invalid batch"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertJSONEqual(t, server.HandleMessage(context.Background(), []byte(tt.request)), tt.want)
+		})
+	}
+}
+
+func TestMCPToolsList(t *testing.T) {
+	server := newTestMCPServer(t, false)
+	resp := server.HandleMessage(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`))
+
+	var msg struct {
+		Result MCPListToolsResult `json:"result"`
+	}
+	if err := json.Unmarshal(resp, &msg); err != nil {
+		t.Fatalf("decode %s: %v", resp, err)
+	}
+	var names []string
+	for _, tool := range msg.Result.Tools {
+		names = append(names, tool.Name)
+	}
+	if want := []string{"echo", "fail", "nothing", "slow", "sum"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("tools = %v, want %v", names, want)
+	}
+	if schema := msg.Result.Tools[0].InputSchema; schema.Type != SchemaTypeObject || schema.Properties["text"].Type != SchemaTypeString {
+		t.Errorf("echo input schema = %+v", schema)
+	}
+}
+
+func TestMCPServerWithoutMemory(t *testing.T) {
+	server := newTestMCPServer(t, false)
+
+	tests := []struct {
+		name    string
+		request string
+		want    string
+	}{
+		{
+			name:    "no resources capability",
+			request: `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26"}}`,
+			want:    `{"jsonrpc":"2.0","id":1,"result":{"protocolVersion":"2025-03-26","capabilities":{"tools":{}},"serverInfo":{"name":"clawdlocal","version":"1.0"}}}`,
+		},
+		{
+			name:    "resources are not served",
+			request: `{"jsonrpc":"2.0","id":2,"method":"resources/list"}`,
+			want:    `{"jsonrpc":"2.0","id":2,"error":{"code":-32601,"message":"method not found: resources/list"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertJSONEqual(t, server.HandleMessage(context.Background(), []byte(tt.request)), tt.want)
+		})
+	}
+}
+
+func TestMCPServeStdio(t *testing.T) {
+	server := newTestMCPServer(t, false)
+	in, inWriter := io.Pipe()
+	outReader, out := io.Pipe()
+
+	done := make(chan error, 1)
+	go func() { done <- server.ServeStdio(context.Background(), in, out) }()
+	responses := bufio.NewScanner(outReader)
+
+	// A slow tool call must not hold back the ping sent after it
+	io.WriteString(inWriter, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"slow"}}`+"\n\n")
+	io.WriteString(inWriter, `{"jsonrpc":"2.0","method":"notifications/initialized"}`+"\n")
+	io.WriteString(inWriter, `{"jsonrpc":"2.0","id":2,"method":"ping"}`+"\n")
+
+	want := []string{
+		`{"jsonrpc":"2.0","id":2,"result":{}}`,
+		`{"jsonrpc":"2.0","id":1,"result":{"content":[{"type":"text","text":"done"}]}}`,
+	}
+	for _, w := range want {
+		if !responses.Scan() {
+			t.Fatalf("no response, want %s", w)
+		}
+		assertJSONEqual(t, responses.Bytes(), w)
+	}
+
+	inWriter.Close()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("ServeStdio = %v, want nil at end of input", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ServeStdio did not return at end of input")
+	}
+}
+
+func TestMCPServeStdioCancel(t *testing.T) {
+	server := newTestMCPServer(t, false)
+	in, inWriter := io.Pipe()
+	defer inWriter.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- server.ServeStdio(ctx, in, io.Discard) }()
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("ServeStdio = %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ServeStdio did not return after cancel")
+	}
+}
+
+func TestMCPServeHTTP(t *testing.T) {
+	server := newTestMCPServer(t, false)
+	ping := `{"jsonrpc":"2.0","id":1,"method":"ping"}`
+
+	tests := []struct {
+		name       string
+		method     string
+		origin     string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "request", method: "POST", body: ping, wantStatus: http.StatusOK, wantBody: `{"jsonrpc":"2.0","id":1,"result":{}}`},
+		{name: "localhost origin", method: "POST", origin: "http://localhost:3000", body: ping, wantStatus: http.StatusOK},
+		{name: "loopback origin", method: "POST", origin: "http://127.0.0.1:8080", body: ping, wantStatus: http.StatusOK},
+		{name: "ipv6 loopback origin", method: "POST", origin: "http://[::1]:8080", body: ping, wantStatus: http.StatusOK},
+		{name: "notification", method: "POST", body: `{"jsonrpc":"2.0","method":"notifications/initialized"}`, wantStatus: http.StatusAccepted},
+		{name: "get stream", method: "GET", wantStatus: http.StatusMethodNotAllowed},
+		{name: "foreign origin", method: "POST", origin: "http://evil.example", body: ping, wantStatus: http.StatusForbidden},
+		{name: "invalid origin", method: "POST", origin: "://", body: ping, wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/mcp", strings.NewReader(tt.body))
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			rec := httptest.NewRecorder()
+			server.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantBody != "" {
+				assertJSONEqual(t, rec.Body.Bytes(), tt.wantBody)
+				if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+					t.Errorf("Content-Type = %q", ct)
+				}
+			}
+			if tt.wantStatus == http.StatusMethodNotAllowed && rec.Header().Get("Allow") != http.MethodPost {
+				t.Errorf("Allow = %q", rec.Header().Get("Allow"))
+			}
+		})
+	}
+}
@@ -29,8 +29,20 @@ type MemoryManager struct {
 	mutex     sync.RWMutex
 	logger    *logrus.Logger
 	config    *MemoryConfig
+
+	listenersMu sync.RWMutex
+	listeners   []MemoryListener
 }
 
+// Memory tiers reported to listeners
+const (
+	MemoryTierShortTerm = "short_term"
+	MemoryTierLongTerm  = "long_term"
+)
+
+// MemoryListener is notified after a memory entry has been written
+type MemoryListener func(tier string, entry *MemoryEntry)
+
 // MemoryConfig holds memory configuration
 type MemoryConfig struct {
 	ShortTermCapacity int           `yaml:"short_term_capacity"`
@@ -63,11 +75,27 @@ func NewMemoryManager(logger *logrus.Logger, config *MemoryConfig) (*MemoryManag
 	return mm, nil
 }
 
+// AddListener registers a listener that is called after every memory write
+func (mm *MemoryManager) AddListener(listener MemoryListener) {
+	mm.listenersMu.Lock()
+	defer mm.listenersMu.Unlock()
+	mm.listeners = append(mm.listeners, listener)
+}
+
+// notifyListeners calls all registered listeners; must be called without holding mm.mutex
+func (mm *MemoryManager) notifyListeners(tier string, entry *MemoryEntry) {
+	mm.listenersMu.RLock()
+	listeners := make([]MemoryListener, len(mm.listeners))
+	copy(listeners, mm.listeners)
+	mm.listenersMu.RUnlock()
+
+	for _, listener := range listeners {
+		listener(tier, entry)
+	}
+}
+
 // SetShortTermMemory stores a value in short-term memory
 func (mm *MemoryManager) SetShortTermMemory(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
-	mm.mutex.Lock()
-	defer mm.mutex.Unlock()
-
 	entry := &MemoryEntry{
 		Key:       key,
 		Value:     value,
@@ -78,13 +106,16 @@ func (mm *MemoryManager) SetShortTermMemory(ctx context.Context, key string, val
 		entry.TTL = &ttl
 	}
 
+	mm.mutex.Lock()
 	mm.shortTerm[key] = entry
 
 	// Enforce capacity limit
 	if len(mm.shortTerm) > mm.config.ShortTermCapacity {
 		mm.evictOldestShortTerm()
 	}
+	mm.mutex.Unlock()
 
+	mm.notifyListeners(MemoryTierShortTerm, entry)
 	return nil
 }
 
@@ -116,19 +147,24 @@ func (mm *MemoryManager) GetShortTermMemory(ctx context.Context, key string) (in
 
 // SetLongTermMemory stores a value in long-term memory
 func (mm *MemoryManager) SetLongTermMemory(ctx context.Context, key string, value interface{}) error {
-	mm.mutex.Lock()
-	defer mm.mutex.Unlock()
-
 	entry := &MemoryEntry{
 		Key:       key,
 		Value:     value,
 		Timestamp: time.Now(),
 	}
 
+	mm.mutex.Lock()
 	mm.longTerm[key] = entry
 
 	// Save to file immediately
-	return mm.saveLongTermMemory()
+	err := mm.saveLongTermMemory()
+	mm.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	mm.notifyListeners(MemoryTierLongTerm, entry)
+	return nil
 }
 
 // GetLongTermMemory retrieves a value from long-term memory
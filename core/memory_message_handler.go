@@ -56,6 +56,11 @@ func (h *MemoryMessageHandler) CanHandle(msgType MessageType) bool {
 		msgType == MessageTypeMemoryDelete
 }
 
+// MessageTypes declares the message types this handler serves
+func (h *MemoryMessageHandler) MessageTypes() []MessageType {
+	return []MessageType{MessageTypeMemoryStore, MessageTypeMemoryGet, MessageTypeMemoryDelete}
+}
+
 // Priority returns the handler priority
 func (h *MemoryMessageHandler) Priority() int {
 	return 150
@@ -63,7 +68,15 @@ func (h *MemoryMessageHandler) Priority() int {
 
 // handleStore stores a value in long-term memory
 func (h *MemoryMessageHandler) handleStore(ctx context.Context, payload *MemoryMessagePayload) error {
-	return h.MemoryManager.SetLongTermMemory(ctx, payload.Key, payload.Value)
+	if err := h.MemoryManager.SetLongTermMemory(ctx, payload.Key, payload.Value); err != nil {
+		return err
+	}
+
+	// Acknowledge the store when the message was sent as a request
+	if responder, ok := ResponderFromContext(ctx); ok {
+		return responder.Reply(&MemoryMessagePayload{Key: payload.Key, Value: payload.Value})
+	}
+	return nil
 }
 
 // handleGet retrieves a value from long-term memory
@@ -76,14 +89,11 @@ func (h *MemoryMessageHandler) handleGet(ctx context.Context, payload *MemoryMes
 		return fmt.Errorf("memory key not found: %s", payload.Key)
 	}
 	
-	// Add result to message metadata for other handlers
-	if msg, ok := ctx.Value("current_message").(*Message); ok {
-		if msg.Metadata == nil {
-			msg.Metadata = make(map[string]interface{})
-		}
-		msg.Metadata["memory_result"] = value
+	// Return the value when the message was sent as a request
+	if responder, ok := ResponderFromContext(ctx); ok {
+		return responder.Reply(&MemoryMessagePayload{Key: payload.Key, Value: value})
 	}
-	
+
 	return nil
 }
 
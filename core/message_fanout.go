@@ -0,0 +1,161 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FanOutMode 消息广播给多个处理器时的执行方式
+type FanOutMode string
+
+const (
+	// FanOutSequential 按优先级逐个执行处理器
+	FanOutSequential FanOutMode = "sequential"
+	// FanOutParallel 相同优先级的处理器并发执行，不同优先级之间仍按顺序执行。
+	// 同组处理器同时启动，其中一个返回ErrStopPropagation不会阻止同组的其他处理器，只会跳过后续分组
+	FanOutParallel FanOutMode = "parallel"
+)
+
+// DefaultFanOutConcurrency 并发模式下同时执行的处理器数量上限的默认值
+const DefaultFanOutConcurrency = 4
+
+// ParseFanOutMode 解析广播方式，空字符串表示sequential
+func ParseFanOutMode(s string) (FanOutMode, error) {
+	switch mode := FanOutMode(s); mode {
+	case "":
+		return FanOutSequential, nil
+	case FanOutSequential, FanOutParallel:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown fan-out mode: %s", s)
+	}
+}
+
+// HandlerError 单个消息处理器返回的错误
+type HandlerError struct {
+	Handler string
+	Err     error
+}
+
+func (e *HandlerError) Error() string {
+	return fmt.Sprintf("handler %s: %v", e.Handler, e.Err)
+}
+
+func (e *HandlerError) Unwrap() error {
+	return e.Err
+}
+
+// HandlerErrors 一条消息的所有处理器错误，按处理器优先级排列
+type HandlerErrors []*HandlerError
+
+func (e HandlerErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return fmt.Sprintf("%d handlers failed: %s", len(e), strings.Join(messages, "; "))
+}
+
+// Unwrap 使errors.Is和errors.As能匹配任一处理器的错误
+func (e HandlerErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// SetFanOut 设置广播方式，concurrency为并发模式下同时执行的处理器数量上限。
+// 并发模式下同一条消息会同时交给多个处理器，处理器不应修改消息。
+func (r *MessageRouter) SetFanOut(mode FanOutMode, concurrency int) {
+	if concurrency <= 0 {
+		concurrency = DefaultFanOutConcurrency
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fanOut = mode
+	r.concurrency = concurrency
+}
+
+// dispatchPlan 一次分发所需的路由器配置快照
+type dispatchPlan struct {
+	middleware  []Middleware
+	timeout     time.Duration
+	parallel    bool
+	concurrency int
+}
+
+// dispatch 将消息交给处理器。处理器按优先级分组，前一组全部完成后才执行下一组，
+// 任一处理器返回ErrStopPropagation时不再执行后续分组。顺序模式下同组中排在它之后的处理器也不再执行，
+// 并发模式下同组处理器已同时启动，会全部执行完毕。返回处理器错误和独占消息的处理器名称。
+func (r *MessageRouter) dispatch(ctx context.Context, msg *Message, entries []*handlerEntry, plan dispatchPlan) (HandlerErrors, string) {
+	errs := make([]error, len(entries))
+	var claimedBy string
+
+	for start := 0; start < len(entries) && claimedBy == ""; {
+		// 相同优先级的处理器组成一组
+		end := start + 1
+		for end < len(entries) && entries[end].handler.Priority() == entries[start].handler.Priority() {
+			end++
+		}
+
+		if plan.parallel && end-start > 1 {
+			sem := make(chan struct{}, plan.concurrency)
+			var wg sync.WaitGroup
+			for i := start; i < end; i++ {
+				sem <- struct{}{}
+				wg.Add(1)
+				go func(i int) {
+					defer func() {
+						<-sem
+						wg.Done()
+					}()
+					errs[i] = invokeEntry(ctx, msg, entries[i], plan)
+				}(i)
+			}
+			wg.Wait()
+		} else {
+			for i := start; i < end; i++ {
+				errs[i] = invokeEntry(ctx, msg, entries[i], plan)
+				if errors.Is(errs[i], ErrStopPropagation) {
+					break
+				}
+			}
+		}
+
+		for i := start; i < end; i++ {
+			if errors.Is(errs[i], ErrStopPropagation) && claimedBy == "" {
+				claimedBy = entries[i].name
+			}
+		}
+		start = end
+	}
+
+	var handlerErrs HandlerErrors
+	for i, err := range errs {
+		if err != nil && !errors.Is(err, ErrStopPropagation) {
+			handlerErrs = append(handlerErrs, &HandlerError{Handler: entries[i].name, Err: err})
+		}
+	}
+	return handlerErrs, claimedBy
+}
+
+// invokeEntry 通过中间件链执行单个处理器，panic和超时只影响该处理器
+func invokeEntry(ctx context.Context, msg *Message, entry *handlerEntry, plan dispatchPlan) error {
+	name := entry.name
+	handle := chainMiddleware(plan.middleware, entry.handler.Handle)
+	start := time.Now()
+	err := invokeSafely(ctx, name, handlerTimeout(entry.handler, plan.timeout), func(ctx context.Context) error {
+		return handle(context.WithValue(ctx, handlerNameContextKey{}, name), msg)
+	})
+	entry.stats.observe(start, err)
+	return err
+}
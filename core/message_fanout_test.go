@@ -0,0 +1,202 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseFanOutMode(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    FanOutMode
+		wantErr bool
+	}{
+		{in: "", want: FanOutSequential},
+		{in: "sequential", want: FanOutSequential},
+		{in: "parallel", want: FanOutParallel},
+		{in: "random", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseFanOutMode(tt.in)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ParseFanOutMode(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlerErrors(t *testing.T) {
+	boom := errors.New("boom")
+	errs := HandlerErrors{
+		{Handler: "memory", Err: boom},
+		{Handler: "tools", Err: &HandlerTimeoutError{Handler: "tools", Timeout: time.Second}},
+	}
+
+	tests := []struct {
+		name   string
+		err    error
+		target error
+		want   bool
+	}{
+		{name: "first handler error", err: errs, target: boom, want: true},
+		{name: "second handler error", err: errs, target: ErrHandlerTimeout, want: true},
+		{name: "unrelated error", err: errs, target: ErrUnauthorized},
+		{name: "wrapped", err: fmt.Errorf("route: %w", errs), target: boom, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errors.Is(tt.err, tt.target); got != tt.want {
+				t.Errorf("errors.Is = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	var handlerErr *HandlerError
+	if !errors.As(errs, &handlerErr) || handlerErr.Handler != "memory" {
+		t.Errorf("errors.As found %+v, want the memory handler error", handlerErr)
+	}
+	if got := errs[:1].Error(); got != "handler memory: boom" {
+		t.Errorf("single error message = %q", got)
+	}
+	if got := errs.Error(); !strings.HasPrefix(got, "2 handlers failed: handler memory: boom; handler tools:") {
+		t.Errorf("joined error message = %q", got)
+	}
+}
+
+// concurrencyProbe records how many handlers run at the same time
+type concurrencyProbe struct {
+	running atomic.Int32
+	max     atomic.Int32
+}
+
+func (p *concurrencyProbe) handler(priority int, delay time.Duration) *funcMessageHandler {
+	return &funcMessageHandler{priority: priority, handle: func(ctx context.Context, msg *Message) error {
+		n := p.running.Add(1)
+		for {
+			peak := p.max.Load()
+			if n <= peak || p.max.CompareAndSwap(peak, n) {
+				break
+			}
+		}
+		time.Sleep(delay)
+		p.running.Add(-1)
+		return nil
+	}}
+}
+
+func TestParallelFanOut(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        FanOutMode
+		concurrency int
+		handlers    int
+		wantMax     int32
+	}{
+		{name: "sequential", mode: FanOutSequential, handlers: 4, wantMax: 1},
+		{name: "parallel", mode: FanOutParallel, concurrency: 8, handlers: 4, wantMax: 4},
+		{name: "bounded", mode: FanOutParallel, concurrency: 2, handlers: 6, wantMax: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var probe concurrencyProbe
+			router := NewMessageRouter()
+			router.SetFanOut(tt.mode, tt.concurrency)
+			for i := 0; i < tt.handlers; i++ {
+				router.RegisterHandler(probe.handler(1, 30*time.Millisecond))
+			}
+
+			if err := router.Route(context.Background(), &Message{ID: "m1", Type: MessageTypeUserInput}); err != nil {
+				t.Fatalf("Route: %v", err)
+			}
+			if got := probe.max.Load(); got != tt.wantMax {
+				t.Errorf("%d handlers ran at once, want %d", got, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestParallelFanOutWaitsForHigherPriorityGroups(t *testing.T) {
+	router := NewMessageRouter()
+	router.SetFanOut(FanOutParallel, 0)
+
+	var mu sync.Mutex
+	var order []string
+	record := func(priority int, name string, delay time.Duration) {
+		router.RegisterHandler(&funcMessageHandler{priority: priority, handle: func(ctx context.Context, msg *Message) error {
+			time.Sleep(delay)
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			return nil
+		}})
+	}
+	record(1, "high-slow", 40*time.Millisecond)
+	record(1, "high-fast", 0)
+	record(2, "low", 0)
+
+	router.Route(context.Background(), &Message{ID: "m1", Type: MessageTypeUserInput})
+	if len(order) != 3 || order[0] != "high-fast" || order[2] != "low" {
+		t.Errorf("order = %v, want the low priority handler after both high priority handlers", order)
+	}
+}
+
+func TestParallelFanOutAggregatesErrors(t *testing.T) {
+	boom := errors.New("boom")
+	bang := errors.New("bang")
+
+	tests := []struct {
+		name         string
+		results      []error // per handler, all with the same priority
+		wantHandlers []string
+		wantLowerRan bool
+	}{
+		{name: "all succeed", results: []error{nil, nil, nil}, wantLowerRan: true},
+		{name: "every failure is reported", results: []error{boom, nil, bang}, wantHandlers: []string{"h0", "h2"}, wantLowerRan: true},
+		{name: "a claim still runs its own group", results: []error{ErrStopPropagation, boom}, wantHandlers: []string{"h1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := NewMessageRouter()
+			router.SetFanOut(FanOutParallel, 0)
+			for i, result := range tt.results {
+				result := result
+				router.RegisterNamedHandler(fmt.Sprintf("h%d", i), &funcMessageHandler{priority: 1, handle: func(ctx context.Context, msg *Message) error {
+					return result
+				}})
+			}
+			var lowerRan atomic.Bool
+			router.RegisterNamedHandler("lower", &funcMessageHandler{priority: 2, handle: func(ctx context.Context, msg *Message) error {
+				lowerRan.Store(true)
+				return nil
+			}})
+
+			err := router.Route(context.Background(), &Message{ID: "m1", Type: MessageTypeUserInput})
+			var handlerErrs HandlerErrors
+			if len(tt.wantHandlers) == 0 {
+				if err != nil {
+					t.Fatalf("Route = %v, want nil", err)
+				}
+			} else if !errors.As(err, &handlerErrs) {
+				t.Fatalf("Route = %v, want HandlerErrors", err)
+			}
+
+			var got []string
+			for _, e := range handlerErrs {
+				got = append(got, e.Handler)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.wantHandlers) {
+				t.Errorf("failed handlers = %v, want %v", got, tt.wantHandlers)
+			}
+			if lowerRan.Load() != tt.wantLowerRan {
+				t.Errorf("lower priority handler ran = %v, want %v", lowerRan.Load(), tt.wantLowerRan)
+			}
+		})
+	}
+}
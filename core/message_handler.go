@@ -3,6 +3,8 @@ package core
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
@@ -27,92 +29,386 @@ type Message struct {
 	Payload   interface{}           `json:"payload"`
 	Timestamp time.Time             `json:"timestamp"`
 	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+
+	CorrelationID string `json:"correlation_id,omitempty"` // 同一用户请求派生的所有事件、消息和工具调用共享该ID
+	CausationID   string `json:"causation_id,omitempty"`   // 直接导致该消息的事件或消息ID
+	ReplyTo       string `json:"reply_to,omitempty"`       // 回复消息对应的请求消息ID
 }
 
-// MessageHandler 处理消息的接口
+// MessageHandler 处理消息的接口，Handle必须在ctx结束后尽快返回
 type MessageHandler interface {
 	Handle(ctx context.Context, msg *Message) error
 	CanHandle(msgType MessageType) bool
 	Priority() int // 优先级，数字越小优先级越高
 }
 
+// MessageTypeProvider 可选接口，处理器通过它声明自己处理的消息类型。
+// 类型可以包含通配符*，例如"memory_*"匹配所有以memory_开头的类型，"*"匹配所有类型。
+// 未实现该接口的处理器在分发时通过CanHandle判断。
+type MessageTypeProvider interface {
+	MessageTypes() []MessageType
+}
+
+// handlerEntry 已注册的处理器及其声明的消息类型模式
+type handlerEntry struct {
+	id       HandlerID
+	name     string // 处理器名称，消息的Target为该名称时只交给该处理器
+	handler  MessageHandler
+	patterns []MessageType // 为nil时通过CanHandle判断
+	stats    *handlerStats // 替换处理器时保留
+}
+
+// matches 判断处理器是否处理该消息类型
+func (e *handlerEntry) matches(msgType MessageType) bool {
+	if e.patterns == nil {
+		return e.handler.CanHandle(msgType)
+	}
+	for _, pattern := range e.patterns {
+		if MatchMessageType(pattern, msgType) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchMessageType 判断消息类型是否匹配模式，模式中的*匹配任意长度的字符
+func MatchMessageType(pattern, msgType MessageType) bool {
+	return matchPattern(string(pattern), string(msgType))
+}
+
+// matchPattern 判断字符串是否匹配只含*通配符的模式
+func matchPattern(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return len(s) >= len(last) && strings.HasSuffix(s, last)
+}
+
 // MessageRouter 路由消息到合适的处理器
 type MessageRouter struct {
-	handlers map[MessageType][]MessageHandler
-	mu       sync.RWMutex
+	entries        []*handlerEntry // 按优先级排序，相同优先级保持注册顺序
+	handlerID      HandlerID       // 最近分配的处理器句柄
+	mu             sync.RWMutex
+	handlerTimeout time.Duration
+	tracer         *Tracer
+	pending        map[string]*pendingRequest // 等待回复的请求，按请求消息ID索引
+	fanOut         FanOutMode
+	concurrency    int // 并发模式下同时执行的处理器数量上限
+
+	middleware      []Middleware      // 作用于所有消息的中间件
+	typedMiddleware []typedMiddleware // 按消息类型模式注册的中间件
 }
 
 // NewMessageRouter 创建新的消息路由器
 func NewMessageRouter() *MessageRouter {
 	return &MessageRouter{
-		handlers: make(map[MessageType][]MessageHandler),
+		handlerTimeout: DefaultHandlerTimeout,
+		pending:        make(map[string]*pendingRequest),
+		fanOut:         FanOutSequential,
+		concurrency:    DefaultFanOutConcurrency,
+	}
+}
+
+// SetHandlerTimeout 设置处理器单次执行的默认超时时间
+func (r *MessageRouter) SetHandlerTimeout(timeout time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlerTimeout = timeout
+}
+
+// RouteTimeout 返回路由一条消息最长可能耗费的时间，即所有处理器超时时间之和。
+// 每个处理器各自受超时限制，调用Route的一方不应使用更短的超时。
+func (r *MessageRouter) RouteTimeout() time.Duration {
+	r.mu.RLock()
+	entries := make([]*handlerEntry, len(r.entries))
+	copy(entries, r.entries)
+	fallback := r.handlerTimeout
+	r.mu.RUnlock()
+
+	var total time.Duration
+	for _, entry := range entries {
+		total += handlerTimeout(entry.handler, fallback)
+	}
+	return total
+}
+
+// SetTracer 设置追踪器，路由过的消息会作为span记录
+func (r *MessageRouter) SetTracer(tracer *Tracer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tracer = tracer
+}
+
+// RegisterHandler 注册消息处理器，处理器名称为其类型名，返回的句柄用于注销和替换。
+// 实现了MessageTypeProvider的处理器按声明的类型模式匹配，其他处理器在分发时通过CanHandle匹配，
+// 因此自定义消息类型无需预先定义。
+func (r *MessageRouter) RegisterHandler(handler MessageHandler) HandlerID {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.addEntry(newHandlerEntry(fmt.Sprintf("%T", handler), handler))
+}
+
+// RegisterNamedHandler 以指定名称注册消息处理器，Target为该名称的消息只交给该处理器
+func (r *MessageRouter) RegisterNamedHandler(name string, handler MessageHandler) (HandlerID, error) {
+	if name == "" {
+		return 0, fmt.Errorf("handler name is required")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, entry := range r.entries {
+		if entry.name == name {
+			return 0, fmt.Errorf("handler %s is already registered", name)
+		}
+	}
+	return r.addEntry(newHandlerEntry(name, handler)), nil
+}
+
+// UnregisterHandler 注销处理器，正在执行的调用不受影响，处理器不存在时返回false
+func (r *MessageRouter) UnregisterHandler(id HandlerID) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, entry := range r.entries {
+		if entry.id == id {
+			// 复制而不是原地修改，Route持有的旧切片不受影响
+			entries := make([]*handlerEntry, 0, len(r.entries)-1)
+			entries = append(entries, r.entries[:i]...)
+			r.entries = append(entries, r.entries[i+1:]...)
+			return true
+		}
 	}
+	return false
 }
 
-// RegisterHandler 注册消息处理器
-func (r *MessageRouter) RegisterHandler(handler MessageHandler) {
+// ReplaceHandler 原子地替换处理器，保留句柄、名称和调用统计。
+// 替换后分发的消息交给新处理器，正在执行的调用仍由旧处理器完成。
+func (r *MessageRouter) ReplaceHandler(id HandlerID, handler MessageHandler) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	for _, msgType := range []MessageType{
-		MessageTypeUserInput,
-		MessageTypeSystemEvent,
-		MessageTypeToolResponse,
-		MessageTypeAgentMessage,
-		MessageTypeExternalEvent,
-	} {
-		if handler.CanHandle(msgType) {
-			r.handlers[msgType] = append(r.handlers[msgType], handler)
-			// 按优先级排序
-			handlers := r.handlers[msgType]
-			for i := len(handlers) - 1; i > 0; i-- {
-				if handlers[i].Priority() < handlers[i-1].Priority() {
-					handlers[i], handlers[i-1] = handlers[i-1], handlers[i]
-				} else {
-					break
+	for i, entry := range r.entries {
+		if entry.id != id {
+			continue
+		}
+		replacement := newHandlerEntry(entry.name, handler)
+		replacement.id = entry.id
+		replacement.stats = entry.stats
+
+		entries := append([]*handlerEntry(nil), r.entries...)
+		entries[i] = replacement
+		// 新处理器的优先级可能不同
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].handler.Priority() < entries[j].handler.Priority()
+		})
+		r.entries = entries
+		return nil
+	}
+	return fmt.Errorf("%w: %d", ErrHandlerNotRegistered, id)
+}
+
+// Handlers 返回所有已注册的处理器及其调用统计，按优先级排序
+func (r *MessageRouter) Handlers() []HandlerInfo {
+	r.mu.RLock()
+	entries := r.entries
+	r.mu.RUnlock()
+
+	infos := make([]HandlerInfo, 0, len(entries))
+	for _, entry := range entries {
+		priority := entry.handler.Priority()
+		info := HandlerInfo{
+			ID:       entry.id,
+			Name:     entry.name,
+			Types:    []string{},
+			Dynamic:  entry.patterns == nil,
+			Priority: &priority,
+			Stats:    entry.stats.snapshot(),
+		}
+		if entry.patterns != nil {
+			for _, pattern := range entry.patterns {
+				info.Types = append(info.Types, string(pattern))
+			}
+		} else {
+			for _, msgType := range knownMessageTypes {
+				if entry.handler.CanHandle(msgType) {
+					info.Types = append(info.Types, string(msgType))
 				}
 			}
 		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+func newHandlerEntry(name string, handler MessageHandler) *handlerEntry {
+	entry := &handlerEntry{name: name, handler: handler, stats: &handlerStats{}}
+	if provider, ok := handler.(MessageTypeProvider); ok {
+		entry.patterns = append([]MessageType{}, provider.MessageTypes()...)
+	}
+	return entry
+}
+
+// addEntry 分配句柄并按优先级插入处理器，调用者必须持有r.mu
+func (r *MessageRouter) addEntry(entry *handlerEntry) HandlerID {
+	r.handlerID++
+	entry.id = r.handlerID
+
+	// 复制而不是原地修改，Route持有的旧切片不受影响
+	r.entries = append(append([]*handlerEntry(nil), r.entries...), entry)
+	// 按优先级排序
+	entries := r.entries
+	for i := len(entries) - 1; i > 0; i-- {
+		if entries[i].handler.Priority() < entries[i-1].handler.Priority() {
+			entries[i], entries[i-1] = entries[i-1], entries[i]
+		} else {
+			break
+		}
+	}
+	return entry.id
+}
+
+// resolve 返回处理该消息类型的处理器，按优先级排序，调用者必须持有r.mu
+func (r *MessageRouter) resolve(msgType MessageType) []*handlerEntry {
+	var entries []*handlerEntry
+	for _, entry := range r.entries {
+		if entry.matches(msgType) {
+			entries = append(entries, entry)
+		}
 	}
+	return entries
 }
 
-// Route 路由消息到所有匹配的处理器
+// resolveTarget 返回名为target且处理该消息类型的处理器，调用者必须持有r.mu
+func (r *MessageRouter) resolveTarget(target string, msgType MessageType) ([]*handlerEntry, error) {
+	var named, entries []*handlerEntry
+	for _, entry := range r.entries {
+		if entry.name != target {
+			continue
+		}
+		named = append(named, entry)
+		if entry.matches(msgType) {
+			entries = append(entries, entry)
+		}
+	}
+	if len(named) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrTargetNotFound, target)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%w: handler %s does not handle message type %s", ErrTargetNotFound, target, msgType)
+	}
+	return entries, nil
+}
+
+// Route 路由消息到处理器。未设置Target时广播给所有匹配类型的处理器，
+// 设置了Target时只交给该名称的处理器。处理器返回ErrStopPropagation时独占该消息，
+// 优先级更低的处理器不再收到它。处理器出错时返回HandlerErrors。
 func (r *MessageRouter) Route(ctx context.Context, msg *Message) error {
 	r.mu.RLock()
-	handlers, exists := r.handlers[msg.Type]
+	var entries []*handlerEntry
+	var resolveErr error
+	if msg.Target != "" {
+		entries, resolveErr = r.resolveTarget(msg.Target, msg.Type)
+	} else {
+		entries = r.resolve(msg.Type)
+	}
+	plan := dispatchPlan{
+		middleware:  r.middlewareFor(msg.Type),
+		timeout:     r.handlerTimeout,
+		parallel:    r.fanOut == FanOutParallel,
+		concurrency: r.concurrency,
+	}
+	tracer := r.tracer
 	r.mu.RUnlock()
 
-	if !exists {
-		return fmt.Errorf("no handlers registered for message type: %s", msg.Type)
+	if msg.CorrelationID == "" {
+		msg.CorrelationID, msg.CausationID = TraceFromContext(ctx)
+	}
+	start := time.Now()
+	span := &TraceSpan{
+		ID:            msg.ID,
+		Kind:          TraceSpanMessage,
+		Name:          string(msg.Type),
+		CorrelationID: msg.CorrelationID,
+		CausationID:   msg.CausationID,
+		Timestamp:     start,
+		Attributes: map[string]interface{}{
+			"source":   msg.Source,
+			"target":   msg.Target,
+			"handlers": len(entries),
+		},
 	}
+	defer func() {
+		span.Duration = time.Since(start)
+		tracer.Record(span)
+	}()
 
-	var firstErr error
-	for _, handler := range handlers {
-		if err := handler.Handle(ctx, msg); err != nil {
-			if firstErr == nil {
-				firstErr = err
-			}
-			// 继续处理其他处理器，即使有错误
-		}
+	if resolveErr != nil {
+		span.Error = resolveErr.Error()
+		return resolveErr
+	}
+	if len(entries) == 0 {
+		err := fmt.Errorf("no handlers registered for message type: %s", msg.Type)
+		span.Error = err.Error()
+		return err
 	}
 
-	return firstErr
+	// 处理器中发起的工具调用等操作以该消息为直接原因
+	ctx = ContextWithTrace(ctx, msg.CorrelationID, msg.ID)
+
+	// 某个处理器出错时继续执行其他处理器，所有错误一并返回
+	handlerErrs, claimedBy := r.dispatch(ctx, msg, entries, plan)
+	if claimedBy != "" {
+		span.Attributes["claimed_by"] = claimedBy
+	}
+	if len(handlerErrs) > 0 {
+		span.Error = handlerErrs.Error()
+		return handlerErrs
+	}
+	return nil
 }
 
-// GetHandlers 获取指定类型的消息处理器
+// GetHandlers 获取指定类型的消息处理器，按优先级排序
 func (r *MessageRouter) GetHandlers(msgType MessageType) []MessageHandler {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	handlers, exists := r.handlers[msgType]
-	if !exists {
+	entries := r.resolve(msgType)
+	if len(entries) == 0 {
 		return nil
 	}
+	handlers := make([]MessageHandler, len(entries))
+	for i, entry := range entries {
+		handlers[i] = entry.handler
+	}
+	return handlers
+}
+
+// GetHandler 获取指定名称的消息处理器
+func (r *MessageRouter) GetHandler(name string) (MessageHandler, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 
-	// 返回副本以避免外部修改
-	result := make([]MessageHandler, len(handlers))
-	copy(result, handlers)
-	return result
+	for _, entry := range r.entries {
+		if entry.name == name {
+			return entry.handler, true
+		}
+	}
+	return nil, false
 }
 
 // MessageQueue 消息队列
@@ -0,0 +1,279 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMatchMessageType(t *testing.T) {
+	tests := []struct {
+		pattern MessageType
+		msgType MessageType
+		want    bool
+	}{
+		{pattern: "user_input", msgType: "user_input", want: true},
+		{pattern: "user_input", msgType: "user_input_extra"},
+		{pattern: "*", msgType: "anything", want: true},
+		{pattern: "*", msgType: "", want: true},
+		{pattern: "memory_*", msgType: "memory_store", want: true},
+		{pattern: "memory_*", msgType: "memory_", want: true},
+		{pattern: "memory_*", msgType: "memory"},
+		{pattern: "memory_*", msgType: "long_memory_store"},
+		{pattern: "*_event", msgType: "system_event", want: true},
+		{pattern: "*_event", msgType: "system_events"},
+		{pattern: "a*b*c", msgType: "abc", want: true},
+		{pattern: "a*b*c", msgType: "a_b_b_c", want: true},
+		{pattern: "a*b*c", msgType: "a_c"},
+		{pattern: "a*bc*bc", msgType: "abc"},
+		{pattern: "ab*ba", msgType: "aba"},
+		{pattern: "**", msgType: "x", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.pattern)+"/"+string(tt.msgType), func(t *testing.T) {
+			if got := MatchMessageType(tt.pattern, tt.msgType); got != tt.want {
+				t.Errorf("MatchMessageType(%q, %q) = %v, want %v", tt.pattern, tt.msgType, got, tt.want)
+			}
+		})
+	}
+}
+
+// typedMessageHandler is a MessageHandler that declares its message types
+type typedMessageHandler struct {
+	funcMessageHandler
+	patterns []MessageType
+}
+
+func (h *typedMessageHandler) MessageTypes() []MessageType {
+	return h.patterns
+}
+
+func TestRouterResolvesDeclaredTypes(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	record := func(name string) func(ctx context.Context, msg *Message) error {
+		return func(ctx context.Context, msg *Message) error {
+			mu.Lock()
+			calls = append(calls, name)
+			mu.Unlock()
+			return nil
+		}
+	}
+
+	router := NewMessageRouter()
+	router.RegisterHandler(&typedMessageHandler{funcMessageHandler{priority: 20, handle: record("memory")}, []MessageType{"memory_*"}})
+	router.RegisterHandler(&typedMessageHandler{funcMessageHandler{priority: 30, handle: record("audit")}, []MessageType{"*"}})
+	router.RegisterHandler(&funcMessageHandler{priority: 10, types: []MessageType{MessageTypeUserInput, "custom"}, handle: record("legacy")})
+	router.RegisterHandler(&typedMessageHandler{funcMessageHandler{priority: 10, handle: record("custom")}, []MessageType{"custom"}})
+	// A declared type list takes precedence over CanHandle
+	router.RegisterHandler(&typedMessageHandler{funcMessageHandler{priority: 5, types: []MessageType{MessageTypeUserInput}, handle: record("declared")}, []MessageType{"declared_only"}})
+
+	tests := []struct {
+		msgType MessageType
+		want    []string
+	}{
+		{msgType: MessageTypeMemoryStore, want: []string{"memory", "audit"}},
+		{msgType: "memory_custom", want: []string{"memory", "audit"}},
+		{msgType: MessageTypeUserInput, want: []string{"legacy", "audit"}},
+		{msgType: "custom", want: []string{"legacy", "custom", "audit"}},
+		{msgType: "declared_only", want: []string{"declared", "audit"}},
+		{msgType: "unknown", want: []string{"audit"}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.msgType), func(t *testing.T) {
+			calls = nil
+			if err := router.Route(context.Background(), &Message{ID: GenerateMessageID(), Type: tt.msgType}); err != nil {
+				t.Fatalf("Route: %v", err)
+			}
+			if !reflect.DeepEqual(calls, tt.want) {
+				t.Errorf("handlers called %v, want %v", calls, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouterWithoutMatchingHandler(t *testing.T) {
+	router := NewMessageRouter()
+	router.RegisterHandler(&typedMessageHandler{patterns: []MessageType{"memory_*"}})
+
+	err := router.Route(context.Background(), &Message{ID: "m1", Type: "custom"})
+	if err == nil || !strings.Contains(err.Error(), "no handlers registered for message type: custom") {
+		t.Errorf("Route = %v, want a no handlers error", err)
+	}
+}
+
+func TestRouterHandlersListsTypes(t *testing.T) {
+	router := NewMessageRouter()
+	router.RegisterHandler(&typedMessageHandler{funcMessageHandler{priority: 1}, []MessageType{"memory_*", "custom"}})
+	router.RegisterHandler(&funcMessageHandler{priority: 2, types: []MessageType{MessageTypeUserInput, MessageTypeMemoryGet}})
+
+	infos := router.Handlers()
+	if len(infos) != 2 {
+		t.Fatalf("%d handlers, want 2", len(infos))
+	}
+	tests := []struct {
+		info        HandlerInfo
+		wantTypes   []string
+		wantDynamic bool
+	}{
+		{info: infos[0], wantTypes: []string{"memory_*", "custom"}},
+		{info: infos[1], wantTypes: []string{"user_input", "memory_get"}, wantDynamic: true},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.info.Types, tt.wantTypes) || tt.info.Dynamic != tt.wantDynamic {
+			t.Errorf("%s: types %v dynamic %v, want %v dynamic %v", tt.info.Name, tt.info.Types, tt.info.Dynamic, tt.wantTypes, tt.wantDynamic)
+		}
+	}
+}
+
+func TestMemoryMessageHandlerServesItsTypes(t *testing.T) {
+	memory, _ := NewMemoryManager(testLogger(), &MemoryConfig{LongTermFile: filepath.Join(t.TempDir(), "long_term.json")})
+	router := NewMessageRouter()
+	router.RegisterHandler(&MemoryMessageHandler{MemoryManager: memory})
+
+	store := &Message{ID: "m1", Type: MessageTypeMemoryStore, Payload: map[string]interface{}{"key": "color", "value": "blue"}}
+	if err := router.Route(context.Background(), store); err != nil {
+		t.Fatalf("Route memory_store: %v", err)
+	}
+	value, found, err := memory.GetLongTermMemory(context.Background(), "color")
+	if err != nil || !found || value != "blue" {
+		t.Errorf("stored value = %v, %v, %v", value, found, err)
+	}
+
+	get := &Message{ID: "m2", Type: MessageTypeMemoryGet, Payload: map[string]interface{}{"key": "missing"}}
+	if err := router.Route(context.Background(), get); err == nil || !strings.Contains(err.Error(), "memory key not found") {
+		t.Errorf("Route memory_get = %v, want the handler's not found error", err)
+	}
+}
+
+func TestRouteTarget(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     *Message
+		want    []string
+		wantErr error
+	}{
+		{name: "broadcast without target", msg: &Message{Type: MessageTypeMemoryGet}, want: []string{"memory", "catch_all"}},
+		{name: "named target", msg: &Message{Type: MessageTypeMemoryGet, Target: "memory"}, want: []string{"memory"}},
+		{name: "target by type name", msg: &Message{Type: MessageTypeToolResponse, Target: fmt.Sprintf("%T", &funcMessageHandler{})}, want: []string{"tools"}},
+		{name: "unknown target", msg: &Message{Type: MessageTypeMemoryGet, Target: "nobody"}, wantErr: ErrTargetNotFound},
+		{name: "target does not handle the type", msg: &Message{Type: MessageTypeUserInput, Target: "memory"}, wantErr: ErrTargetNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			record := func(name string) func(ctx context.Context, msg *Message) error {
+				return func(ctx context.Context, msg *Message) error {
+					calls = append(calls, name)
+					return nil
+				}
+			}
+			router := NewMessageRouter()
+			router.RegisterNamedHandler("memory", &typedMessageHandler{funcMessageHandler{priority: 1, handle: record("memory")}, []MessageType{"memory_*"}})
+			router.RegisterHandler(&funcMessageHandler{priority: 2, types: []MessageType{MessageTypeToolResponse}, handle: record("tools")})
+			router.RegisterNamedHandler("catch_all", &typedMessageHandler{funcMessageHandler{priority: 3, handle: record("catch_all")}, []MessageType{"memory_*"}})
+
+			tt.msg.ID = GenerateMessageID()
+			err := router.Route(context.Background(), tt.msg)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("Route = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(calls, tt.want) {
+				t.Errorf("handlers called %v, want %v", calls, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegisterNamedHandler(t *testing.T) {
+	router := NewMessageRouter()
+	if _, err := router.RegisterNamedHandler("memory", &funcMessageHandler{}); err != nil {
+		t.Fatalf("RegisterNamedHandler: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		as   string
+	}{
+		{name: "duplicate name", as: "memory"},
+		{name: "empty name", as: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := router.RegisterNamedHandler(tt.as, &funcMessageHandler{}); err == nil {
+				t.Error("RegisterNamedHandler succeeded")
+			}
+		})
+	}
+
+	if _, ok := router.GetHandler("memory"); !ok {
+		t.Error("GetHandler did not find the named handler")
+	}
+	if _, ok := router.GetHandler("missing"); ok {
+		t.Error("GetHandler found a missing handler")
+	}
+}
+
+func TestRouteStopPropagation(t *testing.T) {
+	boom := errors.New("boom")
+
+	tests := []struct {
+		name        string
+		results     map[string]error // handler name -> returned error
+		want        []string
+		wantClaimed string
+		wantErr     error
+	}{
+		{name: "broadcast", want: []string{"first", "second", "third"}},
+		{name: "claimed", results: map[string]error{"first": ErrStopPropagation}, want: []string{"first"}, wantClaimed: "first"},
+		{name: "claimed within a priority group", results: map[string]error{"second": ErrStopPropagation}, want: []string{"first", "second"}, wantClaimed: "second"},
+		{
+			name:        "earlier errors are still reported",
+			results:     map[string]error{"first": boom, "second": ErrStopPropagation},
+			want:        []string{"first", "second"},
+			wantClaimed: "second",
+			wantErr:     boom,
+		},
+		{name: "wrapped sentinel", results: map[string]error{"first": fmt.Errorf("mine: %w", ErrStopPropagation)}, want: []string{"first"}, wantClaimed: "first"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			tracer := NewTracer(testLogger(), nil)
+			router := NewMessageRouter()
+			router.SetTracer(tracer)
+			for _, h := range []struct {
+				name     string
+				priority int
+			}{{"first", 1}, {"second", 2}, {"third", 2}} {
+				name := h.name
+				router.RegisterNamedHandler(name, &funcMessageHandler{priority: h.priority, handle: func(ctx context.Context, msg *Message) error {
+					calls = append(calls, name)
+					return tt.results[name]
+				}})
+			}
+
+			err := router.Route(context.Background(), &Message{ID: "m1", Type: MessageTypeUserInput, CorrelationID: "req"})
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("Route = %v, want %v", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrStopPropagation) {
+				t.Error("the stop sentinel leaked into the returned error")
+			}
+			if !reflect.DeepEqual(calls, tt.want) {
+				t.Errorf("handlers called %v, want %v", calls, tt.want)
+			}
+
+			trace, _ := tracer.Trace("req")
+			claimed, _ := trace.Roots[0].Attributes["claimed_by"].(string)
+			if claimed != tt.wantClaimed {
+				t.Errorf("claimed_by = %q, want %q", claimed, tt.wantClaimed)
+			}
+		})
+	}
+}
@@ -0,0 +1,346 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// MessageHandlerFunc 以函数形式处理消息，中间件链的基本单元
+type MessageHandlerFunc func(ctx context.Context, msg *Message) error
+
+// Middleware 包装消息处理函数，用于日志、鉴权、校验、指标等横切逻辑
+type Middleware func(next MessageHandlerFunc) MessageHandlerFunc
+
+// typedMiddleware 只作用于匹配类型模式的消息的中间件
+type typedMiddleware struct {
+	pattern    MessageType
+	middleware Middleware
+}
+
+// Use 添加作用于所有消息的中间件，先添加的中间件位于外层
+func (r *MessageRouter) Use(middleware ...Middleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.middleware = append(r.middleware, middleware...)
+}
+
+// UseFor 添加只作用于匹配类型模式的消息的中间件，位于全局中间件内层
+func (r *MessageRouter) UseFor(pattern MessageType, middleware ...Middleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, mw := range middleware {
+		r.typedMiddleware = append(r.typedMiddleware, typedMiddleware{pattern: pattern, middleware: mw})
+	}
+}
+
+// middlewareFor 返回作用于该消息类型的中间件，调用者必须持有r.mu
+func (r *MessageRouter) middlewareFor(msgType MessageType) []Middleware {
+	chain := append([]Middleware(nil), r.middleware...)
+	for _, tm := range r.typedMiddleware {
+		if MatchMessageType(tm.pattern, msgType) {
+			chain = append(chain, tm.middleware)
+		}
+	}
+	return chain
+}
+
+// chainMiddleware 用中间件包装处理函数，chain[0]位于最外层
+func chainMiddleware(chain []Middleware, handler MessageHandlerFunc) MessageHandlerFunc {
+	for i := len(chain) - 1; i >= 0; i-- {
+		handler = chain[i](handler)
+	}
+	return handler
+}
+
+type handlerNameContextKey struct{}
+
+// HandlerNameFromContext 获取当前执行的处理器名称，供中间件记录日志和指标
+func HandlerNameFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(handlerNameContextKey{}).(string)
+	return name
+}
+
+// LoggingMiddleware 记录每个处理器处理消息的结果和耗时
+func LoggingMiddleware(logger *logrus.Logger) Middleware {
+	return func(next MessageHandlerFunc) MessageHandlerFunc {
+		return func(ctx context.Context, msg *Message) error {
+			start := time.Now()
+			err := next(ctx, msg)
+
+			entry := logger.WithFields(logrus.Fields{
+				"message_id":     msg.ID,
+				"message_type":   msg.Type,
+				"source":         msg.Source,
+				"target":         msg.Target,
+				"handler":        HandlerNameFromContext(ctx),
+				"correlation_id": msg.CorrelationID,
+				"duration_ms":    float64(time.Since(start)) / float64(time.Millisecond),
+			})
+			switch {
+			case errors.Is(err, ErrStopPropagation):
+				entry.Debug("Message claimed by handler")
+			case err != nil:
+				entry.WithError(err).Warn("Message handler failed")
+			default:
+				entry.Debug("Message handled")
+			}
+			return err
+		}
+	}
+}
+
+// RecoveryMiddleware 将处理器的panic转换为HandlerPanicError，使外层中间件能看到该错误
+func RecoveryMiddleware() Middleware {
+	return func(next MessageHandlerFunc) MessageHandlerFunc {
+		return func(ctx context.Context, msg *Message) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = &HandlerPanicError{
+						Handler: HandlerNameFromContext(ctx),
+						Value:   r,
+						Stack:   string(debug.Stack()),
+					}
+				}
+			}()
+			return next(ctx, msg)
+		}
+	}
+}
+
+// PayloadValidator 校验消息负载，返回的错误说明负载不符合要求的原因
+type PayloadValidator func(payload interface{}) error
+
+// RequireFields 返回要求负载为对象并包含指定字段的校验器
+func RequireFields(fields ...string) PayloadValidator {
+	return func(payload interface{}) error {
+		object, err := payloadObject(payload)
+		if err != nil {
+			return err
+		}
+		for _, field := range fields {
+			if value, ok := object[field]; !ok || value == nil {
+				return fmt.Errorf("missing required field: %s", field)
+			}
+		}
+		return nil
+	}
+}
+
+// payloadObject 将结构体或map形式的负载统一转换为map
+func payloadObject(payload interface{}) (map[string]interface{}, error) {
+	if object, ok := payload.(map[string]interface{}); ok {
+		return object, nil
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	var object map[string]interface{}
+	if err := json.Unmarshal(data, &object); err != nil || object == nil {
+		return nil, fmt.Errorf("payload must be an object")
+	}
+	return object, nil
+}
+
+// ValidationMiddleware 按消息类型校验负载，validators的键支持*通配符，
+// 校验失败的消息不会交给处理器，返回包装了ErrInvalidPayload的错误
+func ValidationMiddleware(validators map[MessageType]PayloadValidator) Middleware {
+	return func(next MessageHandlerFunc) MessageHandlerFunc {
+		return func(ctx context.Context, msg *Message) error {
+			for pattern, validate := range validators {
+				if !MatchMessageType(pattern, msg.Type) {
+					continue
+				}
+				if err := validate(msg.Payload); err != nil {
+					return fmt.Errorf("%w for %s: %v", ErrInvalidPayload, msg.Type, err)
+				}
+			}
+			return next(ctx, msg)
+		}
+	}
+}
+
+// AuthorizationRule 允许Source发送给Target的消息，字段支持*通配符，空字段匹配任意值
+type AuthorizationRule struct {
+	Source string        `yaml:"source" json:"source,omitempty"`
+	Target string        `yaml:"target" json:"target,omitempty"`
+	Types  []MessageType `yaml:"types" json:"types,omitempty"`
+}
+
+// allows 判断规则是否允许该消息
+func (rule AuthorizationRule) allows(msg *Message) bool {
+	if rule.Source != "" && !matchPattern(rule.Source, msg.Source) {
+		return false
+	}
+	if rule.Target != "" && !matchPattern(rule.Target, msg.Target) {
+		return false
+	}
+	if len(rule.Types) == 0 {
+		return true
+	}
+	for _, pattern := range rule.Types {
+		if MatchMessageType(pattern, msg.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthorizationMiddleware 只放行至少匹配一条规则的消息，其他消息返回包装了ErrUnauthorized的错误
+func AuthorizationMiddleware(rules ...AuthorizationRule) Middleware {
+	return func(next MessageHandlerFunc) MessageHandlerFunc {
+		return func(ctx context.Context, msg *Message) error {
+			for _, rule := range rules {
+				if rule.allows(msg) {
+					return next(ctx, msg)
+				}
+			}
+			return fmt.Errorf("%w: %s from %q to %q", ErrUnauthorized, msg.Type, msg.Source, msg.Target)
+		}
+	}
+}
+
+// DefaultLatencyBuckets 延迟直方图的默认桶上限
+var DefaultLatencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+// LatencyHistogram 消息处理延迟直方图，Counts比BucketsMs多一个桶，用于超过最大上限的样本
+type LatencyHistogram struct {
+	MessageType MessageType `json:"message_type"`
+	Handler     string      `json:"handler"`
+	BucketsMs   []float64   `json:"buckets_ms"`
+	Counts      []uint64    `json:"counts"`
+	Count       uint64      `json:"count"`
+	Errors      uint64      `json:"errors"`
+	SumMs       float64     `json:"sum_ms"`
+}
+
+// MaxMetricMessageTypes 单独统计的消息类型数量上限，内置类型总是单独统计，
+// 超过上限后出现的其他类型合并到MetricsOtherMessageType
+const MaxMetricMessageTypes = 64
+
+// MetricsOtherMessageType 超过MaxMetricMessageTypes后新消息类型合并统计使用的类型
+const MetricsOtherMessageType MessageType = "other"
+
+type histogramKey struct {
+	msgType MessageType
+	handler string
+}
+
+// MessageMetrics 按消息类型和处理器统计处理延迟
+type MessageMetrics struct {
+	mu         sync.Mutex
+	buckets    []time.Duration
+	histograms map[histogramKey]*LatencyHistogram
+	types      map[MessageType]struct{} // 单独统计的非内置消息类型
+}
+
+// NewMessageMetrics 创建消息指标收集器，buckets为空时使用DefaultLatencyBuckets
+func NewMessageMetrics(buckets []time.Duration) *MessageMetrics {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	buckets = append([]time.Duration(nil), buckets...)
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i] < buckets[j] })
+
+	return &MessageMetrics{
+		buckets:    buckets,
+		histograms: make(map[histogramKey]*LatencyHistogram),
+		types:      make(map[MessageType]struct{}),
+	}
+}
+
+// Middleware 返回记录处理延迟的中间件
+func (m *MessageMetrics) Middleware() Middleware {
+	return func(next MessageHandlerFunc) MessageHandlerFunc {
+		return func(ctx context.Context, msg *Message) error {
+			start := time.Now()
+			err := next(ctx, msg)
+			m.observe(msg.Type, HandlerNameFromContext(ctx), time.Since(start), err)
+			return err
+		}
+	}
+}
+
+// observe 记录一次处理
+func (m *MessageMetrics) observe(msgType MessageType, handler string, d time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	msgType = m.metricType(msgType)
+	key := histogramKey{msgType: msgType, handler: handler}
+	h, ok := m.histograms[key]
+	if !ok {
+		h = &LatencyHistogram{
+			MessageType: msgType,
+			Handler:     handler,
+			BucketsMs:   make([]float64, len(m.buckets)),
+			Counts:      make([]uint64, len(m.buckets)+1),
+		}
+		for i, b := range m.buckets {
+			h.BucketsMs[i] = float64(b) / float64(time.Millisecond)
+		}
+		m.histograms[key] = h
+	}
+
+	i := sort.Search(len(m.buckets), func(i int) bool { return d <= m.buckets[i] })
+	h.Counts[i]++
+	h.Count++
+	h.SumMs += float64(d) / float64(time.Millisecond)
+	if err != nil && !errors.Is(err, ErrStopPropagation) {
+		h.Errors++
+	}
+}
+
+// metricType 返回统计使用的消息类型，调用者需持有m.mu
+func (m *MessageMetrics) metricType(msgType MessageType) MessageType {
+	for _, known := range knownMessageTypes {
+		if msgType == known {
+			return msgType
+		}
+	}
+	if _, ok := m.types[msgType]; ok {
+		return msgType
+	}
+	if len(m.types) >= MaxMetricMessageTypes {
+		return MetricsOtherMessageType
+	}
+	m.types[msgType] = struct{}{}
+	return msgType
+}
+
+// Snapshot 返回所有直方图的副本，按消息类型和处理器排序
+func (m *MessageMetrics) Snapshot() []*LatencyHistogram {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make([]*LatencyHistogram, 0, len(m.histograms))
+	for _, h := range m.histograms {
+		copied := *h
+		copied.Counts = append([]uint64(nil), h.Counts...)
+		result = append(result, &copied)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].MessageType != result[j].MessageType {
+			return result[i].MessageType < result[j].MessageType
+		}
+		return result[i].Handler < result[j].Handler
+	})
+	return result
+}
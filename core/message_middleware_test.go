@@ -0,0 +1,336 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+// tracingMiddleware records when it is entered and left
+func tracingMiddleware(name string, calls *[]string) Middleware {
+	return func(next MessageHandlerFunc) MessageHandlerFunc {
+		return func(ctx context.Context, msg *Message) error {
+			*calls = append(*calls, name+">")
+			err := next(ctx, msg)
+			*calls = append(*calls, "<"+name)
+			return err
+		}
+	}
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	var calls []string
+	router := NewMessageRouter()
+	router.Use(tracingMiddleware("a", &calls), tracingMiddleware("b", &calls))
+	router.UseFor("memory_*", tracingMiddleware("memory", &calls))
+	router.RegisterHandler(&funcMessageHandler{handle: func(ctx context.Context, msg *Message) error {
+		calls = append(calls, "handler")
+		return nil
+	}})
+
+	tests := []struct {
+		msgType MessageType
+		want    []string
+	}{
+		{msgType: MessageTypeMemoryGet, want: []string{"a>", "b>", "memory>", "handler", "<memory", "<b", "<a"}},
+		{msgType: MessageTypeUserInput, want: []string{"a>", "b>", "handler", "<b", "<a"}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.msgType), func(t *testing.T) {
+			calls = nil
+			if err := router.Route(context.Background(), &Message{ID: GenerateMessageID(), Type: tt.msgType}); err != nil {
+				t.Fatalf("Route: %v", err)
+			}
+			if !reflect.DeepEqual(calls, tt.want) {
+				t.Errorf("calls = %v, want %v", calls, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddlewareRunsPerHandler(t *testing.T) {
+	var names []string
+	router := NewMessageRouter()
+	router.Use(func(next MessageHandlerFunc) MessageHandlerFunc {
+		return func(ctx context.Context, msg *Message) error {
+			names = append(names, HandlerNameFromContext(ctx))
+			return next(ctx, msg)
+		}
+	})
+	router.RegisterHandler(&funcMessageHandler{priority: 1})
+	router.RegisterNamedHandler("named", &funcMessageHandler{priority: 2})
+
+	router.Route(context.Background(), &Message{ID: "m1", Type: MessageTypeUserInput})
+	want := []string{fmt.Sprintf("%T", &funcMessageHandler{}), "named"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("handler names = %v, want %v", names, want)
+	}
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	var seen error
+	router := NewMessageRouter()
+	router.Use(func(next MessageHandlerFunc) MessageHandlerFunc {
+		return func(ctx context.Context, msg *Message) error {
+			seen = next(ctx, msg)
+			return seen
+		}
+	}, RecoveryMiddleware())
+	router.RegisterNamedHandler("buggy", &funcMessageHandler{handle: func(ctx context.Context, msg *Message) error {
+		panic("kaboom")
+	}})
+
+	err := router.Route(context.Background(), &Message{ID: "m1", Type: MessageTypeUserInput})
+	var panicErr *HandlerPanicError
+	if !errors.As(seen, &panicErr) || panicErr.Handler != "buggy" || panicErr.Value != "kaboom" {
+		t.Fatalf("outer middleware saw %v, want a HandlerPanicError", seen)
+	}
+	if !errors.As(err, &panicErr) {
+		t.Errorf("Route = %v, want the panic error", err)
+	}
+}
+
+func TestRequireFields(t *testing.T) {
+	type payload struct {
+		Key   string `json:"key"`
+		Value string `json:"value,omitempty"`
+	}
+
+	tests := []struct {
+		name    string
+		payload interface{}
+		wantErr bool
+	}{
+		{name: "map with fields", payload: map[string]interface{}{"key": "k", "value": 1}},
+		{name: "struct with fields", payload: payload{Key: "k", Value: "v"}},
+		{name: "struct pointer", payload: &payload{Key: "k", Value: "v"}},
+		{name: "missing field", payload: map[string]interface{}{"key": "k"}, wantErr: true},
+		{name: "nil field", payload: map[string]interface{}{"key": "k", "value": nil}, wantErr: true},
+		{name: "omitted struct field", payload: payload{Key: "k"}, wantErr: true},
+		{name: "not an object", payload: "text", wantErr: true},
+		{name: "nil payload", payload: nil, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := RequireFields("key", "value")(tt.payload); (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidationMiddleware(t *testing.T) {
+	tests := []struct {
+		name        string
+		msg         *Message
+		wantErr     error
+		wantHandled bool
+	}{
+		{name: "valid", msg: &Message{Type: MessageTypeMemoryStore, Payload: map[string]interface{}{"key": "k"}}, wantHandled: true},
+		{name: "invalid", msg: &Message{Type: MessageTypeMemoryStore, Payload: map[string]interface{}{}}, wantErr: ErrInvalidPayload},
+		{name: "pattern", msg: &Message{Type: "memory_custom", Payload: "text"}, wantErr: ErrInvalidPayload},
+		{name: "unvalidated type", msg: &Message{Type: MessageTypeUserInput, Payload: "text"}, wantHandled: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handled := false
+			router := NewMessageRouter()
+			router.Use(ValidationMiddleware(map[MessageType]PayloadValidator{"memory_*": RequireFields("key")}))
+			router.RegisterHandler(&funcMessageHandler{handle: func(ctx context.Context, msg *Message) error {
+				handled = true
+				return nil
+			}})
+
+			tt.msg.ID = GenerateMessageID()
+			err := router.Route(context.Background(), tt.msg)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Errorf("Route = %v, want %v", err, tt.wantErr)
+			}
+			if handled != tt.wantHandled {
+				t.Errorf("handled = %v, want %v", handled, tt.wantHandled)
+			}
+		})
+	}
+}
+
+func TestAuthorizationMiddleware(t *testing.T) {
+	rules := []AuthorizationRule{
+		{Source: "web", Types: []MessageType{MessageTypeUserInput}},
+		{Source: "plugin_*", Target: "memory", Types: []MessageType{"memory_*"}},
+		{Source: "admin"},
+	}
+
+	tests := []struct {
+		name string
+		msg  *Message
+		want bool
+	}{
+		{name: "allowed type", msg: &Message{Source: "web", Type: MessageTypeUserInput}, want: true},
+		{name: "other type", msg: &Message{Source: "web", Type: MessageTypeMemoryStore}},
+		{name: "source pattern and target", msg: &Message{Source: "plugin_notes", Target: "memory", Type: MessageTypeMemoryGet}, want: true},
+		{name: "wrong target", msg: &Message{Source: "plugin_notes", Target: "tools", Type: MessageTypeMemoryGet}},
+		{name: "rule without types", msg: &Message{Source: "admin", Type: "anything"}, want: true},
+		{name: "unknown source", msg: &Message{Source: "stranger", Type: MessageTypeUserInput}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := NewMessageRouter()
+			router.Use(AuthorizationMiddleware(rules...))
+			router.RegisterHandler(&funcMessageHandler{})
+			if tt.msg.Target != "" {
+				router.RegisterNamedHandler(tt.msg.Target, &funcMessageHandler{})
+			}
+
+			tt.msg.ID = GenerateMessageID()
+			err := router.Route(context.Background(), tt.msg)
+			if got := err == nil; got != tt.want {
+				t.Errorf("allowed = %v, want %v (err %v)", got, tt.want, err)
+			}
+			if !tt.want && !errors.Is(err, ErrUnauthorized) {
+				t.Errorf("err = %v, want ErrUnauthorized", err)
+			}
+		})
+	}
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantLevel logrus.Level
+	}{
+		{name: "success", wantLevel: logrus.DebugLevel},
+		{name: "claimed", err: ErrStopPropagation, wantLevel: logrus.DebugLevel},
+		{name: "failure", err: errors.New("boom"), wantLevel: logrus.WarnLevel},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, hook := logtest.NewNullLogger()
+			logger.SetLevel(logrus.DebugLevel)
+			router := NewMessageRouter()
+			router.Use(LoggingMiddleware(logger))
+			router.RegisterNamedHandler("logged", &funcMessageHandler{handle: func(ctx context.Context, msg *Message) error {
+				return tt.err
+			}})
+
+			router.Route(context.Background(), &Message{ID: "m1", Type: MessageTypeUserInput, Source: "web", CorrelationID: "req"})
+			entry := hook.LastEntry()
+			if entry == nil || entry.Level != tt.wantLevel {
+				t.Fatalf("entry = %v, want level %s", entry, tt.wantLevel)
+			}
+			for field, want := range map[string]interface{}{"message_id": "m1", "handler": "logged", "source": "web", "correlation_id": "req"} {
+				if got := entry.Data[field]; got != want {
+					t.Errorf("%s = %v, want %v", field, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMessageMetrics(t *testing.T) {
+	metrics := NewMessageMetrics([]time.Duration{50 * time.Millisecond, 10 * time.Millisecond})
+	metrics.observe(MessageTypeUserInput, "h", 5*time.Millisecond, nil)
+	metrics.observe(MessageTypeUserInput, "h", 20*time.Millisecond, errors.New("boom"))
+	metrics.observe(MessageTypeUserInput, "h", time.Second, ErrStopPropagation)
+	metrics.observe(MessageTypeUserInput, "other", time.Millisecond, nil)
+
+	snapshot := metrics.Snapshot()
+	if len(snapshot) != 2 {
+		t.Fatalf("%d histograms, want 2", len(snapshot))
+	}
+	h := snapshot[0]
+	want := &LatencyHistogram{
+		MessageType: MessageTypeUserInput,
+		Handler:     "h",
+		BucketsMs:   []float64{10, 50},
+		Counts:      []uint64{1, 1, 1},
+		Count:       3,
+		Errors:      1,
+		SumMs:       1025,
+	}
+	if !reflect.DeepEqual(h, want) {
+		t.Errorf("histogram = %+v, want %+v", h, want)
+	}
+
+	// The snapshot is a copy
+	h.Counts[0] = 100
+	if metrics.Snapshot()[0].Counts[0] != 1 {
+		t.Error("modifying the snapshot changed the metrics")
+	}
+}
+
+func TestMessageMetricsBoundsTypes(t *testing.T) {
+	metrics := NewMessageMetrics(nil)
+	for i := 0; i < MaxMetricMessageTypes+10; i++ {
+		metrics.observe(MessageType(fmt.Sprintf("custom_%d", i)), "h", time.Millisecond, nil)
+	}
+	// Built-in types and types seen before the cap are still counted separately
+	metrics.observe(MessageTypeUserInput, "h", time.Millisecond, nil)
+	metrics.observe("custom_0", "h", time.Millisecond, nil)
+
+	counts := make(map[MessageType]uint64)
+	for _, h := range metrics.Snapshot() {
+		counts[h.MessageType] = h.Count
+	}
+	tests := []struct {
+		msgType MessageType
+		want    uint64
+	}{
+		{msgType: MetricsOtherMessageType, want: 10},
+		{msgType: MessageTypeUserInput, want: 1},
+		{msgType: "custom_0", want: 2},
+		{msgType: MessageType(fmt.Sprintf("custom_%d", MaxMetricMessageTypes-1)), want: 1},
+		{msgType: MessageType(fmt.Sprintf("custom_%d", MaxMetricMessageTypes)), want: 0},
+	}
+	for _, tt := range tests {
+		if got := counts[tt.msgType]; got != tt.want {
+			t.Errorf("%s counted %d times, want %d", tt.msgType, got, tt.want)
+		}
+	}
+	if len(counts) != MaxMetricMessageTypes+2 {
+		t.Errorf("%d histograms, want %d", len(counts), MaxMetricMessageTypes+2)
+	}
+}
+
+func TestMessageMetricsEndpoint(t *testing.T) {
+	tests := []struct {
+		name       string
+		metrics    bool
+		wantStatus int
+	}{
+		{name: "metrics", metrics: true, wantStatus: http.StatusOK},
+		{name: "no metrics", wantStatus: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := newTestWebServer(t, startTestLoop(t, nil, nil))
+			if tt.metrics {
+				metrics := NewMessageMetrics(nil)
+				router := NewMessageRouter()
+				router.Use(metrics.Middleware())
+				router.RegisterHandler(&funcMessageHandler{})
+				router.Route(context.Background(), &Message{ID: "m1", Type: MessageTypeUserInput})
+				ws.agent.metrics = metrics
+			}
+
+			rec := serveTestRequest(ws, "GET", "/api/v1/messages/metrics", "")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.metrics {
+				var histograms []*LatencyHistogram
+				if err := json.Unmarshal(rec.Body.Bytes(), &histograms); err != nil || len(histograms) != 1 || histograms[0].Count != 1 {
+					t.Errorf("body = %s", rec.Body)
+				}
+			}
+		})
+	}
+}
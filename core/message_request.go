@@ -0,0 +1,262 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ReplyMode 请求等待回复的方式
+type ReplyMode string
+
+const (
+	// ReplyFirst 收到第一个回复即返回，其余处理器继续执行但回复被丢弃
+	ReplyFirst ReplyMode = "first"
+	// ReplyAll 等待所有处理器完成，返回收集到的全部回复
+	ReplyAll ReplyMode = "all"
+)
+
+// DefaultRequestTimeout 请求等待回复的默认超时时间
+const DefaultRequestTimeout = 30 * time.Second
+
+// RequestOptions 请求选项
+type RequestOptions struct {
+	Timeout time.Duration // 等待回复的超时时间，默认DefaultRequestTimeout
+	Mode    ReplyMode     // 回复方式，默认ReplyFirst
+}
+
+// ReplyType 返回请求类型对应的默认回复类型，例如memory_get的回复类型为memory_get_response
+func ReplyType(msgType MessageType) MessageType {
+	return msgType + "_response"
+}
+
+// Responder 处理器通过它回复当前请求，由MessageRouter.Request放入处理器的上下文
+type Responder struct {
+	router  *MessageRouter
+	request *Message
+	pending *pendingRequest
+}
+
+type responderContextKey struct{}
+
+// ResponderFromContext 获取当前请求的Responder，消息不是通过Request发送时返回false
+func ResponderFromContext(ctx context.Context) (*Responder, bool) {
+	responder, ok := ctx.Value(responderContextKey{}).(*Responder)
+	return responder, ok
+}
+
+// Reply 回复当前请求，消息不是通过Request发送时返回ErrNoResponder
+func Reply(ctx context.Context, payload interface{}) error {
+	responder, ok := ResponderFromContext(ctx)
+	if !ok {
+		return ErrNoResponder
+	}
+	return responder.Reply(payload)
+}
+
+// Request 返回被回复的请求消息
+func (rs *Responder) Request() *Message {
+	return rs.request
+}
+
+// Reply 以默认回复类型回复请求
+func (rs *Responder) Reply(payload interface{}) error {
+	return rs.ReplyMessage(&Message{Payload: payload})
+}
+
+// ReplyError 回复处理失败，错误信息放在回复的metadata中
+func (rs *Responder) ReplyError(err error) error {
+	return rs.ReplyMessage(&Message{
+		Metadata: map[string]interface{}{"error": err.Error()},
+	})
+}
+
+// ReplyMessage 发送自定义回复，未设置的ID、类型、目标和关联字段会自动填充。
+// 请求已结束（ReplyFirst已收到回复或已超时）时回复被丢弃，不返回错误，
+// 处理器本身的工作已经完成，不应因此被视为失败。
+func (rs *Responder) ReplyMessage(reply *Message) error {
+	if reply.ID == "" {
+		reply.ID = GenerateMessageID()
+	}
+	if reply.Type == "" {
+		reply.Type = ReplyType(rs.request.Type)
+	}
+	if reply.Target == "" {
+		reply.Target = rs.request.Source
+	}
+	if reply.Timestamp.IsZero() {
+		reply.Timestamp = time.Now()
+	}
+	reply.ReplyTo = rs.request.ID
+	reply.CorrelationID = rs.request.CorrelationID
+	reply.CausationID = rs.request.ID
+	if rs.pending.add(reply) {
+		rs.router.traceReply(reply)
+	}
+	return nil
+}
+
+// pendingRequest 等待回复的请求
+type pendingRequest struct {
+	mu      sync.Mutex
+	replies []*Message
+	closed  bool
+	arrived chan struct{} // 收到第一个回复时关闭
+}
+
+func newPendingRequest() *pendingRequest {
+	return &pendingRequest{arrived: make(chan struct{})}
+}
+
+// add 记录回复，请求已结束时返回false
+func (p *pendingRequest) add(reply *Message) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return false
+	}
+	p.replies = append(p.replies, reply)
+	if len(p.replies) == 1 {
+		close(p.arrived)
+	}
+	return true
+}
+
+// close 结束请求并返回已收到的回复，之后到达的回复会被丢弃
+func (p *pendingRequest) close() []*Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	return p.replies
+}
+
+// Request 发送请求消息并等待第一个回复
+func (r *MessageRouter) Request(ctx context.Context, msg *Message) (*Message, error) {
+	replies, err := r.RequestWithOptions(ctx, msg, RequestOptions{Mode: ReplyFirst})
+	if err != nil {
+		return nil, err
+	}
+	return replies[0], nil
+}
+
+// RequestAll 发送请求消息，等待所有处理器完成并返回全部回复
+func (r *MessageRouter) RequestAll(ctx context.Context, msg *Message, timeout time.Duration) ([]*Message, error) {
+	return r.RequestWithOptions(ctx, msg, RequestOptions{Timeout: timeout, Mode: ReplyAll})
+}
+
+// RequestWithOptions 发送请求消息并按指定方式等待回复。
+// 回复按请求消息ID关联；ReplyAll模式下超时或处理器出错时会同时返回已收到的回复和错误。
+func (r *MessageRouter) RequestWithOptions(ctx context.Context, msg *Message, opts RequestOptions) ([]*Message, error) {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultRequestTimeout
+	}
+	if opts.Mode == "" {
+		opts.Mode = ReplyFirst
+	}
+	if msg.ID == "" {
+		msg.ID = GenerateMessageID()
+	}
+	if msg.CorrelationID == "" {
+		msg.CorrelationID, msg.CausationID = TraceFromContext(ctx)
+	}
+	if msg.CorrelationID == "" {
+		// 不在已有追踪中的请求作为新追踪的根
+		msg.CorrelationID = msg.ID
+	}
+
+	pending := newPendingRequest()
+	r.mu.Lock()
+	if _, exists := r.pending[msg.ID]; exists {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("request %s is already pending", msg.ID)
+	}
+	r.pending[msg.ID] = pending
+	r.mu.Unlock()
+
+	defer func() {
+		r.mu.Lock()
+		delete(r.pending, msg.ID)
+		r.mu.Unlock()
+	}()
+
+	// 提前返回时不取消路由，其余处理器在请求超时前仍可执行完成
+	reqCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	routeCtx := context.WithValue(reqCtx, responderContextKey{}, &Responder{router: r, request: msg, pending: pending})
+	routed := make(chan error, 1)
+	go func() {
+		defer cancel()
+		routed <- r.Route(routeCtx, msg)
+	}()
+
+	arrived := pending.arrived
+	if opts.Mode == ReplyAll {
+		// 收集模式下只在路由完成后返回
+		arrived = nil
+	}
+
+	select {
+	case <-arrived:
+		return pending.close()[:1], nil
+	case err := <-routed:
+		replies := pending.close()
+		if len(replies) == 0 {
+			if err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%w: %s", ErrNoReply, msg.Type)
+		}
+		if opts.Mode == ReplyFirst {
+			return replies[:1], nil
+		}
+		return replies, err
+	case <-reqCtx.Done():
+		replies := pending.close()
+		if opts.Mode == ReplyFirst && len(replies) > 0 {
+			return replies[:1], nil
+		}
+		err := reqCtx.Err()
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("%w after %s: %s", ErrRequestTimeout, opts.Timeout, msg.Type)
+		}
+		if len(replies) == 0 {
+			return nil, err
+		}
+		return replies, err
+	}
+}
+
+// DeliverReply 将回复交给等待中的请求，按reply.ReplyTo关联。
+// 异步完成的处理器可以保存请求ID，稍后通过它回复。
+func (r *MessageRouter) DeliverReply(reply *Message) error {
+	r.mu.RLock()
+	pending, exists := r.pending[reply.ReplyTo]
+	r.mu.RUnlock()
+
+	if !exists || !pending.add(reply) {
+		return fmt.Errorf("%w: %s", ErrRequestNotFound, reply.ReplyTo)
+	}
+	r.traceReply(reply)
+	return nil
+}
+
+// traceReply 将已交给请求的回复记录为span
+func (r *MessageRouter) traceReply(reply *Message) {
+	r.mu.RLock()
+	tracer := r.tracer
+	r.mu.RUnlock()
+
+	tracer.Record(&TraceSpan{
+		ID:            reply.ID,
+		Kind:          TraceSpanMessage,
+		Name:          string(reply.Type),
+		CorrelationID: reply.CorrelationID,
+		CausationID:   reply.CausationID,
+		Timestamp:     reply.Timestamp,
+		Attributes: map[string]interface{}{
+			"reply_to": reply.ReplyTo,
+			"target":   reply.Target,
+		},
+	})
+}
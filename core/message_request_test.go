@@ -0,0 +1,329 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// replyingHandler returns a handler that waits for delay, then replies with payload
+func replyingHandler(priority int, delay time.Duration, payload interface{}) *funcMessageHandler {
+	return &funcMessageHandler{priority: priority, handle: func(ctx context.Context, msg *Message) error {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		return Reply(ctx, payload)
+	}}
+}
+
+func replyPayloads(replies []*Message) []interface{} {
+	payloads := make([]interface{}, len(replies))
+	for i, reply := range replies {
+		payloads[i] = reply.Payload
+	}
+	return payloads
+}
+
+func TestRouterRequestModes(t *testing.T) {
+	boom := errors.New("boom")
+
+	tests := []struct {
+		name     string
+		handlers []MessageHandler
+		opts     RequestOptions
+		want     []interface{}
+		wantErr  error
+	}{
+		{
+			name:     "first reply wins",
+			handlers: []MessageHandler{replyingHandler(1, 0, "first"), replyingHandler(2, time.Minute, "never")},
+			opts:     RequestOptions{Timeout: 5 * time.Second, Mode: ReplyFirst},
+			want:     []interface{}{"first"},
+		},
+		{
+			name:     "gather all",
+			handlers: []MessageHandler{replyingHandler(1, 0, "a"), replyingHandler(2, 10*time.Millisecond, "b")},
+			opts:     RequestOptions{Timeout: time.Second, Mode: ReplyAll},
+			want:     []interface{}{"a", "b"},
+		},
+		{
+			name:     "no reply",
+			handlers: []MessageHandler{&funcMessageHandler{}},
+			opts:     RequestOptions{Timeout: time.Second},
+			wantErr:  ErrNoReply,
+		},
+		{
+			name: "handler error without a reply",
+			handlers: []MessageHandler{&funcMessageHandler{handle: func(ctx context.Context, msg *Message) error {
+				return boom
+			}}},
+			opts:    RequestOptions{Timeout: time.Second},
+			wantErr: boom,
+		},
+		{
+			name:     "timeout",
+			handlers: []MessageHandler{replyingHandler(1, time.Minute, "never")},
+			opts:     RequestOptions{Timeout: 20 * time.Millisecond},
+			wantErr:  ErrRequestTimeout,
+		},
+		{
+			name:     "gather all returns partial replies on timeout",
+			handlers: []MessageHandler{replyingHandler(1, 0, "a"), replyingHandler(2, time.Minute, "never")},
+			opts:     RequestOptions{Timeout: 50 * time.Millisecond, Mode: ReplyAll},
+			want:     []interface{}{"a"},
+			wantErr:  ErrRequestTimeout,
+		},
+		{
+			name: "gather all returns replies and handler errors",
+			handlers: []MessageHandler{replyingHandler(1, 0, "a"), &funcMessageHandler{priority: 2, handle: func(ctx context.Context, msg *Message) error {
+				return boom
+			}}},
+			opts:    RequestOptions{Timeout: time.Second, Mode: ReplyAll},
+			want:    []interface{}{"a"},
+			wantErr: boom,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := NewMessageRouter()
+			for _, handler := range tt.handlers {
+				router.RegisterHandler(handler)
+			}
+
+			start := time.Now()
+			replies, err := router.RequestWithOptions(context.Background(), &Message{Type: MessageTypeMemoryGet, Source: "caller"}, tt.opts)
+			if tt.wantErr == nil && time.Since(start) >= tt.opts.Timeout {
+				t.Errorf("request waited for its timeout")
+			}
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got := replyPayloads(replies); len(tt.want) > 0 && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("replies = %v, want %v", got, tt.want)
+			} else if len(tt.want) == 0 && len(replies) != 0 {
+				t.Errorf("replies = %v, want none", got)
+			}
+			router.mu.RLock()
+			pending := len(router.pending)
+			router.mu.RUnlock()
+			if pending != 0 {
+				t.Errorf("%d requests still pending", pending)
+			}
+		})
+	}
+}
+
+func TestReplyFields(t *testing.T) {
+	router := NewMessageRouter()
+	router.RegisterHandler(&funcMessageHandler{handle: func(ctx context.Context, msg *Message) error {
+		responder, ok := ResponderFromContext(ctx)
+		if !ok || responder.Request() != msg {
+			t.Error("responder does not carry the request")
+		}
+		return responder.ReplyError(errors.New("not found"))
+	}})
+
+	request := &Message{ID: "req-1", Type: MessageTypeMemoryGet, Source: "caller", CorrelationID: "trace-1"}
+	reply, err := router.Request(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Request: %v", err)
+	}
+
+	want := Message{
+		Type:          ReplyType(MessageTypeMemoryGet),
+		Target:        "caller",
+		ReplyTo:       "req-1",
+		CorrelationID: "trace-1",
+		CausationID:   "req-1",
+		Metadata:      map[string]interface{}{"error": "not found"},
+	}
+	got := Message{
+		Type:          reply.Type,
+		Target:        reply.Target,
+		ReplyTo:       reply.ReplyTo,
+		CorrelationID: reply.CorrelationID,
+		CausationID:   reply.CausationID,
+		Metadata:      reply.Metadata,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("reply = %+v, want %+v", got, want)
+	}
+	if reply.ID == "" || reply.Timestamp.IsZero() {
+		t.Errorf("reply ID or timestamp not set: %+v", reply)
+	}
+}
+
+func TestReplyOutsideRequest(t *testing.T) {
+	router := NewMessageRouter()
+	var replyErr error
+	router.RegisterHandler(&funcMessageHandler{handle: func(ctx context.Context, msg *Message) error {
+		replyErr = Reply(ctx, "ignored")
+		return nil
+	}})
+
+	if err := router.Route(context.Background(), &Message{ID: "m1", Type: MessageTypeUserInput}); err != nil {
+		t.Fatalf("Route: %v", err)
+	}
+	if !errors.Is(replyErr, ErrNoResponder) {
+		t.Errorf("Reply = %v, want ErrNoResponder", replyErr)
+	}
+}
+
+func TestLateReplyIsDropped(t *testing.T) {
+	router := NewMessageRouter()
+	responders := make(chan *Responder, 1)
+	router.RegisterHandler(&funcMessageHandler{handle: func(ctx context.Context, msg *Message) error {
+		responder, _ := ResponderFromContext(ctx)
+		responders <- responder
+		return responder.Reply("first")
+	}})
+
+	reply, err := router.Request(context.Background(), &Message{Type: MessageTypeUserInput})
+	if err != nil {
+		t.Fatalf("Request: %v", err)
+	}
+	responder := <-responders
+	if err := responder.Reply("late"); err != nil {
+		t.Errorf("late Reply = %v, want it dropped silently", err)
+	}
+	// Replies addressed by ID cannot tell an ended request from an unknown one
+	if err := router.DeliverReply(&Message{ReplyTo: reply.ReplyTo}); !errors.Is(err, ErrRequestNotFound) {
+		t.Errorf("late DeliverReply = %v, want ErrRequestNotFound", err)
+	}
+}
+
+func TestReplyFirstDoesNotFailLaterRepliers(t *testing.T) {
+	memory, _ := NewMemoryManager(testLogger(), &MemoryConfig{LongTermFile: filepath.Join(t.TempDir(), "long_term.json")})
+	memory.SetLongTermMemory(context.Background(), "color", "blue")
+	tools, _ := NewToolManager(testLogger())
+	tools.RegisterTool(&Tool{Name: "ping", Handler: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+		return "pong", nil
+	}})
+
+	tests := []struct {
+		name    string
+		handler MessageHandler
+		msg     *Message
+	}{
+		{name: "memory store", handler: &MemoryMessageHandler{MemoryManager: memory}, msg: &Message{Type: MessageTypeMemoryStore, Payload: map[string]interface{}{"key": "size", "value": 3.0}}},
+		{name: "memory get", handler: &MemoryMessageHandler{MemoryManager: memory}, msg: &Message{Type: MessageTypeMemoryGet, Payload: map[string]interface{}{"key": "color"}}},
+		{name: "tool call", handler: &ToolCallMessageHandler{ToolManager: tools}, msg: &Message{Type: MessageTypeToolResponse, Payload: map[string]interface{}{"tool_name": "ping"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := NewMessageRouter()
+			// Replies first; the handler under test only runs once Request has returned
+			router.RegisterHandler(&funcMessageHandler{priority: -1, handle: func(ctx context.Context, msg *Message) error {
+				return Reply(ctx, "first")
+			}})
+			returned := make(chan struct{})
+			id, _ := router.RegisterNamedHandler("late", &funcMessageHandler{handle: func(ctx context.Context, msg *Message) error {
+				<-returned
+				return tt.handler.Handle(ctx, msg)
+			}})
+
+			reply, err := router.Request(context.Background(), tt.msg)
+			close(returned)
+			if err != nil || reply.Payload != "first" {
+				t.Fatalf("Request = %v, %v; want the first reply", reply, err)
+			}
+			stats := func() HandlerStats {
+				for _, info := range router.Handlers() {
+					if info.ID == id {
+						return info.Stats
+					}
+				}
+				return HandlerStats{}
+			}
+			waitFor(t, time.Second, "late handler finished", func() bool { return stats().Invocations == 1 })
+			if s := stats(); s.Failures != 0 {
+				t.Errorf("late handler failed: %s", s.LastError)
+			}
+		})
+	}
+}
+
+func TestRequestRejectsDuplicateID(t *testing.T) {
+	router := NewMessageRouter()
+	release := make(chan struct{})
+	router.RegisterHandler(&funcMessageHandler{handle: func(ctx context.Context, msg *Message) error {
+		<-release
+		return Reply(ctx, "done")
+	}})
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := router.Request(context.Background(), &Message{ID: "req-1", Type: MessageTypeUserInput})
+		done <- err
+	}()
+	waitFor(t, time.Second, "first request pending", func() bool {
+		router.mu.RLock()
+		defer router.mu.RUnlock()
+		return router.pending["req-1"] != nil
+	})
+
+	if _, err := router.Request(context.Background(), &Message{ID: "req-1", Type: MessageTypeUserInput}); err == nil {
+		t.Error("a second request with the same ID was accepted")
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Errorf("first request: %v", err)
+	}
+}
+
+func TestRequestReturnsToolAndMemoryResults(t *testing.T) {
+	memory, _ := NewMemoryManager(testLogger(), &MemoryConfig{LongTermFile: filepath.Join(t.TempDir(), "long_term.json")})
+	memory.SetLongTermMemory(context.Background(), "color", "blue")
+
+	tools, _ := NewToolManager(testLogger())
+	tools.RegisterTool(&Tool{Name: "double", Handler: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+		return args["n"].(float64) * 2, nil
+	}})
+
+	router := NewMessageRouter()
+	router.RegisterHandler(&MemoryMessageHandler{MemoryManager: memory})
+	router.RegisterHandler(&ToolCallMessageHandler{ToolManager: tools})
+
+	tests := []struct {
+		name  string
+		msg   *Message
+		check func(t *testing.T, payload interface{})
+	}{
+		{
+			name: "memory get",
+			msg:  &Message{Type: MessageTypeMemoryGet, Payload: map[string]interface{}{"key": "color"}},
+			check: func(t *testing.T, payload interface{}) {
+				if got := payload.(*MemoryMessagePayload); got.Value != "blue" {
+					t.Errorf("value = %v, want blue", got.Value)
+				}
+			},
+		},
+		{
+			name: "tool call",
+			msg:  &Message{Type: MessageTypeToolResponse, Payload: map[string]interface{}{"tool_name": "double", "args": map[string]interface{}{"n": 21.0}}},
+			check: func(t *testing.T, payload interface{}) {
+				result := payload.(map[string]interface{})
+				if result["result"] != 42.0 || result["success"] != true {
+					t.Errorf("tool result = %v", result)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reply, err := router.Request(context.Background(), tt.msg)
+			if err != nil {
+				t.Fatalf("Request: %v", err)
+			}
+			if reply.Type != ReplyType(tt.msg.Type) {
+				t.Errorf("reply type = %s", reply.Type)
+			}
+			tt.check(t, reply.Payload)
+		})
+	}
+}
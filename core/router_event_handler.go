@@ -0,0 +1,208 @@
+package core
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// EventTypeMessageResult is emitted after an event has been routed through the MessageRouter
+const EventTypeMessageResult EventType = "message_result"
+
+// RouterEventHandler bridges the EventLoop into the MessageRouter. Each event is
+// converted into a Message, routed to the registered message handlers and the
+// outcome is published back to the loop as an EventTypeMessageResult event once
+// the final attempt has finished. Result and heartbeat events are accepted but not
+// routed, so they are recorded in the history without being reported as unhandled.
+// Cron events are only routed when a message handler serves system events.
+type RouterEventHandler struct {
+	router    *MessageRouter
+	eventLoop *EventLoop
+	logger    *logrus.Logger
+
+	messages sync.Map // *Event -> *Message of the latest attempt
+}
+
+// NewRouterEventHandler creates a new router-dispatching event handler
+func NewRouterEventHandler(router *MessageRouter, eventLoop *EventLoop, logger *logrus.Logger) *RouterEventHandler {
+	if logger == nil {
+		logger = logrus.New()
+	}
+	return &RouterEventHandler{
+		router:    router,
+		eventLoop: eventLoop,
+		logger:    logger,
+	}
+}
+
+// Handle converts the event into a message and routes it
+func (h *RouterEventHandler) Handle(ctx context.Context, event *Event) error {
+	if !h.routes(event.Type) {
+		return nil
+	}
+
+	msg := EventToMessage(event)
+	h.messages.Store(event, msg)
+
+	return h.router.Route(ctx, msg)
+}
+
+// CanHandle checks if this handler can handle the event type
+func (h *RouterEventHandler) CanHandle(eventType EventType) bool {
+	if eventType == EventTypeCron {
+		return h.routes(eventType)
+	}
+	return true
+}
+
+// routes reports whether events of the type are converted into messages and routed
+func (h *RouterEventHandler) routes(eventType EventType) bool {
+	switch eventType {
+	case EventTypeMessageResult:
+		// Result events are produced by this handler, routing them again would loop forever
+		return false
+	case EventTypeHeartbeat:
+		// Heartbeats only probe the loop's latency, the heartbeat watchdog observes them
+		return false
+	case EventTypeCron:
+		// Without a handler asking for cron runs they would only reach catch-all handlers
+		return len(h.router.GetHandlers(MessageTypeForEvent(eventType))) > 0
+	default:
+		return true
+	}
+}
+
+// RetryPolicy runs each event through the router once. A failing message handler
+// would otherwise re-run every handler of the route, including those that already
+// succeeded and are not idempotent.
+func (h *RouterEventHandler) RetryPolicy() *RetryPolicy {
+	return &RetryPolicy{MaxAttempts: 1}
+}
+
+// HandlerTimeout bounds routing by the timeouts of the message handlers, which each
+// enforce their own limit; the event loop's handler timeout would cut long tool calls short
+func (h *RouterEventHandler) HandlerTimeout() time.Duration {
+	return h.router.RouteTimeout()
+}
+
+// EventCompleted publishes the routing outcome after the final attempt
+func (h *RouterEventHandler) EventCompleted(event *Event, err error) {
+	if !h.routes(event.Type) {
+		return
+	}
+
+	value, ok := h.messages.LoadAndDelete(event)
+	if !ok {
+		// The attempt timed out before it converted the event
+		value = EventToMessage(event)
+	}
+	h.publishResult(event, value.(*Message), err)
+}
+
+// publishResult emits the routing outcome as a follow-up event
+func (h *RouterEventHandler) publishResult(event *Event, msg *Message, routeErr error) {
+	if h.eventLoop == nil {
+		return
+	}
+
+	data := map[string]interface{}{
+		"message_id":   msg.ID,
+		"message_type": string(msg.Type),
+		"success":      routeErr == nil,
+	}
+	if routeErr != nil {
+		data["error"] = routeErr.Error()
+	}
+
+	result := &Event{
+		ID:        GenerateMessageID(),
+		Type:      EventTypeMessageResult,
+		Timestamp: time.Now(),
+		Data:      data,
+		Metadata: map[string]interface{}{
+			"source_event_id": event.ID,
+		},
+
+		CorrelationID: msg.CorrelationID,
+		CausationID:   msg.ID,
+	}
+
+	if err := h.eventLoop.Emit(result); err != nil {
+		h.logger.WithError(err).WithField("event_id", event.ID).
+			Warn("Failed to publish message result event")
+	}
+}
+
+// EventToMessage converts an event into a message for the MessageRouter.
+// Events whose data already is a Message are passed through unchanged.
+func EventToMessage(event *Event) *Message {
+	switch data := event.Data.(type) {
+	case *Message:
+		linkMessage(data, event)
+		return data
+	case Message:
+		linkMessage(&data, event)
+		return &data
+	}
+
+	metadata := make(map[string]interface{}, len(event.Metadata)+1)
+	for k, v := range event.Metadata {
+		metadata[k] = v
+	}
+	metadata["event_id"] = event.ID
+
+	msgType := MessageTypeForEvent(event.Type)
+	if override, ok := event.Metadata["message_type"].(string); ok && override != "" {
+		msgType = MessageType(override)
+	}
+
+	source, _ := event.Metadata["source"].(string)
+	if source == "" {
+		source = "event_loop"
+	}
+	target, _ := event.Metadata["target"].(string)
+
+	timestamp := event.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	return &Message{
+		ID:        GenerateMessageID(),
+		Type:      msgType,
+		Source:    source,
+		Target:    target,
+		Payload:   event.Data,
+		Timestamp: timestamp,
+		Metadata:  metadata,
+
+		CorrelationID: event.CorrelationID,
+		CausationID:   event.ID,
+	}
+}
+
+// linkMessage links a message carried by an event back to that event
+func linkMessage(msg *Message, event *Event) {
+	if msg.CorrelationID == "" {
+		msg.CorrelationID = event.CorrelationID
+	}
+	if msg.CausationID == "" {
+		msg.CausationID = event.ID
+	}
+}
+
+// MessageTypeForEvent maps an event type to the message type it is routed as
+func MessageTypeForEvent(eventType EventType) MessageType {
+	switch eventType {
+	case EventTypeMessage:
+		return MessageTypeUserInput
+	case EventTypeToolCall:
+		return MessageTypeToolResponse
+	case EventTypeSystem, EventTypeHeartbeat, EventTypeCron:
+		return MessageTypeSystemEvent
+	default:
+		return MessageTypeExternalEvent
+	}
+}
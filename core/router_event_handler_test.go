@@ -0,0 +1,253 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestMessageTypeForEvent(t *testing.T) {
+	tests := []struct {
+		eventType EventType
+		want      MessageType
+	}{
+		{EventTypeMessage, MessageTypeUserInput},
+		{EventTypeToolCall, MessageTypeToolResponse},
+		{EventTypeSystem, MessageTypeSystemEvent},
+		{EventTypeHeartbeat, MessageTypeSystemEvent},
+		{EventTypeCron, MessageTypeSystemEvent},
+		{EventType("webhook"), MessageTypeExternalEvent},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.eventType), func(t *testing.T) {
+			if got := MessageTypeForEvent(tt.eventType); got != tt.want {
+				t.Errorf("MessageTypeForEvent(%s) = %s, want %s", tt.eventType, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventToMessage(t *testing.T) {
+	carried := &Message{ID: "msg-1", Type: MessageTypeAgentMessage}
+
+	tests := []struct {
+		name        string
+		event       *Event
+		wantID      string
+		wantType    MessageType
+		wantSource  string
+		wantTarget  string
+		wantCause   string
+		wantCorrel  string
+		wantEventID bool
+	}{
+		{
+			name:        "plain data",
+			event:       &Event{ID: "ev-1", Type: EventTypeMessage, Data: "hi", CorrelationID: "req-1"},
+			wantType:    MessageTypeUserInput,
+			wantSource:  "event_loop",
+			wantCause:   "ev-1",
+			wantCorrel:  "req-1",
+			wantEventID: true,
+		},
+		{
+			name: "metadata overrides",
+			event: &Event{ID: "ev-2", Type: EventTypeSystem, Metadata: map[string]interface{}{
+				"message_type": "memory_store",
+				"source":       "api",
+				"target":       "memory",
+			}},
+			wantType:    MessageTypeMemoryStore,
+			wantSource:  "api",
+			wantTarget:  "memory",
+			wantCause:   "ev-2",
+			wantEventID: true,
+		},
+		{
+			name:       "message passed through",
+			event:      &Event{ID: "ev-3", Type: EventTypeMessage, Data: carried, CorrelationID: "req-3"},
+			wantID:     "msg-1",
+			wantType:   MessageTypeAgentMessage,
+			wantCause:  "ev-3",
+			wantCorrel: "req-3",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := EventToMessage(tt.event)
+			if tt.wantID != "" && msg.ID != tt.wantID {
+				t.Errorf("ID = %s, want %s", msg.ID, tt.wantID)
+			}
+			if msg.ID == "" {
+				t.Error("message has no ID")
+			}
+			if msg.Type != tt.wantType {
+				t.Errorf("Type = %s, want %s", msg.Type, tt.wantType)
+			}
+			if msg.Source != tt.wantSource {
+				t.Errorf("Source = %q, want %q", msg.Source, tt.wantSource)
+			}
+			if msg.Target != tt.wantTarget {
+				t.Errorf("Target = %q, want %q", msg.Target, tt.wantTarget)
+			}
+			if msg.CausationID != tt.wantCause {
+				t.Errorf("CausationID = %q, want %q", msg.CausationID, tt.wantCause)
+			}
+			if msg.CorrelationID != tt.wantCorrel {
+				t.Errorf("CorrelationID = %q, want %q", msg.CorrelationID, tt.wantCorrel)
+			}
+			if got, _ := msg.Metadata["event_id"].(string); tt.wantEventID && got != tt.event.ID {
+				t.Errorf("metadata event_id = %q, want %q", got, tt.event.ID)
+			}
+		})
+	}
+}
+
+func TestRouterEventHandlerPublishesOneResult(t *testing.T) {
+	tests := []struct {
+		name        string
+		handlerErr  error
+		wantSuccess bool
+	}{
+		{name: "success", wantSuccess: true},
+		{name: "failure", handlerErr: errors.New("boom"), wantSuccess: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, hook := logtest.NewNullLogger()
+			el := startTestLoop(t, logger, &EventLoopConfig{
+				Retry: &RetryPolicy{MaxAttempts: 3},
+			})
+
+			var calls atomic.Int32
+			router := NewMessageRouter()
+			router.RegisterHandler(&funcMessageHandler{handle: func(ctx context.Context, msg *Message) error {
+				calls.Add(1)
+				return tt.handlerErr
+			}})
+			el.RegisterHandler(NewRouterEventHandler(router, el, logger))
+
+			records, unsubscribe := el.SubscribeProcessed(nil, SubscribeOptions{})
+			defer unsubscribe()
+
+			event := &Event{Type: EventTypeMessage, Data: "hello"}
+			if err := el.Emit(event); err != nil {
+				t.Fatalf("Emit: %v", err)
+			}
+
+			var results []*EventRecord
+			timeout := time.After(2 * time.Second)
+			for len(results) == 0 {
+				select {
+				case record := <-records:
+					if record.Event.Type == EventTypeMessageResult {
+						results = append(results, record)
+					}
+				case <-timeout:
+					t.Fatal("no message_result event")
+				}
+			}
+			// Give a duplicate result the chance to show up
+			select {
+			case record := <-records:
+				if record.Event.Type == EventTypeMessageResult {
+					t.Fatalf("second message_result for one event: %+v", record.Event.Data)
+				}
+			case <-time.After(100 * time.Millisecond):
+			}
+
+			if got := calls.Load(); got != 1 {
+				t.Errorf("message handler ran %d times, want 1", got)
+			}
+			result := results[0]
+			if !result.Handled {
+				t.Error("message_result event was not handled")
+			}
+			data := result.Event.Data.(map[string]interface{})
+			if data["success"] != tt.wantSuccess {
+				t.Errorf("success = %v, want %v", data["success"], tt.wantSuccess)
+			}
+			if got := result.Event.Metadata["source_event_id"]; got != event.ID {
+				t.Errorf("source_event_id = %v, want %s", got, event.ID)
+			}
+			for _, entry := range hook.AllEntries() {
+				if entry.Level == logrus.WarnLevel && entry.Message == "No handler found for event" {
+					t.Errorf("unexpected warning for %v", entry.Data["event_type"])
+				}
+			}
+		})
+	}
+}
+
+func TestRouterEventHandlerBridgedEventTypes(t *testing.T) {
+	tests := []struct {
+		name          string
+		eventType     EventType
+		systemHandler bool // register a handler for system events next to the demo handlers
+		wantCanHandle bool
+		wantRouted    bool
+	}{
+		{name: "heartbeat is not routed", eventType: EventTypeHeartbeat, systemHandler: true, wantCanHandle: true},
+		{name: "cron without a system handler", eventType: EventTypeCron},
+		{name: "cron with a system handler", eventType: EventTypeCron, systemHandler: true, wantCanHandle: true, wantRouted: true},
+		{name: "system event", eventType: EventTypeSystem, systemHandler: true, wantCanHandle: true, wantRouted: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			el := startTestLoop(t, nil, nil)
+			router := NewMessageRouter()
+			// The demo handlers only take conversational messages
+			router.RegisterHandler(&EchoHandler{})
+			router.RegisterHandler(&TestHandler{})
+			var routed atomic.Int32
+			if tt.systemHandler {
+				router.RegisterHandler(&funcMessageHandler{types: []MessageType{MessageTypeSystemEvent}, handle: func(ctx context.Context, msg *Message) error {
+					routed.Add(1)
+					return nil
+				}})
+			}
+			handler := NewRouterEventHandler(router, el, testLogger())
+			if got := handler.CanHandle(tt.eventType); got != tt.wantCanHandle {
+				t.Fatalf("CanHandle(%s) = %v, want %v", tt.eventType, got, tt.wantCanHandle)
+			}
+			el.RegisterHandler(handler)
+
+			records, unsubscribe := el.SubscribeProcessed(nil, SubscribeOptions{})
+			defer unsubscribe()
+			if err := el.Emit(&Event{Type: tt.eventType}); err != nil {
+				t.Fatalf("Emit: %v", err)
+			}
+
+			var results int
+			timeout := time.After(300 * time.Millisecond)
+		collect:
+			for {
+				select {
+				case record := <-records:
+					if record.Event.Type == EventTypeMessageResult {
+						results++
+					} else if record.Handled != tt.wantCanHandle {
+						t.Errorf("handled = %v, want %v", record.Handled, tt.wantCanHandle)
+					}
+				case <-timeout:
+					break collect
+				}
+			}
+			wantCount := 0
+			if tt.wantRouted {
+				wantCount = 1
+			}
+			if got := int(routed.Load()); got != wantCount {
+				t.Errorf("routed %d times, want %d", got, wantCount)
+			}
+			if results != wantCount {
+				t.Errorf("%d message_result events, want %d", results, wantCount)
+			}
+		})
+	}
+}
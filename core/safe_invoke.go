@@ -0,0 +1,120 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultHandlerTimeout 处理器单次执行的默认超时时间
+const DefaultHandlerTimeout = 30 * time.Second
+
+// HandlerTimeoutProvider 可由EventHandler或MessageHandler实现，为该处理器指定独立的超时时间
+type HandlerTimeoutProvider interface {
+	HandlerTimeout() time.Duration
+}
+
+// abandonedInvocations 超时或取消后仍在后台运行的处理器数量
+var abandonedInvocations atomic.Int64
+
+// AbandonedInvocations 返回超时或取消后仍在后台运行的处理器、工具数量。
+// 该值持续增长说明有处理器没有响应ctx的取消。
+func AbandonedInvocations() int64 {
+	return abandonedInvocations.Load()
+}
+
+// invocation 的状态，用于在超时与处理器返回之间只选出一方
+const (
+	invocationRunning int32 = iota
+	invocationFinished
+	invocationAbandoned
+)
+
+// HandlerPanicError 处理器panic时返回的错误，包含panic值和调用栈
+type HandlerPanicError struct {
+	Handler string
+	Value   interface{}
+	Stack   string
+}
+
+func (e *HandlerPanicError) Error() string {
+	return fmt.Sprintf("handler %s panicked: %v", e.Handler, e.Value)
+}
+
+// HandlerTimeoutError 处理器执行超时时返回的错误
+type HandlerTimeoutError struct {
+	Handler string
+	Timeout time.Duration
+}
+
+func (e *HandlerTimeoutError) Error() string {
+	return fmt.Sprintf("handler %s timed out after %s", e.Handler, e.Timeout)
+}
+
+// Unwrap 使errors.Is(err, ErrHandlerTimeout)成立
+func (e *HandlerTimeoutError) Unwrap() error {
+	return ErrHandlerTimeout
+}
+
+// handlerTimeout 返回处理器的超时时间，处理器未指定时使用fallback
+func handlerTimeout(handler interface{}, fallback time.Duration) time.Duration {
+	if provider, ok := handler.(HandlerTimeoutProvider); ok {
+		if timeout := provider.HandlerTimeout(); timeout > 0 {
+			return timeout
+		}
+	}
+	return fallback
+}
+
+// invokeSafely 在独立的goroutine中执行处理器，捕获panic并施加超时。
+// 超时后立即返回，处理器必须在ctx结束后尽快返回；忽略ctx的处理器会在后台继续运行直到结束，
+// 期间计入AbandonedInvocations。因此超时默认不重试，避免新的尝试与仍在运行的尝试并发。
+func invokeSafely(ctx context.Context, name string, timeout time.Duration, fn func(ctx context.Context) error) error {
+	parent := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var state atomic.Int32
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- &HandlerPanicError{
+					Handler: name,
+					Value:   r,
+					Stack:   string(debug.Stack()),
+				}
+			}
+			if !state.CompareAndSwap(invocationRunning, invocationFinished) {
+				abandonedInvocations.Add(-1)
+			}
+		}()
+		done <- fn(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		if state.CompareAndSwap(invocationRunning, invocationAbandoned) {
+			abandonedInvocations.Add(1)
+			err = ctx.Err()
+		} else {
+			// 处理器恰好已经返回
+			err = <-done
+		}
+	}
+
+	// 响应ctx、在超时后返回ctx错误的处理器同样报告为超时，以免被当作普通错误重试；
+	// 调用方自己的截止时间到期不属于处理器超时，原样返回
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == context.DeadlineExceeded && parent.Err() == nil {
+		return &HandlerTimeoutError{Handler: name, Timeout: timeout}
+	}
+	return err
+}
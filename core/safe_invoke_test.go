@@ -0,0 +1,250 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInvokeSafely(t *testing.T) {
+	boom := errors.New("boom")
+
+	tests := []struct {
+		name    string
+		ctx     func() (context.Context, context.CancelFunc)
+		timeout time.Duration
+		fn      func(ctx context.Context) error
+		check   func(t *testing.T, err error)
+	}{
+		{
+			name: "success",
+			fn:   func(ctx context.Context) error { return nil },
+			check: func(t *testing.T, err error) {
+				if err != nil {
+					t.Errorf("err = %v, want nil", err)
+				}
+			},
+		},
+		{
+			name: "error is returned unchanged",
+			fn:   func(ctx context.Context) error { return boom },
+			check: func(t *testing.T, err error) {
+				if err != boom {
+					t.Errorf("err = %v, want %v", err, boom)
+				}
+			},
+		},
+		{
+			name: "panic is recovered with its stack",
+			fn:   func(ctx context.Context) error { panic("kaboom") },
+			check: func(t *testing.T, err error) {
+				var panicErr *HandlerPanicError
+				if !errors.As(err, &panicErr) {
+					t.Fatalf("err = %v, want a HandlerPanicError", err)
+				}
+				if panicErr.Handler != "test" || panicErr.Value != "kaboom" {
+					t.Errorf("panic error = %+v", panicErr)
+				}
+				if !strings.Contains(panicErr.Stack, "safe_invoke_test.go") {
+					t.Errorf("stack does not point at the panicking function:\n%s", panicErr.Stack)
+				}
+			},
+		},
+		{
+			name:    "timeout",
+			timeout: 10 * time.Millisecond,
+			fn: func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+			check: func(t *testing.T, err error) {
+				var timeoutErr *HandlerTimeoutError
+				if !errors.As(err, &timeoutErr) || !errors.Is(err, ErrHandlerTimeout) {
+					t.Fatalf("err = %v, want a HandlerTimeoutError", err)
+				}
+				if timeoutErr.Handler != "test" || timeoutErr.Timeout != 10*time.Millisecond {
+					t.Errorf("timeout error = %+v", timeoutErr)
+				}
+			},
+		},
+		{
+			name: "parent cancelled",
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				time.AfterFunc(10*time.Millisecond, cancel)
+				return ctx, cancel
+			},
+			timeout: time.Minute,
+			fn: func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+			check: func(t *testing.T, err error) {
+				if !errors.Is(err, context.Canceled) || errors.Is(err, ErrHandlerTimeout) {
+					t.Errorf("err = %v, want context.Canceled", err)
+				}
+			},
+		},
+		{
+			name: "parent deadline is not the handler's timeout",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 10*time.Millisecond)
+			},
+			timeout: time.Minute,
+			fn: func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+			check: func(t *testing.T, err error) {
+				if !errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrHandlerTimeout) {
+					t.Errorf("err = %v, want the parent's context.DeadlineExceeded", err)
+				}
+			},
+		},
+		{
+			name: "timeout derived from the parent deadline",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 10*time.Millisecond)
+			},
+			fn: func(ctx context.Context) error {
+				if _, ok := ctx.Deadline(); !ok {
+					return errors.New("no deadline")
+				}
+				return nil
+			},
+			check: func(t *testing.T, err error) {
+				if err != nil {
+					t.Errorf("err = %v, want nil", err)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.Background(), context.CancelFunc(func() {})
+			if tt.ctx != nil {
+				ctx, cancel = tt.ctx()
+			}
+			defer cancel()
+			before := AbandonedInvocations()
+			tt.check(t, invokeSafely(ctx, "test", tt.timeout, tt.fn))
+			// Abandoned handlers return right after ctx; let them finish so later tests see a settled gauge
+			waitFor(t, time.Second, "abandoned handlers to finish", func() bool { return AbandonedInvocations() == before })
+		})
+	}
+}
+
+func TestInvokeSafelyAbandonedGauge(t *testing.T) {
+	before := AbandonedInvocations()
+	release := make(chan struct{})
+	finished := make(chan struct{})
+
+	err := invokeSafely(context.Background(), "stubborn", 10*time.Millisecond, func(ctx context.Context) error {
+		defer close(finished)
+		<-release // ignores ctx
+		return nil
+	})
+	if !errors.Is(err, ErrHandlerTimeout) {
+		t.Fatalf("err = %v, want a timeout", err)
+	}
+	if got := AbandonedInvocations() - before; got != 1 {
+		t.Errorf("AbandonedInvocations grew by %d while the handler ran on, want 1", got)
+	}
+
+	close(release)
+	<-finished
+	waitFor(t, time.Second, "abandoned gauge to drop", func() bool { return AbandonedInvocations() == before })
+}
+
+func TestHandlerTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler interface{}
+		want    time.Duration
+	}{
+		{name: "fallback", handler: &funcEventHandler{}, want: time.Second},
+		{name: "provider", handler: &slowEventHandler{timeout: 5 * time.Second}, want: 5 * time.Second},
+		{name: "provider without timeout", handler: &slowEventHandler{}, want: time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := handlerTimeout(tt.handler, time.Second); got != tt.want {
+				t.Errorf("handlerTimeout = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventLoopSurvivesPanickingHandler(t *testing.T) {
+	el := startTestLoop(t, nil, &EventLoopConfig{Retry: &RetryPolicy{MaxAttempts: 1}})
+	history, _ := NewEventHistory(testLogger(), nil)
+	el.SetHistory(history)
+
+	el.RegisterHandler(&funcEventHandler{types: []EventType{EventTypeSystem}, handle: func(ctx context.Context, event *Event) error {
+		panic("plugin bug")
+	}})
+	el.RegisterHandler(&funcEventHandler{types: []EventType{EventTypeSystem, EventTypeMessage}})
+
+	el.Emit(&Event{Type: EventTypeSystem})
+	el.Emit(&Event{Type: EventTypeMessage})
+	waitFor(t, 2*time.Second, "both events", func() bool { return history.Len() == 2 })
+
+	page, _ := history.Query(EventHistoryQuery{Types: []EventType{EventTypeSystem}})
+	handlers := page.Events[0].Handlers
+	if len(handlers) != 2 {
+		t.Fatalf("%d handler records, want 2", len(handlers))
+	}
+	if handlers[0].Stack == "" || !strings.Contains(handlers[0].Error, "plugin bug") {
+		t.Errorf("panicking handler record = %+v", handlers[0])
+	}
+	if handlers[1].Error != "" {
+		t.Errorf("second handler failed: %s", handlers[1].Error)
+	}
+}
+
+func TestRouterIsolatesFailingHandlers(t *testing.T) {
+	tests := []struct {
+		name      string
+		handle    func(ctx context.Context, msg *Message) error
+		timeout   time.Duration
+		wantPanic bool
+		wantTime  bool
+	}{
+		{name: "panic", handle: func(ctx context.Context, msg *Message) error { panic("plugin bug") }, wantPanic: true},
+		{
+			name: "timeout",
+			handle: func(ctx context.Context, msg *Message) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+			timeout:  10 * time.Millisecond,
+			wantTime: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := NewMessageRouter()
+			router.SetHandlerTimeout(tt.timeout)
+			ran := false
+			router.RegisterHandler(&funcMessageHandler{priority: 10, handle: tt.handle})
+			router.RegisterHandler(&funcMessageHandler{priority: 1, handle: func(ctx context.Context, msg *Message) error {
+				ran = true
+				return nil
+			}})
+
+			err := router.Route(context.Background(), &Message{ID: "m1", Type: MessageTypeUserInput})
+			var panicErr *HandlerPanicError
+			if got := errors.As(err, &panicErr); got != tt.wantPanic {
+				t.Errorf("panic error = %v, want %v (err %v)", got, tt.wantPanic, err)
+			}
+			if got := errors.Is(err, ErrHandlerTimeout); got != tt.wantTime {
+				t.Errorf("timeout error = %v, want %v (err %v)", got, tt.wantTime, err)
+			}
+			if !ran {
+				t.Error("the lower priority handler did not run")
+			}
+		})
+	}
+}
@@ -0,0 +1,458 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/sirupsen/logrus"
+)
+
+// CatchUpPolicy decides what happens to runs missed while the agent was down
+type CatchUpPolicy string
+
+const (
+	// CatchUpSkip drops missed runs and waits for the next occurrence
+	CatchUpSkip CatchUpPolicy = "skip"
+	// CatchUpOnce emits a single event if at least one run was missed
+	CatchUpOnce CatchUpPolicy = "once"
+	// CatchUpAll emits one event per missed run, up to maxCatchUpRuns
+	CatchUpAll CatchUpPolicy = "all"
+)
+
+// Where a job was defined
+const (
+	// ScheduleSourceAPI marks jobs added at runtime, they are kept until removed
+	ScheduleSourceAPI = "api"
+	// ScheduleSourceConfig marks jobs defined in the config file, they are removed
+	// once they are no longer configured
+	ScheduleSourceConfig = "config"
+)
+
+// maxCatchUpRuns bounds the events emitted for a single job by CatchUpAll
+const maxCatchUpRuns = 100
+
+// cronParser accepts standard 5-field, 6-field (with seconds) and descriptor (@every, @daily, ...) specs
+var cronParser = cron.NewParser(
+	cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
+)
+
+// ScheduleJob is a recurring job that emits EventTypeCron events
+type ScheduleJob struct {
+	ID        string                 `json:"id"`
+	Name      string                 `json:"name"`
+	Spec      string                 `json:"spec"`
+	Payload   interface{}            `json:"payload,omitempty"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	CatchUp   CatchUpPolicy          `json:"catch_up,omitempty"`
+	Source    string                 `json:"source,omitempty"` // ScheduleSourceAPI or ScheduleSourceConfig, empty means api
+	CreatedAt time.Time              `json:"created_at"`
+	LastRun   time.Time              `json:"last_run,omitempty"`
+	NextRun   time.Time              `json:"next_run,omitempty"`
+}
+
+// SchedulerConfig holds scheduler configuration
+type SchedulerConfig struct {
+	File string `yaml:"file"` // optional JSON file for job definitions, empty keeps jobs in memory only
+}
+
+type scheduledJob struct {
+	job      *ScheduleJob
+	schedule cron.Schedule
+}
+
+// Scheduler emits cron events for registered jobs
+type Scheduler struct {
+	jobs      map[string]*scheduledJob
+	mutex     sync.RWMutex
+	eventLoop *EventLoop
+	logger    *logrus.Logger
+	config    *SchedulerConfig
+	wake      chan struct{}
+	now       func() time.Time
+}
+
+// ParseCatchUpPolicy validates a catch-up policy, empty means skip
+func ParseCatchUpPolicy(s string) (CatchUpPolicy, error) {
+	switch policy := CatchUpPolicy(s); policy {
+	case "":
+		return CatchUpSkip, nil
+	case CatchUpSkip, CatchUpOnce, CatchUpAll:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown catch-up policy: %s", s)
+	}
+}
+
+// NewScheduler creates a new scheduler, loading persisted jobs if configured
+func NewScheduler(logger *logrus.Logger, eventLoop *EventLoop, config *SchedulerConfig) (*Scheduler, error) {
+	if logger == nil {
+		logger = logrus.New()
+	}
+	if config == nil {
+		config = &SchedulerConfig{}
+	}
+
+	s := &Scheduler{
+		jobs:      make(map[string]*scheduledJob),
+		eventLoop: eventLoop,
+		logger:    logger,
+		config:    config,
+		wake:      make(chan struct{}, 1),
+		now:       time.Now,
+	}
+
+	if config.File != "" {
+		if err := s.load(); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// AddJob validates and registers a job. A job with the same ID is replaced,
+// keeping its last run so missed runs are still detected.
+func (s *Scheduler) AddJob(job *ScheduleJob) (*ScheduleJob, error) {
+	schedule, err := cronParser.Parse(job.Spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: %w", job.Spec, err)
+	}
+	policy, err := ParseCatchUpPolicy(string(job.CatchUp))
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+	if job.ID == "" {
+		job.ID = GenerateMessageID()
+	}
+	if job.Name == "" {
+		job.Name = job.ID
+	}
+	job.CatchUp = policy
+	if existing, ok := s.jobs[job.ID]; ok {
+		if job.CreatedAt.IsZero() {
+			job.CreatedAt = existing.job.CreatedAt
+		}
+		if job.LastRun.IsZero() {
+			job.LastRun = existing.job.LastRun
+		}
+	}
+	if job.CreatedAt.IsZero() {
+		job.CreatedAt = now
+	}
+	job.NextRun = schedule.Next(now)
+
+	s.jobs[job.ID] = &scheduledJob{job: job, schedule: schedule}
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+
+	s.notify()
+	s.logger.WithField("job_id", job.ID).WithField("spec", job.Spec).Info("Scheduled job")
+	copied := *job
+	return &copied, nil
+}
+
+// SetConfigJobs registers the jobs defined in the config file and removes jobs
+// that were loaded from an earlier config but are no longer configured
+func (s *Scheduler) SetConfigJobs(jobs []*ScheduleJob) error {
+	configured := make(map[string]bool, len(jobs))
+	for _, job := range jobs {
+		job.Source = ScheduleSourceConfig
+		added, err := s.AddJob(job)
+		if err != nil {
+			return fmt.Errorf("scheduler job %s: %w", job.Name, err)
+		}
+		configured[added.ID] = true
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	removed := 0
+	for id, sj := range s.jobs {
+		if sj.job.Source == ScheduleSourceConfig && !configured[id] {
+			delete(s.jobs, id)
+			removed++
+			s.logger.WithField("job_id", id).Info("Removed job that is no longer configured")
+		}
+	}
+	if removed == 0 {
+		return nil
+	}
+	s.notify()
+	return s.save()
+}
+
+// RemoveJob deletes a job
+func (s *Scheduler) RemoveJob(id string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.jobs[id]; !ok {
+		return false, nil
+	}
+	delete(s.jobs, id)
+	s.notify()
+	return true, s.save()
+}
+
+// GetJob returns a copy of a single job
+func (s *Scheduler) GetJob(id string) (*ScheduleJob, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	sj, ok := s.jobs[id]
+	if !ok {
+		return nil, false
+	}
+	job := *sj.job
+	return &job, true
+}
+
+// ListJobs returns copies of all jobs ordered by next run
+func (s *Scheduler) ListJobs() []*ScheduleJob {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	jobs := make([]*ScheduleJob, 0, len(s.jobs))
+	for _, sj := range s.jobs {
+		job := *sj.job
+		jobs = append(jobs, &job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].NextRun.Before(jobs[j].NextRun)
+	})
+	return jobs
+}
+
+// Start runs missed jobs according to their catch-up policy, then fires jobs until ctx is done
+func (s *Scheduler) Start(ctx context.Context) {
+	s.catchUp()
+
+	for {
+		timer := time.NewTimer(s.untilNextRun())
+		select {
+		case <-timer.C:
+			s.runDue()
+		case <-s.wake:
+			timer.Stop()
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// untilNextRun returns how long to sleep before the earliest job is due
+func (s *Scheduler) untilNextRun() time.Duration {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	// Wake up periodically even without jobs so clock changes are noticed
+	wait := time.Minute
+	now := s.now()
+	for _, sj := range s.jobs {
+		if d := sj.job.NextRun.Sub(now); d < wait {
+			wait = d
+		}
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return wait
+}
+
+// runDue emits events for every job whose next run has passed
+func (s *Scheduler) runDue() {
+	s.mutex.Lock()
+	now := s.now()
+	var due []*ScheduleJob
+	for _, sj := range s.jobs {
+		if sj.job.NextRun.IsZero() || sj.job.NextRun.After(now) {
+			continue
+		}
+		scheduledAt := sj.job.NextRun
+		sj.job.LastRun = scheduledAt
+		sj.job.NextRun = sj.schedule.Next(now)
+
+		job := *sj.job
+		job.LastRun = scheduledAt
+		due = append(due, &job)
+	}
+	if len(due) > 0 {
+		if err := s.save(); err != nil {
+			s.logger.WithError(err).Warn("Failed to persist schedules")
+		}
+	}
+	s.mutex.Unlock()
+
+	for _, job := range due {
+		s.emit(job, job.LastRun, false)
+	}
+}
+
+// catchUp emits events for runs missed since each job's last run, or since its
+// creation when it never ran
+func (s *Scheduler) catchUp() {
+	s.mutex.Lock()
+	now := s.now()
+	type missedRun struct {
+		job *ScheduleJob
+		at  time.Time
+	}
+	var missed []missedRun
+	for _, sj := range s.jobs {
+		job := sj.job
+		// Jobs that never ran have missed every run since they were created
+		since := job.LastRun
+		if since.IsZero() {
+			since = job.CreatedAt
+		}
+		if since.IsZero() {
+			job.NextRun = sj.schedule.Next(now)
+			continue
+		}
+
+		var runs []time.Time
+		for t := sj.schedule.Next(since); !t.After(now) && len(runs) < maxCatchUpRuns; t = sj.schedule.Next(t) {
+			runs = append(runs, t)
+		}
+		job.NextRun = sj.schedule.Next(now)
+		if len(runs) == 0 {
+			continue
+		}
+
+		switch job.CatchUp {
+		case CatchUpOnce:
+			runs = runs[len(runs)-1:]
+		case CatchUpAll:
+		default:
+			s.logger.WithField("job_id", job.ID).Infof("Skipping %d missed runs", len(runs))
+			continue
+		}
+
+		job.LastRun = runs[len(runs)-1]
+		copied := *job
+		for _, at := range runs {
+			missed = append(missed, missedRun{job: &copied, at: at})
+		}
+	}
+	if err := s.save(); err != nil {
+		s.logger.WithError(err).Warn("Failed to persist schedules")
+	}
+	s.mutex.Unlock()
+
+	for _, run := range missed {
+		s.emit(run.job, run.at, true)
+	}
+}
+
+// emit sends a cron event for a job run
+func (s *Scheduler) emit(job *ScheduleJob, scheduledAt time.Time, catchUp bool) {
+	metadata := make(map[string]interface{}, len(job.Metadata)+4)
+	for k, v := range job.Metadata {
+		metadata[k] = v
+	}
+	metadata["job_id"] = job.ID
+	metadata["job_name"] = job.Name
+	metadata["scheduled_at"] = scheduledAt
+	if catchUp {
+		metadata["catch_up"] = true
+	}
+
+	event := &Event{
+		ID:        GenerateMessageID(),
+		Type:      EventTypeCron,
+		Timestamp: s.now(),
+		Data:      job.Payload,
+		Metadata:  metadata,
+	}
+
+	if err := s.eventLoop.Emit(event); err != nil {
+		s.logger.WithError(err).WithField("job_id", job.ID).Error("Failed to emit cron event")
+	}
+}
+
+// notify wakes the scheduler loop after the job set changed
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// save writes job definitions to file; callers must hold s.mutex
+func (s *Scheduler) save() error {
+	if s.config.File == "" {
+		return nil
+	}
+
+	dir := filepath.Dir(s.config.File)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	jobs := make(map[string]*ScheduleJob, len(s.jobs))
+	for id, sj := range s.jobs {
+		jobs[id] = sj.job
+	}
+
+	data, err := json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal schedules: %w", err)
+	}
+
+	tmp := s.config.File + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write schedules file: %w", err)
+	}
+	if err := os.Rename(tmp, s.config.File); err != nil {
+		return fmt.Errorf("failed to replace schedules file: %w", err)
+	}
+	return nil
+}
+
+// load reads job definitions from file
+func (s *Scheduler) load() error {
+	data, err := os.ReadFile(s.config.File)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// File doesn't exist, that's okay
+			return nil
+		}
+		return fmt.Errorf("failed to read schedules file: %w", err)
+	}
+
+	if len(data) == 0 {
+		return nil
+	}
+
+	var jobs map[string]*ScheduleJob
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return fmt.Errorf("failed to unmarshal schedules: %w", err)
+	}
+
+	for id, job := range jobs {
+		schedule, err := cronParser.Parse(job.Spec)
+		if err != nil {
+			s.logger.WithError(err).WithField("job_id", id).Warn("Skipping job with invalid schedule")
+			continue
+		}
+		s.jobs[id] = &scheduledJob{job: job, schedule: schedule}
+	}
+
+	s.logger.Infof("Loaded %d scheduled jobs from %s", len(s.jobs), s.config.File)
+	return nil
+}
@@ -0,0 +1,451 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a settable time source for the scheduler
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+}
+
+// newTestScheduler creates a scheduler on a running event loop and returns the cron events it emits
+func newTestScheduler(t *testing.T, file string, clock *fakeClock) (*Scheduler, <-chan *Event) {
+	t.Helper()
+	el := startTestLoop(t, nil, nil)
+	events, unsubscribe := el.SubscribeWithOptions(EventTypeFilter(EventTypeCron), SubscribeOptions{Buffer: 2 * maxCatchUpRuns})
+	t.Cleanup(unsubscribe)
+
+	s, err := NewScheduler(testLogger(), el, &SchedulerConfig{File: file})
+	if err != nil {
+		t.Fatalf("NewScheduler: %v", err)
+	}
+	if clock != nil {
+		s.now = clock.Now
+	}
+	return s, events
+}
+
+// drainEvents returns the events already delivered to a subscription
+func drainEvents(events <-chan *Event) []*Event {
+	var drained []*Event
+	for {
+		select {
+		case event := <-events:
+			drained = append(drained, event)
+		default:
+			return drained
+		}
+	}
+}
+
+func TestParseCatchUpPolicy(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    CatchUpPolicy
+		wantErr bool
+	}{
+		{in: "", want: CatchUpSkip},
+		{in: "skip", want: CatchUpSkip},
+		{in: "once", want: CatchUpOnce},
+		{in: "all", want: CatchUpAll},
+		{in: "twice", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseCatchUpPolicy(tt.in)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ParseCatchUpPolicy(%q) = %q, %v", tt.in, got, err)
+			}
+		})
+	}
+}
+
+func TestSchedulerAddJob(t *testing.T) {
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		job      *ScheduleJob
+		wantNext time.Time
+		wantErr  string
+	}{
+		{name: "five fields", job: &ScheduleJob{Spec: "30 2 * * *"}, wantNext: time.Date(2024, 1, 2, 2, 30, 0, 0, time.UTC)},
+		{name: "six fields with seconds", job: &ScheduleJob{Spec: "15 * * * * *"}, wantNext: now.Add(15 * time.Second)},
+		{name: "every", job: &ScheduleJob{Spec: "@every 90s"}, wantNext: now.Add(90 * time.Second)},
+		{name: "descriptor", job: &ScheduleJob{Spec: "@daily"}, wantNext: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{name: "invalid spec", job: &ScheduleJob{Spec: "every day"}, wantErr: "invalid schedule"},
+		{name: "too many fields", job: &ScheduleJob{Spec: "* * * * * * *"}, wantErr: "invalid schedule"},
+		{name: "invalid catch-up", job: &ScheduleJob{Spec: "@hourly", CatchUp: "twice"}, wantErr: "unknown catch-up policy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestScheduler(t, "", &fakeClock{now: now})
+			job, err := s.AddJob(tt.job)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				if len(s.ListJobs()) != 0 {
+					t.Error("invalid job was registered")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("AddJob: %v", err)
+			}
+			if job.ID == "" || job.Name != job.ID || job.CatchUp != CatchUpSkip || !job.CreatedAt.Equal(now) {
+				t.Errorf("defaults not filled in: %+v", job)
+			}
+			if !job.NextRun.Equal(tt.wantNext) {
+				t.Errorf("NextRun = %s, want %s", job.NextRun, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestSchedulerReplaceKeepsHistory(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)}
+	s, _ := newTestScheduler(t, "", clock)
+
+	first, _ := s.AddJob(&ScheduleJob{ID: "job", Spec: "@hourly"})
+	clock.Set(clock.Now().Add(time.Hour))
+	s.runDue()
+	ran, _ := s.GetJob("job")
+
+	clock.Set(clock.Now().Add(time.Minute))
+	replaced, err := s.AddJob(&ScheduleJob{ID: "job", Spec: "@every 5m", Payload: "new"})
+	if err != nil {
+		t.Fatalf("AddJob: %v", err)
+	}
+	if !replaced.CreatedAt.Equal(first.CreatedAt) || !replaced.LastRun.Equal(ran.LastRun) {
+		t.Errorf("replacement lost history: created %s last run %s, want %s and %s",
+			replaced.CreatedAt, replaced.LastRun, first.CreatedAt, ran.LastRun)
+	}
+	if len(s.ListJobs()) != 1 {
+		t.Errorf("%d jobs, want the job replaced", len(s.ListJobs()))
+	}
+}
+
+func TestSchedulerRunDue(t *testing.T) {
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	clock := &fakeClock{now: start}
+	s, events := newTestScheduler(t, "", clock)
+
+	s.AddJob(&ScheduleJob{
+		ID:       "hourly",
+		Name:     "consolidate",
+		Spec:     "@hourly",
+		Payload:  map[string]interface{}{"task": "consolidate"},
+		Metadata: map[string]interface{}{"session_id": "maintenance"},
+	})
+	s.AddJob(&ScheduleJob{ID: "daily", Spec: "@daily"})
+
+	tests := []struct {
+		name     string
+		advance  time.Duration
+		wantJobs []string
+	}{
+		{name: "nothing due", advance: 30 * time.Minute},
+		{name: "hourly due", advance: 30 * time.Minute, wantJobs: []string{"hourly"}},
+		{name: "not due twice", advance: time.Second},
+		{name: "both due", advance: 14 * time.Hour, wantJobs: []string{"daily", "hourly"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock.Set(clock.Now().Add(tt.advance))
+			s.runDue()
+
+			emitted := drainEvents(events)
+			var jobs []string
+			for _, event := range emitted {
+				id := event.Metadata["job_id"].(string)
+				jobs = append(jobs, id)
+				if job, _ := s.GetJob(id); !job.LastRun.Equal(event.Metadata["scheduled_at"].(time.Time)) {
+					t.Errorf("job %s LastRun = %s, want the emitted run %v", id, job.LastRun, event.Metadata["scheduled_at"])
+				}
+			}
+			if len(jobs) == 2 && jobs[0] > jobs[1] {
+				jobs[0], jobs[1] = jobs[1], jobs[0]
+			}
+			if strings.Join(jobs, ",") != strings.Join(tt.wantJobs, ",") {
+				t.Fatalf("emitted %v, want %v", jobs, tt.wantJobs)
+			}
+			for _, job := range s.ListJobs() {
+				if !job.NextRun.After(clock.Now()) {
+					t.Errorf("job %s NextRun %s not after now %s", job.ID, job.NextRun, clock.Now())
+				}
+			}
+		})
+	}
+}
+
+func TestSchedulerEventContent(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)}
+	s, events := newTestScheduler(t, "", clock)
+	s.AddJob(&ScheduleJob{
+		ID:       "job",
+		Name:     "consolidate",
+		Spec:     "@hourly",
+		Payload:  map[string]interface{}{"task": "consolidate"},
+		Metadata: map[string]interface{}{"session_id": "maintenance"},
+	})
+
+	clock.Set(clock.Now().Add(time.Hour))
+	s.runDue()
+	emitted := drainEvents(events)
+	if len(emitted) != 1 {
+		t.Fatalf("%d events, want 1", len(emitted))
+	}
+	event := emitted[0]
+	if event.Type != EventTypeCron {
+		t.Errorf("Type = %s, want cron", event.Type)
+	}
+	if payload, _ := event.Data.(map[string]interface{}); payload["task"] != "consolidate" {
+		t.Errorf("Data = %v, want the job payload", event.Data)
+	}
+	want := map[string]interface{}{
+		"job_id":       "job",
+		"job_name":     "consolidate",
+		"session_id":   "maintenance",
+		"scheduled_at": time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC),
+	}
+	for k, v := range want {
+		if event.Metadata[k] != v {
+			t.Errorf("metadata %s = %v, want %v", k, event.Metadata[k], v)
+		}
+	}
+	if _, ok := event.Metadata["catch_up"]; ok {
+		t.Error("regular run marked as catch-up")
+	}
+}
+
+func TestSchedulerCatchUp(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	lastRun := created.Add(2 * time.Hour)
+	restart := created.Add(7*time.Hour + 30*time.Minute)
+
+	tests := []struct {
+		name      string
+		spec      string
+		policy    CatchUpPolicy
+		lastRun   time.Time
+		wantRuns  []time.Time
+		wantCount int // checked instead of wantRuns when set
+	}{
+		{name: "skip", spec: "@hourly", policy: CatchUpSkip, lastRun: lastRun},
+		{name: "once", spec: "@hourly", policy: CatchUpOnce, lastRun: lastRun, wantRuns: []time.Time{created.Add(7 * time.Hour)}},
+		{
+			name:    "all",
+			spec:    "@hourly",
+			policy:  CatchUpAll,
+			lastRun: lastRun,
+			wantRuns: []time.Time{
+				created.Add(3 * time.Hour), created.Add(4 * time.Hour), created.Add(5 * time.Hour),
+				created.Add(6 * time.Hour), created.Add(7 * time.Hour),
+			},
+		},
+		{
+			name:     "never ran counts from creation",
+			spec:     "0 */3 * * *",
+			policy:   CatchUpAll,
+			wantRuns: []time.Time{created.Add(3 * time.Hour), created.Add(6 * time.Hour)},
+		},
+		{name: "all is bounded", spec: "@every 1m", policy: CatchUpAll, lastRun: lastRun, wantCount: maxCatchUpRuns},
+		{name: "nothing missed", spec: "@daily", policy: CatchUpAll, lastRun: lastRun},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "schedules.json")
+
+			// Register the job before the downtime
+			before, _ := newTestScheduler(t, file, &fakeClock{now: created})
+			if _, err := before.AddJob(&ScheduleJob{ID: "job", Spec: tt.spec, CatchUp: tt.policy, LastRun: tt.lastRun}); err != nil {
+				t.Fatalf("AddJob: %v", err)
+			}
+
+			after, events := newTestScheduler(t, file, &fakeClock{now: restart})
+			after.catchUp()
+			emitted := drainEvents(events)
+
+			if tt.wantCount > 0 {
+				if len(emitted) != tt.wantCount {
+					t.Errorf("%d catch-up events, want %d", len(emitted), tt.wantCount)
+				}
+			} else {
+				if len(emitted) != len(tt.wantRuns) {
+					t.Fatalf("%d catch-up events, want %d", len(emitted), len(tt.wantRuns))
+				}
+				for i, event := range emitted {
+					if at := event.Metadata["scheduled_at"].(time.Time); !at.Equal(tt.wantRuns[i]) {
+						t.Errorf("run %d scheduled at %s, want %s", i, at, tt.wantRuns[i])
+					}
+					if event.Metadata["catch_up"] != true {
+						t.Errorf("run %d not marked as catch-up", i)
+					}
+				}
+			}
+
+			job, _ := after.GetJob("job")
+			if !job.NextRun.After(restart) {
+				t.Errorf("NextRun = %s, want after the restart", job.NextRun)
+			}
+			if len(emitted) > 0 {
+				last := emitted[len(emitted)-1].Metadata["scheduled_at"].(time.Time)
+				if !job.LastRun.Equal(last) {
+					t.Errorf("LastRun = %s, want the last caught up run %s", job.LastRun, last)
+				}
+			}
+
+			// Caught up runs are persisted and not repeated after another restart
+			if tt.wantCount == 0 {
+				again, events := newTestScheduler(t, file, &fakeClock{now: restart})
+				again.catchUp()
+				if n := len(drainEvents(events)); n != 0 {
+					t.Errorf("%d runs caught up twice", n)
+				}
+			}
+		})
+	}
+}
+
+func TestSchedulerPersistence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "data", "schedules.json")
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s, _ := newTestScheduler(t, file, clock)
+
+	s.AddJob(&ScheduleJob{ID: "keep", Spec: "@hourly", Payload: "p", CatchUp: CatchUpOnce})
+	s.AddJob(&ScheduleJob{ID: "drop", Spec: "@daily"})
+	if removed, err := s.RemoveJob("drop"); err != nil || !removed {
+		t.Fatalf("RemoveJob = %v, %v", removed, err)
+	}
+	if removed, _ := s.RemoveJob("drop"); removed {
+		t.Error("RemoveJob reported a missing job as removed")
+	}
+
+	reloaded, _ := newTestScheduler(t, file, clock)
+	jobs := reloaded.ListJobs()
+	if len(jobs) != 1 || jobs[0].ID != "keep" || jobs[0].Payload != "p" || jobs[0].CatchUp != CatchUpOnce {
+		t.Fatalf("reloaded jobs = %+v", jobs)
+	}
+	if !jobs[0].CreatedAt.Equal(clock.Now()) {
+		t.Errorf("CreatedAt = %s, want %s", jobs[0].CreatedAt, clock.Now())
+	}
+}
+
+func TestSchedulerSetConfigJobs(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "schedules.json")
+	s, _ := newTestScheduler(t, file, nil)
+
+	s.AddJob(&ScheduleJob{ID: "api-job", Spec: "@hourly", Source: ScheduleSourceAPI})
+	if err := s.SetConfigJobs([]*ScheduleJob{
+		{ID: "nightly", Spec: "0 3 * * *"},
+		{ID: "checks", Spec: "@every 10m"},
+	}); err != nil {
+		t.Fatalf("SetConfigJobs: %v", err)
+	}
+
+	// The next start no longer configures "checks"
+	restarted, _ := newTestScheduler(t, file, nil)
+	if err := restarted.SetConfigJobs([]*ScheduleJob{{ID: "nightly", Spec: "0 4 * * *"}}); err != nil {
+		t.Fatalf("SetConfigJobs: %v", err)
+	}
+
+	var ids []string
+	for _, job := range restarted.ListJobs() {
+		ids = append(ids, job.ID+"/"+job.Source)
+	}
+	if got := strings.Join(ids, ","); got != "api-job/api,nightly/config" && got != "nightly/config,api-job/api" {
+		t.Errorf("jobs = %s, want api-job and nightly", got)
+	}
+	if job, _ := restarted.GetJob("nightly"); job.Spec != "0 4 * * *" {
+		t.Errorf("nightly spec = %s, want the updated config", job.Spec)
+	}
+
+	if err := restarted.SetConfigJobs([]*ScheduleJob{{ID: "bad", Spec: "nope"}}); err == nil {
+		t.Error("SetConfigJobs accepted an invalid job")
+	}
+}
+
+func TestSchedulerStartFiresJobs(t *testing.T) {
+	s, events := newTestScheduler(t, "", nil)
+	s.AddJob(&ScheduleJob{ID: "tick", Spec: "* * * * * *"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Start(ctx)
+
+	select {
+	case event := <-events:
+		if event.Metadata["job_id"] != "tick" {
+			t.Errorf("job_id = %v, want tick", event.Metadata["job_id"])
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("scheduler did not fire the job")
+	}
+}
+
+func TestScheduleEndpoints(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantJobs   int
+	}{
+		{name: "list", method: "GET", path: "/api/v1/schedules", wantStatus: http.StatusOK, wantJobs: 1},
+		{name: "get", method: "GET", path: "/api/v1/schedules/existing", wantStatus: http.StatusOK, wantJobs: 1},
+		{name: "get missing", method: "GET", path: "/api/v1/schedules/missing", wantStatus: http.StatusNotFound, wantJobs: 1},
+		{name: "create", method: "POST", path: "/api/v1/schedules", body: `{"name":"checks","spec":"@every 5m","payload":{"x":1},"catch_up":"once"}`, wantStatus: http.StatusCreated, wantJobs: 2},
+		{name: "create without spec", method: "POST", path: "/api/v1/schedules", body: `{"name":"checks"}`, wantStatus: http.StatusBadRequest, wantJobs: 1},
+		{name: "create with invalid spec", method: "POST", path: "/api/v1/schedules", body: `{"spec":"soon"}`, wantStatus: http.StatusBadRequest, wantJobs: 1},
+		{name: "create with invalid json", method: "POST", path: "/api/v1/schedules", body: `{`, wantStatus: http.StatusBadRequest, wantJobs: 1},
+		{name: "delete", method: "DELETE", path: "/api/v1/schedules/existing", wantStatus: http.StatusNoContent, wantJobs: 0},
+		{name: "delete missing", method: "DELETE", path: "/api/v1/schedules/missing", wantStatus: http.StatusNotFound, wantJobs: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestScheduler(t, "", nil)
+			s.AddJob(&ScheduleJob{ID: "existing", Spec: "@hourly"})
+			ws := newTestWebServer(t, s.eventLoop)
+			ws.agent.scheduler = s
+
+			rec := serveTestRequest(ws, tt.method, tt.path, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if n := len(s.ListJobs()); n != tt.wantJobs {
+				t.Errorf("%d jobs, want %d", n, tt.wantJobs)
+			}
+
+			if tt.name == "create" {
+				var job ScheduleJob
+				json.Unmarshal(rec.Body.Bytes(), &job)
+				if job.ID == "" || job.Source != ScheduleSourceAPI || job.CatchUp != CatchUpOnce || job.NextRun.IsZero() {
+					t.Errorf("created job = %+v", job)
+				}
+			}
+		})
+	}
+}
@@ -16,7 +16,13 @@ func (h *TestHandler) Handle(ctx context.Context, msg *Message) error {
 
 // CanHandle checks if this handler can handle the message type
 func (h *TestHandler) CanHandle(msgType MessageType) bool {
-	return true // Handle all message types for testing
+	return msgType == MessageTypeUserInput || msgType == MessageTypeAgentMessage
+}
+
+// MessageTypes limits the demo handler to conversational messages so that
+// system and scheduled events are not printed
+func (h *TestHandler) MessageTypes() []MessageType {
+	return []MessageType{MessageTypeUserInput, MessageTypeAgentMessage}
 }
 
 // Priority returns the handler priority (lower number = higher priority)
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 )
 
 // ToolCallMessage represents a tool call message
@@ -36,9 +37,12 @@ func (h *ToolCallMessageHandler) Handle(ctx context.Context, msg *Message) error
 
 	// Execute the tool
 	call := &ToolCall{
-		ID:   msg.ID,
+		ID:   GenerateMessageID(),
 		Name: toolCall.ToolName,
 		Args: toolCall.Args,
+
+		CorrelationID: msg.CorrelationID,
+		CausationID:   msg.ID,
 	}
 	
 	result, err := h.ToolManager.ExecuteTool(ctx, call)
@@ -46,20 +50,45 @@ func (h *ToolCallMessageHandler) Handle(ctx context.Context, msg *Message) error
 		return fmt.Errorf("tool execution failed: %w", err)
 	}
 
-	// Log the result
 	resultPayload := map[string]interface{}{
+		"call_id":   call.ID,
 		"tool_name": toolCall.ToolName,
 		"result":    result.Result,
 		"error":     result.Error,
 		"success":   result.Error == "",
 	}
 
-	// In a real implementation, this would be sent back through the message router
-	// For now, just log it
-	fmt.Printf("Tool call result: %+v\n", resultPayload)
+	// Send the result back to the caller when the message was sent as a request
+	if responder, ok := ResponderFromContext(ctx); ok {
+		if err := responder.Reply(resultPayload); err != nil {
+			return err
+		}
+	} else {
+		// Nobody is waiting for the result, just log it
+		fmt.Printf("Tool call result: %+v\n", resultPayload)
+	}
+
+	// Failed calls fail the message so they reach the dead letter store
+	if result.Error != "" {
+		cause := ErrToolCallFailed
+		if result.Cancelled {
+			cause = ErrToolCallCancelled
+		}
+		return fmt.Errorf("%w: %s: %s", cause, call.Name, result.Error)
+	}
 	return nil
 }
 
+// HandlerTimeout lets a call run as long as the slowest registered tool may take.
+// Every call is already bounded by its tool's timeout and retry policy, a shorter
+// handler timeout would abandon calls that are still within their limits.
+func (h *ToolCallMessageHandler) HandlerTimeout() time.Duration {
+	if h.ToolManager == nil {
+		return 0
+	}
+	return h.ToolManager.MaxCallDuration()
+}
+
 // CanHandle checks if this handler can handle the message type
 func (h *ToolCallMessageHandler) CanHandle(msgType MessageType) bool {
 	return msgType == MessageTypeToolResponse
@@ -0,0 +1,341 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+)
+
+// ToolFormat selects the tool definition format understood by a model provider
+type ToolFormat string
+
+const (
+	ToolFormatOpenAI    ToolFormat = "openai"
+	ToolFormatAnthropic ToolFormat = "anthropic"
+	ToolFormatMCP       ToolFormat = "mcp"
+)
+
+// ParseToolFormat parses a tool definition format name
+func ParseToolFormat(s string) (ToolFormat, error) {
+	switch format := ToolFormat(s); format {
+	case ToolFormatOpenAI, ToolFormatAnthropic, ToolFormatMCP:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown tool format: %s", s)
+	}
+}
+
+// OpenAITool is a tool definition for the OpenAI chat completions "tools" parameter
+type OpenAITool struct {
+	Type     string         `json:"type"`
+	Function OpenAIFunction `json:"function"`
+}
+
+// OpenAIFunction describes a function the model may call
+type OpenAIFunction struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Parameters  *JSONSchema `json:"parameters"`
+}
+
+// AnthropicTool is a tool definition for the Anthropic messages "tools" parameter
+type AnthropicTool struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	InputSchema *JSONSchema `json:"input_schema"`
+}
+
+// MCPTool is a tool definition as returned by the MCP tools/list method
+type MCPTool struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	InputSchema *JSONSchema `json:"inputSchema"`
+}
+
+// invalidFunctionNameChars matches characters OpenAI and Anthropic reject in tool names
+var invalidFunctionNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// functionName returns the tool name as exported to OpenAI and Anthropic, which only
+// allow letters, digits, underscores and dashes. For example "fs.read" becomes "fs_read".
+func functionName(name string) string {
+	return invalidFunctionNameChars.ReplaceAllString(name, "_")
+}
+
+// inputSchema returns the tool's parameter schema, or an empty object schema for
+// tools that accept any arguments since providers require an object schema
+func inputSchema(tool *Tool) *JSONSchema {
+	if tool.Parameters != nil {
+		return tool.Parameters
+	}
+	return ObjectSchema(map[string]*JSONSchema{})
+}
+
+// OpenAITools returns the registered tools as OpenAI function definitions
+func (tm *ToolManager) OpenAITools() []OpenAITool {
+	tools := tm.ListTools()
+	defs := make([]OpenAITool, len(tools))
+	for i, tool := range tools {
+		defs[i] = OpenAITool{
+			Type: "function",
+			Function: OpenAIFunction{
+				Name:        functionName(tool.Name),
+				Description: tool.Description,
+				Parameters:  inputSchema(tool),
+			},
+		}
+	}
+	return defs
+}
+
+// AnthropicTools returns the registered tools as Anthropic tool definitions
+func (tm *ToolManager) AnthropicTools() []AnthropicTool {
+	tools := tm.ListTools()
+	defs := make([]AnthropicTool, len(tools))
+	for i, tool := range tools {
+		defs[i] = AnthropicTool{
+			Name:        functionName(tool.Name),
+			Description: tool.Description,
+			InputSchema: inputSchema(tool),
+		}
+	}
+	return defs
+}
+
+// MCPTools returns the registered tools as MCP tool definitions
+func (tm *ToolManager) MCPTools() []MCPTool {
+	tools := tm.ListTools()
+	defs := make([]MCPTool, len(tools))
+	for i, tool := range tools {
+		defs[i] = MCPTool{
+			Name:        tool.Name,
+			Description: tool.Description,
+			InputSchema: inputSchema(tool),
+		}
+	}
+	return defs
+}
+
+// ExportTools returns the registered tools in the given format
+func (tm *ToolManager) ExportTools(format ToolFormat) (interface{}, error) {
+	switch format {
+	case ToolFormatOpenAI:
+		return tm.OpenAITools(), nil
+	case ToolFormatAnthropic:
+		return tm.AnthropicTools(), nil
+	case ToolFormatMCP:
+		return tm.MCPTools(), nil
+	default:
+		return nil, fmt.Errorf("unknown tool format: %s", format)
+	}
+}
+
+// resolveToolName maps a name used by a model back to the registered tool name
+func (tm *ToolManager) resolveToolName(name string) string {
+	if _, exists := tm.GetTool(name); exists {
+		return name
+	}
+	for _, tool := range tm.ListTools() {
+		if functionName(tool.Name) == name {
+			return tool.Name
+		}
+	}
+	return name
+}
+
+// ParseToolCalls extracts the tool calls from a model response in the given format.
+// Exported names such as "fs_read" are mapped back to the registered tool names.
+//
+// Accepted input:
+//   - openai: a chat completion, an assistant message, or its "tool_calls" array
+//   - anthropic: a messages response or its "content" array; only tool_use blocks are used
+//   - mcp: a tools/call JSON-RPC request or its params
+func (tm *ToolManager) ParseToolCalls(format ToolFormat, data []byte) ([]*ToolCall, error) {
+	var calls []*ToolCall
+	var err error
+	switch format {
+	case ToolFormatOpenAI:
+		calls, err = parseOpenAIToolCalls(data)
+	case ToolFormatAnthropic:
+		calls, err = parseAnthropicToolCalls(data)
+	case ToolFormatMCP:
+		calls, err = parseMCPToolCall(data)
+	default:
+		return nil, fmt.Errorf("unknown tool format: %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, call := range calls {
+		call.Name = tm.resolveToolName(call.Name)
+	}
+	return calls, nil
+}
+
+type openAIToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+type openAIMessage struct {
+	ToolCalls []openAIToolCall `json:"tool_calls"`
+}
+
+type openAIChatCompletion struct {
+	Choices []struct {
+		Message openAIMessage `json:"message"`
+	} `json:"choices"`
+}
+
+func parseOpenAIToolCalls(data []byte) ([]*ToolCall, error) {
+	var raw []openAIToolCall
+	if isJSONArray(data) {
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("failed to parse OpenAI tool calls: %w", err)
+		}
+	} else {
+		var completion struct {
+			openAIChatCompletion
+			openAIMessage
+		}
+		if err := json.Unmarshal(data, &completion); err != nil {
+			return nil, fmt.Errorf("failed to parse OpenAI response: %w", err)
+		}
+		raw = completion.ToolCalls
+		for _, choice := range completion.Choices {
+			raw = append(raw, choice.Message.ToolCalls...)
+		}
+	}
+
+	calls := make([]*ToolCall, 0, len(raw))
+	for _, tc := range raw {
+		if tc.Type != "" && tc.Type != "function" {
+			continue
+		}
+		args, err := decodeToolArguments(tc.Function.Arguments)
+		if err != nil {
+			return nil, fmt.Errorf("invalid arguments for tool call %s: %w", tc.ID, err)
+		}
+		calls = append(calls, &ToolCall{
+			ID:   tc.ID,
+			Name: tc.Function.Name,
+			Args: args,
+		})
+	}
+	return calls, nil
+}
+
+type anthropicContentBlock struct {
+	Type  string          `json:"type"`
+	ID    string          `json:"id"`
+	Name  string          `json:"name"`
+	Input json.RawMessage `json:"input"`
+}
+
+func parseAnthropicToolCalls(data []byte) ([]*ToolCall, error) {
+	var blocks []anthropicContentBlock
+	if isJSONArray(data) {
+		if err := json.Unmarshal(data, &blocks); err != nil {
+			return nil, fmt.Errorf("failed to parse Anthropic content blocks: %w", err)
+		}
+	} else {
+		var message struct {
+			Content []anthropicContentBlock `json:"content"`
+		}
+		if err := json.Unmarshal(data, &message); err != nil {
+			return nil, fmt.Errorf("failed to parse Anthropic response: %w", err)
+		}
+		blocks = message.Content
+	}
+
+	calls := make([]*ToolCall, 0, len(blocks))
+	for _, block := range blocks {
+		if block.Type != "tool_use" {
+			continue
+		}
+		args, err := decodeToolArguments(block.Input)
+		if err != nil {
+			return nil, fmt.Errorf("invalid input for tool use %s: %w", block.ID, err)
+		}
+		calls = append(calls, &ToolCall{
+			ID:   block.ID,
+			Name: block.Name,
+			Args: args,
+		})
+	}
+	return calls, nil
+}
+
+// mcpCallParams is the params object of an MCP tools/call request
+type mcpCallParams struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+}
+
+func parseMCPToolCall(data []byte) ([]*ToolCall, error) {
+	var request struct {
+		Method string         `json:"method"`
+		Params *mcpCallParams `json:"params"`
+		mcpCallParams
+	}
+	if err := json.Unmarshal(data, &request); err != nil {
+		return nil, fmt.Errorf("failed to parse MCP tool call: %w", err)
+	}
+
+	params := &request.mcpCallParams
+	if request.Params != nil {
+		if request.Method != "" && request.Method != "tools/call" {
+			return nil, fmt.Errorf("unexpected MCP method: %s", request.Method)
+		}
+		params = request.Params
+	}
+	if params.Name == "" {
+		return nil, fmt.Errorf("MCP tool call has no tool name")
+	}
+
+	return []*ToolCall{{Name: params.Name, Args: params.Arguments}}, nil
+}
+
+// decodeToolArguments decodes arguments given either as a JSON object or, as OpenAI
+// does, as a string containing a JSON object
+func decodeToolArguments(raw json.RawMessage) (map[string]interface{}, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return map[string]interface{}{}, nil
+	}
+
+	var encoded string
+	if err := json.Unmarshal(raw, &encoded); err == nil {
+		if encoded == "" {
+			return map[string]interface{}{}, nil
+		}
+		raw = json.RawMessage(encoded)
+	}
+
+	var args map[string]interface{}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, fmt.Errorf("arguments must be a JSON object: %w", err)
+	}
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	return args, nil
+}
+
+// isJSONArray reports whether the JSON document is an array
+func isJSONArray(data []byte) bool {
+	for _, c := range data {
+		switch c {
+		case ' ', '\t', '\r', '\n':
+			continue
+		case '[':
+			return true
+		default:
+			return false
+		}
+	}
+	return false
+}
@@ -0,0 +1,230 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// exportTestTools returns a tool manager with a dotted tool name and a tool without a schema
+func exportTestTools(t *testing.T) *ToolManager {
+	t.Helper()
+	tm, _ := NewToolManager(testLogger())
+	tm.RegisterTool(&Tool{
+		Name:        "fs.read",
+		Description: "Read a file",
+		Parameters:  ObjectSchema(map[string]*JSONSchema{"path": {Type: SchemaTypeString}}, "path"),
+		Handler: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+			return "read " + args["path"].(string), nil
+		},
+	})
+	tm.RegisterTool(&Tool{Name: "ping", Handler: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+		return "pong", nil
+	}})
+	return tm
+}
+
+func TestParseToolFormat(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    ToolFormat
+		wantErr bool
+	}{
+		{in: "openai", want: ToolFormatOpenAI},
+		{in: "anthropic", want: ToolFormatAnthropic},
+		{in: "mcp", want: ToolFormatMCP},
+		{in: "OpenAI", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseToolFormat(tt.in)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ParseToolFormat(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportTools(t *testing.T) {
+	tm := exportTestTools(t)
+	params := `{"type":"object","properties":{"path":{"type":"string"}},"required":["path"]}`
+	empty := `{"type":"object"}`
+
+	tests := []struct {
+		format  ToolFormat
+		want    string
+		wantErr bool
+	}{
+		{
+			format: ToolFormatOpenAI,
+			want: `[{"type":"function","function":{"name":"fs_read","description":"Read a file","parameters":` + params + `}},` +
+				`{"type":"function","function":{"name":"ping","parameters":` + empty + `}}]`,
+		},
+		{
+			format: ToolFormatAnthropic,
+			want:   `[{"name":"fs_read","description":"Read a file","input_schema":` + params + `},{"name":"ping","input_schema":` + empty + `}]`,
+		},
+		{
+			format: ToolFormatMCP,
+			want:   `[{"name":"fs.read","description":"Read a file","inputSchema":` + params + `},{"name":"ping","inputSchema":` + empty + `}]`,
+		},
+		{format: "gemini", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			defs, err := tm.ExportTools(tt.format)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("ExportTools succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExportTools: %v", err)
+			}
+			got, _ := json.Marshal(defs)
+			if string(got) != tt.want {
+				t.Errorf("ExportTools =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseToolCalls(t *testing.T) {
+	tm := exportTestTools(t)
+	path := map[string]interface{}{"path": "a.txt"}
+
+	tests := []struct {
+		name    string
+		format  ToolFormat
+		data    string
+		want    []*ToolCall
+		wantErr string
+	}{
+		{
+			name:   "openai completion",
+			format: ToolFormatOpenAI,
+			data:   `{"choices":[{"message":{"role":"assistant","tool_calls":[{"id":"call_1","type":"function","function":{"name":"fs_read","arguments":"{\"path\":\"a.txt\"}"}}]}}]}`,
+			want:   []*ToolCall{{ID: "call_1", Name: "fs.read", Args: path}},
+		},
+		{
+			name:   "openai message",
+			format: ToolFormatOpenAI,
+			data:   `{"role":"assistant","tool_calls":[{"id":"call_1","function":{"name":"ping","arguments":""}}]}`,
+			want:   []*ToolCall{{ID: "call_1", Name: "ping", Args: map[string]interface{}{}}},
+		},
+		{
+			name:   "openai tool calls array with object arguments",
+			format: ToolFormatOpenAI,
+			data:   `[{"id":"a","type":"function","function":{"name":"fs_read","arguments":{"path":"a.txt"}}},{"id":"b","type":"other"}]`,
+			want:   []*ToolCall{{ID: "a", Name: "fs.read", Args: path}},
+		},
+		{
+			name:    "openai arguments not an object",
+			format:  ToolFormatOpenAI,
+			data:    `[{"id":"a","function":{"name":"ping","arguments":"[1]"}}]`,
+			wantErr: "invalid arguments for tool call a",
+		},
+		{
+			name:   "anthropic message",
+			format: ToolFormatAnthropic,
+			data:   `{"role":"assistant","content":[{"type":"text","text":"Reading"},{"type":"tool_use","id":"toolu_1","name":"fs_read","input":{"path":"a.txt"}}]}`,
+			want:   []*ToolCall{{ID: "toolu_1", Name: "fs.read", Args: path}},
+		},
+		{
+			name:   "anthropic content array",
+			format: ToolFormatAnthropic,
+			data:   ` [{"type":"tool_use","id":"toolu_1","name":"unknown_tool","input":null}]`,
+			want:   []*ToolCall{{ID: "toolu_1", Name: "unknown_tool", Args: map[string]interface{}{}}},
+		},
+		{
+			name:   "mcp request",
+			format: ToolFormatMCP,
+			data:   `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"fs.read","arguments":{"path":"a.txt"}}}`,
+			want:   []*ToolCall{{Name: "fs.read", Args: path}},
+		},
+		{
+			name:   "mcp params",
+			format: ToolFormatMCP,
+			data:   `{"name":"fs.read","arguments":{"path":"a.txt"}}`,
+			want:   []*ToolCall{{Name: "fs.read", Args: path}},
+		},
+		{
+			name:    "mcp other method",
+			format:  ToolFormatMCP,
+			data:    `{"method":"tools/list","params":{"name":"x"}}`,
+			wantErr: "unexpected MCP method: tools/list",
+		},
+		{name: "mcp without name", format: ToolFormatMCP, data: `{}`, wantErr: "no tool name"},
+		{name: "invalid json", format: ToolFormatAnthropic, data: `{`, wantErr: "failed to parse Anthropic response"},
+		{name: "unknown format", format: "gemini", data: `{}`, wantErr: "unknown tool format"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tm.ParseToolCalls(tt.format, []byte(tt.data))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ParseToolCalls = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseToolCalls: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				gotJSON, _ := json.Marshal(got)
+				wantJSON, _ := json.Marshal(tt.want)
+				t.Errorf("ParseToolCalls = %s, want %s", gotJSON, wantJSON)
+			}
+		})
+	}
+}
+
+func TestToolFormatEndpoints(t *testing.T) {
+	ws := newTestWebServer(t, startTestLoop(t, nil, nil))
+	ws.agent.ToolManager = exportTestTools(t)
+
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "openai definitions", method: "GET", url: "/api/v1/tools?format=openai", wantStatus: http.StatusOK, wantBody: `"name":"fs_read"`},
+		{name: "anthropic definitions", method: "GET", url: "/api/v1/tools?format=anthropic", wantStatus: http.StatusOK, wantBody: `"input_schema"`},
+		{name: "unknown format", method: "GET", url: "/api/v1/tools?format=gemini", wantStatus: http.StatusBadRequest, wantBody: "unknown tool format"},
+		{
+			name:       "execute anthropic tool calls",
+			method:     "POST",
+			url:        "/api/v1/tool-calls?format=anthropic",
+			body:       `{"content":[{"type":"tool_use","id":"toolu_1","name":"fs_read","input":{"path":"a.txt"}},{"type":"tool_use","id":"toolu_2","name":"ping","input":{}}]}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `"result":"read a.txt"`,
+		},
+		{name: "missing format", method: "POST", url: "/api/v1/tool-calls", body: `{}`, wantStatus: http.StatusBadRequest},
+		{name: "unparsable calls", method: "POST", url: "/api/v1/tool-calls?format=mcp", body: `{}`, wantStatus: http.StatusBadRequest, wantBody: "no tool name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveTestRequest(ws, tt.method, tt.url, tt.body)
+			if rec.Code != tt.wantStatus || !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("status %d body %s, want %d containing %s", rec.Code, rec.Body.String(), tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+
+	rec := serveTestRequest(ws, "POST", "/api/v1/tool-calls?format=anthropic", `[{"type":"tool_use","id":"a","name":"ping"},{"type":"tool_use","id":"b","name":"missing"}]`)
+	var results []*ToolResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(results) != 2 || results[0].Result != "pong" || results[0].ID != "a" || results[1].Error != "tool missing not found" {
+		t.Errorf("results = %s", rec.Body.String())
+	}
+}
@@ -2,21 +2,29 @@ package core
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
 // Tool represents a callable function that can be executed by the agent
 type Tool struct {
-	Name        string                 `json:"name"`
-	Description string                 `json:"description"`
-	Parameters  map[string]interface{} `json:"parameters"`
-	Handler     ToolHandler            `json:"-"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Parameters  *JSONSchema `json:"parameters,omitempty"` // object schema of the arguments, nil accepts any arguments
+	Handler     ToolHandler `json:"-"`
+
+	Timeout   time.Duration     `json:"-"` // limit of a single attempt, 0 uses the ToolManager default
+	Retry     *RetryPolicy      `json:"-"` // retries of failed attempts, nil runs the handler once
+	Retryable ToolRetryableFunc `json:"-"` // which failures are retried, nil uses IsRetryableToolError
 }
 
-// ToolHandler is the function signature for tool handlers
+// ToolHandler is the function signature for tool handlers. Handlers must return
+// promptly once ctx is done, otherwise they keep running after a timeout or cancellation.
 type ToolHandler func(ctx context.Context, args map[string]interface{}) (interface{}, error)
 
 // ToolCall represents a request to call a tool
@@ -24,14 +32,24 @@ type ToolCall struct {
 	ID   string                 `json:"id"`
 	Name string                 `json:"name"`
 	Args map[string]interface{} `json:"args"`
+
+	CorrelationID string `json:"correlation_id,omitempty"` // request this call belongs to
+	CausationID   string `json:"causation_id,omitempty"`   // message or event that made the call
 }
 
 // ToolResult represents the result of a tool call
 type ToolResult struct {
-	ID     string      `json:"id"`
-	Name   string      `json:"name"`
-	Result interface{} `json:"result"`
-	Error  string      `json:"error,omitempty"`
+	ID               string           `json:"id"`
+	Name             string           `json:"name"`
+	Result           interface{}      `json:"result"`
+	Error            string           `json:"error,omitempty"`
+	ValidationErrors ValidationErrors `json:"validation_errors,omitempty"` // arguments that did not match the tool's schema
+	CorrelationID    string           `json:"correlation_id,omitempty"`
+
+	Attempts           int       `json:"attempts"`                       // handler invocations, including retries
+	DurationMs         float64   `json:"duration_ms"`                    // total time, including backoff between attempts
+	AttemptDurationsMs []float64 `json:"attempt_durations_ms,omitempty"` // time taken by each attempt
+	Cancelled          bool      `json:"cancelled,omitempty"`
 }
 
 // ToolManager manages registered tools
@@ -39,13 +57,19 @@ type ToolManager struct {
 	mu    sync.RWMutex
 	tools map[string]*Tool
 	logger *logrus.Logger
+	tracer *Tracer
+
+	defaultTimeout time.Duration
+	running        map[string]*runningToolCall
 }
 
 // NewToolManager creates a new tool manager
 func NewToolManager(logger *logrus.Logger) (*ToolManager, error) {
 	return &ToolManager{
-		tools:  make(map[string]*Tool),
-		logger: logger,
+		tools:          make(map[string]*Tool),
+		logger:         logger,
+		defaultTimeout: DefaultToolTimeout,
+		running:        make(map[string]*runningToolCall),
 	}, nil
 }
 
@@ -57,12 +81,31 @@ func (tm *ToolManager) RegisterTool(tool *Tool) error {
 	if _, exists := tm.tools[tool.Name]; exists {
 		return fmt.Errorf("tool %s already registered", tool.Name)
 	}
+	if tool.Parameters != nil && tool.Parameters.Type != SchemaTypeObject {
+		return fmt.Errorf("tool %s parameters must be an object schema", tool.Name)
+	}
+	if err := tool.Parameters.Compile(); err != nil {
+		return fmt.Errorf("tool %s parameters: %w", tool.Name, err)
+	}
 
 	tm.tools[tool.Name] = tool
 	tm.logger.Infof("Registered tool: %s", tool.Name)
 	return nil
 }
 
+// UnregisterTool removes a tool, returning false if it was not registered
+func (tm *ToolManager) UnregisterTool(name string) bool {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	if _, exists := tm.tools[name]; !exists {
+		return false
+	}
+	delete(tm.tools, name)
+	tm.logger.Infof("Unregistered tool: %s", name)
+	return true
+}
+
 // GetTool retrieves a tool by name
 func (tm *ToolManager) GetTool(name string) (*Tool, bool) {
 	tm.mu.RLock()
@@ -72,7 +115,7 @@ func (tm *ToolManager) GetTool(name string) (*Tool, bool) {
 	return tool, exists
 }
 
-// ListTools returns all registered tools
+// ListTools returns all registered tools ordered by name
 func (tm *ToolManager) ListTools() []*Tool {
 	tm.mu.RLock()
 	defer tm.mu.RUnlock()
@@ -81,32 +124,266 @@ func (tm *ToolManager) ListTools() []*Tool {
 	for _, tool := range tm.tools {
 		tools = append(tools, tool)
 	}
+	sort.Slice(tools, func(i, j int) bool {
+		return tools[i].Name < tools[j].Name
+	})
 	return tools
 }
 
-// ExecuteTool executes a tool call
+// SetTracer sets the tracer that records executed tool calls
+func (tm *ToolManager) SetTracer(tracer *Tracer) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.tracer = tracer
+}
+
+// SetDefaultTimeout sets the attempt timeout of tools that do not declare one
+func (tm *ToolManager) SetDefaultTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = DefaultToolTimeout
+	}
+
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.defaultTimeout = timeout
+}
+
+// MaxCallDuration returns the longest a call of any registered tool may take: the
+// attempt timeout for every attempt plus the longest backoffs between them
+func (tm *ToolManager) MaxCallDuration() time.Duration {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+
+	var longest time.Duration
+	for _, tool := range tm.tools {
+		timeout := tm.defaultTimeout
+		if tool.Timeout > 0 {
+			timeout = tool.Timeout
+		}
+		d := time.Duration(tool.Retry.attempts())*timeout + tool.Retry.maxTotalBackoff()
+		if d > longest {
+			longest = d
+		}
+	}
+	return longest
+}
+
+// RunningToolCalls returns the calls currently executing, oldest first
+func (tm *ToolManager) RunningToolCalls() []ToolCallInfo {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+
+	calls := make([]ToolCallInfo, 0, len(tm.running))
+	for _, running := range tm.running {
+		calls = append(calls, running.info)
+	}
+	sort.Slice(calls, func(i, j int) bool {
+		return calls[i].StartedAt.Before(calls[j].StartedAt)
+	})
+	return calls
+}
+
+// CancelToolCall cancels a running call. The handler's context is cancelled and no
+// further attempts are made; ExecuteTool returns a result with Cancelled set.
+func (tm *ToolManager) CancelToolCall(id string) error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	running, exists := tm.running[id]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrToolCallNotFound, id)
+	}
+	running.cancelled = true
+	running.cancel()
+	tm.logger.Infof("Cancelled tool call %s (%s)", id, running.info.Name)
+	return nil
+}
+
+// ExecuteTool executes a tool call, enforcing the tool's timeout and retry policy.
+// Calls without a correlation ID inherit it from ctx, or start a new request.
 func (tm *ToolManager) ExecuteTool(ctx context.Context, call *ToolCall) (*ToolResult, error) {
+	if call.ID == "" {
+		call.ID = GenerateMessageID()
+	}
+	if call.CorrelationID == "" {
+		call.CorrelationID, call.CausationID = TraceFromContext(ctx)
+	}
+	if call.CorrelationID == "" {
+		call.CorrelationID = call.ID
+	}
+
+	tm.mu.RLock()
+	tracer := tm.tracer
+	tm.mu.RUnlock()
+
+	start := time.Now()
+	result := tm.executeTool(ContextWithTrace(ctx, call.CorrelationID, call.ID), call)
+	result.CorrelationID = call.CorrelationID
+	duration := time.Since(start)
+	result.DurationMs = float64(duration) / float64(time.Millisecond)
+
+	tracer.Record(&TraceSpan{
+		ID:            call.ID,
+		Kind:          TraceSpanToolCall,
+		Name:          call.Name,
+		CorrelationID: call.CorrelationID,
+		CausationID:   call.CausationID,
+		Timestamp:     start,
+		Duration:      duration,
+		Error:         result.Error,
+		Attributes: map[string]interface{}{
+			"attempts": result.Attempts,
+		},
+	})
+
+	return result, nil
+}
+
+// executeTool runs the tool handler and converts its outcome into a result
+func (tm *ToolManager) executeTool(ctx context.Context, call *ToolCall) *ToolResult {
 	tool, exists := tm.GetTool(call.Name)
 	if !exists {
 		return &ToolResult{
 			ID:    call.ID,
 			Name:  call.Name,
 			Error: fmt.Sprintf("tool %s not found", call.Name),
-		}, nil
+		}
+	}
+
+	// Handlers receive arguments with defaults applied and types coerced
+	args, err := tool.Parameters.ValidateArgs(call.Args)
+	if err != nil {
+		result := &ToolResult{
+			ID:    call.ID,
+			Name:  call.Name,
+			Error: fmt.Sprintf("invalid arguments for tool %s: %v", call.Name, err),
+		}
+		if validationErrs, ok := err.(ValidationErrors); ok {
+			result.ValidationErrors = validationErrs
+		}
+		return result
 	}
 
-	result, err := tool.Handler(ctx, call.Args)
+	ctx, running, err := tm.startCall(ctx, call)
 	if err != nil {
 		return &ToolResult{
 			ID:    call.ID,
 			Name:  call.Name,
 			Error: err.Error(),
-		}, nil
+		}
 	}
+	defer tm.finishCall(call.ID)
 
-	return &ToolResult{
-		ID:     call.ID,
-		Name:   call.Name,
-		Result: result,
-	}, nil
+	return tm.runAttempts(ctx, tool, call, args, running)
+}
+
+// runAttempts invokes the handler until it succeeds, fails permanently, runs out of
+// attempts or the call is cancelled
+func (tm *ToolManager) runAttempts(ctx context.Context, tool *Tool, call *ToolCall, args map[string]interface{}, running *runningToolCall) *ToolResult {
+	tm.mu.RLock()
+	timeout := tm.defaultTimeout
+	tm.mu.RUnlock()
+	if tool.Timeout > 0 {
+		timeout = tool.Timeout
+	}
+	retryable := tool.Retryable
+	if retryable == nil {
+		retryable = IsRetryableToolError
+	}
+	maxAttempts := tool.Retry.attempts()
+
+	result := &ToolResult{
+		ID:   call.ID,
+		Name: call.Name,
+	}
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		tm.mu.Lock()
+		running.info.Attempt = attempt
+		tm.mu.Unlock()
+
+		start := time.Now()
+		var value interface{}
+		err := invokeSafely(ctx, call.Name, timeout, func(ctx context.Context) error {
+			var err error
+			value, err = tool.Handler(ctx, args)
+			return err
+		})
+		if errors.Is(err, ErrHandlerTimeout) {
+			err = &ToolTimeoutError{Tool: call.Name, Timeout: timeout}
+		}
+		result.Attempts = attempt
+		result.AttemptDurationsMs = append(result.AttemptDurationsMs, float64(time.Since(start))/float64(time.Millisecond))
+
+		if err == nil {
+			result.Result = value
+			result.Error = ""
+			return result
+		}
+		if tm.cancelled(running) {
+			result.Error = fmt.Sprintf("%v after %d attempt(s)", ErrToolCallCancelled, attempt)
+			result.Cancelled = true
+			return result
+		}
+		result.Error = err.Error()
+		if attempt == maxAttempts || ctx.Err() != nil || !retryable(call, err) {
+			return result
+		}
+
+		backoff := tool.Retry.Backoff(attempt)
+		tm.logger.WithError(err).
+			WithField("tool", call.Name).
+			WithField("call_id", call.ID).
+			WithField("attempt", attempt).
+			Warnf("Tool call failed, retrying in %s", backoff)
+
+		if sleepContext(ctx, backoff) != nil {
+			if tm.cancelled(running) {
+				result.Error = fmt.Sprintf("%v after %d attempt(s)", ErrToolCallCancelled, attempt)
+				result.Cancelled = true
+			}
+			return result
+		}
+	}
+	return result
+}
+
+// startCall registers a call as running and returns the context that CancelToolCall cancels
+func (tm *ToolManager) startCall(ctx context.Context, call *ToolCall) (context.Context, *runningToolCall, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	if _, exists := tm.running[call.ID]; exists {
+		cancel()
+		return nil, nil, fmt.Errorf("tool call %s is already running", call.ID)
+	}
+
+	running := &runningToolCall{
+		info: ToolCallInfo{
+			ID:            call.ID,
+			Name:          call.Name,
+			CorrelationID: call.CorrelationID,
+			StartedAt:     time.Now(),
+		},
+		cancel: cancel,
+	}
+	tm.running[call.ID] = running
+	return ctx, running, nil
+}
+
+// finishCall removes a call from the running set and releases its context
+func (tm *ToolManager) finishCall(id string) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	if running, exists := tm.running[id]; exists {
+		running.cancel()
+		delete(tm.running, id)
+	}
+}
+
+// cancelled reports whether CancelToolCall was called for the call
+func (tm *ToolManager) cancelled(running *runningToolCall) bool {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	return running.cancelled
 }
\ No newline at end of file
@@ -0,0 +1,431 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingTool returns a tool whose handler signals started and then waits for its context
+func blockingTool(name string, started chan<- string) *Tool {
+	return &Tool{Name: name, Handler: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+		if started != nil {
+			started <- name
+		}
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}}
+}
+
+func TestIsRetryableToolError(t *testing.T) {
+	boom := errors.New("boom")
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "plain error", err: boom},
+		{name: "marked", err: MarkRetryable(boom), want: true},
+		{name: "wrapped marked", err: fmt.Errorf("fetch: %w", MarkRetryable(boom)), want: true},
+		{name: "timeout", err: &ToolTimeoutError{Tool: "slow", Timeout: time.Second}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryableToolError(&ToolCall{}, tt.err); got != tt.want {
+				t.Errorf("IsRetryableToolError = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if MarkRetryable(nil) != nil {
+		t.Error("MarkRetryable(nil) is not nil")
+	}
+	if err := MarkRetryable(boom); !errors.Is(err, boom) || err.Error() != "boom" {
+		t.Errorf("MarkRetryable hides the original error: %v", err)
+	}
+	if err := error(&ToolTimeoutError{Tool: "slow", Timeout: time.Second}); !errors.Is(err, ErrToolTimeout) {
+		t.Errorf("%v is not ErrToolTimeout", err)
+	}
+}
+
+func TestExecuteToolRetries(t *testing.T) {
+	retry := &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, Multiplier: 1}
+	boom := errors.New("boom")
+
+	tests := []struct {
+		name           string
+		tool           Tool
+		failures       int   // attempts that fail before the handler succeeds
+		err            error // returned by failing attempts; nil blocks until the attempt times out
+		defaultTimeout time.Duration
+		wantAttempts   int
+		wantErr        string
+	}{
+		{name: "first attempt succeeds", tool: Tool{Retry: retry}, wantAttempts: 1},
+		{name: "retryable failures", tool: Tool{Retry: retry}, failures: 2, err: MarkRetryable(boom), wantAttempts: 3},
+		{name: "attempts exhausted", tool: Tool{Retry: retry}, failures: 5, err: MarkRetryable(boom), wantAttempts: 3, wantErr: "boom"},
+		{name: "permanent failure", tool: Tool{Retry: retry}, failures: 5, err: boom, wantAttempts: 1, wantErr: "boom"},
+		{name: "no retry policy", tool: Tool{}, failures: 1, err: MarkRetryable(boom), wantAttempts: 1, wantErr: "boom"},
+		{
+			name:         "timeouts are not retried by default",
+			tool:         Tool{Retry: retry, Timeout: 20 * time.Millisecond},
+			failures:     5,
+			wantAttempts: 1,
+			wantErr:      "tool flaky timed out after 20ms",
+		},
+		{
+			name: "custom classification retries timeouts",
+			tool: Tool{Retry: retry, Timeout: 20 * time.Millisecond, Retryable: func(call *ToolCall, err error) bool {
+				return errors.Is(err, ErrToolTimeout)
+			}},
+			failures:     1,
+			wantAttempts: 2,
+		},
+		{
+			name:           "manager default timeout",
+			tool:           Tool{},
+			failures:       1,
+			defaultTimeout: 30 * time.Millisecond,
+			wantAttempts:   1,
+			wantErr:        "tool flaky timed out after 30ms",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt // still read by handlers abandoned after their attempt
+		t.Run(tt.name, func(t *testing.T) {
+			tm, _ := NewToolManager(testLogger())
+			if tt.defaultTimeout > 0 {
+				tm.SetDefaultTimeout(tt.defaultTimeout)
+			}
+			var calls atomic.Int32
+			tool := tt.tool
+			tool.Name = "flaky"
+			tool.Handler = func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+				if int(calls.Add(1)) > tt.failures {
+					return "ok", nil
+				}
+				if tt.err == nil {
+					<-ctx.Done()
+					return nil, ctx.Err()
+				}
+				return nil, tt.err
+			}
+			tm.RegisterTool(&tool)
+
+			result, err := tm.ExecuteTool(context.Background(), &ToolCall{Name: "flaky"})
+			if err != nil {
+				t.Fatalf("ExecuteTool: %v", err)
+			}
+			if result.Attempts != tt.wantAttempts || len(result.AttemptDurationsMs) != tt.wantAttempts {
+				t.Errorf("attempts = %d with %d durations, want %d", result.Attempts, len(result.AttemptDurationsMs), tt.wantAttempts)
+			}
+			if result.Error != tt.wantErr {
+				t.Errorf("error = %q, want %q", result.Error, tt.wantErr)
+			}
+			if tt.wantErr == "" && result.Result != "ok" {
+				t.Errorf("result = %v, want ok", result.Result)
+			}
+			var sum float64
+			for _, d := range result.AttemptDurationsMs {
+				sum += d
+			}
+			if result.DurationMs < sum {
+				t.Errorf("duration %fms is shorter than its attempts %fms", result.DurationMs, sum)
+			}
+		})
+	}
+}
+
+func TestExecuteToolRecoversPanics(t *testing.T) {
+	tm, _ := NewToolManager(testLogger())
+	tm.RegisterTool(&Tool{Name: "broken", Handler: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+		panic("nil map")
+	}})
+
+	result, err := tm.ExecuteTool(context.Background(), &ToolCall{Name: "broken"})
+	if err != nil || !strings.Contains(result.Error, "nil map") || result.Attempts != 1 {
+		t.Errorf("result = %+v, %v, want the panic reported", result, err)
+	}
+}
+
+func TestCancelToolCall(t *testing.T) {
+	tests := []struct {
+		name  string
+		retry *RetryPolicy
+		err   error // returned by the handler; nil blocks until cancelled
+	}{
+		{name: "during an attempt"},
+		{name: "during backoff", retry: &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Minute}, err: MarkRetryable(errors.New("boom"))},
+	}
+	for _, tt := range tests {
+		tt := tt // still read by handlers abandoned after their attempt
+		t.Run(tt.name, func(t *testing.T) {
+			tm, _ := NewToolManager(testLogger())
+			var calls atomic.Int32
+			tm.RegisterTool(&Tool{Name: "work", Retry: tt.retry, Handler: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+				calls.Add(1)
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}})
+
+			done := make(chan *ToolResult, 1)
+			go func() {
+				result, _ := tm.ExecuteTool(context.Background(), &ToolCall{ID: "call-1", Name: "work", CorrelationID: "req-1"})
+				done <- result
+			}()
+			waitFor(t, time.Second, "attempt started", func() bool { return calls.Load() == 1 })
+
+			running := tm.RunningToolCalls()
+			if len(running) != 1 || running[0].ID != "call-1" || running[0].CorrelationID != "req-1" || running[0].Attempt != 1 {
+				t.Errorf("running calls = %+v", running)
+			}
+			if err := tm.CancelToolCall("call-1"); err != nil {
+				t.Fatalf("CancelToolCall: %v", err)
+			}
+
+			var result *ToolResult
+			select {
+			case result = <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("ExecuteTool did not return after cancel")
+			}
+			if !result.Cancelled || result.Error != "tool call cancelled after 1 attempt(s)" || calls.Load() != 1 {
+				t.Errorf("result = %+v after %d attempts, want cancelled after 1", result, calls.Load())
+			}
+			if running := tm.RunningToolCalls(); len(running) != 0 {
+				t.Errorf("running calls after cancel = %+v", running)
+			}
+			if err := tm.CancelToolCall("call-1"); !errors.Is(err, ErrToolCallNotFound) {
+				t.Errorf("second CancelToolCall = %v, want ErrToolCallNotFound", err)
+			}
+		})
+	}
+}
+
+func TestExecuteToolCallerContext(t *testing.T) {
+	tm, _ := NewToolManager(testLogger())
+	tm.RegisterTool(blockingTool("wait", nil))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	result, _ := tm.ExecuteTool(ctx, &ToolCall{Name: "wait"})
+	// The caller's deadline is not the tool's timeout and not a cancellation by ID
+	if result.Cancelled || !strings.Contains(result.Error, "context deadline exceeded") {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestExecuteToolRejectsRunningID(t *testing.T) {
+	tm, _ := NewToolManager(testLogger())
+	started := make(chan string, 1)
+	tm.RegisterTool(blockingTool("wait", started))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		tm.ExecuteTool(context.Background(), &ToolCall{ID: "call-1", Name: "wait"})
+	}()
+	<-started
+
+	result, _ := tm.ExecuteTool(context.Background(), &ToolCall{ID: "call-1", Name: "wait"})
+	if result.Error != "tool call call-1 is already running" || result.Attempts != 0 {
+		t.Errorf("result = %+v", result)
+	}
+	tm.CancelToolCall("call-1")
+	<-done
+}
+
+func TestConcurrentToolCalls(t *testing.T) {
+	tm, _ := NewToolManager(testLogger())
+	started := make(chan string, 8)
+	tm.RegisterTool(blockingTool("wait", started))
+
+	var wg sync.WaitGroup
+	results := make([]*ToolResult, 8)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = tm.ExecuteTool(context.Background(), &ToolCall{ID: fmt.Sprintf("call-%d", i), Name: "wait"})
+		}(i)
+	}
+	for range results {
+		<-started
+	}
+	if running := tm.RunningToolCalls(); len(running) != len(results) {
+		t.Fatalf("%d running calls, want %d", len(running), len(results))
+	}
+	for _, info := range tm.RunningToolCalls() {
+		go tm.CancelToolCall(info.ID)
+	}
+	wg.Wait()
+
+	for i, result := range results {
+		if !result.Cancelled {
+			t.Errorf("call %d = %+v, want cancelled", i, result)
+		}
+	}
+}
+
+func TestMaxCallDuration(t *testing.T) {
+	tests := []struct {
+		name  string
+		tools []*Tool
+		want  time.Duration
+	}{
+		{name: "no tools"},
+		{name: "manager default timeout", tools: []*Tool{{Name: "a"}}, want: 10 * time.Second},
+		{name: "tool timeout", tools: []*Tool{{Name: "a", Timeout: time.Second}}, want: time.Second},
+		{
+			name:  "attempts and backoff",
+			tools: []*Tool{{Name: "a", Timeout: time.Second, Retry: &RetryPolicy{MaxAttempts: 3, InitialBackoff: 100 * time.Millisecond, Multiplier: 2}}},
+			want:  3*time.Second + 300*time.Millisecond,
+		},
+		{
+			name:  "largest jitter",
+			tools: []*Tool{{Name: "a", Timeout: time.Second, Retry: &RetryPolicy{MaxAttempts: 2, InitialBackoff: 100 * time.Millisecond, Jitter: 0.5}}},
+			want:  2*time.Second + 150*time.Millisecond,
+		},
+		{
+			name:  "slowest tool",
+			tools: []*Tool{{Name: "a", Timeout: time.Second}, {Name: "b", Timeout: 5 * time.Second}, {Name: "c"}},
+			want:  10 * time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tm, _ := NewToolManager(testLogger())
+			tm.SetDefaultTimeout(10 * time.Second)
+			for _, tool := range tt.tools {
+				tm.RegisterTool(tool)
+			}
+			if got := tm.MaxCallDuration(); got != tt.want {
+				t.Errorf("MaxCallDuration = %s, want %s", got, tt.want)
+			}
+			handler := &ToolCallMessageHandler{ToolManager: tm}
+			if got := handler.HandlerTimeout(); got != tt.want {
+				t.Errorf("HandlerTimeout = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	tm, _ := NewToolManager(testLogger())
+	tm.SetDefaultTimeout(0)
+	tm.RegisterTool(&Tool{Name: "a"})
+	if got := tm.MaxCallDuration(); got != DefaultToolTimeout {
+		t.Errorf("MaxCallDuration with a zero default = %s, want %s", got, DefaultToolTimeout)
+	}
+	if got := (&ToolCallMessageHandler{}).HandlerTimeout(); got != 0 {
+		t.Errorf("HandlerTimeout without a tool manager = %s", got)
+	}
+}
+
+func TestToolCallMessageHandlerErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		tool    string
+		cancel  bool
+		wantErr error
+	}{
+		{name: "success", tool: "ok"},
+		{name: "tool failure", tool: "fail", wantErr: ErrToolCallFailed},
+		{name: "unknown tool", tool: "missing", wantErr: ErrToolCallFailed},
+		{name: "cancelled", tool: "wait", cancel: true, wantErr: ErrToolCallCancelled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tm, _ := NewToolManager(testLogger())
+			started := make(chan string, 1)
+			tm.RegisterTool(blockingTool("wait", started))
+			tm.RegisterTool(&Tool{Name: "ok", Handler: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+				return "done", nil
+			}})
+			tm.RegisterTool(&Tool{Name: "fail", Handler: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+				return nil, errors.New("boom")
+			}})
+			router := NewMessageRouter()
+			router.RegisterHandler(&ToolCallMessageHandler{ToolManager: tm})
+
+			if tt.cancel {
+				go func() {
+					<-started
+					tm.CancelToolCall(tm.RunningToolCalls()[0].ID)
+				}()
+			}
+			msg := &Message{Type: MessageTypeToolResponse, Payload: map[string]interface{}{"tool_name": tt.tool}}
+			replies, err := router.RequestWithOptions(context.Background(), msg, RequestOptions{Timeout: 5 * time.Second, Mode: ReplyAll})
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Errorf("Request = %v, want %v", err, tt.wantErr)
+			}
+			if len(replies) != 1 {
+				t.Fatalf("%d replies, want the result even when the call failed", len(replies))
+			}
+			payload := replies[0].Payload.(map[string]interface{})
+			if payload["success"] != (tt.wantErr == nil) || payload["call_id"] == "" {
+				t.Errorf("reply = %v", payload)
+			}
+		})
+	}
+}
+
+func TestToolCallEndpoints(t *testing.T) {
+	ws := newTestWebServer(t, startTestLoop(t, nil, nil))
+	tm, _ := NewToolManager(testLogger())
+	started := make(chan string, 1)
+	tm.RegisterTool(blockingTool("wait", started))
+	ws.agent.ToolManager = tm
+
+	done := make(chan string, 1)
+	go func() {
+		rec := serveTestRequest(ws, "POST", "/api/v1/tools/wait/execute", `{"id": "call-1", "parameters": {}}`)
+		done <- rec.Body.String()
+	}()
+	<-started
+
+	rec := serveTestRequest(ws, "GET", "/api/v1/tool-calls", "")
+	var running []ToolCallInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &running); err != nil || len(running) != 1 || running[0].ID != "call-1" {
+		t.Fatalf("running calls = %s, %v", rec.Body.String(), err)
+	}
+
+	tests := []struct {
+		name       string
+		id         string
+		wantStatus int
+	}{
+		{name: "running call", id: "call-1", wantStatus: http.StatusNoContent},
+		{name: "already finished", id: "call-1", wantStatus: http.StatusNotFound},
+		{name: "unknown call", id: "call-2", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantStatus == http.StatusNotFound {
+				waitFor(t, time.Second, "call finished", func() bool { return len(tm.RunningToolCalls()) == 0 })
+			}
+			rec := serveTestRequest(ws, "DELETE", "/api/v1/tool-calls/"+tt.id, "")
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+
+	select {
+	case body := <-done:
+		if !strings.Contains(body, `"cancelled":true`) {
+			t.Errorf("execute response = %s, want a cancelled result", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("execute request did not return after cancel")
+	}
+}
@@ -0,0 +1,75 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultToolTimeout is the time a single tool attempt may run when neither the tool
+// nor the ToolManager sets a timeout
+const DefaultToolTimeout = 60 * time.Second
+
+// ToolRetryableFunc decides whether a failed attempt of a call may be retried
+type ToolRetryableFunc func(call *ToolCall, err error) bool
+
+// RetryableError marks a tool error as safe to retry
+type RetryableError struct {
+	Err error
+}
+
+func (e *RetryableError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RetryableError) Unwrap() error {
+	return e.Err
+}
+
+// MarkRetryable wraps err so IsRetryableToolError reports it as retryable
+func MarkRetryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &RetryableError{Err: err}
+}
+
+// IsRetryableToolError is the default retry classification: only errors wrapped with
+// MarkRetryable are retried. Timed out attempts are not, since a handler that ignores
+// its context keeps running after the timeout; tools whose handlers honour ctx can opt
+// in with a Retryable function.
+func IsRetryableToolError(call *ToolCall, err error) bool {
+	var retryable *RetryableError
+	return errors.As(err, &retryable)
+}
+
+// ToolTimeoutError is returned when a tool attempt exceeds its timeout
+type ToolTimeoutError struct {
+	Tool    string
+	Timeout time.Duration
+}
+
+func (e *ToolTimeoutError) Error() string {
+	return fmt.Sprintf("tool %s timed out after %s", e.Tool, e.Timeout)
+}
+
+// Unwrap makes errors.Is(err, ErrToolTimeout) true
+func (e *ToolTimeoutError) Unwrap() error {
+	return ErrToolTimeout
+}
+
+// ToolCallInfo describes a tool call that is currently running
+type ToolCallInfo struct {
+	ID            string    `json:"id"`
+	Name          string    `json:"name"`
+	CorrelationID string    `json:"correlation_id,omitempty"`
+	StartedAt     time.Time `json:"started_at"`
+	Attempt       int       `json:"attempt"`
+}
+
+// runningToolCall tracks an executing call so it can be listed and cancelled
+type runningToolCall struct {
+	info      ToolCallInfo
+	cancel    func()
+	cancelled bool
+}
@@ -0,0 +1,492 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// JSON Schema types supported for tool parameters
+const (
+	SchemaTypeObject  = "object"
+	SchemaTypeArray   = "array"
+	SchemaTypeString  = "string"
+	SchemaTypeNumber  = "number"
+	SchemaTypeInteger = "integer"
+	SchemaTypeBoolean = "boolean"
+)
+
+// JSONSchema is the subset of JSON Schema used to describe tool parameters.
+// An empty Type accepts any value.
+type JSONSchema struct {
+	Type        string                 `json:"type,omitempty"`
+	Description string                 `json:"description,omitempty"`
+	Properties  map[string]*JSONSchema `json:"properties,omitempty"`
+	Required    []string               `json:"required,omitempty"`
+	Items       *JSONSchema            `json:"items,omitempty"`
+	Enum        []interface{}          `json:"enum,omitempty"`
+	Default     interface{}            `json:"default,omitempty"`
+	Minimum     *float64               `json:"minimum,omitempty"`
+	Maximum     *float64               `json:"maximum,omitempty"`
+	MinLength   *int                   `json:"minLength,omitempty"`
+	MaxLength   *int                   `json:"maxLength,omitempty"`
+	Pattern     string                 `json:"pattern,omitempty"`
+
+	// AdditionalProperties is false to reject unknown object keys, or a *JSONSchema
+	// that unknown keys must match. Nil allows any unknown key.
+	AdditionalProperties interface{} `json:"additionalProperties,omitempty"`
+
+	// Set by Compile
+	pattern    *regexp.Regexp
+	additional *JSONSchema
+}
+
+// ObjectSchema returns an object schema with the given properties and required keys
+func ObjectSchema(properties map[string]*JSONSchema, required ...string) *JSONSchema {
+	return &JSONSchema{
+		Type:       SchemaTypeObject,
+		Properties: properties,
+		Required:   required,
+	}
+}
+
+// Compile compiles the patterns of the schema and its nested schemas so validation does
+// not recompile them, and reports the first invalid pattern. RegisterTool compiles the
+// parameters of every tool; the schema must not be modified afterwards.
+func (s *JSONSchema) Compile() error {
+	return s.compile("")
+}
+
+func (s *JSONSchema) compile(path string) error {
+	if s == nil {
+		return nil
+	}
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			if path == "" {
+				return fmt.Errorf("invalid pattern %q: %w", s.Pattern, err)
+			}
+			return fmt.Errorf("%s: invalid pattern %q: %w", path, s.Pattern, err)
+		}
+		s.pattern = re
+	}
+
+	names := make([]string, 0, len(s.Properties))
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := s.Properties[name].compile(joinPath(path, name)); err != nil {
+			return err
+		}
+	}
+	if err := s.Items.compile(path + "[]"); err != nil {
+		return err
+	}
+
+	s.additional = nil
+	additional := s.additionalSchema()
+	if err := additional.compile(joinPath(path, "*")); err != nil {
+		return err
+	}
+	s.additional = additional
+	return nil
+}
+
+// ValidationError describes one argument that does not match the schema
+type ValidationError struct {
+	Path    string `json:"path"` // dotted path of the argument, e.g. "headers.Accept" or "args[0]"
+	Message string `json:"message"`
+}
+
+func (e ValidationError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// ValidationErrors is returned when arguments do not match a schema
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// ValidateArgs validates tool arguments against the schema and returns a copy with
+// defaults applied and values coerced to the declared types (for example "42" to 42
+// for an integer). A nil schema accepts any arguments.
+func (s *JSONSchema) ValidateArgs(args map[string]interface{}) (map[string]interface{}, error) {
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	if s == nil {
+		return args, nil
+	}
+
+	var errs ValidationErrors
+	value := s.coerce("", args, &errs)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	coerced, _ := value.(map[string]interface{})
+	return coerced, nil
+}
+
+// coerce validates a single value, recording errors and returning the coerced value
+func (s *JSONSchema) coerce(path string, value interface{}, errs *ValidationErrors) interface{} {
+	fail := func(format string, args ...interface{}) interface{} {
+		*errs = append(*errs, ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+		return value
+	}
+
+	var coerced interface{}
+	var ok bool
+	switch s.Type {
+	case "":
+		coerced, ok = value, true
+	case SchemaTypeString:
+		coerced, ok = coerceString(value)
+	case SchemaTypeInteger:
+		coerced, ok = coerceInteger(value)
+	case SchemaTypeNumber:
+		coerced, ok = coerceNumber(value)
+	case SchemaTypeBoolean:
+		coerced, ok = coerceBoolean(value)
+	case SchemaTypeArray:
+		return s.coerceArray(path, value, errs)
+	case SchemaTypeObject:
+		return s.coerceObject(path, value, errs)
+	default:
+		return fail("unsupported schema type %q", s.Type)
+	}
+	if !ok {
+		return fail("expected %s, got %s", s.Type, jsonTypeName(value))
+	}
+
+	if len(s.Enum) > 0 && !enumContains(s.Enum, coerced) {
+		return fail("must be one of %s", formatEnum(s.Enum))
+	}
+	switch v := coerced.(type) {
+	case string:
+		length := len([]rune(v))
+		if s.MinLength != nil && length < *s.MinLength {
+			return fail("must be at least %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			return fail("must be at most %d characters", *s.MaxLength)
+		}
+		if s.Pattern != "" {
+			re := s.pattern
+			if re == nil {
+				// Schemas that were never compiled
+				var err error
+				if re, err = regexp.Compile(s.Pattern); err != nil {
+					return fail("invalid pattern %q: %v", s.Pattern, err)
+				}
+			}
+			if !re.MatchString(v) {
+				return fail("must match pattern %s", s.Pattern)
+			}
+		}
+	case int, float64:
+		n, _ := coerceNumber(v)
+		if s.Minimum != nil && n.(float64) < *s.Minimum {
+			return fail("must be >= %v", *s.Minimum)
+		}
+		if s.Maximum != nil && n.(float64) > *s.Maximum {
+			return fail("must be <= %v", *s.Maximum)
+		}
+	}
+	return coerced
+}
+
+// coerceObject validates an object, applying defaults for missing properties
+func (s *JSONSchema) coerceObject(path string, value interface{}, errs *ValidationErrors) interface{} {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		if decoded, isObject := decodeJSONString(value).(map[string]interface{}); isObject {
+			object, ok = decoded, true
+		}
+	}
+	if !ok {
+		*errs = append(*errs, ValidationError{Path: path, Message: fmt.Sprintf("expected object, got %s", jsonTypeName(value))})
+		return value
+	}
+
+	result := make(map[string]interface{}, len(object))
+	for _, name := range s.Required {
+		if v, exists := object[name]; !exists || v == nil {
+			if _, hasDefault := s.defaultFor(name); !hasDefault {
+				*errs = append(*errs, ValidationError{Path: joinPath(path, name), Message: "is required"})
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		v := object[key]
+		if v == nil {
+			continue
+		}
+		if property, declared := s.Properties[key]; declared {
+			result[key] = property.coerce(joinPath(path, key), v, errs)
+			continue
+		}
+		switch additional := s.additionalSchema(); {
+		case additional == nil && s.AdditionalProperties == false:
+			*errs = append(*errs, ValidationError{Path: joinPath(path, key), Message: "is not an allowed property"})
+		case additional != nil:
+			result[key] = additional.coerce(joinPath(path, key), v, errs)
+		default:
+			result[key] = v
+		}
+	}
+
+	for name := range s.Properties {
+		if _, present := result[name]; present {
+			continue
+		}
+		if def, hasDefault := s.defaultFor(name); hasDefault {
+			result[name] = def
+		}
+	}
+	return result
+}
+
+// coerceArray validates every item of an array
+func (s *JSONSchema) coerceArray(path string, value interface{}, errs *ValidationErrors) interface{} {
+	items, ok := value.([]interface{})
+	if !ok {
+		if decoded, isArray := decodeJSONString(value).([]interface{}); isArray {
+			items, ok = decoded, true
+		}
+	}
+	if !ok {
+		// Typed slices built in Go code, e.g. []string
+		rv := reflect.ValueOf(value)
+		if value != nil && rv.Kind() == reflect.Slice {
+			items = make([]interface{}, rv.Len())
+			for i := range items {
+				items[i] = rv.Index(i).Interface()
+			}
+			ok = true
+		}
+	}
+	if !ok {
+		*errs = append(*errs, ValidationError{Path: path, Message: fmt.Sprintf("expected array, got %s", jsonTypeName(value))})
+		return value
+	}
+
+	result := make([]interface{}, len(items))
+	for i, item := range items {
+		if s.Items == nil {
+			result[i] = item
+			continue
+		}
+		result[i] = s.Items.coerce(fmt.Sprintf("%s[%d]", path, i), item, errs)
+	}
+	return result
+}
+
+// defaultFor returns a copy of a property's default value
+func (s *JSONSchema) defaultFor(name string) (interface{}, bool) {
+	property, ok := s.Properties[name]
+	if !ok || property.Default == nil {
+		return nil, false
+	}
+	// Copy so handlers cannot modify the schema's default
+	data, err := json.Marshal(property.Default)
+	if err != nil {
+		return property.Default, true
+	}
+	var def interface{}
+	if err := json.Unmarshal(data, &def); err != nil {
+		return property.Default, true
+	}
+	if property.Type == SchemaTypeInteger {
+		if n, ok := coerceInteger(def); ok {
+			def = n
+		}
+	}
+	return def, true
+}
+
+// additionalSchema returns the schema unknown object keys must match, if any
+func (s *JSONSchema) additionalSchema() *JSONSchema {
+	if s.additional != nil {
+		return s.additional
+	}
+	switch additional := s.AdditionalProperties.(type) {
+	case *JSONSchema:
+		return additional
+	case map[string]interface{}:
+		// Schemas decoded from JSON
+		data, err := json.Marshal(additional)
+		if err != nil {
+			return nil
+		}
+		var schema JSONSchema
+		if err := json.Unmarshal(data, &schema); err != nil {
+			return nil
+		}
+		return &schema
+	}
+	return nil
+}
+
+func coerceString(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case int:
+		return strconv.Itoa(v), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return nil, false
+}
+
+func coerceInteger(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case int32:
+		return int(v), true
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return int(v), true
+		}
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return int(n), true
+		}
+	case string:
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+			return n, true
+		}
+	}
+	return nil, false
+}
+
+func coerceNumber(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case json.Number:
+		if n, err := v.Float64(); err == nil {
+			return n, true
+		}
+	case string:
+		if n, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+			return n, true
+		}
+	}
+	return nil, false
+}
+
+func coerceBoolean(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case bool:
+		return v, true
+	case string:
+		if b, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+			return b, true
+		}
+	}
+	return nil, false
+}
+
+// decodeJSONString decodes arguments that arrived as a JSON-encoded string
+func decodeJSONString(value interface{}) interface{} {
+	s, ok := value.(string)
+	if !ok {
+		return nil
+	}
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(s), &decoded); err != nil {
+		return nil
+	}
+	return decoded
+}
+
+// enumContains compares values by their JSON encoding so 1 matches 1.0
+func enumContains(enum []interface{}, value interface{}) bool {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range enum {
+		if reflect.DeepEqual(allowed, value) {
+			return true
+		}
+		if a, err := json.Marshal(allowed); err == nil && string(a) == string(encoded) {
+			return true
+		}
+	}
+	return false
+}
+
+func formatEnum(enum []interface{}) string {
+	values := make([]string, len(enum))
+	for i, v := range enum {
+		data, _ := json.Marshal(v)
+		values[i] = string(data)
+	}
+	return "[" + strings.Join(values, ", ") + "]"
+}
+
+// jsonTypeName names a value's JSON type for error messages
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64, float32, int, int64, int32, json.Number:
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
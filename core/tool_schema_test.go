@@ -0,0 +1,337 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func floatPtr(f float64) *float64 { return &f }
+func intPtr(n int) *int           { return &n }
+
+func TestValidateArgsCoercion(t *testing.T) {
+	schema := ObjectSchema(map[string]*JSONSchema{
+		"path":    {Type: SchemaTypeString},
+		"count":   {Type: SchemaTypeInteger, Default: 10},
+		"ratio":   {Type: SchemaTypeNumber},
+		"force":   {Type: SchemaTypeBoolean, Default: false},
+		"tags":    {Type: SchemaTypeArray, Items: &JSONSchema{Type: SchemaTypeString}},
+		"headers": {Type: SchemaTypeObject, AdditionalProperties: &JSONSchema{Type: SchemaTypeString}},
+		"any":     {},
+	}, "path")
+
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		want map[string]interface{}
+	}{
+		{
+			name: "defaults applied",
+			args: map[string]interface{}{"path": "a.txt"},
+			want: map[string]interface{}{"path": "a.txt", "count": 10, "force": false},
+		},
+		{
+			name: "strings to declared types",
+			args: map[string]interface{}{"path": "a.txt", "count": "42", "ratio": " 0.5 ", "force": "true"},
+			want: map[string]interface{}{"path": "a.txt", "count": 42, "ratio": 0.5, "force": true},
+		},
+		{
+			name: "numbers to strings and integers",
+			args: map[string]interface{}{"path": 7.0, "count": 3.0, "ratio": 2},
+			want: map[string]interface{}{"path": "7", "count": 3, "ratio": 2.0, "force": false},
+		},
+		{
+			name: "json encoded array and object",
+			args: map[string]interface{}{"path": "a", "tags": `["x", 1]`, "headers": `{"Accept": "json"}`},
+			want: map[string]interface{}{"path": "a", "count": 10, "force": false, "tags": []interface{}{"x", "1"}, "headers": map[string]interface{}{"Accept": "json"}},
+		},
+		{
+			name: "typed slice",
+			args: map[string]interface{}{"path": "a", "tags": []string{"x", "y"}},
+			want: map[string]interface{}{"path": "a", "count": 10, "force": false, "tags": []interface{}{"x", "y"}},
+		},
+		{
+			name: "untyped values and unknown keys pass through",
+			args: map[string]interface{}{"path": "a", "any": []interface{}{1.0}, "extra": true},
+			want: map[string]interface{}{"path": "a", "count": 10, "force": false, "any": []interface{}{1.0}, "extra": true},
+		},
+		{
+			name: "null uses the default",
+			args: map[string]interface{}{"path": "a", "count": nil},
+			want: map[string]interface{}{"path": "a", "count": 10, "force": false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := schema.ValidateArgs(tt.args)
+			if err != nil {
+				t.Fatalf("ValidateArgs: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ValidateArgs = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateArgsErrors(t *testing.T) {
+	schema := ObjectSchema(map[string]*JSONSchema{
+		"path":  {Type: SchemaTypeString, MinLength: intPtr(1), MaxLength: intPtr(5)},
+		"mode":  {Type: SchemaTypeString, Enum: []interface{}{"read", "write"}},
+		"level": {Type: SchemaTypeInteger, Enum: []interface{}{1, 2}},
+		"count": {Type: SchemaTypeInteger, Minimum: floatPtr(1), Maximum: floatPtr(10)},
+		"name":  {Type: SchemaTypeString, Pattern: "^[a-z]+$"},
+		"flag":  {Type: SchemaTypeBoolean},
+		"tags":  {Type: SchemaTypeArray, Items: &JSONSchema{Type: SchemaTypeInteger}},
+		"options": {
+			Type:                 SchemaTypeObject,
+			Properties:           map[string]*JSONSchema{"depth": {Type: SchemaTypeInteger}},
+			Required:             []string{"depth"},
+			AdditionalProperties: false,
+		},
+	}, "path")
+
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		want ValidationErrors
+	}{
+		{name: "missing required", args: map[string]interface{}{}, want: ValidationErrors{{Path: "path", Message: "is required"}}},
+		{name: "wrong type", args: map[string]interface{}{"path": []interface{}{}}, want: ValidationErrors{{Path: "path", Message: "expected string, got array"}}},
+		{name: "too short", args: map[string]interface{}{"path": ""}, want: ValidationErrors{{Path: "path", Message: "must be at least 1 characters"}}},
+		{name: "too long in runes", args: map[string]interface{}{"path": "ééééééé"}, want: ValidationErrors{{Path: "path", Message: "must be at most 5 characters"}}},
+		{name: "not in enum", args: map[string]interface{}{"path": "a", "mode": "exec"}, want: ValidationErrors{{Path: "mode", Message: `must be one of ["read", "write"]`}}},
+		{name: "integer enum matches coerced value", args: map[string]interface{}{"path": "a", "level": "3"}, want: ValidationErrors{{Path: "level", Message: "must be one of [1, 2]"}}},
+		{name: "below minimum", args: map[string]interface{}{"path": "a", "count": 0}, want: ValidationErrors{{Path: "count", Message: "must be >= 1"}}},
+		{name: "above maximum", args: map[string]interface{}{"path": "a", "count": "11"}, want: ValidationErrors{{Path: "count", Message: "must be <= 10"}}},
+		{name: "fractional integer", args: map[string]interface{}{"path": "a", "count": 1.5}, want: ValidationErrors{{Path: "count", Message: "expected integer, got number"}}},
+		{name: "pattern", args: map[string]interface{}{"path": "a", "name": "A1"}, want: ValidationErrors{{Path: "name", Message: "must match pattern ^[a-z]+$"}}},
+		{name: "boolean", args: map[string]interface{}{"path": "a", "flag": "maybe"}, want: ValidationErrors{{Path: "flag", Message: "expected boolean, got string"}}},
+		{name: "array item", args: map[string]interface{}{"path": "a", "tags": []interface{}{1, "x"}}, want: ValidationErrors{{Path: "tags[1]", Message: "expected integer, got string"}}},
+		{name: "not an array", args: map[string]interface{}{"path": "a", "tags": 1}, want: ValidationErrors{{Path: "tags", Message: "expected array, got number"}}},
+		{
+			name: "nested object",
+			args: map[string]interface{}{"path": "a", "options": map[string]interface{}{"extra": 1}},
+			want: ValidationErrors{{Path: "options.depth", Message: "is required"}, {Path: "options.extra", Message: "is not an allowed property"}},
+		},
+		{
+			name: "every error is reported",
+			args: map[string]interface{}{"mode": "exec", "count": 20},
+			want: ValidationErrors{{Path: "path", Message: "is required"}, {Path: "count", Message: "must be <= 10"}, {Path: "mode", Message: `must be one of ["read", "write"]`}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := schema.ValidateArgs(tt.args)
+			var got ValidationErrors
+			if !errors.As(err, &got) {
+				t.Fatalf("ValidateArgs = %v, want ValidationErrors", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("errors = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateArgsNilSchema(t *testing.T) {
+	var schema *JSONSchema
+	args, err := schema.ValidateArgs(nil)
+	if err != nil || args == nil {
+		t.Errorf("ValidateArgs(nil) = %v, %v, want empty arguments", args, err)
+	}
+}
+
+func TestValidateArgsCopiesDefaults(t *testing.T) {
+	schema := ObjectSchema(map[string]*JSONSchema{
+		"tags": {Type: SchemaTypeArray, Default: []interface{}{"a"}},
+	})
+	args, _ := schema.ValidateArgs(nil)
+	args["tags"].([]interface{})[0] = "changed"
+
+	args, _ = schema.ValidateArgs(nil)
+	if got := args["tags"].([]interface{})[0]; got != "a" {
+		t.Errorf("default = %v, want it unchanged by an earlier call", got)
+	}
+}
+
+func TestAdditionalPropertiesDecodedFromJSON(t *testing.T) {
+	var schema JSONSchema
+	data := `{"type": "object", "additionalProperties": {"type": "integer", "pattern": "("}}`
+	if err := json.Unmarshal([]byte(data), &schema); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if err := schema.Compile(); err == nil || !strings.HasPrefix(err.Error(), "*: invalid pattern") {
+		t.Errorf("Compile = %v, want the additional properties pattern reported", err)
+	}
+
+	schema.AdditionalProperties.(map[string]interface{})["pattern"] = ""
+	if err := schema.Compile(); err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	args, err := schema.ValidateArgs(map[string]interface{}{"n": "5"})
+	if err != nil || args["n"] != 5 {
+		t.Errorf("ValidateArgs = %v, %v, want n coerced to 5", args, err)
+	}
+}
+
+func TestCompileReportsInvalidPatterns(t *testing.T) {
+	tests := []struct {
+		name     string
+		schema   *JSONSchema
+		wantPath string
+	}{
+		{name: "nil schema", schema: nil},
+		{name: "valid", schema: ObjectSchema(map[string]*JSONSchema{"a": {Type: SchemaTypeString, Pattern: "^a$"}})},
+		{name: "top level", schema: &JSONSchema{Type: SchemaTypeString, Pattern: "("}, wantPath: "invalid pattern"},
+		{name: "property", schema: ObjectSchema(map[string]*JSONSchema{"a": {Pattern: "["}}), wantPath: "a: invalid pattern"},
+		{
+			name:     "array items",
+			schema:   ObjectSchema(map[string]*JSONSchema{"a": {Type: SchemaTypeArray, Items: &JSONSchema{Pattern: "*"}}}),
+			wantPath: "a[]: invalid pattern",
+		},
+		{
+			name:     "additional properties",
+			schema:   ObjectSchema(map[string]*JSONSchema{"a": {Type: SchemaTypeObject, AdditionalProperties: &JSONSchema{Pattern: "("}}}),
+			wantPath: "a.*: invalid pattern",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.schema.Compile()
+			if tt.wantPath == "" {
+				if err != nil {
+					t.Errorf("Compile = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantPath) {
+				t.Errorf("Compile = %v, want an error starting with %q", err, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestRegisterToolValidatesSchema(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  *JSONSchema
+		wantErr string
+	}{
+		{name: "no schema"},
+		{name: "object schema", schema: ObjectSchema(map[string]*JSONSchema{"path": {Type: SchemaTypeString}})},
+		{name: "not an object", schema: &JSONSchema{Type: SchemaTypeString}, wantErr: "parameters must be an object schema"},
+		{name: "invalid pattern", schema: ObjectSchema(map[string]*JSONSchema{"path": {Pattern: "("}}), wantErr: "parameters: path: invalid pattern"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tm, _ := NewToolManager(testLogger())
+			err := tm.RegisterTool(&Tool{Name: "read_file", Parameters: tt.schema})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("RegisterTool = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("RegisterTool = %v, want %q", err, tt.wantErr)
+			}
+			if _, exists := tm.GetTool("read_file"); exists {
+				t.Error("the tool was registered")
+			}
+		})
+	}
+}
+
+func TestExecuteToolValidatesArgs(t *testing.T) {
+	var received map[string]interface{}
+	tm, _ := NewToolManager(testLogger())
+	tm.RegisterTool(&Tool{
+		Name: "read_file",
+		Parameters: ObjectSchema(map[string]*JSONSchema{
+			"path":  {Type: SchemaTypeString},
+			"limit": {Type: SchemaTypeInteger, Default: 100},
+		}, "path"),
+		Handler: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+			received = args
+			return "ok", nil
+		},
+	})
+
+	tests := []struct {
+		name         string
+		args         map[string]interface{}
+		wantReceived map[string]interface{}
+		wantErrors   ValidationErrors
+	}{
+		{name: "coerced", args: map[string]interface{}{"path": "a.txt", "limit": "5"}, wantReceived: map[string]interface{}{"path": "a.txt", "limit": 5}},
+		{name: "default", args: map[string]interface{}{"path": "a.txt"}, wantReceived: map[string]interface{}{"path": "a.txt", "limit": 100}},
+		{name: "invalid", args: map[string]interface{}{"limit": "many"}, wantErrors: ValidationErrors{{Path: "path", Message: "is required"}, {Path: "limit", Message: "expected integer, got string"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received = nil
+			result, err := tm.ExecuteTool(context.Background(), &ToolCall{Name: "read_file", Args: tt.args})
+			if err != nil {
+				t.Fatalf("ExecuteTool: %v", err)
+			}
+			if !reflect.DeepEqual(received, tt.wantReceived) {
+				t.Errorf("handler received %v, want %v", received, tt.wantReceived)
+			}
+			if !reflect.DeepEqual(result.ValidationErrors, tt.wantErrors) {
+				t.Errorf("validation errors = %v, want %v", result.ValidationErrors, tt.wantErrors)
+			}
+			if (result.Error != "") != (tt.wantErrors != nil) || (tt.wantErrors != nil && result.Attempts != 0) {
+				t.Errorf("result = %+v", result)
+			}
+		})
+	}
+}
+
+func TestToolsEndpointServesSchema(t *testing.T) {
+	ws := newTestWebServer(t, startTestLoop(t, nil, nil))
+	tm, _ := NewToolManager(testLogger())
+	schema := ObjectSchema(map[string]*JSONSchema{
+		"path": {Type: SchemaTypeString, Description: "Path to the file to read"},
+		"mode": {Type: SchemaTypeString, Enum: []interface{}{"text", "binary"}, Default: "text"},
+	}, "path")
+	tm.RegisterTool(&Tool{Name: "read_file", Parameters: schema, Handler: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+		return args["mode"], nil
+	}})
+	ws.agent.ToolManager = tm
+
+	rec := serveTestRequest(ws, "GET", "/api/v1/tools", "")
+	var tools []struct {
+		Name       string          `json:"name"`
+		Parameters json.RawMessage `json:"parameters"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &tools); err != nil || len(tools) != 1 {
+		t.Fatalf("decode %s: %v", rec.Body.String(), err)
+	}
+	want, _ := json.Marshal(schema)
+	if string(tools[0].Parameters) != string(want) {
+		t.Errorf("parameters = %s, want %s", tools[0].Parameters, want)
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "valid", body: `{"parameters": {"path": "a.txt"}}`, wantStatus: http.StatusOK, wantBody: `"result":"text"`},
+		{name: "invalid", body: `{"parameters": {"mode": "hex"}}`, wantStatus: http.StatusBadRequest, wantBody: `"validation_errors":[{"path":"path","message":"is required"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveTestRequest(ws, "POST", "/api/v1/tools/read_file/execute", tt.body)
+			if rec.Code != tt.wantStatus || !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("status %d body %s, want %d containing %s", rec.Code, rec.Body.String(), tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+}
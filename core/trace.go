@@ -0,0 +1,177 @@
+package core
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TraceSpanKind identifies what a span describes
+type TraceSpanKind string
+
+const (
+	TraceSpanEvent    TraceSpanKind = "event"
+	TraceSpanMessage  TraceSpanKind = "message"
+	TraceSpanToolCall TraceSpanKind = "tool_call"
+)
+
+// TraceSpan records one processed event, routed message or executed tool call.
+// Spans sharing a CorrelationID belong to the same user request; CausationID is
+// the ID of the span that caused this one.
+type TraceSpan struct {
+	ID            string                 `json:"id"`
+	Kind          TraceSpanKind          `json:"kind"`
+	Name          string                 `json:"name"`
+	CorrelationID string                 `json:"correlation_id"`
+	CausationID   string                 `json:"causation_id,omitempty"`
+	Timestamp     time.Time              `json:"timestamp"`
+	Duration      time.Duration          `json:"duration"`
+	Error         string                 `json:"error,omitempty"`
+	Attributes    map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// TraceNode is a span together with the spans it caused
+type TraceNode struct {
+	*TraceSpan
+	Children []*TraceNode `json:"children,omitempty"`
+}
+
+// Trace is the causal tree of a single correlation ID
+type Trace struct {
+	CorrelationID string       `json:"correlation_id"`
+	Spans         int          `json:"spans"`
+	Roots         []*TraceNode `json:"roots"`
+}
+
+// TracerConfig holds tracer configuration
+type TracerConfig struct {
+	Capacity int `yaml:"capacity"` // correlation IDs kept before the oldest trace is evicted
+}
+
+const (
+	defaultTraceCapacity = 1000
+	// maxSpansPerTrace bounds a single runaway trace
+	maxSpansPerTrace = 1000
+)
+
+// Tracer keeps the spans of recent correlation IDs in memory
+type Tracer struct {
+	traces map[string][]*TraceSpan
+	order  []string // correlation IDs, oldest first
+	mutex  sync.RWMutex
+	logger *logrus.Logger
+	config *TracerConfig
+}
+
+// NewTracer creates a new tracer
+func NewTracer(logger *logrus.Logger, config *TracerConfig) *Tracer {
+	if logger == nil {
+		logger = logrus.New()
+	}
+	if config == nil {
+		config = &TracerConfig{}
+	}
+	if config.Capacity <= 0 {
+		config.Capacity = defaultTraceCapacity
+	}
+
+	return &Tracer{
+		traces: make(map[string][]*TraceSpan),
+		logger: logger,
+		config: config,
+	}
+}
+
+// Record stores a span; spans without a correlation ID are ignored.
+// A nil tracer is valid and records nothing.
+func (t *Tracer) Record(span *TraceSpan) {
+	if t == nil || span.CorrelationID == "" {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	spans, exists := t.traces[span.CorrelationID]
+	if !exists {
+		t.order = append(t.order, span.CorrelationID)
+		if len(t.order) > t.config.Capacity {
+			delete(t.traces, t.order[0])
+			t.order = t.order[1:]
+		}
+	}
+	if len(spans) >= maxSpansPerTrace {
+		t.logger.WithField("correlation_id", span.CorrelationID).Debug("Trace is full, dropping span")
+		return
+	}
+	t.traces[span.CorrelationID] = append(spans, span)
+}
+
+// Trace returns the causal tree for a correlation ID
+func (t *Tracer) Trace(correlationID string) (*Trace, bool) {
+	t.mutex.RLock()
+	spans, exists := t.traces[correlationID]
+	spans = append([]*TraceSpan(nil), spans...)
+	t.mutex.RUnlock()
+
+	if !exists {
+		return nil, false
+	}
+
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].Timestamp.Before(spans[j].Timestamp)
+	})
+
+	// A requeued event is recorded once per delivery, children attach to the first
+	nodes := make([]*TraceNode, len(spans))
+	byID := make(map[string]*TraceNode, len(spans))
+	for i, span := range spans {
+		nodes[i] = &TraceNode{TraceSpan: span}
+		if _, ok := byID[span.ID]; !ok {
+			byID[span.ID] = nodes[i]
+		}
+	}
+
+	trace := &Trace{CorrelationID: correlationID, Spans: len(spans)}
+	for _, node := range nodes {
+		if parent, ok := byID[node.CausationID]; ok && parent != node {
+			parent.Children = append(parent.Children, node)
+		} else {
+			// The cause was never recorded (or evicted), show the span at the top level
+			trace.Roots = append(trace.Roots, node)
+		}
+	}
+	return trace, true
+}
+
+// Len returns the number of traces held
+func (t *Tracer) Len() int {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return len(t.traces)
+}
+
+type traceContextKey struct{}
+
+type traceContext struct {
+	correlationID string
+	causationID   string
+}
+
+// ContextWithTrace returns a context carrying the correlation ID and the ID of the
+// event or message being handled, so work started from it can be linked back
+func ContextWithTrace(ctx context.Context, correlationID, causationID string) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, traceContext{
+		correlationID: correlationID,
+		causationID:   causationID,
+	})
+}
+
+// TraceFromContext returns the correlation and causation IDs stored by ContextWithTrace
+func TraceFromContext(ctx context.Context) (correlationID, causationID string) {
+	tc, _ := ctx.Value(traceContextKey{}).(traceContext)
+	return tc.correlationID, tc.causationID
+}
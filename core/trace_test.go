@@ -0,0 +1,386 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGenerateMessageIDIsSortableAndUnique(t *testing.T) {
+	const n = 10000
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = GenerateMessageID()
+	}
+
+	seen := make(map[string]bool, n)
+	for i, id := range ids {
+		if len(id) != 26 {
+			t.Fatalf("ID %q has %d characters, want 26", id, len(id))
+		}
+		if seen[id] {
+			t.Fatalf("duplicate ID %q", id)
+		}
+		seen[id] = true
+		if i > 0 && id <= ids[i-1] {
+			t.Fatalf("ID %q does not sort after %q", id, ids[i-1])
+		}
+	}
+}
+
+func TestGenerateMessageIDConcurrent(t *testing.T) {
+	const goroutines, perGoroutine = 8, 1000
+	var mu sync.Mutex
+	seen := make(map[string]bool, goroutines*perGoroutine)
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perGoroutine; i++ {
+				id := GenerateMessageID()
+				mu.Lock()
+				if seen[id] {
+					t.Errorf("duplicate ID %q", id)
+				}
+				seen[id] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestGenerateMessageIDEncodesTime(t *testing.T) {
+	before := time.Now().UnixMilli()
+	id := GenerateMessageID()
+
+	// The first 10 characters hold the 48 bit millisecond timestamp
+	var ms int64
+	for _, c := range id[:10] {
+		ms = ms<<5 | int64(indexOfCrockford(t, c))
+	}
+	if ms < before || ms > time.Now().UnixMilli()+1 {
+		t.Errorf("ID %s encodes %d ms, want about %d", id, ms, before)
+	}
+}
+
+// failingReader is an entropy source that always fails
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) {
+	return 0, errors.New("entropy unavailable")
+}
+
+func TestGenerateMessageIDWithoutEntropy(t *testing.T) {
+	idGenerator.Lock()
+	idGenerator.source = failingReader{}
+	idGenerator.Unlock()
+	defer func() {
+		idGenerator.Lock()
+		idGenerator.source = nil
+		idGenerator.Unlock()
+	}()
+
+	ids := make([]string, 0, 5)
+	for i := 0; i < 5; i++ {
+		ids = append(ids, GenerateMessageID())
+		// Move to the next millisecond so the entropy source is consulted
+		time.Sleep(2 * time.Millisecond)
+	}
+	for i := 1; i < len(ids); i++ {
+		// The random part is counted up instead of drawn from a predictable source
+		if ids[i][10:] <= ids[i-1][10:] {
+			t.Errorf("random part of %s does not follow %s", ids[i], ids[i-1])
+		}
+	}
+}
+
+func indexOfCrockford(t *testing.T, c rune) int {
+	t.Helper()
+	for i, a := range crockfordAlphabet {
+		if a == c {
+			return i
+		}
+	}
+	t.Fatalf("%q is not in the Crockford alphabet", c)
+	return 0
+}
+
+func TestIncrementEntropy(t *testing.T) {
+	tests := []struct {
+		name         string
+		in           [10]byte
+		want         [10]byte
+		wantOverflow bool
+	}{
+		{name: "simple", in: [10]byte{9: 1}, want: [10]byte{9: 2}},
+		{name: "carry", in: [10]byte{8: 1, 9: 0xFF}, want: [10]byte{8: 2, 9: 0}},
+		{
+			name:         "overflow",
+			in:           [10]byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF},
+			want:         [10]byte{},
+			wantOverflow: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entropy := tt.in
+			if overflow := incrementEntropy(&entropy); overflow != tt.wantOverflow {
+				t.Errorf("overflow = %v, want %v", overflow, tt.wantOverflow)
+			}
+			if entropy != tt.want {
+				t.Errorf("entropy = %v, want %v", entropy, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeULID(t *testing.T) {
+	tests := []struct {
+		name string
+		id   [16]byte
+		want string
+	}{
+		{name: "zero", id: [16]byte{}, want: "00000000000000000000000000"},
+		{name: "max", id: [16]byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, want: "7ZZZZZZZZZZZZZZZZZZZZZZZZZ"},
+		{name: "lowest bit", id: [16]byte{15: 1}, want: "00000000000000000000000001"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := encodeULID(tt.id); got != tt.want {
+				t.Errorf("encodeULID = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// traceShape renders a trace tree as "id[child child]" strings for comparison
+func traceShape(nodes []*TraceNode) []string {
+	shape := make([]string, len(nodes))
+	for i, node := range nodes {
+		shape[i] = node.ID
+		if len(node.Children) > 0 {
+			shape[i] += fmt.Sprint(traceShape(node.Children))
+		}
+	}
+	return shape
+}
+
+func TestTracerTrace(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	span := func(id, cause string, offset int) *TraceSpan {
+		return &TraceSpan{ID: id, CausationID: cause, CorrelationID: "req", Timestamp: base.Add(time.Duration(offset) * time.Millisecond)}
+	}
+
+	tests := []struct {
+		name  string
+		spans []*TraceSpan
+		want  []string
+	}{
+		{
+			name:  "chain",
+			spans: []*TraceSpan{span("event", "", 0), span("message", "event", 1), span("tool", "message", 2)},
+			want:  []string{"event[message[tool]]"},
+		},
+		{
+			name:  "recorded out of order",
+			spans: []*TraceSpan{span("tool", "message", 2), span("message", "event", 1), span("event", "", 0)},
+			want:  []string{"event[message[tool]]"},
+		},
+		{
+			name:  "siblings in time order",
+			spans: []*TraceSpan{span("event", "", 0), span("b", "event", 2), span("a", "event", 1)},
+			want:  []string{"event[a b]"},
+		},
+		{
+			name:  "missing cause becomes a root",
+			spans: []*TraceSpan{span("event", "", 0), span("orphan", "evicted", 1)},
+			want:  []string{"event", "orphan"},
+		},
+		{
+			name:  "redelivered event keeps children on the first span",
+			spans: []*TraceSpan{span("event", "", 0), span("event", "", 2), span("message", "event", 1)},
+			want:  []string{"event[message]", "event"},
+		},
+		{
+			name:  "span caused by itself",
+			spans: []*TraceSpan{span("loop", "loop", 0)},
+			want:  []string{"loop"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracer := NewTracer(testLogger(), nil)
+			for _, s := range tt.spans {
+				tracer.Record(s)
+			}
+			trace, ok := tracer.Trace("req")
+			if !ok {
+				t.Fatal("trace not found")
+			}
+			if trace.Spans != len(tt.spans) {
+				t.Errorf("Spans = %d, want %d", trace.Spans, len(tt.spans))
+			}
+			if got := traceShape(trace.Roots); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tree = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTracerBounds(t *testing.T) {
+	tracer := NewTracer(testLogger(), &TracerConfig{Capacity: 2})
+	for _, id := range []string{"a", "b", "c"} {
+		tracer.Record(&TraceSpan{ID: id, CorrelationID: id})
+	}
+	tracer.Record(&TraceSpan{ID: "uncorrelated"})
+
+	if tracer.Len() != 2 {
+		t.Errorf("Len = %d, want 2", tracer.Len())
+	}
+	if _, ok := tracer.Trace("a"); ok {
+		t.Error("the oldest trace was not evicted")
+	}
+
+	for i := 0; i < maxSpansPerTrace+10; i++ {
+		tracer.Record(&TraceSpan{ID: fmt.Sprint(i), CorrelationID: "c"})
+	}
+	if trace, _ := tracer.Trace("c"); trace.Spans != maxSpansPerTrace {
+		t.Errorf("Spans = %d, want the cap %d", trace.Spans, maxSpansPerTrace)
+	}
+
+	var nilTracer *Tracer
+	nilTracer.Record(&TraceSpan{ID: "x", CorrelationID: "x"})
+}
+
+func TestTraceContext(t *testing.T) {
+	if correlation, causation := TraceFromContext(context.Background()); correlation != "" || causation != "" {
+		t.Errorf("empty context = %q, %q", correlation, causation)
+	}
+	ctx := ContextWithTrace(context.Background(), "req", "cause")
+	if correlation, causation := TraceFromContext(ctx); correlation != "req" || causation != "cause" {
+		t.Errorf("TraceFromContext = %q, %q", correlation, causation)
+	}
+}
+
+func TestTracePropagatesAcrossEventsMessagesAndToolCalls(t *testing.T) {
+	tracer := NewTracer(testLogger(), nil)
+
+	tools, _ := NewToolManager(testLogger())
+	tools.SetTracer(tracer)
+	tools.RegisterTool(&Tool{Name: "lookup", Handler: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+		return "found", nil
+	}})
+
+	router := NewMessageRouter()
+	router.SetTracer(tracer)
+	router.RegisterHandler(&funcMessageHandler{handle: func(ctx context.Context, msg *Message) error {
+		_, err := tools.ExecuteTool(ctx, &ToolCall{Name: "lookup"})
+		return err
+	}})
+
+	el := startTestLoop(t, nil, nil)
+	el.SetTracer(tracer)
+	done := make(chan struct{})
+	el.RegisterHandler(&funcEventHandler{handle: func(ctx context.Context, event *Event) error {
+		defer close(done)
+		return router.Route(ctx, &Message{ID: "msg-1", Type: MessageTypeUserInput})
+	}})
+
+	event := &Event{ID: "ev-1", Type: EventTypeMessage}
+	if err := el.Emit(event); err != nil {
+		t.Fatalf("Emit: %v", err)
+	}
+	<-done
+	waitFor(t, time.Second, "event span", func() bool {
+		trace, ok := tracer.Trace("ev-1")
+		return ok && trace.Spans == 3
+	})
+
+	trace, _ := tracer.Trace(event.CorrelationID)
+	if len(trace.Roots) != 1 || len(trace.Roots[0].Children) != 1 || len(trace.Roots[0].Children[0].Children) != 1 {
+		t.Fatalf("tree = %v, want event -> message -> tool call", traceShape(trace.Roots))
+	}
+	eventSpan := trace.Roots[0]
+	messageSpan := eventSpan.Children[0]
+	toolSpan := messageSpan.Children[0]
+	want := []struct {
+		span  *TraceNode
+		kind  TraceSpanKind
+		cause string
+	}{
+		{eventSpan, TraceSpanEvent, ""},
+		{messageSpan, TraceSpanMessage, "ev-1"},
+		{toolSpan, TraceSpanToolCall, "msg-1"},
+	}
+	for _, w := range want {
+		if w.span.Kind != w.kind || w.span.CausationID != w.cause || w.span.CorrelationID != "ev-1" {
+			t.Errorf("span = %+v, want kind %s caused by %q", w.span.TraceSpan, w.kind, w.cause)
+		}
+	}
+}
+
+func TestExecuteToolStartsNewTrace(t *testing.T) {
+	tracer := NewTracer(testLogger(), nil)
+	tools, _ := NewToolManager(testLogger())
+	tools.SetTracer(tracer)
+	tools.RegisterTool(&Tool{Name: "noop", Handler: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+		correlation, causation := TraceFromContext(ctx)
+		return []string{correlation, causation}, nil
+	}})
+
+	call := &ToolCall{Name: "noop"}
+	result, _ := tools.ExecuteTool(context.Background(), call)
+	if call.CorrelationID != call.ID || call.CausationID != "" || result.CorrelationID != call.ID {
+		t.Errorf("call = %+v, result correlation %q", call, result.CorrelationID)
+	}
+	if got := result.Result; !reflect.DeepEqual(got, []string{call.ID, call.ID}) {
+		t.Errorf("handler context trace = %v, want the call as correlation and cause", got)
+	}
+}
+
+func TestTraceEndpoint(t *testing.T) {
+	tracer := NewTracer(testLogger(), nil)
+	tracer.Record(&TraceSpan{ID: "ev-1", Kind: TraceSpanEvent, CorrelationID: "ev-1"})
+	tracer.Record(&TraceSpan{ID: "msg-1", Kind: TraceSpanMessage, CorrelationID: "ev-1", CausationID: "ev-1"})
+
+	tests := []struct {
+		name       string
+		tracer     *Tracer
+		id         string
+		wantStatus int
+	}{
+		{name: "found", tracer: tracer, id: "ev-1", wantStatus: http.StatusOK},
+		{name: "not found", tracer: tracer, id: "missing", wantStatus: http.StatusNotFound},
+		{name: "no tracer", id: "ev-1", wantStatus: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := newTestWebServer(t, startTestLoop(t, nil, nil))
+			ws.agent.tracer = tt.tracer
+
+			rec := serveTestRequest(ws, "GET", "/api/v1/traces/"+tt.id, "")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var trace Trace
+			if err := json.Unmarshal(rec.Body.Bytes(), &trace); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if trace.Spans != 2 || len(trace.Roots) != 1 || len(trace.Roots[0].Children) != 1 {
+				t.Errorf("trace = %s", rec.Body)
+			}
+		})
+	}
+}
@@ -2,21 +2,90 @@ package core
 
 import (
 	"crypto/rand"
-	"encoding/hex"
+	"io"
+	"sync"
 	"time"
 )
 
-// GenerateMessageID 生成唯一的消息ID
+// crockfordAlphabet ULID使用的Crockford Base32字母表
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// idGenerator 保存上一次生成ID的时间和随机部分，用于保证同一毫秒内的单调性
+var idGenerator struct {
+	sync.Mutex
+	lastMs  uint64
+	entropy [10]byte
+	source  io.Reader // 随机部分的来源，为nil时使用crypto/rand
+}
+
+// GenerateMessageID 生成唯一ID，格式与ULID相同：48位毫秒时间戳加80位随机数，
+// 按字典序排序即按生成时间排序。同一毫秒内生成的ID随机部分递增，保证单调且不重复。
+// 事件、消息、工具调用等所有ID都使用该函数生成。
 func GenerateMessageID() string {
-	bytes := make([]byte, 16)
-	if _, err := rand.Read(bytes); err != nil {
-		// 如果随机数生成失败，使用时间戳作为后备
-		return time.Now().Format("20060102150405.999999999")
+	now := uint64(time.Now().UnixMilli())
+
+	idGenerator.Lock()
+	if now <= idGenerator.lastMs {
+		// 同一毫秒内或时钟回拨，沿用上一次的时间戳并递增随机部分
+		now = idGenerator.lastMs
+		if incrementEntropy(&idGenerator.entropy) {
+			now++
+		}
+	} else {
+		source := idGenerator.source
+		if source == nil {
+			source = rand.Reader
+		}
+		var entropy [10]byte
+		if _, err := io.ReadFull(source, entropy[:]); err == nil {
+			idGenerator.entropy = entropy
+		} else {
+			// 不改用可预测的伪随机数：沿用上一次的随机部分作为计数器递增。
+			// 时间戳已经前进，ID仍然唯一且单调，只是随机部分不再不可预测
+			incrementEntropy(&idGenerator.entropy)
+		}
 	}
-	return hex.EncodeToString(bytes)
+	idGenerator.lastMs = now
+	entropy := idGenerator.entropy
+	idGenerator.Unlock()
+
+	var id [16]byte
+	for i := 0; i < 6; i++ {
+		id[i] = byte(now >> (40 - 8*i))
+	}
+	copy(id[6:], entropy[:])
+	return encodeULID(id)
+}
+
+// incrementEntropy 将随机部分加一，溢出时返回true
+func incrementEntropy(entropy *[10]byte) bool {
+	for i := len(entropy) - 1; i >= 0; i-- {
+		entropy[i]++
+		if entropy[i] != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// encodeULID 将128位ID编码为26个字符，最高的2位作为填充位
+func encodeULID(id [16]byte) string {
+	var out [26]byte
+	for i := range out {
+		var v byte
+		for b := 0; b < 5; b++ {
+			v <<= 1
+			p := i*5 + b - 2
+			if p >= 0 {
+				v |= (id[p/8] >> (7 - p%8)) & 1
+			}
+		}
+		out[i] = crockfordAlphabet[v]
+	}
+	return string(out[:])
 }
 
 // GetCurrentTimestamp 获取当前时间戳（Unix纳秒）
 func GetCurrentTimestamp() int64 {
 	return time.Now().UnixNano()
-}
\ No newline at end of file
+}
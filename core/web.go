@@ -3,11 +3,17 @@ package core
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
 	"github.com/sirupsen/logrus"
 )
 
@@ -18,6 +24,7 @@ type WebServer struct {
 	agent    *Agent
 	logger   *logrus.Logger
 	shutdown chan struct{}
+	hub      *wsHub
 }
 
 // WebConfig represents web server configuration
@@ -42,6 +49,7 @@ func NewWebServer(agent *Agent, config *WebConfig) (*WebServer, error) {
 		logger:   agent.logger,
 		shutdown: make(chan struct{}),
 	}
+	ws.hub = newWSHub(ws)
 
 	// Setup routes
 	ws.setupRoutes()
@@ -66,6 +74,30 @@ func (ws *WebServer) setupRoutes() {
 	// Events
 	api.HandleFunc("/events", ws.postEvent).Methods("POST")
 	api.HandleFunc("/events", ws.getEvents).Methods("GET")
+	api.HandleFunc("/events/delayed", ws.getDelayedEvents).Methods("GET")
+	api.HandleFunc("/events/delayed/{id}", ws.cancelDelayedEvent).Methods("DELETE")
+	
+	// Dead letters
+	api.HandleFunc("/deadletters", ws.getDeadLetters).Methods("GET")
+	api.HandleFunc("/deadletters", ws.purgeDeadLetters).Methods("DELETE")
+	api.HandleFunc("/deadletters/{id}", ws.getDeadLetter).Methods("GET")
+	api.HandleFunc("/deadletters/{id}", ws.deleteDeadLetter).Methods("DELETE")
+	api.HandleFunc("/deadletters/{id}/requeue", ws.requeueDeadLetter).Methods("POST")
+	
+	// Traces
+	api.HandleFunc("/traces/{correlation_id}", ws.getTrace).Methods("GET")
+	
+	// Message handler metrics
+	api.HandleFunc("/messages/metrics", ws.getMessageMetrics).Methods("GET")
+	
+	// Registered handlers
+	api.HandleFunc("/handlers", ws.getHandlers).Methods("GET")
+	
+	// Schedules
+	api.HandleFunc("/schedules", ws.getSchedules).Methods("GET")
+	api.HandleFunc("/schedules", ws.postSchedule).Methods("POST")
+	api.HandleFunc("/schedules/{id}", ws.getSchedule).Methods("GET")
+	api.HandleFunc("/schedules/{id}", ws.deleteSchedule).Methods("DELETE")
 	
 	// Memory
 	api.HandleFunc("/memory/short", ws.getShortTermMemory).Methods("GET")
@@ -76,9 +108,16 @@ func (ws *WebServer) setupRoutes() {
 	// Tools
 	api.HandleFunc("/tools", ws.getTools).Methods("GET")
 	api.HandleFunc("/tools/{name}/execute", ws.executeTool).Methods("POST")
+	api.HandleFunc("/tool-calls", ws.getToolCalls).Methods("GET")
+	api.HandleFunc("/tool-calls", ws.postToolCalls).Methods("POST")
+	api.HandleFunc("/tool-calls/{id}", ws.deleteToolCall).Methods("DELETE")
 	
 	// Health check
 	ws.router.HandleFunc("/health", ws.healthCheck).Methods("GET")
+
+	// Dashboard status and live updates
+	ws.router.HandleFunc("/api/status", ws.getStatus).Methods("GET")
+	ws.router.HandleFunc("/ws", ws.serveWebSocket)
 	
 	// Static files for web UI
 	ws.router.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("./web/static/"))))
@@ -93,6 +132,9 @@ func (ws *WebServer) setupRoutes() {
 // Start starts the web server
 func (ws *WebServer) Start(ctx context.Context) error {
 	ws.logger.Infof("Starting web server on %s", ws.server.Addr)
+
+	ws.hub.attach()
+	go ws.hub.runStatusUpdates(ctx, wsStatusInterval)
 	
 	go func() {
 		if err := ws.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -106,6 +148,7 @@ func (ws *WebServer) Start(ctx context.Context) error {
 // Stop gracefully stops the web server
 func (ws *WebServer) Stop() error {
 	ws.logger.Info("Stopping web server")
+	ws.hub.closeAll()
 	
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -136,17 +179,25 @@ func (ws *WebServer) getAgentInfo(w http.ResponseWriter, r *http.Request) {
 		Version:     ws.agent.config.Agent.Version,
 		Description: ws.agent.config.Agent.Description,
 		Workspace:   ws.agent.config.Agent.Workspace,
-		Uptime:      time.Now(), // TODO: Track actual uptime
+		Uptime:      ws.agent.startedAt,
 		Status:      "running",
 	}
 	
 	ws.writeJSON(w, resp, http.StatusOK)
 }
 
+// eventRetryAfterSeconds is sent as Retry-After when the event queue is saturated
+const eventRetryAfterSeconds = 1
+
 type eventRequest struct {
-	Type     string      `json:"type"`
-	Data     interface{} `json:"data"`
-	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	Type      string      `json:"type"`
+	Data      interface{} `json:"data"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	Priority  EventPriority          `json:"priority,omitempty"`
+	DeliverAt *time.Time             `json:"deliver_at,omitempty"` // RFC3339, the event is held until then
+
+	CorrelationID string `json:"correlation_id,omitempty"` // links the event to an existing request
+	CausationID   string `json:"causation_id,omitempty"`
 }
 
 type eventResponse struct {
@@ -155,6 +206,10 @@ type eventResponse struct {
 	Timestamp time.Time              `json:"timestamp"`
 	Data      interface{}            `json:"data"`
 	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	DeliverAt *time.Time             `json:"deliver_at,omitempty"`
+
+	CorrelationID string `json:"correlation_id"`
+	CausationID   string `json:"causation_id,omitempty"`
 }
 
 func (ws *WebServer) postEvent(w http.ResponseWriter, r *http.Request) {
@@ -166,14 +221,26 @@ func (ws *WebServer) postEvent(w http.ResponseWriter, r *http.Request) {
 	
 	// Create event and emit to event loop
 	event := &Event{
-		ID:        generateID(),
+		ID:        GenerateMessageID(),
 		Type:      EventType(req.Type),
 		Timestamp: time.Now(),
 		Data:      req.Data,
 		Metadata:  req.Metadata,
+		Priority:  req.Priority,
+		NotBefore: req.DeliverAt,
+
+		CorrelationID: req.CorrelationID,
+		CausationID:   req.CausationID,
 	}
 	
 	if err := ws.agent.eventLoop.Emit(event); err != nil {
+		if errors.Is(err, ErrEventQueueFull) || errors.Is(err, ErrEmitTimeout) {
+			// Tell producers to back off instead of dropping the event
+			ws.logger.WithError(err).Warn("Event queue saturated")
+			w.Header().Set("Retry-After", strconv.Itoa(eventRetryAfterSeconds))
+			http.Error(w, "Event queue is full", http.StatusTooManyRequests)
+			return
+		}
 		ws.logger.WithError(err).Error("Failed to emit event")
 		http.Error(w, "Failed to process event", http.StatusInternalServerError)
 		return
@@ -185,16 +252,345 @@ func (ws *WebServer) postEvent(w http.ResponseWriter, r *http.Request) {
 		Timestamp: event.Timestamp,
 		Data:      event.Data,
 		Metadata:  event.Metadata,
+		DeliverAt: event.NotBefore,
+
+		CorrelationID: event.CorrelationID,
+		CausationID:   event.CausationID,
 	}
 	
 	ws.writeJSON(w, resp, http.StatusCreated)
 }
 
+// getEvents returns processed events, newest first.
+// Supported query parameters: type (repeatable or comma separated), since, until (RFC3339),
+// metadata_key, metadata_value, cursor and limit.
 func (ws *WebServer) getEvents(w http.ResponseWriter, r *http.Request) {
-	// TODO: Implement event history retrieval
-	// For now, return empty array
-	resp := []eventResponse{}
-	ws.writeJSON(w, resp, http.StatusOK)
+	var history *EventHistory
+	if ws.agent.eventLoop != nil {
+		history = ws.agent.eventLoop.History()
+	}
+	if history == nil {
+		http.Error(w, "Event history not available", http.StatusInternalServerError)
+		return
+	}
+
+	query, err := parseEventHistoryQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := history.Query(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ws.writeJSON(w, page, http.StatusOK)
+}
+
+// parseEventHistoryQuery builds a history query from the request's query string
+func parseEventHistoryQuery(r *http.Request) (EventHistoryQuery, error) {
+	params := r.URL.Query()
+	query := EventHistoryQuery{
+		MetadataKey:   params.Get("metadata_key"),
+		MetadataValue: params.Get("metadata_value"),
+		Cursor:        params.Get("cursor"),
+	}
+
+	for _, value := range params["type"] {
+		for _, t := range strings.Split(value, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				query.Types = append(query.Types, EventType(t))
+			}
+		}
+	}
+
+	if since := params.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return query, fmt.Errorf("invalid since: %s", since)
+		}
+		query.Since = t
+	}
+
+	if until := params.Get("until"); until != "" {
+		t, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			return query, fmt.Errorf("invalid until: %s", until)
+		}
+		query.Until = t
+	}
+
+	if limit := params.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			return query, fmt.Errorf("invalid limit: %s", limit)
+		}
+		query.Limit = n
+	}
+
+	return query, nil
+}
+
+// getDelayedEvents returns events waiting for their deliver_at time, soonest first
+// requireEventLoop returns the agent's event loop, writing 503 if it is not running one
+func (ws *WebServer) requireEventLoop(w http.ResponseWriter) *EventLoop {
+	el := ws.agent.eventLoop
+	if el == nil {
+		http.Error(w, "Event loop not available", http.StatusServiceUnavailable)
+	}
+	return el
+}
+
+func (ws *WebServer) getDelayedEvents(w http.ResponseWriter, r *http.Request) {
+	el := ws.requireEventLoop(w)
+	if el == nil {
+		return
+	}
+	ws.writeJSON(w, el.DelayedEvents(), http.StatusOK)
+}
+
+func (ws *WebServer) cancelDelayedEvent(w http.ResponseWriter, r *http.Request) {
+	el := ws.requireEventLoop(w)
+	if el == nil {
+		return
+	}
+	err := el.CancelDelayed(mux.Vars(r)["id"])
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, ErrDelayedEventNotFound):
+		http.Error(w, "Delayed event not found", http.StatusNotFound)
+	default:
+		ws.logger.WithError(err).Error("Failed to cancel delayed event")
+		http.Error(w, "Failed to cancel delayed event", http.StatusInternalServerError)
+	}
+}
+
+// deadLetterStore returns the event loop's dead letter store, writing an error if unavailable
+func (ws *WebServer) deadLetterStore(w http.ResponseWriter) *DeadLetterStore {
+	var store *DeadLetterStore
+	if ws.agent.eventLoop != nil {
+		store = ws.agent.eventLoop.DeadLetters()
+	}
+	if store == nil {
+		http.Error(w, "Dead letter store not available", http.StatusInternalServerError)
+	}
+	return store
+}
+
+func (ws *WebServer) getDeadLetters(w http.ResponseWriter, r *http.Request) {
+	store := ws.deadLetterStore(w)
+	if store == nil {
+		return
+	}
+	ws.writeJSON(w, store.List(), http.StatusOK)
+}
+
+func (ws *WebServer) getDeadLetter(w http.ResponseWriter, r *http.Request) {
+	store := ws.deadLetterStore(w)
+	if store == nil {
+		return
+	}
+
+	letter, ok := store.Get(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Dead letter not found", http.StatusNotFound)
+		return
+	}
+	ws.writeJSON(w, letter, http.StatusOK)
+}
+
+func (ws *WebServer) requeueDeadLetter(w http.ResponseWriter, r *http.Request) {
+	if ws.deadLetterStore(w) == nil {
+		return
+	}
+
+	err := ws.agent.eventLoop.RequeueDeadLetter(mux.Vars(r)["id"])
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusAccepted)
+	case errors.Is(err, ErrDeadLetterNotFound):
+		http.Error(w, "Dead letter not found", http.StatusNotFound)
+	case errors.Is(err, ErrEventQueueFull) || errors.Is(err, ErrEmitTimeout):
+		w.Header().Set("Retry-After", strconv.Itoa(eventRetryAfterSeconds))
+		http.Error(w, "Event queue is full", http.StatusTooManyRequests)
+	default:
+		ws.logger.WithError(err).Error("Failed to requeue dead letter")
+		http.Error(w, "Failed to requeue dead letter", http.StatusInternalServerError)
+	}
+}
+
+func (ws *WebServer) deleteDeadLetter(w http.ResponseWriter, r *http.Request) {
+	store := ws.deadLetterStore(w)
+	if store == nil {
+		return
+	}
+
+	removed, err := store.Remove(mux.Vars(r)["id"])
+	if err != nil {
+		ws.logger.WithError(err).Error("Failed to delete dead letter")
+		http.Error(w, "Failed to delete dead letter", http.StatusInternalServerError)
+		return
+	}
+	if !removed {
+		http.Error(w, "Dead letter not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (ws *WebServer) purgeDeadLetters(w http.ResponseWriter, r *http.Request) {
+	store := ws.deadLetterStore(w)
+	if store == nil {
+		return
+	}
+
+	n, err := store.Purge()
+	if err != nil {
+		ws.logger.WithError(err).Error("Failed to purge dead letters")
+		http.Error(w, "Failed to purge dead letters", http.StatusInternalServerError)
+		return
+	}
+	ws.writeJSON(w, map[string]int{"purged": n}, http.StatusOK)
+}
+
+// getTrace returns the causal tree of events, messages and tool calls for one request
+func (ws *WebServer) getTrace(w http.ResponseWriter, r *http.Request) {
+	tracer := ws.agent.Tracer()
+	if tracer == nil {
+		http.Error(w, "Tracer not available", http.StatusInternalServerError)
+		return
+	}
+
+	trace, ok := tracer.Trace(mux.Vars(r)["correlation_id"])
+	if !ok {
+		http.Error(w, "Trace not found", http.StatusNotFound)
+		return
+	}
+	ws.writeJSON(w, trace, http.StatusOK)
+}
+
+// getMessageMetrics returns latency histograms per message type and handler
+func (ws *WebServer) getMessageMetrics(w http.ResponseWriter, r *http.Request) {
+	metrics := ws.agent.MessageMetrics()
+	if metrics == nil {
+		http.Error(w, "Message metrics not available", http.StatusInternalServerError)
+		return
+	}
+	ws.writeJSON(w, metrics.Snapshot(), http.StatusOK)
+}
+
+type handlersResponse struct {
+	MessageHandlers []HandlerInfo `json:"message_handlers"`
+	EventHandlers   []HandlerInfo `json:"event_handlers"`
+}
+
+// getHandlers lists registered message and event handlers with their invocation stats
+func (ws *WebServer) getHandlers(w http.ResponseWriter, r *http.Request) {
+	response := handlersResponse{
+		MessageHandlers: []HandlerInfo{},
+		EventHandlers:   []HandlerInfo{},
+	}
+	if ws.agent.messageRouter != nil {
+		response.MessageHandlers = ws.agent.messageRouter.Handlers()
+	}
+	if ws.agent.eventLoop != nil {
+		response.EventHandlers = ws.agent.eventLoop.Handlers()
+	}
+	ws.writeJSON(w, response, http.StatusOK)
+}
+
+type scheduleRequest struct {
+	ID       string                 `json:"id"`
+	Name     string                 `json:"name"`
+	Spec     string                 `json:"spec"`
+	Payload  interface{}            `json:"payload"`
+	Metadata map[string]interface{} `json:"metadata"`
+	CatchUp  string                 `json:"catch_up"`
+}
+
+// scheduler returns the agent's scheduler, writing an error if unavailable
+func (ws *WebServer) scheduler(w http.ResponseWriter) *Scheduler {
+	scheduler := ws.agent.Scheduler()
+	if scheduler == nil {
+		http.Error(w, "Scheduler not available", http.StatusInternalServerError)
+	}
+	return scheduler
+}
+
+func (ws *WebServer) getSchedules(w http.ResponseWriter, r *http.Request) {
+	scheduler := ws.scheduler(w)
+	if scheduler == nil {
+		return
+	}
+	ws.writeJSON(w, scheduler.ListJobs(), http.StatusOK)
+}
+
+func (ws *WebServer) getSchedule(w http.ResponseWriter, r *http.Request) {
+	scheduler := ws.scheduler(w)
+	if scheduler == nil {
+		return
+	}
+
+	job, ok := scheduler.GetJob(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Schedule not found", http.StatusNotFound)
+		return
+	}
+	ws.writeJSON(w, job, http.StatusOK)
+}
+
+func (ws *WebServer) postSchedule(w http.ResponseWriter, r *http.Request) {
+	scheduler := ws.scheduler(w)
+	if scheduler == nil {
+		return
+	}
+
+	var req scheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Spec == "" {
+		http.Error(w, "Schedule spec is required", http.StatusBadRequest)
+		return
+	}
+
+	job, err := scheduler.AddJob(&ScheduleJob{
+		ID:       req.ID,
+		Name:     req.Name,
+		Spec:     req.Spec,
+		Payload:  req.Payload,
+		Metadata: req.Metadata,
+		CatchUp:  CatchUpPolicy(req.CatchUp),
+		Source:   ScheduleSourceAPI,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ws.writeJSON(w, job, http.StatusCreated)
+}
+
+func (ws *WebServer) deleteSchedule(w http.ResponseWriter, r *http.Request) {
+	scheduler := ws.scheduler(w)
+	if scheduler == nil {
+		return
+	}
+
+	removed, err := scheduler.RemoveJob(mux.Vars(r)["id"])
+	if err != nil {
+		ws.logger.WithError(err).Error("Failed to delete schedule")
+		http.Error(w, "Failed to delete schedule", http.StatusInternalServerError)
+		return
+	}
+	if !removed {
+		http.Error(w, "Schedule not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
 }
 
 func (ws *WebServer) getShortTermMemory(w http.ResponseWriter, r *http.Request) {
@@ -287,9 +683,11 @@ func (ws *WebServer) postLongTermMemory(w http.ResponseWriter, r *http.Request)
 }
 
 type toolResponse struct {
-	Name        string                 `json:"name"`
-	Description string                 `json:"description"`
-	Parameters  map[string]interface{} `json:"parameters"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Parameters  *JSONSchema `json:"parameters"`
+	TimeoutMs   int64       `json:"timeout_ms,omitempty"`
+	MaxAttempts int         `json:"max_attempts"`
 }
 
 func (ws *WebServer) getTools(w http.ResponseWriter, r *http.Request) {
@@ -298,6 +696,21 @@ func (ws *WebServer) getTools(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
+	if format := r.URL.Query().Get("format"); format != "" {
+		toolFormat, err := ParseToolFormat(format)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defs, err := ws.agent.ToolManager.ExportTools(toolFormat)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ws.writeJSON(w, defs, http.StatusOK)
+		return
+	}
+	
 	tools := ws.agent.ToolManager.ListTools()
 	resp := make([]toolResponse, len(tools))
 	
@@ -306,6 +719,8 @@ func (ws *WebServer) getTools(w http.ResponseWriter, r *http.Request) {
 			Name:        tool.Name,
 			Description: tool.Description,
 			Parameters:  tool.Parameters,
+			TimeoutMs:   tool.Timeout.Milliseconds(),
+			MaxAttempts: tool.Retry.attempts(),
 		}
 	}
 	
@@ -313,6 +728,7 @@ func (ws *WebServer) getTools(w http.ResponseWriter, r *http.Request) {
 }
 
 type toolExecuteRequest struct {
+	ID         string                 `json:"id,omitempty"` // optional call ID, used to cancel the call while it runs
 	Parameters map[string]interface{} `json:"parameters"`
 }
 
@@ -336,8 +752,11 @@ func (ws *WebServer) executeTool(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
+	if req.ID == "" {
+		req.ID = GenerateMessageID()
+	}
 	call := &ToolCall{
-		ID:   generateID(),
+		ID:   req.ID,
 		Name: toolName,
 		Args: req.Parameters,
 	}
@@ -351,16 +770,196 @@ func (ws *WebServer) executeTool(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	resp.Result = result
+	if len(result.ValidationErrors) > 0 {
+		ws.writeJSON(w, resp, http.StatusBadRequest)
+		return
+	}
 	ws.writeJSON(w, resp, http.StatusOK)
 }
 
+// getToolCalls returns the tool calls that are currently running
+func (ws *WebServer) getToolCalls(w http.ResponseWriter, r *http.Request) {
+	if ws.agent.ToolManager == nil {
+		http.Error(w, "Tool manager not available", http.StatusInternalServerError)
+		return
+	}
+	
+	ws.writeJSON(w, ws.agent.ToolManager.RunningToolCalls(), http.StatusOK)
+}
+
+// deleteToolCall cancels a running tool call
+func (ws *WebServer) deleteToolCall(w http.ResponseWriter, r *http.Request) {
+	if ws.agent.ToolManager == nil {
+		http.Error(w, "Tool manager not available", http.StatusInternalServerError)
+		return
+	}
+	
+	id := mux.Vars(r)["id"]
+	if err := ws.agent.ToolManager.CancelToolCall(id); err != nil {
+		if errors.Is(err, ErrToolCallNotFound) {
+			http.Error(w, "Tool call not running", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// postToolCalls executes the tool calls in a model response. The format query
+// parameter selects how the body is parsed (openai, anthropic or mcp).
+func (ws *WebServer) postToolCalls(w http.ResponseWriter, r *http.Request) {
+	if ws.agent.ToolManager == nil {
+		http.Error(w, "Tool manager not available", http.StatusInternalServerError)
+		return
+	}
+	
+	format, err := ParseToolFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	
+	calls, err := ws.agent.ToolManager.ParseToolCalls(format, body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	
+	results := make([]*ToolResult, 0, len(calls))
+	for _, call := range calls {
+		result, err := ws.agent.ToolManager.ExecuteTool(r.Context(), call)
+		if err != nil {
+			result = &ToolResult{ID: call.ID, Name: call.Name, Error: err.Error()}
+		}
+		results = append(results, result)
+	}
+	
+	ws.writeJSON(w, results, http.StatusOK)
+}
+
+type healthResponse struct {
+	Status        HealthStatus     `json:"status"`
+	Reasons       []string         `json:"reasons,omitempty"`
+	Version       string           `json:"version"`
+	StartedAt     time.Time        `json:"started_at"`
+	Uptime        string           `json:"uptime"`
+	UptimeSeconds float64          `json:"uptime_seconds"`
+	QueueDepth    int              `json:"queue_depth"`
+	QueueCapacity int              `json:"queue_capacity"`
+	InFlight      int              `json:"in_flight"`
+	Heartbeat     *HeartbeatStatus `json:"heartbeat,omitempty"`
+}
+
+// healthCheck reports liveness; unhealthy agents answer 503 so orchestrators can restart them
 func (ws *WebServer) healthCheck(w http.ResponseWriter, r *http.Request) {
-	resp := map[string]interface{}{
-		"status": "healthy",
-		"uptime": time.Now(),
-		"version": ws.agent.config.Agent.Version,
+	uptime := ws.agent.Uptime()
+	resp := healthResponse{
+		Status:        HealthHealthy,
+		Version:       ws.agent.config.Agent.Version,
+		StartedAt:     ws.agent.startedAt,
+		Uptime:        uptime.Round(time.Second).String(),
+		UptimeSeconds: uptime.Seconds(),
 	}
-	ws.writeJSON(w, resp, http.StatusOK)
+
+	if el := ws.agent.eventLoop; el != nil {
+		resp.QueueDepth = el.GetQueueDepth()
+		resp.QueueCapacity = el.QueueCapacity()
+		resp.InFlight = el.GetInFlight()
+		if !el.IsRunning() {
+			resp.Status = HealthUnhealthy
+			resp.Reasons = []string{"event loop is not running"}
+		}
+	} else {
+		resp.Status = HealthUnhealthy
+		resp.Reasons = []string{"event loop not initialized"}
+	}
+
+	if hb := ws.agent.Heartbeat(); hb != nil {
+		status := hb.Status()
+		resp.Heartbeat = &status
+		resp.Status = status.Status
+		resp.Reasons = status.Reasons
+	}
+
+	statusCode := http.StatusOK
+	if resp.Status == HealthUnhealthy {
+		statusCode = http.StatusServiceUnavailable
+	}
+	ws.writeJSON(w, resp, statusCode)
+}
+
+type statusResponse struct {
+	Running         bool                   `json:"running"`
+	Version         string                 `json:"version"`
+	Workspace       string                 `json:"workspace"`
+	QueueLength     int                    `json:"queue_length"`
+	QueueDepth      int                    `json:"queue_depth"`
+	QueueByPriority map[string]int         `json:"queue_by_priority,omitempty"`
+	OverflowPolicy  string                 `json:"overflow_policy"`
+	Dropped         int64                  `json:"dropped"`
+	Spilled         int                    `json:"spilled"`
+	Delayed         int                    `json:"delayed"`
+	JournalPending  int                    `json:"journal_pending"`
+	DeadLetters     int                    `json:"dead_letters"`
+	InFlight        int                    `json:"in_flight"`
+	Abandoned       int64                  `json:"abandoned_invocations"`
+	Subscribers     int                    `json:"subscribers"`
+	SubDropped      int64                  `json:"subscriber_dropped"`
+	Workers         int                    `json:"workers"`
+	HandlersCount   int                    `json:"handlers_count"`
+	MemoryUsage     string                 `json:"memory_usage"`
+	Memory          map[string]interface{} `json:"memory,omitempty"`
+	Clients         int                    `json:"clients"`
+}
+
+func (ws *WebServer) getStatus(w http.ResponseWriter, r *http.Request) {
+	ws.writeJSON(w, ws.statusSnapshot(), http.StatusOK)
+}
+
+// statusSnapshot collects the current agent status for the dashboard
+func (ws *WebServer) statusSnapshot() statusResponse {
+	resp := statusResponse{
+		Version:   ws.agent.config.Agent.Version,
+		Workspace: ws.agent.config.Agent.Workspace,
+		Abandoned: AbandonedInvocations(),
+		Clients:   ws.hub.clientCount(),
+	}
+
+	if el := ws.agent.eventLoop; el != nil {
+		resp.Running = el.IsRunning()
+		resp.QueueLength = el.GetQueueLength()
+		resp.QueueDepth = el.GetQueueDepth()
+		resp.QueueByPriority = el.GetQueueDepthByPriority()
+		resp.OverflowPolicy = string(el.OverflowPolicy())
+		resp.Dropped = el.GetDroppedCount()
+		resp.Spilled = el.GetSpilledCount()
+		resp.Delayed = el.GetDelayedCount()
+		resp.JournalPending = el.GetJournalPending()
+		if store := el.DeadLetters(); store != nil {
+			resp.DeadLetters = store.Len()
+		}
+		resp.InFlight = el.GetInFlight()
+		resp.Subscribers = el.GetSubscriberCount()
+		resp.SubDropped = el.GetSubscriberDropped()
+		resp.Workers = el.WorkerCount()
+		resp.HandlersCount = el.HandlerCount()
+	}
+
+	if ws.agent.MemoryManager != nil {
+		stats := ws.agent.MemoryManager.GetMemoryStats()
+		resp.Memory = stats
+		resp.MemoryUsage = fmt.Sprintf("%v/%v", stats["short_term_count"], stats["short_term_capacity"])
+	}
+
+	return resp
 }
 
 func (ws *WebServer) serveIndex(w http.ResponseWriter, r *http.Request) {
@@ -375,6 +974,429 @@ func (ws *WebServer) writeJSON(w http.ResponseWriter, data interface{}, statusCo
 	}
 }
 
-func generateID() string {
-	return fmt.Sprintf("%d", time.Now().UnixNano())
-}
\ No newline at end of file
+// WebSocket message types understood by web/static/script.js
+const (
+	wsTypeStatusUpdate    = "status_update"
+	wsTypeEvent           = "event"
+	wsTypeMemoryUpdate    = "memory_update"
+	wsTypeMessageResponse = "message_response"
+	wsTypeMessage         = "message"
+)
+
+const (
+	wsStatusInterval = 5 * time.Second
+	wsWriteTimeout   = 10 * time.Second
+	wsPongTimeout    = 60 * time.Second
+	wsPingInterval   = (wsPongTimeout * 9) / 10
+	wsSendBuffer     = 64
+	wsMaxMessageSize = 64 * 1024
+)
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// wsMessage is the envelope for every frame sent to or received from the dashboard
+type wsMessage struct {
+	Type    string      `json:"type"`
+	Payload interface{} `json:"payload"`
+}
+
+type wsInboundMessage struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// wsChatPayload is the payload of an inbound chat message
+type wsChatPayload struct {
+	Content   string `json:"content"`
+	Timestamp string `json:"timestamp,omitempty"`
+}
+
+type wsMessageResponse struct {
+	Content   string `json:"content"`
+	MessageID string `json:"message_id"`
+	Success   bool   `json:"success"`
+	Error     string `json:"error,omitempty"`
+}
+
+type wsMemoryUpdate struct {
+	Tier           string      `json:"tier"`
+	Key            string      `json:"key"`
+	ShortTermCount interface{} `json:"short_term_count"`
+	LongTermCount  interface{} `json:"long_term_count"`
+	LastUpdated    time.Time   `json:"last_updated"`
+}
+
+// wsHub fans out agent activity to all connected WebSocket clients
+type wsHub struct {
+	server  *WebServer
+	mu      sync.RWMutex
+	clients map[*wsClient]struct{}
+	// pending maps chat event IDs to the client that sent them
+	pending    map[string]*wsClient
+	attachOnce sync.Once
+	// unsubscribe stops the processed event subscription
+	unsubscribe func()
+}
+
+// wsClient is a single WebSocket connection
+type wsClient struct {
+	hub       *wsHub
+	conn      *websocket.Conn
+	send      chan []byte
+	mu        sync.Mutex
+	closed    bool
+}
+
+func newWSHub(server *WebServer) *wsHub {
+	return &wsHub{
+		server:  server,
+		clients: make(map[*wsClient]struct{}),
+		pending: make(map[string]*wsClient),
+	}
+}
+
+// attach subscribes the hub to the agent's event loop and memory manager
+func (h *wsHub) attach() {
+	h.attachOnce.Do(func() {
+		if el := h.server.agent.eventLoop; el != nil {
+			// A subscription keeps slow browsers from holding up the event loop workers
+			records, unsubscribe := el.SubscribeProcessed(nil, SubscribeOptions{DropPolicy: SubscriberDropOldest})
+			h.unsubscribe = unsubscribe
+			go h.forwardEvents(records)
+		}
+		if mm := h.server.agent.MemoryManager; mm != nil {
+			mm.AddListener(h.onMemoryWrite)
+		}
+	})
+}
+
+// runStatusUpdates periodically broadcasts a status snapshot
+func (h *wsHub) runStatusUpdates(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if h.clientCount() > 0 {
+				h.broadcast(wsTypeStatusUpdate, h.server.statusSnapshot())
+			}
+		case <-ctx.Done():
+			return
+		case <-h.server.shutdown:
+			return
+		}
+	}
+}
+
+// forwardEvents relays processed events until the subscription is closed
+func (h *wsHub) forwardEvents(records <-chan *EventRecord) {
+	for record := range records {
+		h.onEvent(record.Event)
+	}
+}
+
+// onEvent forwards processed events and answers pending chat messages
+func (h *wsHub) onEvent(event *Event) {
+	if event.Type == EventTypeMessageResult {
+		h.replyToChat(event)
+	}
+
+	h.broadcast(wsTypeEvent, eventResponse{
+		ID:        event.ID,
+		Type:      string(event.Type),
+		Timestamp: event.Timestamp,
+		Data:      event.Data,
+		Metadata:  event.Metadata,
+	})
+}
+
+// replyToChat sends a message_response to the client whose chat message produced the result
+func (h *wsHub) replyToChat(event *Event) {
+	sourceID, _ := event.Metadata["source_event_id"].(string)
+	if sourceID == "" {
+		return
+	}
+
+	h.mu.Lock()
+	client, ok := h.pending[sourceID]
+	delete(h.pending, sourceID)
+	h.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	data, _ := event.Data.(map[string]interface{})
+	resp := wsMessageResponse{Content: "Message processed", Success: true}
+	resp.MessageID, _ = data["message_id"].(string)
+	if errMsg, ok := data["error"].(string); ok {
+		resp.Success = false
+		resp.Error = errMsg
+		resp.Content = "Message failed: " + errMsg
+	}
+
+	client.sendMessage(wsTypeMessageResponse, resp)
+}
+
+// onMemoryWrite broadcasts memory statistics after each write
+func (h *wsHub) onMemoryWrite(tier string, entry *MemoryEntry) {
+	stats := h.server.agent.MemoryManager.GetMemoryStats()
+	h.broadcast(wsTypeMemoryUpdate, wsMemoryUpdate{
+		Tier:           tier,
+		Key:            entry.Key,
+		ShortTermCount: stats["short_term_count"],
+		LongTermCount:  stats["long_term_count"],
+		LastUpdated:    entry.Timestamp,
+	})
+}
+
+// broadcast sends a message to every connected client
+func (h *wsHub) broadcast(msgType string, payload interface{}) {
+	data, err := json.Marshal(wsMessage{Type: msgType, Payload: payload})
+	if err != nil {
+		h.server.logger.WithError(err).WithField("type", msgType).
+			Error("Failed to marshal WebSocket message")
+		return
+	}
+
+	h.mu.RLock()
+	clients := make([]*wsClient, 0, len(h.clients))
+	for client := range h.clients {
+		clients = append(clients, client)
+	}
+	h.mu.RUnlock()
+
+	for _, client := range clients {
+		client.enqueue(data)
+	}
+}
+
+func (h *wsHub) register(client *wsClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.clients[client] = struct{}{}
+}
+
+func (h *wsHub) unregister(client *wsClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.clients, client)
+	for id, c := range h.pending {
+		if c == client {
+			delete(h.pending, id)
+		}
+	}
+}
+
+func (h *wsHub) clientCount() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients)
+}
+
+// closeAll disconnects every client
+func (h *wsHub) closeAll() {
+	if h.unsubscribe != nil {
+		h.unsubscribe()
+	}
+
+	h.mu.RLock()
+	clients := make([]*wsClient, 0, len(h.clients))
+	for client := range h.clients {
+		clients = append(clients, client)
+	}
+	h.mu.RUnlock()
+
+	for _, client := range clients {
+		client.close()
+	}
+}
+
+// serveWebSocket upgrades the connection and streams live updates
+func (ws *WebServer) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		ws.logger.WithError(err).Warn("WebSocket upgrade failed")
+		return
+	}
+
+	client := &wsClient{
+		hub:  ws.hub,
+		conn: conn,
+		send: make(chan []byte, wsSendBuffer),
+	}
+	ws.hub.register(client)
+	ws.logger.WithField("remote", r.RemoteAddr).Debug("WebSocket client connected")
+
+	go client.writePump()
+	client.sendMessage(wsTypeStatusUpdate, ws.statusSnapshot())
+	client.readPump()
+}
+
+// sendMessage encodes and queues a message for this client only
+func (c *wsClient) sendMessage(msgType string, payload interface{}) {
+	data, err := json.Marshal(wsMessage{Type: msgType, Payload: payload})
+	if err != nil {
+		c.hub.server.logger.WithError(err).WithField("type", msgType).
+			Error("Failed to marshal WebSocket message")
+		return
+	}
+	c.enqueue(data)
+}
+
+// enqueue queues a frame without blocking; slow clients are disconnected
+func (c *wsClient) enqueue(data []byte) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	select {
+	case c.send <- data:
+		c.mu.Unlock()
+		return
+	default:
+	}
+	c.mu.Unlock()
+
+	c.hub.server.logger.Warn("WebSocket client too slow, disconnecting")
+	c.close()
+}
+
+// close unregisters the client and stops its write pump
+func (c *wsClient) close() {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	close(c.send)
+	c.mu.Unlock()
+
+	c.hub.unregister(c)
+}
+
+// readPump handles inbound frames until the connection closes
+func (c *wsClient) readPump() {
+	defer c.close()
+
+	c.conn.SetReadLimit(wsMaxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				c.hub.server.logger.WithError(err).Warn("WebSocket read failed")
+			}
+			return
+		}
+		c.handleInbound(data)
+	}
+}
+
+// writePump writes queued frames and keeps the connection alive with pings
+func (c *wsClient) writePump() {
+	ticker := time.NewTicker(wsPingInterval)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case data, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if !ok {
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handleInbound turns chat messages into MessageTypeUserInput messages on the event loop
+func (c *wsClient) handleInbound(data []byte) {
+	logger := c.hub.server.logger
+
+	var in wsInboundMessage
+	if err := json.Unmarshal(data, &in); err != nil {
+		logger.WithError(err).Warn("Invalid WebSocket message")
+		return
+	}
+	if in.Type != wsTypeMessage {
+		logger.WithField("type", in.Type).Debug("Ignoring unsupported WebSocket message")
+		return
+	}
+
+	var chat wsChatPayload
+	if err := json.Unmarshal(in.Payload, &chat); err != nil || chat.Content == "" {
+		c.sendMessage(wsTypeMessageResponse, wsMessageResponse{
+			Content: "Message failed: empty or invalid payload",
+			Error:   "invalid payload",
+		})
+		return
+	}
+
+	msg := &Message{
+		ID:        GenerateMessageID(),
+		Type:      MessageTypeUserInput,
+		Source:    "websocket",
+		Payload:   chat,
+		Timestamp: time.Now(),
+		Metadata: map[string]interface{}{
+			"remote_addr": c.conn.RemoteAddr().String(),
+		},
+	}
+	event := &Event{
+		ID:        GenerateMessageID(),
+		Type:      EventTypeMessage,
+		Timestamp: msg.Timestamp,
+		Data:      msg,
+		Metadata: map[string]interface{}{
+			"source": "websocket",
+		},
+	}
+
+	el := c.hub.server.agent.eventLoop
+	if el == nil {
+		c.sendMessage(wsTypeMessageResponse, wsMessageResponse{
+			Content:   "Message failed: event loop not available",
+			MessageID: msg.ID,
+			Error:     ErrEventLoopNotRunning.Error(),
+		})
+		return
+	}
+
+	c.hub.mu.Lock()
+	c.hub.pending[event.ID] = c
+	c.hub.mu.Unlock()
+
+	if err := el.Emit(event); err != nil {
+		c.hub.mu.Lock()
+		delete(c.hub.pending, event.ID)
+		c.hub.mu.Unlock()
+
+		logger.WithError(err).Error("Failed to emit WebSocket message")
+		c.sendMessage(wsTypeMessageResponse, wsMessageResponse{
+			Content:   "Message failed: " + err.Error(),
+			MessageID: msg.ID,
+			Error:     err.Error(),
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// startTestWebServer serves the web routes of an agent whose messages are handled by handle
+func startTestWebServer(t *testing.T, handle func(ctx context.Context, msg *Message) error) *httptest.Server {
+	t.Helper()
+	logger := testLogger()
+	el := startTestLoop(t, logger, nil)
+
+	router := NewMessageRouter()
+	router.RegisterHandler(&funcMessageHandler{types: []MessageType{MessageTypeUserInput}, handle: handle})
+	el.RegisterHandler(NewRouterEventHandler(router, el, logger))
+
+	ws := newTestWebServer(t, el)
+	ws.agent.messageRouter = router
+	ws.hub.attach()
+
+	server := httptest.NewServer(ws.router)
+	t.Cleanup(func() {
+		ws.hub.closeAll()
+		server.Close()
+	})
+	return server
+}
+
+func dialTestWebSocket(t *testing.T, server *httptest.Server) *websocket.Conn {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// readWSMessage reads frames until one of the wanted type arrives
+func readWSMessage(t *testing.T, conn *websocket.Conn, msgType string) json.RawMessage {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		var in wsInboundMessage
+		if err := conn.ReadJSON(&in); err != nil {
+			t.Fatalf("waiting for %s: %v", msgType, err)
+		}
+		if in.Type == msgType {
+			return in.Payload
+		}
+	}
+}
+
+func TestWebSocketSendsStatusOnConnect(t *testing.T) {
+	server := startTestWebServer(t, nil)
+	conn := dialTestWebSocket(t, server)
+
+	var status statusResponse
+	if err := json.Unmarshal(readWSMessage(t, conn, wsTypeStatusUpdate), &status); err != nil {
+		t.Fatalf("decode status: %v", err)
+	}
+	if !status.Running {
+		t.Error("status reports the event loop as stopped")
+	}
+	if status.Clients != 1 {
+		t.Errorf("Clients = %d, want 1", status.Clients)
+	}
+}
+
+func TestWebSocketChat(t *testing.T) {
+	tests := []struct {
+		name        string
+		frame       string
+		handlerErr  error
+		wantSuccess bool
+		wantError   string
+		wantContent string
+	}{
+		{
+			name:        "processed",
+			frame:       `{"type":"message","payload":{"content":"hello"}}`,
+			wantSuccess: true,
+			wantContent: "Message processed",
+		},
+		{
+			name:        "handler failure",
+			frame:       `{"type":"message","payload":{"content":"hello"}}`,
+			handlerErr:  errors.New("boom"),
+			wantError:   "boom",
+			wantContent: "Message failed: ",
+		},
+		{
+			name:        "empty content",
+			frame:       `{"type":"message","payload":{"content":""}}`,
+			wantError:   "invalid payload",
+			wantContent: "Message failed: empty or invalid payload",
+		},
+		{
+			name:        "invalid payload",
+			frame:       `{"type":"message","payload":"text"}`,
+			wantError:   "invalid payload",
+			wantContent: "Message failed: empty or invalid payload",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received := make(chan *Message, 1)
+			server := startTestWebServer(t, func(ctx context.Context, msg *Message) error {
+				received <- msg
+				return tt.handlerErr
+			})
+			conn := dialTestWebSocket(t, server)
+			readWSMessage(t, conn, wsTypeStatusUpdate)
+
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(tt.frame)); err != nil {
+				t.Fatalf("WriteMessage: %v", err)
+			}
+
+			var resp wsMessageResponse
+			if err := json.Unmarshal(readWSMessage(t, conn, wsTypeMessageResponse), &resp); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if resp.Success != tt.wantSuccess {
+				t.Errorf("Success = %v, want %v", resp.Success, tt.wantSuccess)
+			}
+			if !strings.Contains(resp.Error, tt.wantError) {
+				t.Errorf("Error = %q, want it to contain %q", resp.Error, tt.wantError)
+			}
+			if !strings.HasPrefix(resp.Content, tt.wantContent) {
+				t.Errorf("Content = %q, want prefix %q", resp.Content, tt.wantContent)
+			}
+
+			if !tt.wantSuccess && tt.handlerErr == nil {
+				return
+			}
+			select {
+			case msg := <-received:
+				if msg.Source != "websocket" {
+					t.Errorf("Source = %q, want websocket", msg.Source)
+				}
+				if resp.MessageID != msg.ID {
+					t.Errorf("MessageID = %q, want %q", resp.MessageID, msg.ID)
+				}
+				if chat, ok := msg.Payload.(wsChatPayload); !ok || chat.Content != "hello" {
+					t.Errorf("Payload = %#v, want chat content hello", msg.Payload)
+				}
+			default:
+				t.Error("handler did not receive the chat message")
+			}
+		})
+	}
+}
+
+func TestWebSocketBroadcastsEvents(t *testing.T) {
+	server := startTestWebServer(t, nil)
+	conn := dialTestWebSocket(t, server)
+	readWSMessage(t, conn, wsTypeStatusUpdate)
+
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"message","payload":{"content":"hi"}}`))
+
+	seen := map[string]bool{}
+	for !seen[string(EventTypeMessage)] || !seen[string(EventTypeMessageResult)] {
+		var event eventResponse
+		if err := json.Unmarshal(readWSMessage(t, conn, wsTypeEvent), &event); err != nil {
+			t.Fatalf("decode event: %v", err)
+		}
+		seen[event.Type] = true
+	}
+}
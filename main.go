@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
@@ -13,6 +15,11 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "mcp" {
+		runMCP(os.Args[2:])
+		return
+	}
+
 	// Load configuration
 	cfg, err := config.Load("config.yaml")
 	if err != nil {
@@ -51,4 +58,43 @@ func main() {
 	}
 
 	fmt.Println("Agent stopped gracefully")
-}
\ No newline at end of file
+}
+
+// runMCP implements "clawdlocal mcp": serve the built-in tools and memory over the
+// Model Context Protocol without the event loop or web UI. Stdout carries the stdio
+// transport, so everything else goes to stderr.
+func runMCP(args []string) {
+	flags := flag.NewFlagSet("mcp", flag.ExitOnError)
+	configPath := flags.String("config", "config.yaml", "configuration file")
+	transport := flags.String("transport", "", "stdio or http (default from config)")
+	addr := flags.String("addr", "", "listen address of the http transport (default from config)")
+	flags.Parse(args)
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+	if *transport != "" {
+		cfg.MCP.Transport = *transport
+	}
+	if *addr != "" {
+		cfg.MCP.Addr = *addr
+	}
+
+	agent, err := core.NewAgent(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create agent: %v\n", err)
+		os.Exit(1)
+	}
+	tools.RegisterAllTools(agent)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := agent.RunMCP(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		fmt.Fprintf(os.Stderr, "MCP server error: %v\n", err)
+		os.Exit(1)
+	}
+	agent.Shutdown()
+}
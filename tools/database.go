@@ -1,6 +1,7 @@
 package tools
 
 import (
+	"clawdlocal/core"
 	"context"
 )
 
@@ -15,11 +16,15 @@ func (t *DatabaseQueryTool) Description() string {
 	return "Execute SQL queries against a database"
 }
 
-func (t *DatabaseQueryTool) Parameters() map[string]interface{} {
-	return map[string]interface{}{
-		"query": "string - SQL query to execute",
-		"args":  "array - Optional arguments for parameterized queries",
-	}
+func (t *DatabaseQueryTool) Parameters() *core.JSONSchema {
+	return core.ObjectSchema(map[string]*core.JSONSchema{
+		"query": {Type: core.SchemaTypeString, Description: "SQL query to execute", MinLength: intPtr(1)},
+		"args":  {Type: core.SchemaTypeArray, Description: "Optional arguments for parameterized queries"},
+	}, "query")
+}
+
+func intPtr(n int) *int {
+	return &n
 }
 
 func (t *DatabaseQueryTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
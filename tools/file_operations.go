@@ -1,6 +1,7 @@
 package tools
 
 import (
+	"clawdlocal/core"
 	"context"
 	"fmt"
 	"os"
@@ -19,10 +20,10 @@ func (t *FileReadTool) Description() string {
 	return "Read the contents of a file from the filesystem"
 }
 
-func (t *FileReadTool) Parameters() map[string]interface{} {
-	return map[string]interface{}{
-		"filepath": "string - Path to the file to read",
-	}
+func (t *FileReadTool) Parameters() *core.JSONSchema {
+	return core.ObjectSchema(map[string]*core.JSONSchema{
+		"filepath": {Type: core.SchemaTypeString, Description: "Path to the file to read"},
+	}, "filepath")
 }
 
 func (t *FileReadTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
@@ -66,11 +67,11 @@ func (t *FileWriteTool) Description() string {
 	return "Write content to a file in the filesystem"
 }
 
-func (t *FileWriteTool) Parameters() map[string]interface{} {
-	return map[string]interface{}{
-		"filepath": "string - Path to the file to write",
-		"content":  "string - Content to write to the file",
-	}
+func (t *FileWriteTool) Parameters() *core.JSONSchema {
+	return core.ObjectSchema(map[string]*core.JSONSchema{
+		"filepath": {Type: core.SchemaTypeString, Description: "Path to the file to write"},
+		"content":  {Type: core.SchemaTypeString, Description: "Content to write to the file"},
+	}, "filepath", "content")
 }
 
 func (t *FileWriteTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
@@ -128,10 +129,10 @@ func (t *FileListTool) Description() string {
 	return "List contents of a directory"
 }
 
-func (t *FileListTool) Parameters() map[string]interface{} {
-	return map[string]interface{}{
-		"dirpath": "string - Path to the directory to list (optional, defaults to './workspace')",
-	}
+func (t *FileListTool) Parameters() *core.JSONSchema {
+	return core.ObjectSchema(map[string]*core.JSONSchema{
+		"dirpath": {Type: core.SchemaTypeString, Description: "Path to the directory to list", Default: "./workspace"},
+	})
 }
 
 func (t *FileListTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
@@ -1,9 +1,12 @@
 package tools
 
 import (
+	"clawdlocal/core"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"strings"
 	"time"
@@ -20,15 +23,54 @@ func (t *NetworkRequestTool) Description() string {
 	return "Make HTTP requests to external services"
 }
 
-func (t *NetworkRequestTool) Parameters() map[string]interface{} {
-	return map[string]interface{}{
-		"url":     "string - URL to request",
-		"method":  "string - HTTP method (GET, POST, PUT, DELETE, etc.)",
-		"headers": "object - Optional headers as key-value pairs",
-		"body":    "string - Optional request body",
+func (t *NetworkRequestTool) Parameters() *core.JSONSchema {
+	return core.ObjectSchema(map[string]*core.JSONSchema{
+		"url": {Type: core.SchemaTypeString, Description: "URL to request", Pattern: "^https?://"},
+		"method": {
+			Type:        core.SchemaTypeString,
+			Description: "HTTP method",
+			Enum:        []interface{}{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"},
+			Default:     "GET",
+		},
+		"headers": {
+			Type:                 core.SchemaTypeObject,
+			Description:          "Optional headers as key-value pairs",
+			AdditionalProperties: &core.JSONSchema{Type: core.SchemaTypeString},
+		},
+		"body": {Type: core.SchemaTypeString, Description: "Optional request body"},
+	}, "url")
+}
+
+// Timeout limits a single request attempt
+func (t *NetworkRequestTool) Timeout() time.Duration {
+	return 30 * time.Second
+}
+
+// RetryPolicy retries requests that failed before a response was received
+func (t *NetworkRequestTool) RetryPolicy() *core.RetryPolicy {
+	return &core.RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
 	}
 }
 
+// Retryable retries timeouts and network errors of idempotent requests only, so a
+// POST that may have reached the server is never sent twice
+func (t *NetworkRequestTool) Retryable(call *core.ToolCall, err error) bool {
+	method, _ := call.Args["method"].(string)
+	switch strings.ToUpper(method) {
+	case "", "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+	default:
+		return false
+	}
+
+	var netErr net.Error
+	return errors.Is(err, core.ErrToolTimeout) || errors.As(err, &netErr)
+}
+
 func (t *NetworkRequestTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
 	url, ok := params["url"].(string)
 	if !ok {
@@ -60,11 +102,8 @@ func (t *NetworkRequestTool) Execute(ctx context.Context, params map[string]inte
 		req.Body = io.NopCloser(strings.NewReader(body))
 	}
 	
-	// Make request
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
-	resp, err := client.Do(req)
+	// Make request; the deadline comes from the tool call's timeout
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,100 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"clawdlocal/core"
+)
+
+func TestNetworkRequestRetryable(t *testing.T) {
+	timeout := &core.ToolTimeoutError{Tool: "network_request", Timeout: time.Second}
+	netErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+	tests := []struct {
+		name   string
+		method interface{}
+		err    error
+		want   bool
+	}{
+		{name: "default method times out", err: timeout, want: true},
+		{name: "GET network error", method: "GET", err: netErr, want: true},
+		{name: "lower case method", method: "delete", err: netErr, want: true},
+		{name: "POST is not repeated", method: "POST", err: timeout},
+		{name: "PATCH is not repeated", method: "PATCH", err: netErr},
+		{name: "other errors", method: "GET", err: errors.New("invalid URL")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			call := &core.ToolCall{Name: "network_request", Args: map[string]interface{}{}}
+			if tt.method != nil {
+				call.Args["method"] = tt.method
+			}
+			if got := (&NetworkRequestTool{}).Retryable(call, tt.err); got != tt.want {
+				t.Errorf("Retryable = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNetworkRequestRetriesDroppedConnections(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			// Drop the first connection without a response
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		method       string
+		wantAttempts int
+		wantOK       bool
+	}{
+		{method: "GET", wantAttempts: 2, wantOK: true},
+		{method: "POST", wantAttempts: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			requests.Store(0)
+			logger := logrus.New()
+			logger.SetOutput(io.Discard)
+			tm, _ := core.NewToolManager(logger)
+			network := &NetworkRequestTool{}
+			retry := network.RetryPolicy()
+			retry.InitialBackoff = time.Millisecond
+			tm.RegisterTool(&core.Tool{
+				Name:       "network_request",
+				Parameters: network.Parameters(),
+				Handler:    network.Execute,
+				Timeout:    network.Timeout(),
+				Retry:      retry,
+				Retryable:  network.Retryable,
+			})
+
+			result, err := tm.ExecuteTool(context.Background(), &core.ToolCall{
+				Name: "network_request",
+				Args: map[string]interface{}{"url": server.URL, "method": tt.method},
+			})
+			if err != nil {
+				t.Fatalf("ExecuteTool: %v", err)
+			}
+			if result.Attempts != tt.wantAttempts || (result.Error == "") != tt.wantOK {
+				t.Errorf("result = %+v, want %d attempts, success %v", result, tt.wantAttempts, tt.wantOK)
+			}
+		})
+	}
+}
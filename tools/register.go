@@ -36,13 +36,17 @@ func RegisterAllTools(agent *core.Agent) {
 	})
 	
 	// Network operations
+	network := &NetworkRequestTool{}
 	agent.ToolManager.RegisterTool(&core.Tool{
 		Name:        "network_request",
 		Description: "Make HTTP requests to external services",
-		Parameters:  (&NetworkRequestTool{}).Parameters(),
+		Parameters:  network.Parameters(),
 		Handler: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
-			return (&NetworkRequestTool{}).Execute(ctx, args)
+			return network.Execute(ctx, args)
 		},
+		Timeout:   network.Timeout(),
+		Retry:     network.RetryPolicy(),
+		Retryable: network.Retryable,
 	})
 	
 	// Database operations